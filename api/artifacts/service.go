@@ -0,0 +1,294 @@
+package artifacts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"api/logger"
+	"api/models"
+	"api/runs"
+	"api/store"
+)
+
+const ArtifactsBucket string = "artifacts"
+
+const (
+	// Applies to the jobs without artifacts.retention-days
+	DefaultRetention     time.Duration = 30 * 24 * time.Hour
+	DefaultPurgeInterval time.Duration = time.Hour
+	// Header carrying the hex SHA-256 of uploads and downloads
+	ChecksumHeader string = "X-Checksum-Sha256"
+)
+
+// The upload was rejected: invalid name, checksum mismatch or conflicting job
+var ErrInvalidArtifact = errors.New("invalid artifact")
+
+type Service struct {
+	store     store.Store
+	pipelines *store.Pipelines
+	runs      *store.Runs
+	blobs     ArtifactStore
+	retention time.Duration
+	now       func() time.Time
+}
+
+/*
+Create the artifact service.
+
+[IN] s: store holding the artifact metadata
+
+[IN] blobs: storage of the artifact contents
+
+[IN] retention: how long artifacts are kept when their job does not say; DefaultRetention when 0
+
+[OUT] *Service: the artifact service
+*/
+func NewService(s store.Store, blobs ArtifactStore, retention time.Duration) *Service {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	return &Service{
+		store:     s,
+		pipelines: store.NewPipelines(s),
+		runs:      store.NewRuns(s),
+		blobs:     blobs,
+		retention: retention,
+		now:       time.Now,
+	}
+}
+
+/*
+Store a file uploaded by a job.
+
+The contents are spooled to disk while they are hashed, so nothing reaches
+the artifact store unless it matches the expected checksum. Uploading the
+same name again from the same job replaces the artifact.
+
+[IN] ctx: request context
+
+[IN] runId: run of the job
+
+[IN] job: job uploading the file
+
+[IN] name: path of the file relative to the job working directory
+
+[IN] content: file contents
+
+[IN] checksum: expected hex SHA-256; not checked when empty
+
+[OUT] *models.Artifact: metadata of the stored artifact
+
+[OUT] error: ErrInvalidArtifact when the upload was rejected
+*/
+func (s *Service) Upload(ctx context.Context, runId, job, name string, content io.Reader, checksum string) (*models.Artifact, error) {
+	err := validateKey(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArtifact, err)
+	}
+	retention, err := s.jobRetention(ctx, runId, job)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := store.Get[models.Artifact](ctx, s.store, ArtifactsBucket, key(runId, name))
+	if err == nil && existing.Job != job {
+		return nil, fmt.Errorf("%w: %s was already uploaded by job %s", ErrInvalidArtifact, name, existing.Job)
+	}
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	spool, err := os.CreateTemp("", "artifact-")
+	if err != nil {
+		return nil, fmt.Errorf("unable to receive artifact %s: %w", name, err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hash), content)
+	if err != nil {
+		return nil, fmt.Errorf("unable to receive artifact %s: %w", name, err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if checksum != "" && !strings.EqualFold(checksum, sum) {
+		return nil, fmt.Errorf("%w: the SHA-256 of %s is %s, expected %s", ErrInvalidArtifact, name, sum, checksum)
+	}
+	_, err = spool.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	err = s.blobs.Put(ctx, key(runId, name), spool, size)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now().UTC()
+	artifact := models.Artifact{
+		Name:      name,
+		RunId:     runId,
+		Job:       job,
+		Size:      size,
+		Sha256:    sum,
+		CreatedAt: now,
+		ExpiresAt: now.Add(retention),
+	}
+	err = store.Put(ctx, s.store, ArtifactsBucket, key(runId, name), artifact)
+	if err != nil {
+		return nil, fmt.Errorf("unable to record artifact %s: %w", name, err)
+	}
+	logger.FromContext(ctx).Infof("Stored artifact %s of job %s in run %s (%d bytes)", name, job, runId, size)
+	return &artifact, nil
+}
+
+// Retention of the artifacts of a job, from its pipeline definition
+func (s *Service) jobRetention(ctx context.Context, runId, job string) (time.Duration, error) {
+	run, err := s.runs.Get(ctx, runId)
+	if err != nil {
+		return 0, err
+	}
+	p, err := s.pipelines.Get(ctx, run.PipelineId)
+	if err != nil {
+		return 0, err
+	}
+	definition := p.Definition.Jobs[job].Artifacts
+	if definition == nil || definition.RetentionDays == 0 {
+		return s.retention, nil
+	}
+	return time.Duration(definition.RetentionDays) * 24 * time.Hour, nil
+}
+
+/*
+List the unexpired artifacts of a run, sorted by name.
+
+Jobs reused by a re-run keep their artifacts in the run that executed them,
+so those are listed as well; an artifact of the run itself wins over a
+reused one with the same name.
+
+[IN] ctx: request context
+
+[IN] runId: the run
+
+[OUT] []models.Artifact: artifacts of the run
+
+[OUT] error: store.ErrNotFound when the run does not exist
+*/
+func (s *Service) List(ctx context.Context, runId string) ([]models.Artifact, error) {
+	run, err := s.runs.Get(ctx, runId)
+	if err != nil {
+		return nil, err
+	}
+	sources := runs.JobSources(run)
+	all, err := store.List[models.Artifact](ctx, s.store, ArtifactsBucket)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	byName := map[string]models.Artifact{}
+	for _, artifact := range all {
+		if sources[artifact.Job] != artifact.RunId || !now.Before(artifact.ExpiresAt) {
+			continue
+		}
+		if previous, ok := byName[artifact.Name]; ok && previous.RunId == run.Id {
+			continue
+		}
+		byName[artifact.Name] = artifact
+	}
+	artifactList := make([]models.Artifact, 0, len(byName))
+	for _, artifact := range byName {
+		artifactList = append(artifactList, artifact)
+	}
+	sort.Slice(artifactList, func(i, j int) bool {
+		return artifactList[i].Name < artifactList[j].Name
+	})
+	return artifactList, nil
+}
+
+/*
+Open an artifact of a run for download.
+
+[IN] ctx: request context
+
+[IN] runId: the run
+
+[IN] name: name of the artifact
+
+[OUT] *models.Artifact: metadata of the artifact, e.g. its size and checksum
+
+[OUT] io.ReadCloser: contents of the artifact, to close once read
+
+[OUT] error: ErrNotFound when the run has no such artifact
+*/
+func (s *Service) Open(ctx context.Context, runId, name string) (*models.Artifact, io.ReadCloser, error) {
+	artifactList, err := s.List(ctx, runId)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, artifact := range artifactList {
+		if artifact.Name != name {
+			continue
+		}
+		reader, err := s.blobs.Open(ctx, key(artifact.RunId, artifact.Name))
+		if err != nil {
+			return nil, nil, err
+		}
+		return &artifact, reader, nil
+	}
+	return nil, nil, fmt.Errorf("%w: %s in run %s", ErrNotFound, name, runId)
+}
+
+// Delete the expired artifacts and return how many were removed
+func (s *Service) Purge(ctx context.Context) (int, error) {
+	all, err := store.List[models.Artifact](ctx, s.store, ArtifactsBucket)
+	if err != nil {
+		return 0, err
+	}
+	now := s.now()
+	purged := 0
+	for _, artifact := range all {
+		if now.Before(artifact.ExpiresAt) {
+			continue
+		}
+		// contents first: metadata without contents would still be listed
+		err = s.blobs.Delete(ctx, key(artifact.RunId, artifact.Name))
+		if err != nil {
+			return purged, err
+		}
+		err = store.Delete(ctx, s.store, ArtifactsBucket, key(artifact.RunId, artifact.Name))
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// Purge periodically until the context is cancelled
+func (s *Service) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		purged, err := s.Purge(ctx)
+		if err != nil {
+			logger.FromContext(ctx).Errorf("Failed to purge expired artifacts: %v", err)
+		}
+		if purged > 0 {
+			logger.FromContext(ctx).Infof("Purged %d expired artifacts", purged)
+		}
+	}
+}
+
+func key(runId, name string) string {
+	return runId + "/" + name
+}
@@ -0,0 +1,174 @@
+package artifacts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"api/models"
+	"api/pipeline"
+	"api/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDefinition string = `
+name: api
+jobs:
+  build:
+    artifacts:
+      paths: [bin/*]
+      retention-days: 7
+    steps: [{run: make build}]
+  test:
+    artifacts:
+      paths: [reports/*.xml]
+    steps: [{run: make test}]
+`
+
+func newTestService(t *testing.T) (*Service, *store.Runs) {
+	ctx := context.Background()
+	dataStore := store.NewMemoryStore()
+	blobs, err := NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	definition, err := pipeline.Parse([]byte(testDefinition))
+	require.NoError(t, err)
+	require.NoError(t, store.NewPipelines(dataStore).Create(ctx, models.Pipeline{Id: "pipeline-1", Name: "api", Definition: *definition}))
+	return NewService(dataStore, blobs, 0), store.NewRuns(dataStore)
+}
+
+func createTestRun(t *testing.T, runs *store.Runs, id string, jobs ...models.Job) {
+	require.NoError(t, runs.Create(context.Background(), models.Run{Id: id, PipelineId: "pipeline-1", Jobs: jobs}))
+}
+
+func checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func readArtifact(t *testing.T, service *Service, runId, name string) string {
+	_, reader, err := service.Open(context.Background(), runId, name)
+	require.NoError(t, err)
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestUpload(t *testing.T) {
+	ctx := context.Background()
+	service, runs := newTestService(t)
+	createTestRun(t, runs, "run-1", models.Job{Name: "build"}, models.Job{Name: "test"})
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return created }
+
+	artifact, err := service.Upload(ctx, "run-1", "build", "bin/app", strings.NewReader("binary"), checksum("binary"))
+	require.NoError(t, err)
+	assert.Equal(t, models.Artifact{
+		Name:      "bin/app",
+		RunId:     "run-1",
+		Job:       "build",
+		Size:      6,
+		Sha256:    checksum("binary"),
+		CreatedAt: created,
+		ExpiresAt: created.Add(7 * 24 * time.Hour),
+	}, *artifact)
+	report, err := service.Upload(ctx, "run-1", "test", "reports/unit.xml", strings.NewReader("<xml/>"), "")
+	require.NoError(t, err)
+	assert.Equal(t, created.Add(DefaultRetention), report.ExpiresAt)
+
+	assert.Equal(t, "binary", readArtifact(t, service, "run-1", "bin/app"))
+	artifactList, err := service.List(ctx, "run-1")
+	require.NoError(t, err)
+	assert.Len(t, artifactList, 2)
+	assert.Equal(t, "bin/app", artifactList[0].Name)
+	assert.Equal(t, "reports/unit.xml", artifactList[1].Name)
+}
+
+func TestUploadRejections(t *testing.T) {
+	ctx := context.Background()
+	service, runs := newTestService(t)
+	createTestRun(t, runs, "run-1", models.Job{Name: "build"}, models.Job{Name: "test"})
+	_, err := service.Upload(ctx, "run-1", "build", "bin/app", strings.NewReader("binary"), "")
+	require.NoError(t, err)
+
+	examples := []struct {
+		name     string
+		job      string
+		artifact string
+		checksum string
+		err      string
+	}{
+		{name: "checksum mismatch", job: "build", artifact: "bin/other", checksum: checksum("tampered"), err: "the SHA-256 of bin/other is"},
+		{name: "path escaping the run", job: "build", artifact: "../run-2/bin/app", err: "invalid artifact key"},
+		{name: "absolute path", job: "build", artifact: "/bin/app", err: "invalid artifact key"},
+		{name: "name taken by another job", job: "test", artifact: "bin/app", err: "already uploaded by job build"},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			_, err := service.Upload(ctx, "run-1", example.job, example.artifact, strings.NewReader("binary"), example.checksum)
+			assert.ErrorIs(t, err, ErrInvalidArtifact)
+			assert.ErrorContains(t, err, example.err)
+		})
+	}
+	_, _, err = service.Open(ctx, "run-1", "bin/other")
+	assert.ErrorIs(t, err, ErrNotFound, "rejected uploads are not stored")
+	_, err = service.Upload(ctx, "unknown", "build", "bin/app", strings.NewReader("binary"), "")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestListResolvesReusedJobs(t *testing.T) {
+	ctx := context.Background()
+	service, runs := newTestService(t)
+	createTestRun(t, runs, "run-1", models.Job{Name: "build"}, models.Job{Name: "test"})
+	_, err := service.Upload(ctx, "run-1", "build", "bin/app", strings.NewReader("first"), "")
+	require.NoError(t, err)
+	_, err = service.Upload(ctx, "run-1", "test", "reports/unit.xml", strings.NewReader("failed"), "")
+	require.NoError(t, err)
+
+	// the re-run reuses build and executes test again
+	createTestRun(t, runs, "run-2", models.Job{Name: "build", ReusedFrom: "run-1"}, models.Job{Name: "test"})
+	_, err = service.Upload(ctx, "run-2", "test", "reports/unit.xml", strings.NewReader("passed"), "")
+	require.NoError(t, err)
+
+	artifactList, err := service.List(ctx, "run-2")
+	require.NoError(t, err)
+	require.Len(t, artifactList, 2)
+	assert.Equal(t, "run-1", artifactList[0].RunId)
+	assert.Equal(t, "run-2", artifactList[1].RunId)
+	assert.Equal(t, "first", readArtifact(t, service, "run-2", "bin/app"))
+	assert.Equal(t, "passed", readArtifact(t, service, "run-2", "reports/unit.xml"))
+	assert.Equal(t, "failed", readArtifact(t, service, "run-1", "reports/unit.xml"))
+}
+
+func TestPurge(t *testing.T) {
+	ctx := context.Background()
+	service, runs := newTestService(t)
+	createTestRun(t, runs, "run-1", models.Job{Name: "build"}, models.Job{Name: "test"})
+	current := time.Now()
+	service.now = func() time.Time { return current }
+	_, err := service.Upload(ctx, "run-1", "build", "bin/app", strings.NewReader("binary"), "")
+	require.NoError(t, err)
+	_, err = service.Upload(ctx, "run-1", "test", "reports/unit.xml", strings.NewReader("<xml/>"), "")
+	require.NoError(t, err)
+
+	current = current.Add(8 * 24 * time.Hour)
+	artifactList, err := service.List(ctx, "run-1")
+	require.NoError(t, err)
+	assert.Len(t, artifactList, 1, "expired artifacts are hidden before they are purged")
+	purged, err := service.Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = service.blobs.Open(ctx, key("run-1", "bin/app"))
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	purged, err = service.Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, purged)
+	assert.Equal(t, "<xml/>", readArtifact(t, service, "run-1", "reports/unit.xml"))
+}
@@ -0,0 +1,111 @@
+// Package artifacts keeps the files uploaded by jobs, along with their checksum
+// and expiry, and serves them back for download.
+package artifacts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"api/paths"
+)
+
+var ErrNotFound = errors.New("artifact not found")
+
+// Storage of the artifact contents; their metadata lives in the API store
+type ArtifactStore interface {
+	// Store size bytes read from content under key, replacing any previous contents
+	Put(ctx context.Context, key string, content io.Reader, size int64) error
+	// ErrNotFound when nothing is stored under key
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// Artifacts stored as files under a directory, e.g. a volume shared by the API replicas
+type LocalStore struct {
+	dir string
+}
+
+func NewLocalStore(dir string) (*LocalStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the artifact directory %s: %w", dir, err)
+	}
+	return &LocalStore{dir: dir}, nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	err := validateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, content io.Reader, size int64) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create the directory of artifact %s: %w", key, err)
+	}
+	// write aside and rename, so readers never see a partial file
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-")
+	if err != nil {
+		return fmt.Errorf("unable to store artifact %s: %w", key, err)
+	}
+	defer os.Remove(file.Name())
+	written, err := io.Copy(file, content)
+	closeErr := file.Close()
+	if err != nil {
+		return fmt.Errorf("unable to store artifact %s: %w", key, err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("unable to store artifact %s: %w", key, closeErr)
+	}
+	if written != size {
+		return fmt.Errorf("unable to store artifact %s: expected %d bytes, got %d", key, size, written)
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open artifact %s: %w", key, err)
+	}
+	return file, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to delete artifact %s: %w", key, err)
+	}
+	return nil
+}
+
+// Keys are slash-separated relative paths that stay inside the storage root
+func validateKey(key string) error {
+	if !paths.Valid(key) {
+		return fmt.Errorf("invalid artifact key %q", key)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+// Package audit keeps an append-only log of the mutating API actions: who
+// did what, from which client and request, and which fields it changed.
+//
+// Events are only ever appended, one JSON document per line, to a file that
+// nothing in the API rewrites or truncates.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"api/context_settings"
+	"api/logger"
+	"api/models"
+
+	"github.com/google/uuid"
+)
+
+// Name of the JSON Lines file of the events under the data directory
+const EventsFile string = "audit.jsonl"
+
+const (
+	// Events returned by a query without a limit
+	DefaultLimit int = 100
+	MaxLimit     int = 1000
+)
+
+// Events matching every set field
+type Filter struct {
+	// Inclusive
+	From time.Time
+	// Exclusive
+	To     time.Time
+	Actor  string
+	Action models.AuditAction
+	// Unlimited when 0
+	Limit int
+}
+
+type Service struct {
+	path string
+	now  func() time.Time
+}
+
+// Audit log kept in the JSON Lines file at path, created on the first event
+func NewService(path string) *Service {
+	return &Service{path: path, now: time.Now}
+}
+
+/*
+Append an event to the audit log.
+
+The request id, origin and caller are read from the request context when the event does not set them.
+
+[IN] ctx: request context
+
+[IN] event: action, resource and changes
+
+[OUT] *models.AuditEvent: the recorded event
+
+[OUT] error: for error propagation
+*/
+func (s *Service) Record(ctx context.Context, event models.AuditEvent) (*models.AuditEvent, error) {
+	event.Id = uuid.NewString()
+	event.At = s.now().UTC()
+	if event.Resource == "" {
+		event.Resource = event.Action.Resource()
+	}
+	if event.Actor == "" {
+		event.Actor, _ = ctx.Value(context_settings.Caller).(string)
+	}
+	if event.RequestId == "" {
+		event.RequestId, _ = ctx.Value(context_settings.RequestId).(string)
+	}
+	if event.Origin == "" {
+		event.Origin, _ = ctx.Value(context_settings.Origin).(string)
+	}
+	err := s.append(event)
+	if err != nil {
+		return nil, fmt.Errorf("unable to record %s of %s %s: %w", event.Action, event.Resource, event.ResourceId, err)
+	}
+	return &event, nil
+}
+
+// Write an event as a single line; O_APPEND writes land whole at the end of the file, even from several replicas
+func (s *Service) append(event models.AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.path), 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create the audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open the audit log: %w", err)
+	}
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("unable to write the audit log: %w", err)
+	}
+	return file.Close()
+}
+
+// Events matching a filter, newest first
+func (s *Service) Query(ctx context.Context, filter Filter) ([]models.AuditEvent, error) {
+	log := logger.FromContext(ctx)
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []models.AuditEvent{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the audit log: %w", err)
+	}
+	defer file.Close()
+
+	matching := []models.AuditEvent{}
+	reader := bufio.NewReader(file)
+	for number := 1; ; number++ {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// a line without its newline is still being written
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the audit log: %w", err)
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		event := models.AuditEvent{}
+		err = json.Unmarshal(line, &event)
+		if err != nil {
+			log.Warnf("Skipping line %d of the audit log: %v", number, err)
+			continue
+		}
+		if filter.matches(event) {
+			matching = append(matching, event)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].At.After(matching[j].At)
+	})
+	if filter.Limit > 0 && len(matching) > filter.Limit {
+		matching = matching[:filter.Limit]
+	}
+	return matching, nil
+}
+
+func (f Filter) matches(event models.AuditEvent) bool {
+	if !f.From.IsZero() && event.At.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !event.At.Before(f.To) {
+		return false
+	}
+	if f.Actor != "" && event.Actor != f.Actor {
+		return false
+	}
+	return f.Action == "" || event.Action == f.Action
+}
+
+/*
+Fields that differ between two states of a resource.
+
+Objects are compared field by field, lists as a whole.
+
+[IN] before: the resource before the action; nil when it created the resource
+
+[IN] after: the resource after the action; nil when it deleted the resource
+
+[OUT] []models.FieldChange: the changes, by field path
+
+[OUT] error: when a state cannot be encoded as JSON
+*/
+func Diff(before, after any) ([]models.FieldChange, error) {
+	beforeFields, err := flatten(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := flatten(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := []models.FieldChange{}
+	for field, value := range beforeFields {
+		afterValue, ok := afterFields[field]
+		if !ok {
+			changes = append(changes, models.FieldChange{Field: field, Before: value})
+		} else if !reflect.DeepEqual(value, afterValue) {
+			changes = append(changes, models.FieldChange{Field: field, Before: value, After: afterValue})
+		}
+	}
+	for field, value := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			changes = append(changes, models.FieldChange{Field: field, After: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes, nil
+}
+
+// Leaf values of a JSON document by dotted path
+func flatten(value any) (map[string]any, error) {
+	fields := map[string]any{}
+	if value == nil || reflect.ValueOf(value).Kind() == reflect.Pointer && reflect.ValueOf(value).IsNil() {
+		return fields, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode the audited state: %w", err)
+	}
+	var document any
+	err = json.Unmarshal(data, &document)
+	if err != nil {
+		return nil, err
+	}
+	var walk func(prefix string, node any)
+	walk = func(prefix string, node any) {
+		object, ok := node.(map[string]any)
+		if !ok {
+			fields[prefix] = node
+			return
+		}
+		for key, child := range object {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			walk(key, child)
+		}
+	}
+	walk("", document)
+	return fields, nil
+}
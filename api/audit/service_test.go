@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"api/context_settings"
+	"api/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestService(t *testing.T) *Service {
+	service := NewService(filepath.Join(t.TempDir(), EventsFile))
+	now := start
+	service.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+	return service
+}
+
+func TestRecord(t *testing.T) {
+	service := newTestService(t)
+	ctx := context.WithValue(context.Background(), context_settings.Caller, "alice")
+	ctx = context.WithValue(ctx, context_settings.RequestId, "request-1")
+	ctx = context.WithValue(ctx, context_settings.Origin, "cli@1.2.0")
+
+	event, err := service.Record(ctx, models.AuditEvent{Action: models.AuditRunCancel, ResourceId: "run-1"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, event.Id)
+	assert.Equal(t, start.Add(time.Minute), event.At)
+	assert.Equal(t, "alice", event.Actor)
+	assert.Equal(t, "run", event.Resource)
+	assert.Equal(t, "request-1", event.RequestId)
+	assert.Equal(t, "cli@1.2.0", event.Origin)
+
+	event, err = service.Record(ctx, models.AuditEvent{Action: models.AuditRunTrigger, Actor: "github", ResourceId: "run-2"})
+	require.NoError(t, err)
+	assert.Equal(t, "github", event.Actor, "the actor of the event wins over the caller")
+}
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+	for _, event := range []models.AuditEvent{
+		{Action: models.AuditPipelineCreate, Actor: "alice", ResourceId: "pipeline-1"},
+		{Action: models.AuditRunCancel, Actor: "bob", ResourceId: "run-1"},
+		{Action: models.AuditRunCancel, Actor: "alice", ResourceId: "run-2"},
+		{Action: models.AuditSecretPut, Actor: "alice", ResourceId: "pipeline-1/TOKEN"},
+	} {
+		_, err := service.Record(ctx, event)
+		require.NoError(t, err)
+	}
+
+	examples := []struct {
+		name     string
+		filter   Filter
+		expected []string
+	}{
+		{name: "newest first", filter: Filter{}, expected: []string{"pipeline-1/TOKEN", "run-2", "run-1", "pipeline-1"}},
+		{name: "actor", filter: Filter{Actor: "alice"}, expected: []string{"pipeline-1/TOKEN", "run-2", "pipeline-1"}},
+		{name: "action", filter: Filter{Action: models.AuditRunCancel}, expected: []string{"run-2", "run-1"}},
+		{name: "time range", filter: Filter{From: start.Add(2 * time.Minute), To: start.Add(4 * time.Minute)}, expected: []string{"run-2", "run-1"}},
+		{name: "limit", filter: Filter{Limit: 1}, expected: []string{"pipeline-1/TOKEN"}},
+		{name: "no match", filter: Filter{Actor: "carol"}, expected: []string{}},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			events, err := service.Query(ctx, example.filter)
+			require.NoError(t, err)
+			resourceIds := []string{}
+			for _, event := range events {
+				resourceIds = append(resourceIds, event.ResourceId)
+			}
+			assert.Equal(t, example.expected, resourceIds)
+		})
+	}
+}
+
+func TestRecordAppendsLines(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+	events, err := service.Query(ctx, Filter{})
+	require.NoError(t, err)
+	assert.Empty(t, events, "the log is created on the first event")
+
+	_, err = service.Record(ctx, models.AuditEvent{Action: models.AuditRunCancel, Actor: "alice", ResourceId: "run-1"})
+	require.NoError(t, err)
+	written, err := os.ReadFile(service.path)
+	require.NoError(t, err)
+	_, err = service.Record(ctx, models.AuditEvent{Action: models.AuditRunCancel, Actor: "bob", ResourceId: "run-2"})
+	require.NoError(t, err)
+	contents, err := os.ReadFile(service.path)
+	require.NoError(t, err)
+	assert.Equal(t, string(written), string(contents[:len(written)]), "earlier events are never rewritten")
+	assert.Equal(t, 2, strings.Count(string(contents), "\n"))
+
+	// a line torn by a crash and the one still being written are skipped
+	file, err := os.OpenFile(service.path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString("{\"id\":\"torn\n{\"id\":\"partial\"")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	events, err = service.Query(ctx, Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "run-2", events[0].ResourceId)
+	assert.Equal(t, "run-1", events[1].ResourceId)
+}
+
+func TestDiff(t *testing.T) {
+	before := &models.Run{Id: "run-1", Status: models.StatusRunning, Attempt: 1}
+	after := &models.Run{Id: "run-1", Status: models.StatusCancelled, Reason: "cancelled on request", Attempt: 1}
+
+	changes, err := Diff(before, after)
+	require.NoError(t, err)
+	assert.Equal(t, []models.FieldChange{
+		{Field: "reason", After: "cancelled on request"},
+		{Field: "status", Before: "running", After: "cancelled"},
+	}, changes)
+
+	var missing *models.Secret
+	changes, err = Diff(missing, models.Secret{Name: "TOKEN", Scope: models.SecretScopePipeline})
+	require.NoError(t, err)
+	assert.Contains(t, changes, models.FieldChange{Field: "name", After: "TOKEN"})
+
+	changes, err = Diff(map[string]any{"labels": map[string]any{"os": "linux", "arch": "amd64"}}, map[string]any{"labels": map[string]any{"os": "linux"}})
+	require.NoError(t, err)
+	assert.Equal(t, []models.FieldChange{{Field: "labels.arch", Before: "amd64"}}, changes)
+
+	changes, err = Diff(nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
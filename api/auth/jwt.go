@@ -0,0 +1,405 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"api/models"
+)
+
+const (
+	// Tolerated clock difference with the issuer
+	clockSkew time.Duration = time.Minute
+	// Remote keys are fetched again after this long, or sooner for an unknown key id
+	keysMaxAge time.Duration = time.Hour
+	// Least time between two fetches, failed or not, so an outage or forged key ids cannot flood the provider
+	keysMinInterval  time.Duration = time.Minute
+	keysFetchTimeout time.Duration = 10 * time.Second
+	maxJWKSBytes     int64         = 1 << 20
+)
+
+// Signature algorithms accepted in JWTs; symmetric ones and `none` never are
+var algorithms = map[string]struct {
+	hash crypto.Hash
+	ec   bool
+}{
+	"RS256": {hash: crypto.SHA256},
+	"RS384": {hash: crypto.SHA384},
+	"RS512": {hash: crypto.SHA512},
+	"ES256": {hash: crypto.SHA256, ec: true},
+	"ES384": {hash: crypto.SHA384, ec: true},
+	"ES512": {hash: crypto.SHA512, ec: true},
+}
+
+// Public keys verifying JWT signatures, by key id
+type KeySet interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// Settings of the OIDC provider issuing the JWTs
+type JWTConfig struct {
+	// Expected `iss` claim
+	Issuer string
+	// Expected in the `aud` claim; not checked when empty
+	Audience string
+	Keys     KeySet
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyId     string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	Name      string   `json:"name"`
+	Email     string   `json:"email"`
+	Groups    []string `json:"groups"`
+}
+
+// The `aud` claim, either a string or a list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+func decodeSegment(segment string, value any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+// Whether a bearer token is a JWT rather than an API token
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+/*
+Verify a JWT and read the identity it carries.
+
+[IN] ctx: request context
+
+[IN] config: expected issuer and audience, and keys of the issuer
+
+[IN] token: the compact JWT
+
+[IN] now: current time, to check its validity period
+
+[OUT] *models.Identity: the subject of the JWT
+
+[OUT] error: ErrUnauthorized when the JWT is invalid, expired or from another issuer
+*/
+func verifyJWT(ctx context.Context, config JWTConfig, token string, now time.Time) (*models.Identity, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, fmt.Errorf("%w: malformed JWT", ErrUnauthorized)
+	}
+	header := jwtHeader{}
+	err := decodeSegment(segments[0], &header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed JWT header", ErrUnauthorized)
+	}
+	algorithm, ok := algorithms[header.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported JWT algorithm %q", ErrUnauthorized, header.Algorithm)
+	}
+	key, err := config.Keys.Key(ctx, header.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed JWT signature", ErrUnauthorized)
+	}
+	hasher := algorithm.hash.New()
+	hasher.Write([]byte(segments[0] + "." + segments[1]))
+	digest := hasher.Sum(nil)
+	if !verifySignature(key, algorithm.hash, algorithm.ec, digest, signature) {
+		return nil, fmt.Errorf("%w: invalid JWT signature", ErrUnauthorized)
+	}
+
+	claims := jwtClaims{}
+	err = decodeSegment(segments[1], &claims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed JWT claims", ErrUnauthorized)
+	}
+	if claims.Issuer != config.Issuer {
+		return nil, fmt.Errorf("%w: JWT issued by %q", ErrUnauthorized, claims.Issuer)
+	}
+	if config.Audience != "" && !slices.Contains(claims.Audience, config.Audience) {
+		return nil, fmt.Errorf("%w: JWT not issued for %q", ErrUnauthorized, config.Audience)
+	}
+	if claims.ExpiresAt == nil || now.After(unixTime(*claims.ExpiresAt).Add(clockSkew)) {
+		return nil, fmt.Errorf("%w: the JWT expired", ErrUnauthorized)
+	}
+	if claims.NotBefore != nil && now.Add(clockSkew).Before(unixTime(*claims.NotBefore)) {
+		return nil, fmt.Errorf("%w: the JWT is not valid yet", ErrUnauthorized)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: the JWT has no subject", ErrUnauthorized)
+	}
+	name := claims.Name
+	if name == "" {
+		name = claims.Email
+	}
+	expiresAt := unixTime(*claims.ExpiresAt).UTC()
+	return &models.Identity{
+		Subject:   claims.Subject,
+		Method:    models.AuthMethodJWT,
+		Name:      name,
+		Issuer:    claims.Issuer,
+		Groups:    claims.Groups,
+		ExpiresAt: &expiresAt,
+	}, nil
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+func verifySignature(key crypto.PublicKey, hash crypto.Hash, ec bool, digest, signature []byte) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return !ec && rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		// JWS signatures are the two integers, each padded to the size of the curve
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !ec || len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, digest, r, s)
+	default:
+		return false
+	}
+}
+
+// A key of a JSON Web Key Set
+type jwk struct {
+	KeyId   string `json:"kid"`
+	KeyType string `json:"kty"`
+	Use     string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+/*
+Parse a JSON Web Key Set, e.g. served by the jwks_uri of an OIDC provider.
+
+Only RSA and EC signing keys are kept.
+
+[IN] data: the JWKS document
+
+[OUT] map[string]crypto.PublicKey: public keys by key id
+
+[OUT] error: when the document or one of its keys is invalid
+*/
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	document := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	err := json.Unmarshal(data, &document)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, key := range document.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		publicKey, err := key.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q in JWKS: %w", key.KeyId, err)
+		}
+		if publicKey != nil {
+			keys[key.KeyId] = publicKey
+		}
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Curve]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("the point is not on the curve")
+		}
+		return key, nil
+	default:
+		// e.g. symmetric keys, which never verify JWTs here
+		return nil, nil
+	}
+}
+
+// Fixed keys, e.g. a local key in tests or an offline deployment
+type StaticKeySet map[string]crypto.PublicKey
+
+func (s StaticKeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	key, ok := s[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown JWT key %q", ErrUnauthorized, kid)
+	}
+	return key, nil
+}
+
+// Keys fetched from the JWKS endpoint of an OIDC provider and cached
+type RemoteKeySet struct {
+	url    string
+	client *http.Client
+	now    func() time.Time
+
+	mu   sync.Mutex
+	keys map[string]crypto.PublicKey
+	// Last successful fetch
+	fetchedAt time.Time
+	// Last fetch, successful or not, and its error
+	attemptedAt time.Time
+	err         error
+	// Closed when the fetch in flight completes; nil when there is none
+	fetching chan struct{}
+}
+
+func NewRemoteKeySet(url string) *RemoteKeySet {
+	return &RemoteKeySet{url: url, client: &http.Client{Timeout: keysFetchTimeout}, now: time.Now}
+}
+
+// The key with the id; the keys are fetched again when they are stale or the id is unknown, as providers rotate them
+func (r *RemoteKeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	r.mu.Lock()
+	key, ok := r.keys[kid]
+	now := r.now()
+	fresh := ok && now.Sub(r.fetchedAt) < keysMaxAge
+	recent := !r.attemptedAt.IsZero() && now.Sub(r.attemptedAt) < keysMinInterval
+	if fresh || (recent && r.fetching == nil) {
+		defer r.mu.Unlock()
+		return r.lookup(kid)
+	}
+	// joins the fetch in flight, if any
+	done := r.refresh()
+	r.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if ok {
+			return key, nil
+		}
+		return nil, ctx.Err()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lookup(kid)
+}
+
+// The cached key with the id, or why there is none; r.mu must be held
+func (r *RemoteKeySet) lookup(kid string) (crypto.PublicKey, error) {
+	key, ok := r.keys[kid]
+	if ok {
+		// stale keys are still used while the provider is down, so an outage does not lock everyone out
+		return key, nil
+	}
+	if r.keys == nil && r.err != nil {
+		return nil, r.err
+	}
+	return nil, fmt.Errorf("%w: unknown JWT key %q", ErrUnauthorized, kid)
+}
+
+// Start fetching the keys unless a fetch is in flight, returning a channel closed once it completes; r.mu must be held
+func (r *RemoteKeySet) refresh() <-chan struct{} {
+	if r.fetching != nil {
+		return r.fetching
+	}
+	done := make(chan struct{})
+	r.fetching = done
+	r.attemptedAt = r.now()
+	go func() {
+		// shared by every waiting request, so none of their contexts may cancel it
+		ctx, cancel := context.WithTimeout(context.Background(), keysFetchTimeout)
+		defer cancel()
+		keys, err := r.fetch(ctx)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if err == nil {
+			r.keys, r.fetchedAt = keys, r.now()
+		}
+		r.err, r.fetching = err, nil
+		close(done)
+	}()
+	return done
+}
+
+func (r *RemoteKeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := r.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch the JWKS: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch the JWKS: status %d", response.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxJWKSBytes))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the JWKS: %w", err)
+	}
+	return ParseJWKS(data)
+}
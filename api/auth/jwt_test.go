@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIssuer string = "https://issuer.example.com"
+
+var testNow = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Sign claims as a compact JWT with a local key
+func signJWT(t *testing.T, key crypto.Signer, algorithm, kid string, claims map[string]any) string {
+	header, err := json.Marshal(map[string]string{"alg": algorithm, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss":    testIssuer,
+		"sub":    "user-1",
+		"aud":    []string{"aeternum", "other"},
+		"exp":    testNow.Add(time.Hour).Unix(),
+		"email":  "user@example.com",
+		"groups": []string{"admins"},
+	}
+}
+
+func TestVerifyJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	config := JWTConfig{
+		Issuer:   testIssuer,
+		Audience: "aeternum",
+		Keys:     StaticKeySet{"rsa": rsaKey.Public(), "ec": ecKey.Public()},
+	}
+	with := func(changes map[string]any) map[string]any {
+		claims := validClaims()
+		for claim, value := range changes {
+			if value == nil {
+				delete(claims, claim)
+				continue
+			}
+			claims[claim] = value
+		}
+		return claims
+	}
+
+	examples := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{name: "RS256", token: signJWT(t, rsaKey, "RS256", "rsa", validClaims()), valid: true},
+		{name: "ES256", token: signJWT(t, ecKey, "ES256", "ec", validClaims()), valid: true},
+		{name: "single audience", token: signJWT(t, rsaKey, "RS256", "rsa", with(map[string]any{"aud": "aeternum"})), valid: true},
+		{name: "within clock skew", token: signJWT(t, rsaKey, "RS256", "rsa", with(map[string]any{"exp": testNow.Add(-30 * time.Second).Unix()})), valid: true},
+		{name: "expired", token: signJWT(t, rsaKey, "RS256", "rsa", with(map[string]any{"exp": testNow.Add(-time.Hour).Unix()}))},
+		{name: "without expiry", token: signJWT(t, rsaKey, "RS256", "rsa", with(map[string]any{"exp": nil}))},
+		{name: "not yet valid", token: signJWT(t, rsaKey, "RS256", "rsa", with(map[string]any{"nbf": testNow.Add(time.Hour).Unix()}))},
+		{name: "other issuer", token: signJWT(t, rsaKey, "RS256", "rsa", with(map[string]any{"iss": "https://evil.example.com"}))},
+		{name: "other audience", token: signJWT(t, rsaKey, "RS256", "rsa", with(map[string]any{"aud": "other"}))},
+		{name: "without subject", token: signJWT(t, rsaKey, "RS256", "rsa", with(map[string]any{"sub": nil}))},
+		{name: "unknown key", token: signJWT(t, otherKey, "RS256", "other", validClaims())},
+		{name: "wrong key", token: signJWT(t, otherKey, "RS256", "rsa", validClaims())},
+		{name: "algorithm mismatch", token: signJWT(t, rsaKey, "ES256", "rsa", validClaims())},
+		{name: "none", token: signJWT(t, rsaKey, "none", "rsa", validClaims())},
+		{name: "malformed", token: "a.b.c"},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			identity, err := verifyJWT(context.Background(), config, example.token, testNow)
+			if !example.valid {
+				assert.ErrorIs(t, err, ErrUnauthorized)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, identity.ExpiresAt, "JWTs always expire")
+			identity.ExpiresAt = nil
+			assert.Equal(t, models.Identity{
+				Subject: "user-1",
+				Method:  models.AuthMethodJWT,
+				Name:    "user@example.com",
+				Issuer:  testIssuer,
+				Groups:  []string{"admins"},
+			}, *identity)
+		})
+	}
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	fetches := 0
+	kid := "key-1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		fmt.Fprintf(w, `{"keys": [
+			{"kid": %q, "kty": "RSA", "use": "sig", "n": %q, "e": "AQAB"},
+			{"kid": "ec", "kty": "EC", "crv": "P-256", "x": %q, "y": %q},
+			{"kid": "encryption", "kty": "RSA", "use": "enc", "n": "AQAB", "e": "AQAB"},
+			{"kid": "hmac", "kty": "oct", "k": "c2VjcmV0"}
+		]}`, kid, base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			base64.RawURLEncoding.EncodeToString(ecKey.X.Bytes()), base64.RawURLEncoding.EncodeToString(ecKey.Y.Bytes()))
+	}))
+	defer server.Close()
+	keys := NewRemoteKeySet(server.URL)
+	now := testNow
+	keys.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	publicKey, err := keys.Key(ctx, "key-1")
+	require.NoError(t, err)
+	assert.True(t, key.PublicKey.Equal(publicKey))
+	_, err = keys.Key(ctx, "ec")
+	require.NoError(t, err)
+	_, err = keys.Key(ctx, "hmac")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	assert.Equal(t, 1, fetches, "unknown keys are not fetched again right away")
+
+	// the provider rotated its key
+	kid = "key-2"
+	now = now.Add(2 * time.Minute)
+	_, err = keys.Key(ctx, "key-2")
+	require.NoError(t, err)
+	assert.Equal(t, 2, fetches)
+	_, err = keys.Key(ctx, "key-1")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestRemoteKeySetOutage(t *testing.T) {
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	keys := NewRemoteKeySet(server.URL)
+	now := testNow
+	var clock sync.Mutex
+	keys.now = func() time.Time {
+		clock.Lock()
+		defer clock.Unlock()
+		return now
+	}
+
+	// concurrent requests share one fetch, and a cancelled caller does not cancel it
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := keys.Key(cancelled, "key-1")
+	assert.ErrorIs(t, err, context.Canceled)
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		go func(i int) {
+			_, err := keys.Key(context.Background(), fmt.Sprintf("key-%d", i))
+			errs <- err
+		}(i)
+	}
+	close(release)
+	for i := 0; i < 5; i++ {
+		assert.ErrorContains(t, <-errs, "status 503")
+	}
+	assert.EqualValues(t, 1, fetches.Load())
+
+	// failed fetches are not retried before the minimum interval
+	_, err = keys.Key(context.Background(), "key-1")
+	assert.ErrorContains(t, err, "status 503")
+	assert.EqualValues(t, 1, fetches.Load())
+	clock.Lock()
+	now = now.Add(keysMinInterval)
+	clock.Unlock()
+	_, err = keys.Key(context.Background(), "key-1")
+	assert.ErrorContains(t, err, "status 503")
+	assert.EqualValues(t, 2, fetches.Load())
+}
@@ -0,0 +1,218 @@
+// Package auth authenticates the callers of the HTTP API, either with a
+// personal API token or with a JWT issued by an OIDC provider.
+//
+// API tokens are random strings shown once at creation; like runner tokens,
+// only their SHA-256 hash is stored. JWTs are verified against the keys the
+// provider publishes in its JWKS.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"api/context_settings"
+	"api/logger"
+	"api/models"
+	"api/store"
+
+	"github.com/google/uuid"
+)
+
+const TokensBucket string = "api-tokens"
+
+// Prefix of the API tokens, telling them apart from JWTs and runner tokens
+const tokenPrefix string = "aet_"
+
+// Missing, unknown, expired or invalid credentials
+var ErrUnauthorized = errors.New("unauthorized")
+
+type Service struct {
+	store store.Store
+	// Nil when JWTs are not accepted
+	jwt *JWTConfig
+	now func() time.Time
+}
+
+/*
+Create the authentication service.
+
+[IN] s: store holding the hashes of the API tokens
+
+[IN] jwt: provider of the accepted JWTs; only API tokens are accepted when nil
+
+[OUT] *Service: the authentication service
+*/
+func NewService(s store.Store, jwt *JWTConfig) *Service {
+	return &Service{store: s, jwt: jwt, now: time.Now}
+}
+
+/*
+Authenticate the bearer token of a request.
+
+[IN] ctx: request context
+
+[IN] token: API token or JWT
+
+[OUT] *models.Identity: the caller
+
+[OUT] error: ErrUnauthorized when the token is missing or invalid
+*/
+func (s *Service) Authenticate(ctx context.Context, token string) (*models.Identity, error) {
+	if token == "" {
+		return nil, fmt.Errorf("%w: missing bearer token", ErrUnauthorized)
+	}
+	if isJWT(token) {
+		if s.jwt == nil {
+			return nil, fmt.Errorf("%w: JWTs are not accepted", ErrUnauthorized)
+		}
+		return verifyJWT(ctx, *s.jwt, token, s.now())
+	}
+	apiToken, err := store.Get[models.ApiToken](ctx, s.store, TokensBucket, hashToken(token))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("%w: unknown API token", ErrUnauthorized)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if apiToken.ExpiresAt != nil && !s.now().Before(*apiToken.ExpiresAt) {
+		return nil, fmt.Errorf("%w: API token %s expired", ErrUnauthorized, apiToken.Name)
+	}
+	return &models.Identity{
+		Subject:   apiToken.Subject,
+		Method:    models.AuthMethodToken,
+		Name:      apiToken.Name,
+		TokenId:   apiToken.Id,
+		ExpiresAt: apiToken.ExpiresAt,
+	}, nil
+}
+
+/*
+Create a personal API token.
+
+[IN] ctx: request context
+
+[IN] subject: caller the token authenticates as
+
+[IN] name: what the token is for
+
+[IN] ttl: lifetime of the token; it never expires when 0
+
+[OUT] *models.ApiToken: the token metadata
+
+[OUT] string: the token, which cannot be retrieved later
+
+[OUT] error: for error propagation
+*/
+func (s *Service) CreateToken(ctx context.Context, subject, name string, ttl time.Duration) (*models.ApiToken, string, error) {
+	if subject == "" || strings.TrimSpace(name) == "" {
+		return nil, "", fmt.Errorf("API tokens need a subject and a name")
+	}
+	buffer := make([]byte, 32)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to generate an API token: %w", err)
+	}
+	token := tokenPrefix + hex.EncodeToString(buffer)
+	now := s.now().UTC()
+	apiToken := models.ApiToken{Id: uuid.NewString(), Name: name, Subject: subject, CreatedAt: now}
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		apiToken.ExpiresAt = &expiresAt
+	}
+	err = store.Insert(ctx, s.store, TokensBucket, hashToken(token), apiToken)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to record API token %s: %w", name, err)
+	}
+	logger.FromContext(ctx).Infof("Created API token %s (%s) for %s", name, apiToken.Id, subject)
+	return &apiToken, token, nil
+}
+
+/*
+Create a personal API token for a caller, expiring no later than the credential it authenticated with.
+
+Otherwise a short-lived JWT or an expiring token could mint a token outliving it.
+
+[IN] ctx: request context
+
+[IN] identity: the caller
+
+[IN] name: what the token is for
+
+[IN] ttl: requested lifetime of the token; it never expires when 0 and the caller's credential does not either
+
+[OUT] *models.ApiToken: the token metadata
+
+[OUT] string: the token, which cannot be retrieved later
+
+[OUT] error: for error propagation
+*/
+func (s *Service) CreateTokenFor(ctx context.Context, identity *models.Identity, name string, ttl time.Duration) (*models.ApiToken, string, error) {
+	if identity.ExpiresAt != nil {
+		remaining := identity.ExpiresAt.Sub(s.now())
+		if remaining <= 0 {
+			return nil, "", fmt.Errorf("%w: the credential of %s expired", ErrUnauthorized, identity.Subject)
+		}
+		if ttl == 0 || ttl > remaining {
+			ttl = remaining
+		}
+	}
+	return s.CreateToken(ctx, identity.Subject, name, ttl)
+}
+
+// API tokens of a subject, oldest first
+func (s *Service) ListTokens(ctx context.Context, subject string) ([]models.ApiToken, error) {
+	tokens, err := store.List[models.ApiToken](ctx, s.store, TokensBucket)
+	if err != nil {
+		return nil, err
+	}
+	owned := []models.ApiToken{}
+	for _, token := range tokens {
+		if token.Subject == subject {
+			owned = append(owned, token)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool {
+		return owned[i].CreatedAt.Before(owned[j].CreatedAt)
+	})
+	return owned, nil
+}
+
+// Revoke an API token of a subject; store.ErrNotFound when it has none with the id
+func (s *Service) RevokeToken(ctx context.Context, subject, id string) error {
+	err := s.store.Update(ctx, TokensBucket, func(b store.Bucket) error {
+		for _, tokenHash := range b.Keys() {
+			token, err := store.Decode[models.ApiToken](b, tokenHash)
+			if err != nil {
+				return err
+			}
+			if token.Id == id && token.Subject == subject {
+				b.Delete(tokenHash)
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: API token %s", store.ErrNotFound, id)
+	})
+	if err != nil {
+		return err
+	}
+	logger.FromContext(ctx).Infof("Revoked API token %s of %s", id, subject)
+	return nil
+}
+
+// The authenticated caller of a request; nil when authentication is disabled
+func Caller(ctx context.Context) *models.Identity {
+	identity, _ := ctx.Value(context_settings.Identity).(*models.Identity)
+	return identity
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+	"time"
+
+	"api/context_settings"
+	"api/models"
+	"api/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestService(jwt *JWTConfig) *Service {
+	service := NewService(store.NewMemoryStore(), jwt)
+	service.now = func() time.Time { return testNow }
+	return service
+}
+
+func TestTokens(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(nil)
+
+	apiToken, token, err := service.CreateToken(ctx, "user-1", "laptop", 0)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, tokenPrefix))
+	assert.Nil(t, apiToken.ExpiresAt)
+	expiring, expiringToken, err := service.CreateToken(ctx, "user-1", "ci", time.Hour)
+	require.NoError(t, err)
+	_, _, err = service.CreateToken(ctx, "user-2", "laptop", 0)
+	require.NoError(t, err)
+
+	identity, err := service.Authenticate(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, models.Identity{Subject: "user-1", Method: models.AuthMethodToken, Name: "laptop", TokenId: apiToken.Id}, *identity)
+
+	tokens, err := service.ListTokens(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Len(t, tokens, 2)
+
+	// the value is never stored
+	records, err := store.List[models.ApiToken](ctx, service.store, TokensBucket)
+	require.NoError(t, err)
+	assert.NotContains(t, records, token)
+
+	service.now = func() time.Time { return testNow.Add(time.Hour) }
+	_, err = service.Authenticate(ctx, expiringToken)
+	assert.ErrorIs(t, err, ErrUnauthorized, "expired at %v", expiring.ExpiresAt)
+
+	assert.ErrorIs(t, service.RevokeToken(ctx, "user-2", apiToken.Id), store.ErrNotFound, "only the owner revokes a token")
+	require.NoError(t, service.RevokeToken(ctx, "user-1", apiToken.Id))
+	_, err = service.Authenticate(ctx, token)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestAuthenticate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwt := signJWT(t, key, "RS256", "rsa", validClaims())
+
+	tokensOnly := newTestService(nil)
+	for _, token := range []string{"", "unknown", jwt} {
+		_, err := tokensOnly.Authenticate(context.Background(), token)
+		assert.ErrorIs(t, err, ErrUnauthorized, token)
+	}
+
+	service := newTestService(&JWTConfig{Issuer: testIssuer, Keys: StaticKeySet{"rsa": key.Public()}})
+	identity, err := service.Authenticate(context.Background(), jwt)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", identity.Subject)
+
+	ctx := context.WithValue(context.Background(), context_settings.Identity, identity)
+	assert.Equal(t, identity, Caller(ctx))
+	assert.Nil(t, Caller(context.Background()))
+}
+
+func TestCreateTokenFor(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(nil)
+	expiresAt := testNow.Add(2 * time.Hour)
+	examples := []struct {
+		name      string
+		expiresAt *time.Time
+		ttl       time.Duration
+		expected  *time.Time
+	}{
+		{name: "caller never expires", ttl: 0},
+		{name: "requested lifetime", expiresAt: &expiresAt, ttl: time.Hour, expected: ptr(testNow.Add(time.Hour))},
+		{name: "never expiring from an expiring caller", expiresAt: &expiresAt, ttl: 0, expected: &expiresAt},
+		{name: "outliving the caller", expiresAt: &expiresAt, ttl: 90 * 24 * time.Hour, expected: &expiresAt},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			identity := &models.Identity{Subject: "user-1", Method: models.AuthMethodJWT, ExpiresAt: example.expiresAt}
+			apiToken, _, err := service.CreateTokenFor(ctx, identity, "laptop", example.ttl)
+			require.NoError(t, err)
+			assert.Equal(t, example.expected, apiToken.ExpiresAt)
+		})
+	}
+
+	expired := testNow.Add(-time.Minute)
+	_, _, err := service.CreateTokenFor(ctx, &models.Identity{Subject: "user-1", ExpiresAt: &expired}, "laptop", 0)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
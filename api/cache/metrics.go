@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	resultHit = "hit"
+	// Restored from a restore key rather than the exact key
+	resultPartial = "partial"
+	resultMiss    = "miss"
+)
+
+var (
+	Lookups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_lookups_total",
+			Help: "Cache restores by result: hit, partial (restore key) or miss",
+		}, []string{"result"},
+	)
+	Evictions = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "cache_evictions_total",
+			Help: "Cache entries evicted to keep their pipeline under its size limit",
+		},
+	)
+)
@@ -0,0 +1,291 @@
+// Package cache keeps the dependency caches of the pipelines, e.g. Go modules,
+// as compressed archives stored through the artifact backend.
+//
+// Entries are immutable and scoped to a pipeline. A lookup tries the exact key
+// first, then the most recent entry starting with each restore key. Once the
+// entries of a pipeline outgrow their limit, the least recently used go first.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"api/artifacts"
+	"api/logger"
+	"api/models"
+	"api/store"
+)
+
+const EntriesBucket string = "cache-entries"
+
+const (
+	DefaultMaxEntryBytes    int64 = 2 << 30
+	DefaultMaxPipelineBytes int64 = 10 << 30
+)
+
+var (
+	ErrTooLarge = errors.New("the cache entry is too large")
+	// Checksum mismatch or invalid key
+	ErrInvalidEntry = errors.New("invalid cache entry")
+)
+
+type Service struct {
+	store            store.Store
+	blobs            artifacts.ArtifactStore
+	maxEntryBytes    int64
+	maxPipelineBytes int64
+	now              func() time.Time
+}
+
+/*
+Create the cache service.
+
+[IN] s: store holding the entry metadata
+
+[IN] blobs: storage of the archives
+
+[IN] maxEntryBytes: largest archive accepted; DefaultMaxEntryBytes when 0
+
+[IN] maxPipelineBytes: total size of the entries of a pipeline before eviction; DefaultMaxPipelineBytes when 0
+
+[OUT] *Service: the cache service
+*/
+func NewService(s store.Store, blobs artifacts.ArtifactStore, maxEntryBytes int64, maxPipelineBytes int64) *Service {
+	if maxEntryBytes <= 0 {
+		maxEntryBytes = DefaultMaxEntryBytes
+	}
+	if maxPipelineBytes <= 0 {
+		maxPipelineBytes = DefaultMaxPipelineBytes
+	}
+	return &Service{
+		store:            s,
+		blobs:            blobs,
+		maxEntryBytes:    maxEntryBytes,
+		maxPipelineBytes: maxPipelineBytes,
+		now:              time.Now,
+	}
+}
+
+/*
+Find the entry to restore and open its archive.
+
+[IN] ctx: request context
+
+[IN] pipelineId: pipeline owning the cache
+
+[IN] key: exact key wanted
+
+[IN] restoreKeys: prefixes to fall back to, most preferred first
+
+[OUT] *models.CacheEntry: the entry found; its key differs from key on a fallback; nil on a miss
+
+[OUT] io.ReadCloser: the archive, to close once read; nil on a miss
+
+[OUT] error: for error propagation
+*/
+func (s *Service) Restore(ctx context.Context, pipelineId, key string, restoreKeys []string) (*models.CacheEntry, io.ReadCloser, error) {
+	entries, err := s.List(ctx, pipelineId)
+	if err != nil {
+		return nil, nil, err
+	}
+	entry, result := match(entries, key, restoreKeys)
+	if entry == nil {
+		Lookups.WithLabelValues(result).Inc()
+		return nil, nil, nil
+	}
+	reader, err := s.blobs.Open(ctx, blobKey(pipelineId, entry.Key))
+	if errors.Is(err, artifacts.ErrNotFound) {
+		// the archive was evicted by another replica in the meantime
+		Lookups.WithLabelValues(resultMiss).Inc()
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	Lookups.WithLabelValues(result).Inc()
+	touched, err := store.Modify(ctx, s.store, EntriesBucket, entryKey(pipelineId, entry.Key), func(entry *models.CacheEntry) error {
+		entry.LastUsedAt = s.now().UTC()
+		return nil
+	})
+	if err != nil {
+		reader.Close()
+		return nil, nil, err
+	}
+	return touched, reader, nil
+}
+
+// Exact key first, then the most recent entry starting with each restore key in turn
+func match(entries []models.CacheEntry, key string, restoreKeys []string) (*models.CacheEntry, string) {
+	for i := range entries {
+		if entries[i].Key == key {
+			return &entries[i], resultHit
+		}
+	}
+	for _, prefix := range restoreKeys {
+		var latest *models.CacheEntry
+		for i := range entries {
+			if !strings.HasPrefix(entries[i].Key, prefix) {
+				continue
+			}
+			if latest == nil || entries[i].CreatedAt.After(latest.CreatedAt) {
+				latest = &entries[i]
+			}
+		}
+		if latest != nil {
+			return latest, resultPartial
+		}
+	}
+	return nil, resultMiss
+}
+
+/*
+Store the archive of a cache entry, then evict the least recently used
+entries of the pipeline if they outgrew their limit.
+
+Entries are immutable: saving a key that exists keeps the stored archive.
+
+[IN] ctx: request context
+
+[IN] pipelineId: pipeline owning the cache
+
+[IN] key: key of the entry
+
+[IN] content: compressed archive
+
+[IN] checksum: expected hex SHA-256 of the archive; not checked when empty
+
+[OUT] *models.CacheEntry: the entry
+
+[OUT] bool: whether the entry was created, rather than already there
+
+[OUT] error: ErrTooLarge or ErrInvalidEntry when the archive was rejected
+*/
+func (s *Service) Save(ctx context.Context, pipelineId, key string, content io.Reader, checksum string) (*models.CacheEntry, bool, error) {
+	if key == "" {
+		return nil, false, fmt.Errorf("%w: the key is empty", ErrInvalidEntry)
+	}
+	existing, err := store.Get[models.CacheEntry](ctx, s.store, EntriesBucket, entryKey(pipelineId, key))
+	if err == nil {
+		return existing, false, nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, false, err
+	}
+
+	spool, err := os.CreateTemp("", "cache-")
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to receive cache %s: %w", key, err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hash), io.LimitReader(content, s.maxEntryBytes+1))
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to receive cache %s: %w", key, err)
+	}
+	if size > s.maxEntryBytes {
+		return nil, false, fmt.Errorf("%w: %s exceeds %d bytes", ErrTooLarge, key, s.maxEntryBytes)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if checksum != "" && !strings.EqualFold(checksum, sum) {
+		return nil, false, fmt.Errorf("%w: the SHA-256 of %s is %s, expected %s", ErrInvalidEntry, key, sum, checksum)
+	}
+	_, err = spool.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, false, err
+	}
+	err = s.blobs.Put(ctx, blobKey(pipelineId, key), spool, size)
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := s.now().UTC()
+	entry := models.CacheEntry{PipelineId: pipelineId, Key: key, Size: size, Sha256: sum, CreatedAt: now, LastUsedAt: now}
+	err = store.Put(ctx, s.store, EntriesBucket, entryKey(pipelineId, key), entry)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to record cache %s: %w", key, err)
+	}
+	logger.FromContext(ctx).Infof("Saved cache %s of pipeline %s (%d bytes)", key, pipelineId, size)
+	err = s.evict(ctx, pipelineId, key)
+	if err != nil {
+		return nil, false, err
+	}
+	return &entry, true, nil
+}
+
+// Delete the least recently used entries of a pipeline until they fit, keeping the one just saved
+func (s *Service) evict(ctx context.Context, pipelineId, saved string) error {
+	entries, err := s.List(ctx, pipelineId)
+	if err != nil {
+		return err
+	}
+	total := int64(0)
+	for _, entry := range entries {
+		total += entry.Size
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastUsedAt.Before(entries[j].LastUsedAt)
+	})
+	for _, entry := range entries {
+		if total <= s.maxPipelineBytes {
+			break
+		}
+		if entry.Key == saved {
+			continue
+		}
+		err = s.Delete(ctx, pipelineId, entry.Key)
+		if err != nil {
+			return err
+		}
+		Evictions.Inc()
+		total -= entry.Size
+		logger.FromContext(ctx).Infof("Evicted cache %s of pipeline %s", entry.Key, pipelineId)
+	}
+	return nil
+}
+
+// Entries of a pipeline, most recently used first
+func (s *Service) List(ctx context.Context, pipelineId string) ([]models.CacheEntry, error) {
+	all, err := store.List[models.CacheEntry](ctx, s.store, EntriesBucket)
+	if err != nil {
+		return nil, err
+	}
+	entries := []models.CacheEntry{}
+	for _, entry := range all {
+		if entry.PipelineId == pipelineId {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastUsedAt.After(entries[j].LastUsedAt)
+	})
+	return entries, nil
+}
+
+// Remove an entry and its archive; store.ErrNotFound when there is no such entry
+func (s *Service) Delete(ctx context.Context, pipelineId, key string) error {
+	// metadata first: an entry without archive would be restored as a miss anyway
+	err := store.Delete(ctx, s.store, EntriesBucket, entryKey(pipelineId, key))
+	if err != nil {
+		return err
+	}
+	return s.blobs.Delete(ctx, blobKey(pipelineId, key))
+}
+
+func entryKey(pipelineId, key string) string {
+	return pipelineId + "/" + key
+}
+
+// Keys are free-form, so archives are stored under their hash
+func blobKey(pipelineId, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "cache/" + pipelineId + "/" + hex.EncodeToString(sum[:]) + ".tar.gz"
+}
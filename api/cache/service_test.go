@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"api/artifacts"
+	"api/store"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestService(t *testing.T, maxEntryBytes, maxPipelineBytes int64) *Service {
+	blobs, err := artifacts.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	service := NewService(store.NewMemoryStore(), blobs, maxEntryBytes, maxPipelineBytes)
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// every call happens a minute after the previous one
+	service.now = func() time.Time {
+		current = current.Add(time.Minute)
+		return current
+	}
+	return service
+}
+
+func save(t *testing.T, service *Service, pipelineId, key, content string) {
+	_, created, err := service.Save(context.Background(), pipelineId, key, strings.NewReader(content), "")
+	require.NoError(t, err)
+	require.True(t, created)
+}
+
+// Key and contents of the restored entry; empty on a miss
+func restore(t *testing.T, service *Service, pipelineId, key string, restoreKeys ...string) (string, string) {
+	entry, reader, err := service.Restore(context.Background(), pipelineId, key, restoreKeys)
+	require.NoError(t, err)
+	if entry == nil {
+		return "", ""
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return entry.Key, string(content)
+}
+
+func TestRestore(t *testing.T) {
+	service := newTestService(t, 0, 0)
+	save(t, service, "pipeline-1", "go-linux-aaa", "old modules")
+	save(t, service, "pipeline-1", "go-linux-bbb", "new modules")
+	save(t, service, "pipeline-2", "go-linux-ccc", "other pipeline")
+
+	examples := []struct {
+		name        string
+		key         string
+		restoreKeys []string
+		restored    string
+		content     string
+	}{
+		{name: "exact key", key: "go-linux-aaa", restoreKeys: []string{"go-"}, restored: "go-linux-aaa", content: "old modules"},
+		{name: "most recent entry of a restore key", key: "go-linux-ddd", restoreKeys: []string{"go-linux-"}, restored: "go-linux-bbb", content: "new modules"},
+		{name: "restore keys in order", key: "go-linux-ddd", restoreKeys: []string{"go-windows-", "go-linux-a"}, restored: "go-linux-aaa", content: "old modules"},
+		{name: "miss", key: "go-linux-ccc", restoreKeys: []string{"node-"}},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			restored, content := restore(t, service, "pipeline-1", example.key, example.restoreKeys...)
+			assert.Equal(t, example.restored, restored)
+			assert.Equal(t, example.content, content)
+		})
+	}
+}
+
+func TestRestoreMetrics(t *testing.T) {
+	service := newTestService(t, 0, 0)
+	save(t, service, "pipeline-1", "go-aaa", "modules")
+	hits := testutil.ToFloat64(Lookups.WithLabelValues(resultHit))
+	partials := testutil.ToFloat64(Lookups.WithLabelValues(resultPartial))
+	misses := testutil.ToFloat64(Lookups.WithLabelValues(resultMiss))
+
+	restore(t, service, "pipeline-1", "go-aaa")
+	restore(t, service, "pipeline-1", "go-bbb", "go-")
+	restore(t, service, "pipeline-1", "node-aaa")
+	restore(t, service, "pipeline-1", "node-bbb", "node-")
+	assert.Equal(t, hits+1, testutil.ToFloat64(Lookups.WithLabelValues(resultHit)))
+	assert.Equal(t, partials+1, testutil.ToFloat64(Lookups.WithLabelValues(resultPartial)))
+	assert.Equal(t, misses+2, testutil.ToFloat64(Lookups.WithLabelValues(resultMiss)))
+}
+
+func TestSaveKeepsExistingEntries(t *testing.T) {
+	service := newTestService(t, 0, 0)
+	save(t, service, "pipeline-1", "go-aaa", "first")
+	entry, created, err := service.Save(context.Background(), "pipeline-1", "go-aaa", strings.NewReader("second"), "")
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, int64(5), entry.Size)
+	_, content := restore(t, service, "pipeline-1", "go-aaa")
+	assert.Equal(t, "first", content)
+}
+
+func TestSaveRejections(t *testing.T) {
+	service := newTestService(t, 10, 0)
+	_, _, err := service.Save(context.Background(), "pipeline-1", "go-aaa", strings.NewReader("more than ten bytes"), "")
+	assert.ErrorIs(t, err, ErrTooLarge)
+	_, _, err = service.Save(context.Background(), "pipeline-1", "go-aaa", strings.NewReader("modules"), "0000")
+	assert.ErrorIs(t, err, ErrInvalidEntry)
+	_, _, err = service.Save(context.Background(), "pipeline-1", "", strings.NewReader("modules"), "")
+	assert.ErrorIs(t, err, ErrInvalidEntry)
+	entries, err := service.List(context.Background(), "pipeline-1")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestSaveEvictsLeastRecentlyUsed(t *testing.T) {
+	service := newTestService(t, 0, 20)
+	evictions := testutil.ToFloat64(Evictions)
+	save(t, service, "pipeline-1", "a", "0123456789")
+	save(t, service, "pipeline-1", "b", "0123456789")
+	save(t, service, "pipeline-2", "c", "0123456789")
+	// a is now more recently used than b
+	restore(t, service, "pipeline-1", "a")
+
+	save(t, service, "pipeline-1", "d", "01234")
+	entries, err := service.List(context.Background(), "pipeline-1")
+	require.NoError(t, err)
+	keys := []string{}
+	for _, entry := range entries {
+		keys = append(keys, entry.Key)
+	}
+	assert.Equal(t, []string{"d", "a"}, keys)
+	assert.Equal(t, evictions+1, testutil.ToFloat64(Evictions))
+	_, err = service.blobs.Open(context.Background(), blobKey("pipeline-1", "b"))
+	assert.ErrorIs(t, err, artifacts.ErrNotFound)
+
+	others, err := service.List(context.Background(), "pipeline-2")
+	require.NoError(t, err)
+	assert.Len(t, others, 1, "pipelines have their own limit")
+}
+
+func TestDelete(t *testing.T) {
+	service := newTestService(t, 0, 0)
+	save(t, service, "pipeline-1", "go-aaa", "modules")
+	require.NoError(t, service.Delete(context.Background(), "pipeline-1", "go-aaa"))
+	restored, _ := restore(t, service, "pipeline-1", "go-aaa")
+	assert.Empty(t, restored)
+	assert.ErrorIs(t, service.Delete(context.Background(), "pipeline-1", "go-aaa"), store.ErrNotFound)
+}
@@ -0,0 +1,54 @@
+package githubclient
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/google/go-github/v56/github"
+)
+
+/*
+Tell whether an error comes from calling GitHub, and the status GitHub answered with.
+
+[IN] err: error returned by the GitHub service
+
+[OUT] int: HTTP status of the GitHub response; zero when GitHub could not be reached
+
+[OUT] bool: false when the error happened before calling GitHub, e.g. for an invalid URL
+*/
+func ResponseStatus(err error) (int, bool) {
+	var responseErr *github.ErrorResponse
+	if errors.As(err, &responseErr) && responseErr.Response != nil {
+		return responseErr.Response.StatusCode, true
+	}
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) && rateLimitErr.Response != nil {
+		return rateLimitErr.Response.StatusCode, true
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) && abuseErr.Response != nil {
+		return abuseErr.Response.StatusCode, true
+	}
+	var transportErr *url.Error
+	if errors.As(err, &transportErr) {
+		return 0, true
+	}
+	return 0, false
+}
+
+// How long until GitHub accepts requests again when an error is a rate limit; zero when GitHub did not tell
+func RetryAfter(err error, now time.Time) (time.Duration, bool) {
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return max(rateLimitErr.Rate.Reset.Time.Sub(now), 0), true
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if abuseErr.RetryAfter == nil {
+			return 0, true
+		}
+		return *abuseErr.RetryAfter, true
+	}
+	return 0, false
+}
@@ -0,0 +1,90 @@
+package githubclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseStatus(t *testing.T) {
+	examples := []struct {
+		name     string
+		err      error
+		status   int
+		upstream bool
+	}{
+		{
+			name:     "error response",
+			err:      fmt.Errorf("Failed to get file: %w", &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}}),
+			status:   http.StatusNotFound,
+			upstream: true,
+		},
+		{
+			name:     "rate limit",
+			err:      &github.RateLimitError{Response: &http.Response{StatusCode: http.StatusForbidden}},
+			status:   http.StatusForbidden,
+			upstream: true,
+		},
+		{
+			name:     "unreachable",
+			err:      &url.Error{Op: "Get", URL: "https://api.github.com", Err: fmt.Errorf("connection refused")},
+			upstream: true,
+		},
+		{
+			name: "invalid url",
+			err:  fmt.Errorf("Invalid repository URL"),
+		},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			status, upstream := ResponseStatus(example.err)
+			assert.Equal(t, example.status, status)
+			assert.Equal(t, example.upstream, upstream)
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	wait := 30 * time.Second
+	examples := []struct {
+		name    string
+		err     error
+		wait    time.Duration
+		limited bool
+	}{
+		{
+			name:    "rate limit",
+			err:     &github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: now.Add(time.Minute)}}},
+			wait:    time.Minute,
+			limited: true,
+		},
+		{
+			name:    "rate limit already reset",
+			err:     &github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: now.Add(-time.Minute)}}},
+			limited: true,
+		},
+		{
+			name:    "secondary rate limit",
+			err:     &github.AbuseRateLimitError{RetryAfter: &wait},
+			wait:    wait,
+			limited: true,
+		},
+		{
+			name: "other error",
+			err:  &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}},
+		},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			wait, limited := RetryAfter(example.err, now)
+			assert.Equal(t, example.wait, wait)
+			assert.Equal(t, example.limited, limited)
+		})
+	}
+}
@@ -3,12 +3,18 @@ package githubclient
 import (
 	"context"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
 
 	"api/logger"
 
 	"github.com/google/go-github/v56/github"
 )
 
+const publicGithubURL string = "https://github.com"
+
 type GithubClient struct {
 	client *github.Client
 }
@@ -61,6 +67,57 @@ func (Obj GithubClient) CreateCommit(ctx context.Context, owner string, repo str
 	return Obj.client.Git.CreateCommit(ctx, owner, repo, commit, opts)
 }
 
+func (Obj GithubClient) GetArchiveLink(ctx context.Context, owner string, repo string, archiveFormat github.ArchiveFormat, opts *github.RepositoryContentGetOptions, maxRedirects int) (*url.URL, *github.Response, error) {
+	return Obj.client.Repositories.GetArchiveLink(ctx, owner, repo, archiveFormat, opts, maxRedirects)
+}
+
+func (Obj GithubClient) CompareCommits(ctx context.Context, owner string, repo string, base string, head string, opts *github.ListOptions) (*github.CommitsComparison, *github.Response, error) {
+	return Obj.client.Repositories.CompareCommits(ctx, owner, repo, base, head, opts)
+}
+
+func (Obj GithubClient) CreateStatus(ctx context.Context, owner string, repo string, ref string, status *github.RepoStatus) (*github.RepoStatus, *github.Response, error) {
+	return Obj.client.Repositories.CreateStatus(ctx, owner, repo, ref, status)
+}
+
+func (Obj GithubClient) CreateCheckRun(ctx context.Context, owner string, repo string, opts github.CreateCheckRunOptions) (*github.CheckRun, *github.Response, error) {
+	return Obj.client.Checks.CreateCheckRun(ctx, owner, repo, opts)
+}
+
+func (Obj GithubClient) ListPullRequests(ctx context.Context, owner string, repo string, opts *github.PullRequestListOptions) ([]*github.PullRequest, *github.Response, error) {
+	return Obj.client.PullRequests.List(ctx, owner, repo, opts)
+}
+
+func (Obj GithubClient) ListIssueComments(ctx context.Context, owner string, repo string, number int, opts *github.IssueListCommentsOptions) ([]*github.IssueComment, *github.Response, error) {
+	return Obj.client.Issues.ListComments(ctx, owner, repo, number, opts)
+}
+
+func (Obj GithubClient) CreateIssueComment(ctx context.Context, owner string, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+	return Obj.client.Issues.CreateComment(ctx, owner, repo, number, comment)
+}
+
+func (Obj GithubClient) EditIssueComment(ctx context.Context, owner string, repo string, commentID int64, comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+	return Obj.client.Issues.EditComment(ctx, owner, repo, commentID, comment)
+}
+
+// Download the contents behind a link returned by the API, such as an archive link
+func (Obj GithubClient) Download(ctx context.Context, link *url.URL) (io.ReadCloser, error) {
+	// archive links embed a short-lived token in the query, keep it out of errors
+	location := link.Host + link.Path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create download request: %w", err)
+	}
+	resp, err := Obj.client.Client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to download %s: %w", location, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status downloading %s: %s", location, resp.Status)
+	}
+	return resp.Body, nil
+}
+
 // Function Description: create an authenticated client to the provided Github base URL
 // [IN]: ctx; context
 // [IN]: baseGithubURL; the base URL for the github repo; ex: "https://github.tmc-stargate.com/"
@@ -71,9 +128,14 @@ func createClient(ctx context.Context, baseGithubURL string, token string) (*Git
 	log := logger.FromContext(ctx)
 	log.Debug("Creating github client")
 
-	client, err := github.NewClient(nil).WithAuthToken(token).WithEnterpriseURLs(baseGithubURL, baseGithubURL)
-	if err != nil {
-		return nil, fmt.Errorf("unable to create authenticated github client: %w", err)
+	client := github.NewClient(nil).WithAuthToken(token)
+	// github.com is served by the default API URL, enterprise hosts expose it under /api/v3
+	if baseGithubURL != "" && strings.TrimSuffix(baseGithubURL, "/") != publicGithubURL {
+		var err error
+		client, err = client.WithEnterpriseURLs(baseGithubURL, baseGithubURL)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create authenticated github client: %w", err)
+		}
 	}
 
 	//check the github APIs rate limits for the authenticated user
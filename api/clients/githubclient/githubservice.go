@@ -4,7 +4,10 @@ package githubclient
 import (
 	"context"
 	"fmt"
+	"io"
+	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -24,6 +27,10 @@ const (
 	typeBlob   string = "blob"
 	typeTree   string = "tree"
 	typeCommit string = "commit"
+	// GitHub rejects longer commit status descriptions
+	maxStatusDescription int = 140
+	// GitHub rejects longer check run summaries
+	maxCheckSummary int = 65535
 )
 
 // Function Description: parse the provided file URL and return the required info
@@ -84,6 +91,15 @@ type githubClient interface {
 	CreateTree(ctx context.Context, owner string, repo string, baseTree string, entries []*github.TreeEntry) (*github.Tree, *github.Response, error)
 	UpdateRef(ctx context.Context, owner string, repo string, ref *github.Reference, force bool) (*github.Reference, *github.Response, error)
 	CreateCommit(ctx context.Context, owner string, repo string, commit *github.Commit, opts *github.CreateCommitOptions) (*github.Commit, *github.Response, error)
+	GetArchiveLink(ctx context.Context, owner string, repo string, archiveFormat github.ArchiveFormat, opts *github.RepositoryContentGetOptions, maxRedirects int) (*url.URL, *github.Response, error)
+	CompareCommits(ctx context.Context, owner string, repo string, base string, head string, opts *github.ListOptions) (*github.CommitsComparison, *github.Response, error)
+	CreateStatus(ctx context.Context, owner string, repo string, ref string, status *github.RepoStatus) (*github.RepoStatus, *github.Response, error)
+	CreateCheckRun(ctx context.Context, owner string, repo string, opts github.CreateCheckRunOptions) (*github.CheckRun, *github.Response, error)
+	ListPullRequests(ctx context.Context, owner string, repo string, opts *github.PullRequestListOptions) ([]*github.PullRequest, *github.Response, error)
+	ListIssueComments(ctx context.Context, owner string, repo string, number int, opts *github.IssueListCommentsOptions) ([]*github.IssueComment, *github.Response, error)
+	CreateIssueComment(ctx context.Context, owner string, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error)
+	EditIssueComment(ctx context.Context, owner string, repo string, commentID int64, comment *github.IssueComment) (*github.IssueComment, *github.Response, error)
+	Download(ctx context.Context, link *url.URL) (io.ReadCloser, error)
 }
 
 // Publicly exposed struct
@@ -156,6 +172,108 @@ func (s *GithubService) CommitMultipleFilesToBranch(ctx context.Context, repoUrl
 	return commitMultipleFilesToBranch(ctx, s.client, repoUrl, branchName, commitMessage, fileChanges, filesToDelete)
 }
 
+// Function Description: list the entries of a directory in the repository
+// [IN]: ctx; context
+// [IN]: repoUrl; the target repo URL
+// example for the repoUrl: // "https://github.com/owner/repository-name"
+// [IN]: ref; the branch, tag or commit SHA to read from
+// [IN]: path; the directory path inside the repo; empty for the repository root
+// [RETURN]: []DirectoryEntry; the entries found in the directory
+// [RETURN]: error; for error propagation
+func (s *GithubService) ListDirectory(ctx context.Context, repoURL, ref, path string) ([]DirectoryEntry, error) {
+	return listDirectory(ctx, s.client, repoURL, ref, path)
+}
+
+// Function Description: download a gzipped tarball of the repository at the given ref
+// [IN]: ctx; context
+// [IN]: repoUrl; the target repo URL
+// example for the repoUrl: // "https://github.com/owner/repository-name"
+// [IN]: ref; the branch, tag or commit SHA to archive
+// [RETURN]: io.ReadCloser; the tar.gz stream, which the caller must close
+// [RETURN]: error; for error propagation
+func (s *GithubService) DownloadArchive(ctx context.Context, repoURL, ref string) (io.ReadCloser, error) {
+	return downloadArchive(ctx, s.client, repoURL, ref)
+}
+
+// Function Description: get the full recursive tree of a commit
+// [IN]: ctx; context
+// [IN]: repoUrl; the target repo URL
+// example for the repoUrl: // "https://github.com/owner/repository-name"
+// [IN]: commitSHA; the commit to read the tree from
+// [RETURN]: *CommitTree; every entry of the commit tree
+// [RETURN]: error; for error propagation
+func (s *GithubService) GetCommitTree(ctx context.Context, repoURL, commitSHA string) (*CommitTree, error) {
+	return getCommitTree(ctx, s.client, repoURL, commitSHA)
+}
+
+// Function Description: get the raw contents of a blob
+// [IN]: ctx; context
+// [IN]: repoUrl; the target repo URL
+// example for the repoUrl: // "https://github.com/owner/repository-name"
+// [IN]: blobSHA; the SHA of the blob
+// [RETURN]: []byte; the blob contents
+// [RETURN]: error; for error propagation
+func (s *GithubService) GetBlob(ctx context.Context, repoURL, blobSHA string) ([]byte, error) {
+	return getBlob(ctx, s.client, repoURL, blobSHA)
+}
+
+// Function Description: compare two refs of a repository
+// [IN]: ctx; context
+// [IN]: repoUrl; the target repo URL
+// example for the repoUrl: // "https://github.com/owner/repository-name"
+// [IN]: base; the branch, tag or commit SHA to compare from
+// [IN]: head; the branch, tag or commit SHA to compare to
+// [RETURN]: *RefComparison; the changed files between the two refs
+// [RETURN]: error; for error propagation
+func (s *GithubService) CompareRefs(ctx context.Context, repoURL, base, head string) (*RefComparison, error) {
+	return compareRefs(ctx, s.client, repoURL, base, head)
+}
+
+// Function Description: report a status on a commit
+// [IN]: ctx; context
+// [IN]: repoUrl; the target repo URL
+// example for the repoUrl: // "https://github.com/owner/repository-name"
+// [IN]: sha; the commit SHA
+// [IN]: status; the state, context and description of the status
+// [RETURN]: error; for error propagation
+func (s *GithubService) SetCommitStatus(ctx context.Context, repoURL, sha string, status CommitStatus) error {
+	return setCommitStatus(ctx, s.client, repoURL, sha, status)
+}
+
+// Function Description: report a completed check run on a commit
+// [IN]: ctx; context
+// [IN]: repoUrl; the target repo URL
+// example for the repoUrl: // "https://github.com/owner/repository-name"
+// [IN]: sha; the commit SHA
+// [IN]: check; the name, conclusion and summary of the check run
+// [RETURN]: error; for error propagation
+func (s *GithubService) CreateCheckRun(ctx context.Context, repoURL, sha string, check CheckRun) error {
+	return createCheckRun(ctx, s.client, repoURL, sha, check)
+}
+
+// Function Description: list the open pull requests of a branch
+// [IN]: ctx; context
+// [IN]: repoUrl; the target repo URL
+// example for the repoUrl: // "https://github.com/owner/repository-name"
+// [IN]: branch; the head branch of the pull requests
+// [RETURN]: []PullRequest; the open pull requests
+// [RETURN]: error; for error propagation
+func (s *GithubService) ListPullRequests(ctx context.Context, repoURL, branch string) ([]PullRequest, error) {
+	return listPullRequests(ctx, s.client, repoURL, branch)
+}
+
+// Function Description: create a pull request comment, or update the one holding the marker
+// [IN]: ctx; context
+// [IN]: repoUrl; the target repo URL
+// example for the repoUrl: // "https://github.com/owner/repository-name"
+// [IN]: number; the pull request number
+// [IN]: marker; hidden text telling the comment apart from the others, e.g. <!-- aeternum-coverage -->
+// [IN]: body; markdown body of the comment
+// [RETURN]: error; for error propagation
+func (s *GithubService) UpsertComment(ctx context.Context, repoURL string, number int, marker, body string) error {
+	return upsertComment(ctx, s.client, repoURL, number, marker, body)
+}
+
 // Returns a factory of GithubServices
 // This one is mostly used for tests, where we can customize the client
 type GithubServiceFactory func(ctx context.Context, token string, baseUrl string) (*GithubService, error)
@@ -269,6 +387,9 @@ func getFileLatest(ctx context.Context, githubClient githubClient, repoURL, file
 	if err != nil {
 		return "", fmt.Errorf("unable to get the file contents: %w", err)
 	}
+	if fileContent == nil {
+		return "", fmt.Errorf("the path %s is a directory, not a file", filePath)
+	}
 
 	content, err := fileContent.GetContent()
 	if err != nil {
@@ -279,6 +400,245 @@ func getFileLatest(ctx context.Context, githubClient githubClient, repoURL, file
 
 }
 
+// Function Description: list the entries of a directory in the repository
+// [IN]: ctx; context
+// [IN]: githubClient; an authenticated github client
+// [IN]: repoUrl; the target repo URL
+// [IN]: ref; the branch, tag or commit SHA to read from
+// [IN]: path; the directory path inside the repo
+// [RETURN]: []DirectoryEntry; the entries found in the directory
+// [RETURN]: error; for error propagation
+func listDirectory(ctx context.Context, githubClient githubClient, repoURL, ref, path string) ([]DirectoryEntry, error) {
+	log := logger.FromContext(ctx)
+
+	repoOwner, repo, _, err := parseRepoURL(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the URL: %w", err)
+	}
+
+	fileContent, directoryContent, _, err := githubClient.GetContents(ctx, repoOwner, repo, path, &github.RepositoryContentGetOptions{
+		Ref: ref,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the directory contents: %w", err)
+	}
+	if fileContent != nil {
+		return nil, fmt.Errorf("the path %s is a file, not a directory", path)
+	}
+	log.Debugf("Listed %d entries in %s/%s:%s@%s", len(directoryContent), repoOwner, repo, path, ref)
+
+	entries := make([]DirectoryEntry, 0, len(directoryContent))
+	for _, content := range directoryContent {
+		entries = append(entries, DirectoryEntry{
+			Name: content.GetName(),
+			Path: content.GetPath(),
+			Type: getEntryType(content),
+			Size: content.GetSize(),
+			SHA:  content.GetSHA(),
+		})
+	}
+	return entries, nil
+}
+
+// Directory listings report submodules as files for backwards compatibility;
+// they are told apart by their git URL pointing at a tree instead of a blob.
+func getEntryType(content *github.RepositoryContent) EntryType {
+	switch content.GetType() {
+	case string(EntryTypeDir):
+		return EntryTypeDir
+	case string(EntryTypeSymlink):
+		return EntryTypeSymlink
+	case string(EntryTypeSubmodule):
+		return EntryTypeSubmodule
+	}
+	if content.GetDownloadURL() == "" && strings.Contains(content.GetGitURL(), "/git/trees/") {
+		return EntryTypeSubmodule
+	}
+	return EntryTypeFile
+}
+
+// Function Description: get the full recursive tree of a commit
+// [IN]: ctx; context
+// [IN]: githubClient; an authenticated github client
+// [IN]: repoUrl; the target repo URL
+// [IN]: commitSHA; the commit to read the tree from
+// [RETURN]: *CommitTree; every entry of the commit tree
+// [RETURN]: error; for error propagation
+func getCommitTree(ctx context.Context, githubClient githubClient, repoURL, commitSHA string) (*CommitTree, error) {
+	log := logger.FromContext(ctx)
+
+	repoOwner, repo, _, err := parseRepoURL(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the URL: %w", err)
+	}
+
+	commit, _, err := githubClient.GetCommit(ctx, repoOwner, repo, commitSHA)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the commit %s: %w", commitSHA, err)
+	}
+	treeSHA := commit.GetTree().GetSHA()
+
+	tree, _, err := githubClient.GetTree(ctx, repoOwner, repo, treeSHA, true)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the commit tree: %w", err)
+	}
+	log.Debugf("Tree %s of commit %s has %d entries", treeSHA, commitSHA, len(tree.Entries))
+
+	commitTree := &CommitTree{
+		CommitSHA: commitSHA,
+		TreeSHA:   treeSHA,
+		Entries:   make([]TreeEntry, 0, len(tree.Entries)),
+		Truncated: tree.GetTruncated(),
+	}
+	for _, entry := range tree.Entries {
+		commitTree.Entries = append(commitTree.Entries, TreeEntry{
+			Path: entry.GetPath(),
+			Mode: entry.GetMode(),
+			Type: getTreeEntryType(entry),
+			Size: entry.GetSize(),
+			SHA:  entry.GetSHA(),
+		})
+	}
+	return commitTree, nil
+}
+
+func getTreeEntryType(entry *github.TreeEntry) EntryType {
+	switch entry.GetType() {
+	case typeTree:
+		return EntryTypeDir
+	case typeCommit:
+		return EntryTypeSubmodule
+	}
+	if entry.GetMode() == modeSymlinkPath {
+		return EntryTypeSymlink
+	}
+	return EntryTypeFile
+}
+
+// Function Description: get the raw contents of a blob
+// [IN]: ctx; context
+// [IN]: githubClient; an authenticated github client
+// [IN]: repoUrl; the target repo URL
+// [IN]: blobSHA; the SHA of the blob
+// [RETURN]: []byte; the blob contents
+// [RETURN]: error; for error propagation
+func getBlob(ctx context.Context, githubClient githubClient, repoURL, blobSHA string) ([]byte, error) {
+	repoOwner, repo, _, err := parseRepoURL(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the URL: %w", err)
+	}
+
+	contents, _, err := githubClient.GetBlobRaw(ctx, repoOwner, repo, blobSHA)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the blob %s: %w", blobSHA, err)
+	}
+	return contents, nil
+}
+
+// Function Description: compare two refs of a repository
+// [IN]: ctx; context
+// [IN]: githubClient; an authenticated github client
+// [IN]: repoUrl; the target repo URL
+// [IN]: base; the branch, tag or commit SHA to compare from
+// [IN]: head; the branch, tag or commit SHA to compare to
+// [RETURN]: *RefComparison; the changed files between the two refs
+// [RETURN]: error; for error propagation
+func compareRefs(ctx context.Context, githubClient githubClient, repoURL, base, head string) (*RefComparison, error) {
+	log := logger.FromContext(ctx)
+
+	repoOwner, repo, _, err := parseRepoURL(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the URL: %w", err)
+	}
+
+	// GitHub only returns the changed files (up to 300) along with the first page of commits
+	comparison, _, err := githubClient.CompareCommits(ctx, repoOwner, repo, base, head, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return nil, fmt.Errorf("unable to compare %s...%s: %w", base, head, err)
+	}
+	log.Debugf("Comparison %s...%s on %s/%s changed %d files", base, head, repoOwner, repo, len(comparison.Files))
+
+	result := &RefComparison{
+		Base:         base,
+		Head:         head,
+		BaseSHA:      comparison.GetBaseCommit().GetSHA(),
+		MergeBaseSHA: comparison.GetMergeBaseCommit().GetSHA(),
+		Status:       comparison.GetStatus(),
+		AheadBy:      comparison.GetAheadBy(),
+		BehindBy:     comparison.GetBehindBy(),
+		Files:        make([]ChangedFile, 0, len(comparison.Files)),
+	}
+	result.HeadSHA, err = getComparisonHeadSHA(ctx, githubClient, repoOwner, repo, comparison, base, head)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range comparison.Files {
+		result.Files = append(result.Files, ChangedFile{
+			Filename:         file.GetFilename(),
+			PreviousFilename: file.GetPreviousFilename(),
+			Status:           FileStatus(file.GetStatus()),
+			Additions:        file.GetAdditions(),
+			Deletions:        file.GetDeletions(),
+			Patch:            file.GetPatch(),
+		})
+	}
+	return result, nil
+}
+
+// Commits are listed oldest first, so the head commit is the last one of the last page
+func getComparisonHeadSHA(ctx context.Context, githubClient githubClient, repoOwner, repo string, comparison *github.CommitsComparison, base, head string) (string, error) {
+	if len(comparison.Commits) == 0 {
+		// head has no commit missing from base, so it is their merge base: base itself when identical,
+		// an ancestor of base when behind
+		return comparison.GetMergeBaseCommit().GetSHA(), nil
+	}
+	if comparison.GetTotalCommits() <= len(comparison.Commits) {
+		return comparison.Commits[len(comparison.Commits)-1].GetSHA(), nil
+	}
+
+	perPage := len(comparison.Commits)
+	lastPage := (comparison.GetTotalCommits() + perPage - 1) / perPage
+	lastComparison, _, err := githubClient.CompareCommits(ctx, repoOwner, repo, base, head, &github.ListOptions{PerPage: perPage, Page: lastPage})
+	if err != nil {
+		return "", fmt.Errorf("unable to get the last page of %s...%s: %w", base, head, err)
+	}
+	if len(lastComparison.Commits) == 0 {
+		return "", fmt.Errorf("the last page of %s...%s has no commits", base, head)
+	}
+	return lastComparison.Commits[len(lastComparison.Commits)-1].GetSHA(), nil
+}
+
+// Function Description: download a gzipped tarball of the repository at the given ref
+// [IN]: ctx; context
+// [IN]: githubClient; an authenticated github client
+// [IN]: repoUrl; the target repo URL
+// [IN]: ref; the branch, tag or commit SHA to archive
+// [RETURN]: io.ReadCloser; the tar.gz stream, which the caller must close
+// [RETURN]: error; for error propagation
+func downloadArchive(ctx context.Context, githubClient githubClient, repoURL, ref string) (io.ReadCloser, error) {
+	log := logger.FromContext(ctx)
+
+	repoOwner, repo, _, err := parseRepoURL(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the URL: %w", err)
+	}
+
+	// the API answers with a redirect to a short-lived download link
+	archiveLink, _, err := githubClient.GetArchiveLink(ctx, repoOwner, repo, github.Tarball, &github.RepositoryContentGetOptions{
+		Ref: ref,
+	}, 1)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the archive link: %w", err)
+	}
+	log.Debugf("Downloading archive of %s/%s@%s", repoOwner, repo, ref)
+
+	archive, err := githubClient.Download(ctx, archiveLink)
+	if err != nil {
+		return nil, fmt.Errorf("unable to download the archive: %w", err)
+	}
+	return archive, nil
+}
+
 // Function Description: get the contents of the provided test case URL
 // [IN]: ctx; context
 // [IN]: githubClient; an authenticated github client
@@ -453,15 +813,22 @@ func commitMultipleFilesToBranch(ctx context.Context, githubClient githubClient,
 }
 
 // createTreeEntries creates an array of tree entries for file changes.
+// Changed files are sorted by path so the request body is deterministic.
 func createTreeEntries(fileChanges map[string]string, filesToDelete []string) []*github.TreeEntry {
 	entries := make([]*github.TreeEntry, 0)
 
-	for path, content := range fileChanges {
+	paths := make([]string, 0, len(fileChanges))
+	for path := range fileChanges {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
 		entries = append(entries, &github.TreeEntry{
 			Path:    github.String(path),
 			Mode:    github.String(modeFile),
 			Type:    github.String(typeBlob),
-			Content: github.String(content),
+			Content: github.String(fileChanges[path]),
 		})
 	}
 
@@ -476,3 +843,153 @@ func createTreeEntries(fileChanges map[string]string, filesToDelete []string) []
 
 	return entries
 }
+
+// Function Description: report a status on a commit
+// [IN]: ctx; context
+// [IN]: githubClient; an authenticated github client
+// [IN]: repoUrl; the target repo URL
+// [IN]: sha; the commit SHA
+// [IN]: status; the state, context and description of the status
+// [RETURN]: error; for error propagation
+func setCommitStatus(ctx context.Context, githubClient githubClient, repoURL, sha string, status CommitStatus) error {
+	repoOwner, repo, _, err := parseRepoURL(repoURL)
+	if err != nil {
+		return fmt.Errorf("unable to parse the URL: %w", err)
+	}
+	description := status.Description
+	if len(description) > maxStatusDescription {
+		description = description[:maxStatusDescription-3] + "..."
+	}
+	repoStatus := &github.RepoStatus{
+		State:       github.String(string(status.State)),
+		Context:     github.String(status.Context),
+		Description: github.String(description),
+	}
+	if status.TargetURL != "" {
+		repoStatus.TargetURL = github.String(status.TargetURL)
+	}
+	_, _, err = githubClient.CreateStatus(ctx, repoOwner, repo, sha, repoStatus)
+	if err != nil {
+		return fmt.Errorf("unable to set the %s status of %s: %w", status.Context, sha, err)
+	}
+	logger.FromContext(ctx).Debugf("Set the %s status of %s/%s@%s to %s", status.Context, repoOwner, repo, sha, status.State)
+	return nil
+}
+
+// Function Description: report a completed check run on a commit
+// [IN]: ctx; context
+// [IN]: githubClient; an authenticated github client
+// [IN]: repoUrl; the target repo URL
+// [IN]: sha; the commit SHA
+// [IN]: check; the name, conclusion and summary of the check run
+// [RETURN]: error; for error propagation
+func createCheckRun(ctx context.Context, githubClient githubClient, repoURL, sha string, check CheckRun) error {
+	repoOwner, repo, _, err := parseRepoURL(repoURL)
+	if err != nil {
+		return fmt.Errorf("unable to parse the URL: %w", err)
+	}
+	summary := check.Summary
+	if len(summary) > maxCheckSummary {
+		summary = summary[:maxCheckSummary-3] + "..."
+	}
+	opts := github.CreateCheckRunOptions{
+		Name:        check.Name,
+		HeadSHA:     sha,
+		Conclusion:  github.String(string(check.Conclusion)),
+		CompletedAt: &github.Timestamp{Time: check.CompletedAt},
+		Output: &github.CheckRunOutput{
+			Title:   github.String(check.Title),
+			Summary: github.String(summary),
+		},
+	}
+	if check.DetailsURL != "" {
+		opts.DetailsURL = github.String(check.DetailsURL)
+	}
+	_, _, err = githubClient.CreateCheckRun(ctx, repoOwner, repo, opts)
+	if err != nil {
+		return fmt.Errorf("unable to create the %s check run of %s: %w", check.Name, sha, err)
+	}
+	logger.FromContext(ctx).Debugf("Created the %s check run of %s/%s@%s: %s", check.Name, repoOwner, repo, sha, check.Conclusion)
+	return nil
+}
+
+// Function Description: list the open pull requests of a branch
+// [IN]: ctx; context
+// [IN]: githubClient; an authenticated github client
+// [IN]: repoUrl; the target repo URL
+// [IN]: branch; the head branch of the pull requests
+// [RETURN]: []PullRequest; the open pull requests
+// [RETURN]: error; for error propagation
+func listPullRequests(ctx context.Context, githubClient githubClient, repoURL, branch string) ([]PullRequest, error) {
+	repoOwner, repo, _, err := parseRepoURL(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the URL: %w", err)
+	}
+	requestOptions := &github.PullRequestListOptions{
+		State:       "open",
+		Head:        repoOwner + ":" + branch,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	pullRequests, _, err := githubClient.ListPullRequests(ctx, repoOwner, repo, requestOptions)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the pull requests of %s: %w", branch, err)
+	}
+	pullRequestList := []PullRequest{}
+	for _, pullRequest := range pullRequests {
+		pullRequestList = append(pullRequestList, PullRequest{
+			Number:     pullRequest.GetNumber(),
+			Title:      pullRequest.GetTitle(),
+			HeadBranch: pullRequest.GetHead().GetRef(),
+			HeadSha:    pullRequest.GetHead().GetSHA(),
+			BaseBranch: pullRequest.GetBase().GetRef(),
+		})
+	}
+	logger.FromContext(ctx).Debugf("Found %d open pull requests of %s/%s:%s", len(pullRequestList), repoOwner, repo, branch)
+	return pullRequestList, nil
+}
+
+// Function Description: create a pull request comment, or update the one holding the marker
+// [IN]: ctx; context
+// [IN]: githubClient; an authenticated github client
+// [IN]: repoUrl; the target repo URL
+// [IN]: number; the pull request number
+// [IN]: marker; hidden text telling the comment apart from the others
+// [IN]: body; markdown body of the comment
+// [RETURN]: error; for error propagation
+func upsertComment(ctx context.Context, githubClient githubClient, repoURL string, number int, marker, body string) error {
+	repoOwner, repo, _, err := parseRepoURL(repoURL)
+	if err != nil {
+		return fmt.Errorf("unable to parse the URL: %w", err)
+	}
+	comment := &github.IssueComment{Body: github.String(marker + "\n" + body)}
+	requestOptions := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		comments, response, err := githubClient.ListIssueComments(ctx, repoOwner, repo, number, requestOptions)
+		if err != nil {
+			return fmt.Errorf("unable to list the comments of pull request %d: %w", number, err)
+		}
+		for _, existing := range comments {
+			if !strings.Contains(existing.GetBody(), marker) {
+				continue
+			}
+			_, _, err = githubClient.EditIssueComment(ctx, repoOwner, repo, existing.GetID(), comment)
+			if err != nil {
+				return fmt.Errorf("unable to update comment %d of pull request %d: %w", existing.GetID(), number, err)
+			}
+			logger.FromContext(ctx).Debugf("Updated comment %d of %s/%s#%d", existing.GetID(), repoOwner, repo, number)
+			return nil
+		}
+		if response.NextPage == 0 {
+			break
+		}
+		requestOptions.Page = response.NextPage
+	}
+	_, _, err = githubClient.CreateIssueComment(ctx, repoOwner, repo, number, comment)
+	if err != nil {
+		return fmt.Errorf("unable to comment on pull request %d: %w", number, err)
+	}
+	logger.FromContext(ctx).Debugf("Commented on %s/%s#%d", repoOwner, repo, number)
+	return nil
+}
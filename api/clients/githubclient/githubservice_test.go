@@ -1,316 +1,406 @@
 package githubclient
 
 import (
+	"archive/tar"
+	"compress/gzip"
 	"context"
-	"encoding/base64"
 	"fmt"
+	"io"
+	"path/filepath"
 	"testing"
+	"time"
 
-	mock_githubclient "api/clients/githubclient/mock"
+	"api/clients/githubclient/recorder"
+	"api/config"
+	"api/env"
 
-	"github.com/golang/mock/gomock"
 	"github.com/google/go-github/v56/github"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestGetFile(t *testing.T) {
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
+// Create a github client backed by the named cassette under testdata/cassettes.
+// The cassettes are synthetic fixtures written by hand, see the README there.
+// Run the tests with AETERNUM_RECORD_CASSETTES=true and a valid
+// AETERNUM_GITHUB_TOKEN to capture real payloads instead.
+func newReplayClient(t *testing.T, cassette string) *GithubClient {
+	mode := recorder.ModeFromEnv()
+	rec, err := recorder.New(filepath.Join("testdata", "cassettes", cassette+".json"), mode, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, rec.Stop())
+	})
+
+	client := github.NewClient(rec.Client())
+	if mode == recorder.ModeRecord {
+		client = client.WithAuthToken(env.GetEnvWithDefault(config.EnvVarGithubToken, ""))
+	}
+	return &GithubClient{client: client}
+}
 
-	// Create a mock
-	mockGithubClient := mock_githubclient.NewMockgithubClient(ctrl)
+func TestGetFile(t *testing.T) {
+	githubClient := newReplayClient(t, "get_file")
 
 	fileURL := "https://github.com/api/v3/repos/some-user/my-project/git/blobs/90c519f0118369a331035cd20c559a0e477384cb"
-	owner := "some-user"
-	repo := "my-project"
 	sha := "90c519f0118369a331035cd20c559a0e477384cb" // pragma: allowlist secret
 
-	// Set up expectations for the mock client
-	mockGithubClient.EXPECT().
-		GetBlobRaw(gomock.Any(), owner, repo, sha).
-		Return([]byte("this is the file content"), nil, nil)
-	// Define the expected content
-	expectedContent := "this is the file content"
-
 	ctx := context.Background()
-	content, sha2, _ := getFile(ctx, mockGithubClient, fileURL)
-	// Assert that the returned content matches the expected content
-	assert.Equal(t, expectedContent, content)
+	content, sha2, err := getFile(ctx, githubClient, fileURL)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "this is the file content", content)
 	assert.Equal(t, sha, sha2)
 }
 
 func TestGetFileLatest(t *testing.T) {
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
+	githubClient := newReplayClient(t, "get_file_latest")
+
+	repoUrl := "https://github.com/some-user/my-project"
+	path := ".aeternum/pipeline.yaml"
+	expectedContent := "name: build\njobs:\n  test:\n    steps:\n      - run: go test ./...\n"
+
+	ctx := context.Background()
+	content, err := getFileLatest(ctx, githubClient, repoUrl, path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, expectedContent, content)
+}
 
-	// Create a mock
-	mockGithubClient := mock_githubclient.NewMockgithubClient(ctrl)
+func TestGetFileLatestOnDirectory(t *testing.T) {
+	githubClient := newReplayClient(t, "list_directory")
 
 	repoUrl := "https://github.com/some-user/my-project"
-	owner := "some-user"
-	repo := "my-project"
-	path := "/.woven/part_definitions.json"
-
-	// Set up expectations for the mock client
-
-	fileContent := github.RepositoryContent{
-		Type:            new(string),
-		Target:          new(string),
-		Encoding:        new(string),
-		Size:            new(int),
-		Name:            new(string),
-		Path:            new(string),
-		Content:         new(string),
-		SHA:             new(string),
-		URL:             new(string),
-		GitURL:          new(string),
-		HTMLURL:         new(string),
-		DownloadURL:     new(string),
-		SubmoduleGitURL: new(string),
-	}
 
-	expectedContent := "this is test content"
-	contentDecoded := base64.StdEncoding.EncodeToString([]byte(expectedContent))
+	ctx := context.Background()
+	_, err := getFileLatest(ctx, githubClient, repoUrl, "api")
+
+	assert.ErrorContains(t, err, "is a directory")
+}
 
-	*fileContent.Type = "file"
-	*fileContent.Encoding = "base64"
-	*fileContent.Size = len(contentDecoded)
-	*fileContent.Name = "part_definition.json"
-	*fileContent.Content = string(contentDecoded)
+func TestListDirectory(t *testing.T) {
+	githubClient := newReplayClient(t, "list_directory")
 
-	mockGithubClient.EXPECT().
-		GetContents(gomock.Any(), owner, repo, path, gomock.Any()).
-		Return(&fileContent, nil, nil, nil)
+	repoUrl := "https://github.com/some-user/my-project"
 
 	ctx := context.Background()
-	content, _ := getFileLatest(ctx, mockGithubClient, repoUrl, path)
-	// Assert that the returned content matches the expected content
-	assert.Equal(t, expectedContent, content)
+	entries, err := listDirectory(ctx, githubClient, repoUrl, "main", "api")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []DirectoryEntry{
+		{Name: "cmd", Path: "api/cmd", Type: EntryTypeDir, Size: 0, SHA: "a4d5e6f7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3"},                     // pragma: allowlist secret
+		{Name: "go.mod", Path: "api/go.mod", Type: EntryTypeFile, Size: 1893, SHA: "b8f3c6a1d2e4f5061728394a5b6c7d8e9f0a1b2c"},           // pragma: allowlist secret
+		{Name: "latest", Path: "api/latest", Type: EntryTypeSymlink, Size: 6, SHA: "c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d0"},           // pragma: allowlist secret
+		{Name: "vendor-lib", Path: "api/vendor-lib", Type: EntryTypeSubmodule, Size: 0, SHA: "d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1"}, // pragma: allowlist secret
+	}, entries)
 }
 
-func TestGetDefaultBranchNameSuccess(t *testing.T) {
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
+func TestListDirectoryOnFile(t *testing.T) {
+	githubClient := newReplayClient(t, "list_directory_file")
+
+	repoUrl := "https://github.com/some-user/my-project"
+
+	ctx := context.Background()
+	_, err := listDirectory(ctx, githubClient, repoUrl, "main", "api/go.mod")
+
+	assert.ErrorContains(t, err, "is a file, not a directory")
+}
 
-	// Create a mock
-	mockGithubClient := mock_githubclient.NewMockgithubClient(ctrl)
+func TestDownloadArchive(t *testing.T) {
+	githubClient := newReplayClient(t, "download_archive")
 
 	repoUrl := "https://github.com/some-user/my-project"
-	owner := "some-user"
-	repo := "my-project"
-	branchName := "main"
+	sha := "0108e3c4f3100134a42fa333d103464498669ea5" // pragma: allowlist secret
 
-	repositoryContent := github.Repository{
-		DefaultBranch: &branchName,
+	ctx := context.Background()
+	archive, err := downloadArchive(ctx, githubClient, repoUrl, sha)
+	require.NoError(t, err)
+	defer archive.Close()
+
+	gzipReader, err := gzip.NewReader(archive)
+	require.NoError(t, err)
+	tarReader := tar.NewReader(gzipReader)
+
+	files := map[string]string{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if header.Typeflag == tar.TypeReg {
+			contents, _ := io.ReadAll(tarReader)
+			files[header.Name] = string(contents)
+		}
 	}
+	assert.Equal(t, map[string]string{
+		"some-user-my-project-0108e3c/README.md":  "# my-project\n",
+		"some-user-my-project-0108e3c/api/go.mod": "module api\n",
+	}, files)
+}
+
+func TestGetCommitTree(t *testing.T) {
+	githubClient := newReplayClient(t, "get_commit_tree")
 
-	mockGithubClient.EXPECT().
-		Get(gomock.Any(), owner, repo).
-		Return(&repositoryContent, nil, nil)
+	repoUrl := "https://github.com/some-user/my-project"
+	commitSHA := "0108e3c4f3100134a42fa333d103464498669ea5" // pragma: allowlist secret
 
 	ctx := context.Background()
-	actualBranchName, _ := getDefaultBranchName(ctx, mockGithubClient, repoUrl)
-	// Assert that the returned content matches the expected content
-	assert.Equal(t, actualBranchName, branchName)
+	tree, err := getCommitTree(ctx, githubClient, repoUrl, commitSHA)
+
+	require.NoError(t, err)
+	assert.Equal(t, commitSHA, tree.CommitSHA)
+	assert.Equal(t, "9fb037999f264ba9a7fc6274d15fa3ae2ab98312", tree.TreeSHA)
+	assert.False(t, tree.Truncated)
+
+	types := map[string]EntryType{}
+	for _, entry := range tree.Entries {
+		types[entry.Path] = entry.Type
+	}
+	assert.Equal(t, map[string]EntryType{
+		"README.md":        EntryTypeFile,
+		"scripts":          EntryTypeDir,
+		"scripts/build.sh": EntryTypeFile,
+		"scripts/latest":   EntryTypeSymlink,
+		"vendor-lib":       EntryTypeSubmodule,
+	}, types)
+	assert.True(t, tree.Entries[2].IsExecutable())
+	assert.False(t, tree.Entries[0].IsExecutable())
 }
 
-func TestCommitMultipleFilesToBranch(t *testing.T) {
-	t.Skip("Skipping testing in CI environment")
+func TestGetBlob(t *testing.T) {
+	githubClient := newReplayClient(t, "get_blob")
 
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
+	repoUrl := "https://github.com/some-user/my-project"
 
-	// Create a mock
-	mockGithubClient := mock_githubclient.NewMockgithubClient(ctrl)
+	ctx := context.Background()
+	contents, err := getBlob(ctx, githubClient, repoUrl, "1d3b9c1b1d8f2f5b0c4f3a4c0d5e6f7a8b9c0d1e")
 
-	owner := "some-user"
-	repo := "my-project"
-	branchRef := "refs/heads/branch-name"
-	latestCommitSHA := "0108e3c4f3100134a42fa333d103464498669ea5" // pragma: allowlist secret
-	baseTreeSha := "0108e3c4f3100134a42fa444d103464498669ea5"     // pragma: allowlist secret
-	newSha := "0108e3c4f3100134a42fa532d103464498669ea5"          // pragma: allowlist secret
-	updatedFilesTree := []*github.TreeEntry{
-		{
-			Path:    github.String("contents/fileC.txt"),
-			Mode:    github.String("100644"),
-			Type:    github.String("blob"),
-			Content: github.String("this is a test file#1"),
-		},
-		{
-			Path:    github.String("contents/fileD.txt"),
-			Mode:    github.String("100644"),
-			Type:    github.String("blob"),
-			Content: github.String("this is a test file#2"),
-		},
+	assert.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\ngo build ./...\n", string(contents))
+}
+
+func TestCompareRefs(t *testing.T) {
+	githubClient := newReplayClient(t, "compare_refs")
+
+	repoUrl := "https://github.com/some-user/my-project"
+
+	ctx := context.Background()
+	comparison, err := compareRefs(ctx, githubClient, repoUrl, "main", "feature/docs")
+
+	require.NoError(t, err)
+	assert.Equal(t, "0108e3c4f3100134a42fa333d103464498669ea5", comparison.BaseSHA)      // pragma: allowlist secret
+	assert.Equal(t, "0108e3c4f3100134a42fa333d103464498669ea5", comparison.MergeBaseSHA) // pragma: allowlist secret
+	assert.Equal(t, "c5b97d5ae6c19d5c5df71a34c7fbeeda2479ccbc", comparison.HeadSHA)      // pragma: allowlist secret
+	assert.Equal(t, "ahead", comparison.Status)
+	assert.Equal(t, 2, comparison.AheadBy)
+	assert.Equal(t, 0, comparison.BehindBy)
+
+	statuses := map[string]FileStatus{}
+	for _, file := range comparison.Files {
+		statuses[file.Filename] = file.Status
+	}
+	assert.Equal(t, map[string]FileStatus{
+		"docs/api.md":          FileStatusAdded,
+		"README.md":            FileStatusModified,
+		"docs/old.md":          FileStatusRemoved,
+		"docs/CONTRIBUTING.md": FileStatusRenamed,
+	}, statuses)
+	assert.Equal(t, 3, comparison.Files[1].Additions)
+	assert.Equal(t, 1, comparison.Files[1].Deletions)
+	assert.Contains(t, comparison.Files[1].Patch, "+New intro")
+	assert.Equal(t, "CONTRIBUTING.md", comparison.Files[3].PreviousFilename)
+	assert.ElementsMatch(t, []string{"docs/api.md", "README.md", "docs/old.md", "docs/CONTRIBUTING.md", "CONTRIBUTING.md"}, comparison.ChangedPaths())
+}
+
+func TestCompareRefsBehind(t *testing.T) {
+	githubClient := newReplayClient(t, "compare_refs_behind")
+
+	repoUrl := "https://github.com/some-user/my-project"
+
+	ctx := context.Background()
+	comparison, err := compareRefs(ctx, githubClient, repoUrl, "feature/docs", "main")
+
+	require.NoError(t, err)
+	assert.Equal(t, "behind", comparison.Status)
+	assert.Equal(t, 2, comparison.BehindBy)
+	assert.Equal(t, "c5b97d5ae6c19d5c5df71a34c7fbeeda2479ccbc", comparison.BaseSHA) // pragma: allowlist secret
+	assert.Equal(t, "0108e3c4f3100134a42fa333d103464498669ea5", comparison.HeadSHA) // pragma: allowlist secret
+	assert.Empty(t, comparison.Files)
+}
+
+func TestSetCommitStatus(t *testing.T) {
+	githubClient := newReplayClient(t, "create_status")
+
+	repoUrl := "https://github.com/some-user/my-project"
+	sha := "0108e3c4f3100134a42fa333d103464498669ea5" // pragma: allowlist secret
+
+	ctx := context.Background()
+	err := setCommitStatus(ctx, githubClient, repoUrl, sha, CommitStatus{
+		State:       CommitStateError,
+		Context:     "aeternum/build",
+		Description: "Cancelled: superseded by run 42",
+	})
+
+	assert.NoError(t, err)
+}
+
+func TestCreateCheckRun(t *testing.T) {
+	githubClient := newReplayClient(t, "create_check_run")
+
+	repoUrl := "https://github.com/some-user/my-project"
+	sha := "0108e3c4f3100134a42fa333d103464498669ea5" // pragma: allowlist secret
+
+	ctx := context.Background()
+	err := createCheckRun(ctx, githubClient, repoUrl, sha, CheckRun{
+		Name:        "aeternum/build tests",
+		Conclusion:  CheckConclusionFailure,
+		Title:       "1 failed, 2 passed",
+		Summary:     "| Passed | Failed | Skipped |",
+		DetailsURL:  "https://ci.example.com/v0/runs/42/tests",
+		CompletedAt: time.Date(2024, 10, 19, 12, 0, 0, 0, time.UTC),
+	})
+
+	assert.NoError(t, err)
+}
+
+func TestListPullRequests(t *testing.T) {
+	githubClient := newReplayClient(t, "list_pull_requests")
+
+	repoUrl := "https://github.com/some-user/my-project"
+
+	ctx := context.Background()
+	pullRequests, err := listPullRequests(ctx, githubClient, repoUrl, "feature")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []PullRequest{
 		{
-			Path: github.String("contents/fileA.txt"),
-			Mode: github.String("100644"),
-			Type: github.String("blob"),
+			Number:     7,
+			Title:      "Speed up the store",
+			HeadBranch: "feature",
+			HeadSha:    "6dcb09b5b57875f334f61aebed695e2e4193db5e", // pragma: allowlist secret
+			BaseBranch: "main",
 		},
+	}, pullRequests)
+}
+
+func TestUpsertComment(t *testing.T) {
+	repoUrl := "https://github.com/some-user/my-project"
+	marker := "<!-- aeternum-coverage:api -->"
+
+	examples := []struct {
+		name     string
+		cassette string
+	}{
+		{name: "creates the first comment", cassette: "upsert_comment_create"},
+		{name: "updates the comment holding the marker", cassette: "upsert_comment_edit"},
 	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			githubClient := newReplayClient(t, example.cassette)
 
-	commitMsg := "this is a test commit"
+			ctx := context.Background()
+			err := upsertComment(ctx, githubClient, repoUrl, 7, marker, "Coverage: **81.50%** (+1.25%)")
 
-	ref := github.Reference{
-		Object: &github.GitObject{
-			SHA: github.String(latestCommitSHA),
-		},
+			assert.NoError(t, err)
+		})
 	}
-	mockGithubClient.EXPECT().
-		GetRef(gomock.Any(), owner, repo, branchRef).
-		Return(&ref, nil, nil)
-
-	commit := github.Commit{
-		SHA: github.String(baseTreeSha),
-		Tree: &github.Tree{
-			SHA: github.String(baseTreeSha),
-			Entries: []*github.TreeEntry{
-				{
-					Path:    github.String("contents/fileA.txt"),
-					Mode:    github.String("100644"),
-					Type:    github.String("blob"),
-					Content: github.String("this is existing file #1"),
-				},
-				{
-					Path:    github.String("contents/fileB.txt"),
-					Mode:    github.String("100644"),
-					Type:    github.String("blob"),
-					Content: github.String("this is existing file #2"),
-				},
-			},
-			Truncated: new(bool),
+}
+
+func TestGetListOfBranches(t *testing.T) {
+	githubClient := newReplayClient(t, "list_branches")
+
+	repoUrl := "https://github.com/some-user/my-project"
+
+	ctx := context.Background()
+	branches, err := getListOfBranches(ctx, githubClient, repoUrl)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []GithubBranchesInfo{
+		{
+			Name:      "develop",
+			Uri:       "https://api.github.com/repos/some-user/my-project/commits/6dcb09b5b57875f334f61aebed695e2e4193db5e",
+			CommitSha: "6dcb09b5b57875f334f61aebed695e2e4193db5e", // pragma: allowlist secret
 		},
-	}
-	mockGithubClient.EXPECT().
-		GetCommit(gomock.Any(), owner, repo, latestCommitSHA).
-		Return(&commit, nil, nil)
-
-	tree := github.Tree{
-		SHA: github.String(baseTreeSha),
-		Entries: []*github.TreeEntry{
-			{
-				Path:    github.String("contents/fileB.txt"),
-				Mode:    github.String("100644"),
-				Type:    github.String("blob"),
-				Content: github.String("this is existing file #2"),
-			},
-			{
-				Path:    github.String("contents/fileC.txt"),
-				Mode:    github.String("100644"),
-				Type:    github.String("blob"),
-				Content: github.String("this is a test file#1"),
-			},
-			{
-				Path:    github.String("contents/fileD.txt"),
-				Mode:    github.String("100644"),
-				Type:    github.String("blob"),
-				Content: github.String("this is a test file#2"),
-			},
+		{
+			Name:      "main",
+			Uri:       "https://api.github.com/repos/some-user/my-project/commits/0108e3c4f3100134a42fa333d103464498669ea5",
+			CommitSha: "0108e3c4f3100134a42fa333d103464498669ea5", // pragma: allowlist secret
 		},
-	}
-	mockGithubClient.EXPECT().
-		CreateTree(gomock.Any(), owner, repo, baseTreeSha, gomock.InAnyOrder(updatedFilesTree)).
-		Return(&tree, nil, nil)
-
-	newCommit := github.Commit{
-		SHA:     github.String(newSha),
-		Message: github.String(commitMsg),
-		Tree:    &tree,
-		HTMLURL: github.String("commit URL"),
-	}
-	mockGithubClient.EXPECT().
-		CreateCommit(gomock.Any(), owner, repo,
-			&github.Commit{
-				Parents: []*github.Commit{{SHA: github.String(latestCommitSHA)}},
-				Tree:    &tree,
-				Message: github.String(commitMsg),
-			},
-			&github.CreateCommitOptions{
-				Signer: nil,
-			}).
-		Return(&newCommit, nil, nil)
-
-	commitRef := &github.Reference{
-		Ref: github.String("refs/heads/branch-name"),
-		Object: &github.GitObject{
-			SHA: github.String(*newCommit.SHA),
+		{
+			Name:      "ticketId/testBranch",
+			Uri:       "https://api.github.com/repos/some-user/my-project/commits/c5b97d5ae6c19d5c5df71a34c7fbeeda2479ccbc",
+			CommitSha: "c5b97d5ae6c19d5c5df71a34c7fbeeda2479ccbc", // pragma: allowlist secret
 		},
-	}
-	mockGithubClient.EXPECT().
-		UpdateRef(gomock.Any(), owner, repo, commitRef, false).
-		Return(nil, nil, nil)
+	}, branches)
+}
+
+func TestGetDefaultBranchNameSuccess(t *testing.T) {
+	githubClient := newReplayClient(t, "get_default_branch")
+
+	repoUrl := "https://github.com/some-user/my-project"
+
+	ctx := context.Background()
+	actualBranchName, err := getDefaultBranchName(ctx, githubClient, repoUrl)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "main", actualBranchName)
+}
+
+func TestCommitMultipleFilesToBranch(t *testing.T) {
+	githubClient := newReplayClient(t, "commit_multiple_files")
 
 	branchName := "branch-name"
 	repoUrl := "https://github.com/some-user/my-project"
+	commitMsg := "this is a test commit"
 	fileChanges := make(map[string]string)
 	fileChanges["contents/fileC.txt"] = "this is a test file#1"
 	fileChanges["contents/fileD.txt"] = "this is a test file#2"
 	filesToDelete := []string{"contents/fileA.txt"}
 
 	ctx := context.Background()
-	branchInfo, err := commitMultipleFilesToBranch(ctx, mockGithubClient, repoUrl, branchName, commitMsg, fileChanges, filesToDelete)
+	branchInfo, err := commitMultipleFilesToBranch(ctx, githubClient, repoUrl, branchName, commitMsg, fileChanges, filesToDelete)
 
-	// Assert that no errors occurred
-	expectedSHA := newSha
-	expectedURL := "commit URL"
+	expectedSHA := "0108e3c4f3100134a42fa532d103464498669ea5" // pragma: allowlist secret
+	expectedURL := "https://github.com/some-user/my-project/commit/0108e3c4f3100134a42fa532d103464498669ea5"
 
 	assert.Nil(t, err)
-	assert.Equal(t, branchInfo.CommitSha, expectedSHA)
-	assert.Equal(t, branchInfo.Uri, expectedURL)
-
+	assert.Equal(t, expectedSHA, branchInfo.CommitSha)
+	assert.Equal(t, expectedURL, branchInfo.Uri)
+	assert.Equal(t, branchName, branchInfo.Name)
 }
 
 func TestCreateBranch(t *testing.T) {
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-
-	// Create a mock
-	mockGithubClient := mock_githubclient.NewMockgithubClient(ctrl)
-
-	owner := "some-user"
-	repo := "my-project"
-	latestCommitSHA := "0108e3c4f3100134a42fa333d103464498669ea5" // pragma: allowlist secret
-	newCommitSHA := "0108e3c4f3100134a42fa444d103464498669ea5"    // pragma: allowlist secret
-
-	mainRef := github.Reference{
-		Object: &github.GitObject{
-			SHA: github.String(latestCommitSHA),
-		},
-	}
-	mockGithubClient.EXPECT().
-		GetRef(gomock.Any(), owner, repo, "refs/heads/main").
-		Return(&mainRef, nil, nil)
-
-	newRef := &github.Reference{
-		Ref: github.String("refs/heads/branch-name"),
-		Object: &github.GitObject{
-			SHA: github.String(latestCommitSHA),
-		},
-	}
-	branchRef := github.Reference{
-		Object: &github.GitObject{
-			SHA: github.String(newCommitSHA),
-			URL: github.String("commit URL"),
-		},
-	}
-	mockGithubClient.EXPECT().
-		CreateRef(gomock.Any(), owner, repo, newRef).
-		Return(&branchRef, nil, nil)
+	githubClient := newReplayClient(t, "create_branch")
 
 	repoUrl := "https://github.com/some-user/my-project"
 	branchName := "branch-name"
 
 	ctx := context.Background()
-	branchInfo, err := createBranch(ctx, mockGithubClient, repoUrl, branchName)
+	branchInfo, err := createBranch(ctx, githubClient, repoUrl, branchName)
 
-	// Assert that no errors occurred
-	expectedSHA := newCommitSHA
-	expectedURL := "commit URL"
+	expectedSHA := "0108e3c4f3100134a42fa444d103464498669ea5" // pragma: allowlist secret
+	expectedURL := "https://api.github.com/repos/some-user/my-project/git/commits/0108e3c4f3100134a42fa444d103464498669ea5"
 
 	assert.Nil(t, err)
-	assert.Equal(t, branchInfo.CommitSha, expectedSHA)
-	assert.Equal(t, branchInfo.Uri, expectedURL)
+	assert.Equal(t, expectedSHA, branchInfo.CommitSha)
+	assert.Equal(t, expectedURL, branchInfo.Uri)
+}
 
+func TestCreateTreeEntriesIsDeterministic(t *testing.T) {
+	fileChanges := map[string]string{
+		"b.txt": "b",
+		"a.txt": "a",
+		"c.txt": "c",
+	}
+
+	entries := createTreeEntries(fileChanges, []string{"z.txt"})
+
+	paths := []string{}
+	for _, entry := range entries {
+		paths = append(paths, entry.GetPath())
+	}
+	assert.Equal(t, []string{"a.txt", "b.txt", "c.txt", "z.txt"}, paths)
+	assert.Nil(t, entries[3].Content)
 }
 
 func TestParseRepoURL(t *testing.T) {
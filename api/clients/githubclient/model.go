@@ -26,3 +26,142 @@ type FeatureFile struct {
 	FilePath *string
 	Contents *string
 }
+
+// kind of an entry found in a repository directory
+type EntryType string
+
+const (
+	EntryTypeFile      EntryType = "file"
+	EntryTypeDir       EntryType = "dir"
+	EntryTypeSymlink   EntryType = "symlink"
+	EntryTypeSubmodule EntryType = "submodule"
+)
+
+// single entry of a repository directory listing
+type DirectoryEntry struct {
+	Name string    `json:"name"` // entry name without its parent path
+	Path string    `json:"path"` // full path relative to the repository root
+	Type EntryType `json:"type"` // file, dir, symlink or submodule
+	Size int       `json:"size"` // size in bytes; 0 for directories and submodules
+	SHA  string    `json:"sha"`  // blob/tree SHA, or the pinned commit for submodules
+}
+
+// single entry of a recursive git tree
+type TreeEntry struct {
+	Path string    // full path relative to the repository root
+	Mode string    // git file mode, e.g. 100644, 100755 or 120000
+	Type EntryType // file, dir, symlink or submodule
+	Size int       // blob size in bytes; 0 for anything but files and symlinks
+	SHA  string    // blob/tree SHA, or the pinned commit for submodules
+}
+
+// the full tree of a commit
+type CommitTree struct {
+	CommitSHA string      // the commit the tree belongs to
+	TreeSHA   string      // the root tree SHA
+	Entries   []TreeEntry // every entry of the tree, recursively
+	Truncated bool        // set when GitHub could not return the whole tree in one response
+}
+
+func (e TreeEntry) IsExecutable() bool {
+	return e.Mode == modeExecutable
+}
+
+// how a file changed between two refs
+type FileStatus string
+
+const (
+	FileStatusAdded    FileStatus = "added"
+	FileStatusModified FileStatus = "modified"
+	FileStatusRemoved  FileStatus = "removed"
+	FileStatusRenamed  FileStatus = "renamed"
+)
+
+// state of a commit status, as shown next to the commit on GitHub
+type CommitState string
+
+const (
+	CommitStatePending CommitState = "pending"
+	CommitStateSuccess CommitState = "success"
+	CommitStateFailure CommitState = "failure"
+	CommitStateError   CommitState = "error"
+)
+
+// status reported on a commit
+type CommitStatus struct {
+	State       CommitState `json:"state"`
+	Context     string      `json:"context"`             // label telling statuses apart, e.g. aeternum/build
+	Description string      `json:"description"`         // short summary, truncated to 140 characters by GitHub
+	TargetURL   string      `json:"targetUrl,omitempty"` // link shown next to the status
+}
+
+// conclusion of a completed check run
+type CheckConclusion string
+
+const (
+	CheckConclusionSuccess CheckConclusion = "success"
+	CheckConclusionFailure CheckConclusion = "failure"
+	CheckConclusionNeutral CheckConclusion = "neutral"
+)
+
+// completed check run reported on a commit, with a markdown summary
+type CheckRun struct {
+	Name        string          `json:"name"`                 // label telling check runs apart, e.g. aeternum/build tests
+	Conclusion  CheckConclusion `json:"conclusion"`           // success, failure or neutral
+	Title       string          `json:"title"`                // one line shown next to the check run
+	Summary     string          `json:"summary"`              // markdown, truncated to 65535 characters
+	DetailsURL  string          `json:"detailsUrl,omitempty"` // link to the full results
+	CompletedAt time.Time       `json:"completedAt"`
+}
+
+// open pull request of a branch
+type PullRequest struct {
+	Number     int    `json:"number"`
+	Title      string `json:"title"`
+	HeadBranch string `json:"headBranch"` // branch the changes come from
+	HeadSha    string `json:"headSha"`    // latest commit of the head branch
+	BaseBranch string `json:"baseBranch"` // branch the changes are merged into
+}
+
+// single file changed between two refs
+type ChangedFile struct {
+	Filename         string     `json:"filename"`                   // path of the file at the head ref
+	PreviousFilename string     `json:"previousFilename,omitempty"` // path at the base ref, only set for renames
+	Status           FileStatus `json:"status"`                     // added, modified, removed or renamed
+	Additions        int        `json:"additions"`                  // lines added
+	Deletions        int        `json:"deletions"`                  // lines removed
+	Patch            string     `json:"patch,omitempty"`            // unified diff; omitted by GitHub for binary or huge files
+}
+
+// comparison between a base and a head ref
+type RefComparison struct {
+	Base         string        `json:"base"`         // base ref as requested
+	Head         string        `json:"head"`         // head ref as requested
+	BaseSHA      string        `json:"baseSha"`      // commit the base ref resolved to
+	HeadSHA      string        `json:"headSha"`      // commit the head ref resolved to
+	MergeBaseSHA string        `json:"mergeBaseSha"` // common ancestor of base and head
+	Status       string        `json:"status"`       // ahead, behind, diverged or identical
+	AheadBy      int           `json:"aheadBy"`      // commits in head missing from base
+	BehindBy     int           `json:"behindBy"`     // commits in base missing from head
+	Files        []ChangedFile `json:"files"`        // files changed between the merge base and head
+}
+
+// GitHub lists at most this many files in a comparison, dropping the others
+const MaxComparisonFiles int = 300
+
+// Whether GitHub may have dropped changed files from the comparison
+func (c *RefComparison) FilesTruncated() bool {
+	return len(c.Files) >= MaxComparisonFiles
+}
+
+// Paths of every changed file; renames contribute both their old and new path
+func (c *RefComparison) ChangedPaths() []string {
+	paths := make([]string, 0, len(c.Files))
+	for _, file := range c.Files {
+		paths = append(paths, file.Filename)
+		if file.PreviousFilename != "" {
+			paths = append(paths, file.PreviousFilename)
+		}
+	}
+	return paths
+}
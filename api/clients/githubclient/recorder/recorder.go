@@ -0,0 +1,317 @@
+// Package recorder provides an HTTP transport that records GitHub API
+// interactions to JSON cassettes and replays them offline.
+package recorder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"api/env"
+)
+
+const (
+	// Set to "true" to hit the real API and overwrite the cassettes
+	EnvVarRecordCassettes string = "AETERNUM_RECORD_CASSETTES"
+	redactedValue         string = "REDACTED"
+	// Binary bodies (e.g. archives) are stored base64 encoded
+	bodyEncodingBase64 string = "base64"
+)
+
+type Mode int
+
+const (
+	// Serve responses from the cassette, never touching the network
+	ModeReplay Mode = iota
+	// Forward requests to the real transport and capture the responses
+	ModeRecord
+)
+
+// Headers whose values must never be written to a cassette
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// Query parameters whose values must never be written to a cassette
+var sensitiveQueryParams = []string{
+	"access_token",
+	"token",
+}
+
+type Request struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+type Response struct {
+	StatusCode   int         `json:"statusCode"`
+	Headers      http.Header `json:"headers,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty"`
+}
+
+// A single request/response pair of the API, recorded or written by hand
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Recorder is an http.RoundTripper backed by a cassette file
+type Recorder struct {
+	mode      Mode
+	path      string
+	transport http.RoundTripper
+
+	mu       sync.Mutex
+	cassette Cassette
+	replayed []bool
+}
+
+// Returns the mode requested through the environment, defaulting to replay
+func ModeFromEnv() Mode {
+	if strings.EqualFold(env.GetEnvWithDefault(EnvVarRecordCassettes, ""), "true") {
+		return ModeRecord
+	}
+	return ModeReplay
+}
+
+/*
+Create a recorder for the given cassette.
+
+[IN] path: location of the cassette JSON file
+
+[IN] mode: whether to record new interactions or replay existing ones
+
+[IN] transport: the real transport used while recording; defaults to http.DefaultTransport
+
+[OUT] *Recorder: transport ready to be plugged into an http.Client
+*/
+func New(path string, mode Mode, transport http.RoundTripper) (*Recorder, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	recorder := &Recorder{
+		mode:      mode,
+		path:      path,
+		transport: transport,
+	}
+	if mode == ModeRecord {
+		return recorder, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cassette %s: %w", path, err)
+	}
+	err = json.Unmarshal(contents, &recorder.cassette)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse cassette %s: %w", path, err)
+	}
+	recorder.replayed = make([]bool, len(recorder.cassette.Interactions))
+	return recorder, nil
+}
+
+// Returns an http.Client that sends every request through the recorder
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.mode == ModeRecord {
+		return r.record(req, body)
+	}
+	return r.replay(req, body)
+}
+
+// Write the captured interactions to disk; a no-op while replaying
+func (r *Recorder) Stop() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	contents, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode cassette: %w", err)
+	}
+	err = os.MkdirAll(filepath.Dir(r.path), 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create cassette directory: %w", err)
+	}
+	err = os.WriteFile(r.path, append(contents, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write cassette %s: %w", r.path, err)
+	}
+	return nil
+}
+
+func (r *Recorder) record(req *http.Request, body string) (*http.Response, error) {
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response body: %w", err)
+	}
+
+	encodedBody, bodyEncoding := encodeBody(respBody)
+	interaction := Interaction{
+		Request: Request{
+			Method:  req.Method,
+			URL:     redactURL(req.URL),
+			Headers: redactHeaders(req.Header),
+			Body:    body,
+		},
+		Response: Response{
+			StatusCode:   resp.StatusCode,
+			Headers:      redactHeaders(resp.Header),
+			Body:         encodedBody,
+			BodyEncoding: bodyEncoding,
+		},
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, body string) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	requestURL := redactURL(req.URL)
+	for i, interaction := range r.cassette.Interactions {
+		if r.replayed[i] || !matches(interaction.Request, req.Method, requestURL, body) {
+			continue
+		}
+		r.replayed[i] = true
+		return newResponse(req, interaction.Response)
+	}
+	return nil, fmt.Errorf("no recorded interaction in %s for %s %s", r.path, req.Method, requestURL)
+}
+
+// Interactions match on method, URL and body; JSON bodies are compared structurally
+func matches(recorded Request, method string, requestURL string, body string) bool {
+	if recorded.Method != method || recorded.URL != requestURL {
+		return false
+	}
+	if recorded.Body == body {
+		return true
+	}
+	var recordedJSON, bodyJSON any
+	if json.Unmarshal([]byte(recorded.Body), &recordedJSON) != nil || json.Unmarshal([]byte(body), &bodyJSON) != nil {
+		return false
+	}
+	return reflect.DeepEqual(recordedJSON, bodyJSON)
+}
+
+func newResponse(req *http.Request, recorded Response) (*http.Response, error) {
+	body, err := decodeBody(recorded)
+	if err != nil {
+		return nil, err
+	}
+	header := recorded.Headers.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// Text bodies are stored verbatim so cassettes stay readable
+func encodeBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), bodyEncodingBase64
+}
+
+func decodeBody(recorded Response) ([]byte, error) {
+	if recorded.BodyEncoding != bodyEncodingBase64 {
+		return []byte(recorded.Body), nil
+	}
+	body, err := base64.StdEncoding.DecodeString(recorded.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode recorded response body: %w", err)
+	}
+	return body, nil
+}
+
+// Read the request body while leaving it intact for the real transport
+func readRequestBody(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", nil
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return "", fmt.Errorf("unable to read request body: %w", err)
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return string(body), nil
+}
+
+func redactHeaders(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, name := range sensitiveHeaders {
+		if redacted.Get(name) != "" {
+			redacted.Set(name, redactedValue)
+		}
+	}
+	return redacted
+}
+
+func redactURL(u *url.URL) string {
+	redacted := *u
+	query := redacted.Query()
+	changed := false
+	for _, name := range sensitiveQueryParams {
+		if query.Has(name) {
+			query.Set(name, redactedValue)
+			changed = true
+		}
+	}
+	if changed {
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.String()
+}
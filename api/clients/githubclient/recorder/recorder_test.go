@@ -0,0 +1,131 @@
+package recorder
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newUpstream(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=abc123")
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(`{"path":"` + r.URL.Path + `","body":` + string(body) + `}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	upstream := newUpstream(t)
+	cassettePath := filepath.Join(t.TempDir(), "cassettes", "roundtrip.json")
+
+	rec, err := New(cassettePath, ModeRecord, nil)
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest(http.MethodPost, upstream.URL+"/repos/owner/repo?access_token=secret-value", strings.NewReader(`{"a":1,"b":2}`))
+	req.Header.Set("Authorization", "Bearer ghp_supersecret")
+	resp, err := rec.Client().Do(req)
+	require.NoError(t, err)
+	recordedBody, _ := io.ReadAll(resp.Body)
+	require.NoError(t, rec.Stop())
+
+	contents, err := os.ReadFile(cassettePath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(contents), "ghp_supersecret")
+	assert.NotContains(t, string(contents), "secret-value")
+	assert.NotContains(t, string(contents), "abc123")
+	assert.Contains(t, string(contents), redactedValue)
+
+	upstream.Close()
+	replayer, err := New(cassettePath, ModeReplay, nil)
+	require.NoError(t, err)
+
+	// Key order differs but the JSON body is equivalent
+	req, _ = http.NewRequest(http.MethodPost, upstream.URL+"/repos/owner/repo?access_token=other-value", strings.NewReader(`{"b":2,"a":1}`))
+	resp, err = replayer.Client().Do(req)
+	require.NoError(t, err)
+	replayedBody, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, string(recordedBody), string(replayedBody))
+}
+
+func TestReplayInteractionsAreConsumedInOrder(t *testing.T) {
+	cassettePath := filepath.Join(t.TempDir(), "ordered.json")
+	err := os.WriteFile(cassettePath, []byte(`{"interactions":[
+		{"request":{"method":"GET","url":"https://api.github.com/rate_limit"},"response":{"statusCode":200,"body":"first"}},
+		{"request":{"method":"GET","url":"https://api.github.com/rate_limit"},"response":{"statusCode":200,"body":"second"}}
+	]}`), 0644)
+	require.NoError(t, err)
+
+	rec, err := New(cassettePath, ModeReplay, nil)
+	require.NoError(t, err)
+	client := rec.Client()
+
+	for _, expected := range []string{"first", "second"} {
+		resp, err := client.Get("https://api.github.com/rate_limit")
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, expected, string(body))
+	}
+
+	_, err = client.Get("https://api.github.com/rate_limit")
+	assert.ErrorContains(t, err, "no recorded interaction")
+}
+
+func TestReplayUnknownRequest(t *testing.T) {
+	cassettePath := filepath.Join(t.TempDir(), "empty.json")
+	require.NoError(t, os.WriteFile(cassettePath, []byte(`{"interactions":[]}`), 0644))
+
+	rec, err := New(cassettePath, ModeReplay, nil)
+	require.NoError(t, err)
+
+	_, err = rec.Client().Get("https://api.github.com/repos/owner/repo")
+	assert.ErrorContains(t, err, "GET https://api.github.com/repos/owner/repo")
+}
+
+func TestReplayMissingCassette(t *testing.T) {
+	_, err := New(filepath.Join(t.TempDir(), "missing.json"), ModeReplay, nil)
+	assert.ErrorContains(t, err, "unable to read cassette")
+}
+
+func TestModeFromEnv(t *testing.T) {
+	t.Setenv(EnvVarRecordCassettes, "")
+	assert.Equal(t, ModeReplay, ModeFromEnv())
+
+	t.Setenv(EnvVarRecordCassettes, "true")
+	assert.Equal(t, ModeRecord, ModeFromEnv())
+}
+
+func TestRecordBinaryBody(t *testing.T) {
+	payload := []byte{0x1f, 0x8b, 0x08, 0x00, 0xff, 0xfe}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload)
+	}))
+	defer upstream.Close()
+	cassettePath := filepath.Join(t.TempDir(), "binary.json")
+
+	rec, err := New(cassettePath, ModeRecord, nil)
+	require.NoError(t, err)
+	_, err = rec.Client().Get(upstream.URL + "/archive")
+	require.NoError(t, err)
+	require.NoError(t, rec.Stop())
+
+	replayer, err := New(cassettePath, ModeReplay, nil)
+	require.NoError(t, err)
+	resp, err := replayer.Client().Get(upstream.URL + "/archive")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, payload, body)
+}
@@ -1,20 +1,50 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"api/artifacts"
+	"api/audit"
+	"api/auth"
+	"api/cache"
+	"api/clients/githubclient"
+	"api/config"
+	"api/coverage"
 	"api/env"
+	"api/logger"
+	"api/queue"
+	"api/rbac"
 	"api/router"
+	error_handling "api/router/error_handling"
 	"api/router/system"
+	v0 "api/router/v0"
+	"api/runner"
+	"api/scheduler"
+	"api/secrets"
+	"api/store"
+	"api/testreport"
+	"api/triggers"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 )
 
 var (
-	port    = flag.Int("port", 8080, "Port to listen on")
-	devMode = flag.Bool("dev", true, "Run server in debug mode")
+	port      = flag.Int("port", 8080, "Port to listen on")
+	devMode   = flag.Bool("dev", true, "Run server in debug mode")
+	configDir = flag.String("config-dir", ".", "Directory containing the config.yaml file")
+	dataDir   = flag.String("data-dir", ".data", "Directory where pipelines and runs are stored; share it between replicas")
+	retention = flag.Int("artifact-retention-days", 30, "Days artifacts are kept when their job does not say")
+	cacheSize = flag.Int64("cache-size-mb", cache.DefaultMaxPipelineBytes>>20, "Size of the caches of a pipeline before the least recently used are evicted")
+	newToken  = flag.String("create-token", "", "Print a new API token for this subject and exit, e.g. to bootstrap access")
 )
 
 func init() {
@@ -28,6 +58,9 @@ func init() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 	prometheus.Register(system.HttpLastRequestReceivedTime)
+	prometheus.Register(error_handling.HttpPanicsTotal)
+	prometheus.Register(cache.Lookups)
+	prometheus.Register(cache.Evictions)
 }
 
 func main() {
@@ -38,9 +71,173 @@ func main() {
 		logrus.Infof("Running API production server on port %d", *port)
 		gin.SetMode(gin.ReleaseMode)
 	}
-	service := router.CreateNewService(*port)
-	err := service.Run()
+	deps, err := loadDependencies()
+	if err != nil {
+		logrus.Fatalf("Failed to initialise the server: %v", err)
+	}
+	if *newToken != "" {
+		_, token, err := deps.Auth.CreateToken(context.Background(), *newToken, "created with -create-token", 0)
+		if err != nil {
+			logrus.Fatalf("Failed to create an API token: %v", err)
+		}
+		fmt.Println(token)
+		return
+	}
+	go deps.Scheduler.Run(context.Background())
+	go deps.Runners.RunReaper(context.Background(), runner.DefaultReapInterval)
+	go deps.Artifacts.RunPurger(context.Background(), artifacts.DefaultPurgeInterval)
+	corsSettings, err := config.LoadCorsConfig(*configDir)
+	if err != nil {
+		logrus.Fatalf("Failed to initialise the server: %v", err)
+	}
+	service := router.CreateNewService(*port, deps, corsSettings)
+	err = service.Run()
 	if err != nil {
 		logrus.Error("Error starting the server:", err)
 	}
 }
+
+// Build the API backends from the configuration; the GitHub integration is
+// optional so the server can still run locally without a token.
+func loadDependencies() (v0.Dependencies, error) {
+	ctx := context.Background()
+	deps := v0.Dependencies{}
+
+	dataStore, err := store.NewFileStore(*dataDir)
+	if err != nil {
+		return deps, err
+	}
+	deps.Pipelines = store.NewPipelines(dataStore)
+	jwtConfig, err := newJWTConfig()
+	if err != nil {
+		return deps, err
+	}
+	deps.Auth = auth.NewService(dataStore, jwtConfig)
+	deps.Rbac = rbac.NewService(dataStore, administrators())
+	deps.Audit = audit.NewService(filepath.Join(*dataDir, audit.EventsFile))
+	deps.Runs = store.NewRuns(dataStore)
+	jobQueue := queue.NewStoreQueue(dataStore, triggers.JobQueueName)
+	prometheus.Register(queue.NewDepthCollector(jobQueue))
+	deps.Jobs = jobQueue
+	deps.Scheduler = scheduler.New(dataStore, jobQueue, replicaID())
+	// runners don't depend on the GitHub integration, so their token is read on its own
+	registrationToken := env.GetEnvWithDefault(config.EnvVarRunnerRegistrationToken, "")
+	if registrationToken == "" {
+		logrus.Warnf("%s is not set, runners cannot register", config.EnvVarRunnerRegistrationToken)
+	}
+	deps.Runners = runner.NewService(dataStore, jobQueue, runner.NewFileLogs(filepath.Join(*dataDir, "logs")), registrationToken)
+	artifactStore, err := newArtifactStore()
+	if err != nil {
+		return deps, err
+	}
+	deps.Artifacts = artifacts.NewService(dataStore, artifactStore, time.Duration(*retention)*24*time.Hour)
+	deps.Cache = cache.NewService(dataStore, artifactStore, 0, *cacheSize<<20)
+	deps.TestReports = testreport.NewService(dataStore)
+	deps.Runners.OnJobCompleted(deps.TestReports.PublishSummary)
+	deps.Runners.QuarantineFlakyTests(deps.TestReports)
+	deps.Coverage = coverage.NewService(dataStore)
+	deps.Runners.OnJobCompleted(deps.Coverage.PublishDelta)
+	deps.Secrets, err = newSecrets(dataStore)
+	if err != nil {
+		return deps, err
+	}
+	if deps.Secrets != nil {
+		deps.Runners.InjectSecrets(deps.Secrets)
+	}
+
+	cfg, err := config.LoadConfig(*configDir)
+	if err != nil {
+		logrus.Warnf("Running without GitHub integration: %v", err)
+		return deps, nil
+	}
+	logger.SetLevel(cfg.LogLevel())
+	deps.WebhookSecret = cfg.GithubWebhookSecret()
+	if deps.WebhookSecret == "" && env.IsLocalEnvironment() {
+		logrus.Warnf("%s is not set, webhook signatures will not be checked", config.EnvVarGithubWebhookSecret)
+	} else if deps.WebhookSecret == "" {
+		logrus.Warnf("%s is not set, webhook deliveries will be rejected", config.EnvVarGithubWebhookSecret)
+	}
+
+	github, err := githubclient.DefaultGithubServiceFactory()(ctx, cfg.GithubToken(), cfg.GithubBaseUrl())
+	if err != nil {
+		logrus.Warnf("Running without GitHub integration: %v", err)
+		return deps, nil
+	}
+	deps.Github = github
+	deps.Runners.ReportStatuses(github)
+	deps.TestReports.ReportChecks(github)
+	deps.Coverage.ReportPullRequests(github)
+	return deps, nil
+}
+
+// Subjects holding the admin role everywhere, e.g. to grant the first roles
+func administrators() []string {
+	admins := []string{}
+	for _, subject := range strings.Split(env.GetEnvWithDefault(config.EnvVarAdmins, ""), ",") {
+		subject = strings.TrimSpace(subject)
+		if subject != "" {
+			admins = append(admins, subject)
+		}
+	}
+	if len(admins) == 0 {
+		logrus.Warnf("%s is not set, nobody can grant roles", config.EnvVarAdmins)
+	}
+	return admins
+}
+
+// Accept the JWTs of the configured OIDC provider; nil when there is none
+func newJWTConfig() (*auth.JWTConfig, error) {
+	issuer := env.GetEnvWithDefault(config.EnvVarOidcIssuer, "")
+	if issuer == "" {
+		logrus.Infof("%s is not set, only API tokens authenticate callers", config.EnvVarOidcIssuer)
+		return nil, nil
+	}
+	jwksURL := env.GetEnvWithDefault(config.EnvVarOidcJwksUrl, "")
+	if jwksURL == "" {
+		return nil, fmt.Errorf("%s is required along with %s", config.EnvVarOidcJwksUrl, config.EnvVarOidcIssuer)
+	}
+	return &auth.JWTConfig{
+		Issuer:   issuer,
+		Audience: env.GetEnvWithDefault(config.EnvVarOidcAudience, ""),
+		Keys:     auth.NewRemoteKeySet(jwksURL),
+	}, nil
+}
+
+// Encrypt secrets with the configured master key; nil when there is none
+func newSecrets(dataStore store.Store) (*secrets.Service, error) {
+	encoded := env.GetEnvWithDefault(config.EnvVarSecretsMasterKey, "")
+	if encoded == "" {
+		logrus.Warnf("%s is not set, pipeline secrets are disabled", config.EnvVarSecretsMasterKey)
+		return nil, nil
+	}
+	key, err := secrets.ParseKey(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", config.EnvVarSecretsMasterKey, err)
+	}
+	return secrets.NewService(dataStore, key)
+}
+
+// Store artifacts in S3 when a bucket is configured, next to the other data otherwise
+func newArtifactStore() (artifacts.ArtifactStore, error) {
+	bucket := env.GetEnvWithDefault(config.EnvVarArtifactsS3Bucket, "")
+	if bucket == "" {
+		return artifacts.NewLocalStore(filepath.Join(*dataDir, "artifacts"))
+	}
+	logrus.Infof("Storing artifacts in the S3 bucket %s", bucket)
+	return artifacts.NewS3Store(artifacts.S3Config{
+		Endpoint:        env.GetEnvWithDefault(config.EnvVarArtifactsS3Endpoint, "https://s3.amazonaws.com"),
+		Region:          env.GetEnvWithDefault(config.EnvVarArtifactsS3Region, ""),
+		Bucket:          bucket,
+		AccessKeyId:     env.GetEnvWithDefault(config.EnvVarArtifactsS3AccessKeyId, ""),
+		SecretAccessKey: env.GetEnvWithDefault(config.EnvVarArtifactsS3SecretKey, ""),
+	})
+}
+
+// Identify this process among the replicas sharing the data directory
+func replicaID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%s", hostname, uuid.NewString())
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"api/clients/githubclient"
+	"api/config"
+	"api/env"
+	"api/executor"
+	"api/runner"
+	"api/runner/agent"
+	"api/workspace"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Reported to the API when registering
+const version string = "0.1.0"
+
+var (
+	serverURL = flag.String("server", "http://localhost:8080", "Base URL of the Aeternum API")
+	name      = flag.String("name", "", "Runner name, defaults to the hostname")
+	labels    = flag.String("labels", "", "Comma-separated runner labels, e.g. linux,large")
+	workDir   = flag.String("work-dir", "runner-work", "Directory holding the job workspaces")
+	tokenFile = flag.String("token-file", ".runner-token", "File storing the runner token after registration")
+	quota     = flag.Int64("quota-bytes", 0, "Maximum disk usage of the workspaces; 0 for no limit")
+)
+
+func init() {
+	logrus.SetReportCaller(true)
+	if env.IsLocalEnvironment() {
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	} else {
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	}
+}
+
+func main() {
+	flag.Parse()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := os.MkdirAll(*workDir, 0755)
+	if err != nil {
+		logrus.Fatalf("Unable to create the work directory: %v", err)
+	}
+	client, err := authenticate(ctx)
+	if err != nil {
+		logrus.Fatalf("Unable to authenticate with %s: %v", *serverURL, err)
+	}
+
+	runnerAgent := agent.New(client, executor.New(), loadCheckout(ctx))
+	logrus.Infof("Runner polling %s for jobs", *serverURL)
+	err = runnerAgent.Run(ctx)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logrus.Fatalf("Runner stopped: %v", err)
+	}
+	logrus.Info("Runner stopped")
+}
+
+// Reuse the stored runner token, or register with the registration token
+func authenticate(ctx context.Context) (*agent.Client, error) {
+	token, err := os.ReadFile(*tokenFile)
+	if err == nil {
+		return agent.NewClient(*serverURL, strings.TrimSpace(string(token))), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	runnerName := *name
+	if runnerName == "" {
+		runnerName, _ = os.Hostname()
+	}
+	client := agent.NewClient(*serverURL, "")
+	response, err := client.Register(ctx, os.Getenv(config.EnvVarRunnerRegistrationToken), runner.RegisterRequest{
+		Name:    runnerName,
+		Labels:  splitLabels(*labels),
+		Version: version,
+	})
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("Registered as runner %s", response.RunnerId)
+	err = os.WriteFile(*tokenFile, []byte(response.Token), 0600)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Check out sources from GitHub when a token is available, otherwise start jobs in an empty directory
+func loadCheckout(ctx context.Context) agent.Checkout {
+	token := os.Getenv(config.EnvVarGithubToken)
+	if token == "" {
+		logrus.Warnf("%s is not set, jobs start in an empty directory", config.EnvVarGithubToken)
+		return agent.TempDirCheckout(*workDir)
+	}
+	github, err := githubclient.DefaultGithubServiceFactory()(ctx, token, os.Getenv(config.EnvVarGithubUrl))
+	if err != nil {
+		logrus.Fatalf("Unable to create the GitHub client: %v", err)
+	}
+	manager, err := workspace.NewManager(github, workspace.Config{
+		RootDir:    filepath.Join(*workDir, "workspaces"),
+		QuotaBytes: *quota,
+	})
+	if err != nil {
+		logrus.Fatalf("Unable to create the workspace manager: %v", err)
+	}
+	return agent.WorkspaceCheckout(manager)
+}
+
+func splitLabels(value string) []string {
+	result := []string{}
+	for _, label := range strings.Split(value, ",") {
+		label = strings.TrimSpace(label)
+		if label != "" {
+			result = append(result, label)
+		}
+	}
+	return result
+}
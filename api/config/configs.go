@@ -2,6 +2,7 @@ package config
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path"
@@ -13,8 +14,25 @@ import (
 )
 
 const (
-	EnvVarGithubToken string = "AETERNUM_GITHUB_TOKEN"
-	ConfigFileName    string = "config.yaml"
+	EnvVarGithubUrl               string = "AETERNUM_GITHUB_URL"
+	EnvVarGithubToken             string = "AETERNUM_GITHUB_TOKEN"
+	EnvVarGithubWebhookSecret     string = "AETERNUM_GITHUB_WEBHOOK_SECRET"
+	EnvVarRunnerRegistrationToken string = "AETERNUM_RUNNER_REGISTRATION_TOKEN"
+	// Artifacts go to an S3-compatible bucket when set, to the data directory otherwise
+	EnvVarArtifactsS3Endpoint    string = "AETERNUM_ARTIFACTS_S3_ENDPOINT"
+	EnvVarArtifactsS3Region      string = "AETERNUM_ARTIFACTS_S3_REGION"
+	EnvVarArtifactsS3Bucket      string = "AETERNUM_ARTIFACTS_S3_BUCKET"
+	EnvVarArtifactsS3AccessKeyId string = "AETERNUM_ARTIFACTS_S3_ACCESS_KEY_ID"
+	EnvVarArtifactsS3SecretKey   string = "AETERNUM_ARTIFACTS_S3_SECRET_ACCESS_KEY"
+	// Base64 AES-256 key encrypting the pipeline secrets; secrets are disabled when unset
+	EnvVarSecretsMasterKey string = "AETERNUM_SECRETS_MASTER_KEY"
+	// OIDC provider whose JWTs authenticate API callers; only API tokens are accepted when unset
+	EnvVarOidcIssuer   string = "AETERNUM_OIDC_ISSUER"
+	EnvVarOidcAudience string = "AETERNUM_OIDC_AUDIENCE"
+	EnvVarOidcJwksUrl  string = "AETERNUM_OIDC_JWKS_URL"
+	// Comma-separated subjects holding the admin role on every repository and pipeline
+	EnvVarAdmins   string = "AETERNUM_ADMINS"
+	ConfigFileName string = "config.yaml"
 )
 
 type GithubConfig interface {
@@ -22,10 +40,20 @@ type GithubConfig interface {
 	GithubBaseUrl() string
 }
 
+// Cross-origin requests accepted from browsers, on top of the defaults of the environment
+type CorsConfig struct {
+	// Origins such as https://app.example.com, or https://*.example.com for any of its subdomains
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+	// Origins allowed instead on the routes under a path prefix, e.g. none on /v0/webhooks
+	Routes map[string][]string `yaml:"routes"`
+}
+
 type EnvironmentConfig struct {
-	EnvGithubBaseUrl string `yaml:"AETERNUM_GITHUB_URL"`
-	EnvGithubToken   string `yaml:"AETERNUM_GITHUB_TOKEN"`
-	EnvLogLevel      string `yaml:"AETERNUM_LOG_LEVEL"`
+	EnvGithubBaseUrl       string     `yaml:"AETERNUM_GITHUB_URL"`
+	EnvGithubToken         string     `yaml:"AETERNUM_GITHUB_TOKEN"`
+	EnvGithubWebhookSecret string     `yaml:"AETERNUM_GITHUB_WEBHOOK_SECRET"`
+	EnvLogLevel            string     `yaml:"AETERNUM_LOG_LEVEL"`
+	EnvCors                CorsConfig `yaml:"AETERNUM_CORS"`
 }
 
 func (c *EnvironmentConfig) GithubBaseUrl() string {
@@ -36,10 +64,19 @@ func (c *EnvironmentConfig) GithubToken() string {
 	return c.EnvGithubToken
 }
 
+// Secret used to sign webhook deliveries; empty when signatures are not checked
+func (c *EnvironmentConfig) GithubWebhookSecret() string {
+	return c.EnvGithubWebhookSecret
+}
+
 func (c *EnvironmentConfig) LogLevel() string {
 	return c.EnvLogLevel
 }
 
+func (c *EnvironmentConfig) Cors() CorsConfig {
+	return c.EnvCors
+}
+
 func loadFromFile(configPath string, config *EnvironmentConfig) error {
 	log := logger.FromContext(context.Background())
 	log.Infof("Loading configuration from %s", configPath)
@@ -65,6 +102,7 @@ func loadSecrets(config *EnvironmentConfig) error {
 		return fmt.Errorf("Github token was not set")
 	}
 	config.EnvGithubToken = githubToken
+	config.EnvGithubWebhookSecret = env.GetEnvWithDefault(EnvVarGithubWebhookSecret, config.EnvGithubWebhookSecret)
 	log.Info("Configuration was loaded successfully.")
 	return nil
 }
@@ -85,3 +123,18 @@ func LoadConfig(configDir string) (*EnvironmentConfig, error) {
 	}
 	return &config, err
 }
+
+// Load the CORS settings on their own, as they don't depend on the GitHub integration; empty without a config file
+func LoadCorsConfig(configDir string) (CorsConfig, error) {
+	configFile := path.Join(configDir, ConfigFileName)
+	_, err := os.Stat(configFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return CorsConfig{}, nil
+	}
+	config := EnvironmentConfig{}
+	err = loadFromFile(configFile, &config)
+	if err != nil {
+		return CorsConfig{}, fmt.Errorf("Failed to load the CORS settings: %w", err)
+	}
+	return config.Cors(), nil
+}
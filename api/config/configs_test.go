@@ -69,3 +69,40 @@ AETERNUM_LOG_LEVEL: WARN`
 	_, err = LoadConfig(dir)
 	assert.ErrorContains(t, err, "Failed to load secrets from environment")
 }
+
+func TestLoadConfigWebhookSecret(t *testing.T) {
+	dir := uniqueDir(t)
+	t.Setenv("AETERNUM_GITHUB_TOKEN", "abcdefg4321")
+	t.Setenv("AETERNUM_GITHUB_WEBHOOK_SECRET", "s3cr3t")
+	configFile := path.Join(dir, "config.yaml")
+	err := os.WriteFile(configFile, []byte(`AETERNUM_GITHUB_URL: https://github.com`), 0666)
+	assert.NoError(t, err)
+
+	config, err := LoadConfig(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", config.GithubWebhookSecret())
+}
+
+func TestLoadCorsConfig(t *testing.T) {
+	dir := uniqueDir(t)
+	configFileContents := `
+AETERNUM_LOG_LEVEL: WARN
+AETERNUM_CORS:
+  allowedOrigins:
+    - https://*.example.com
+  routes:
+    /v0/webhooks: []`
+	err := os.WriteFile(path.Join(dir, "config.yaml"), []byte(configFileContents), 0666)
+	assert.NoError(t, err)
+
+	settings, err := LoadCorsConfig(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, CorsConfig{
+		AllowedOrigins: []string{"https://*.example.com"},
+		Routes:         map[string][]string{"/v0/webhooks": {}},
+	}, settings)
+
+	settings, err = LoadCorsConfig(uniqueDir(t))
+	assert.NoError(t, err, "the config file is optional")
+	assert.Equal(t, CorsConfig{}, settings)
+}
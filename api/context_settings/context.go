@@ -6,4 +6,8 @@ const (
 	Version     string = "version"
 	Environment string = "environment"
 	Origin      string = "origin"
+	// Subject of the authenticated caller
+	Caller string = "caller"
+	// *models.Identity of the authenticated caller
+	Identity string = "identity"
 )
@@ -0,0 +1,199 @@
+package coverage
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"api/models"
+)
+
+/*
+Parse a coverage report, telling Go coverprofiles from Cobertura XML by their first line.
+
+[IN] content: the report
+
+[OUT] []models.FileCoverage: coverage of every file, sorted by path
+
+[OUT] error: ErrInvalidReport when the report is neither format
+*/
+func Parse(content io.Reader) ([]models.FileCoverage, error) {
+	reader := bufio.NewReader(content)
+	for {
+		next, err := reader.Peek(5)
+		if err == io.EOF && len(next) == 0 {
+			return nil, fmt.Errorf("%w: the report is empty", ErrInvalidReport)
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		switch {
+		case len(next) > 0 && strings.ContainsRune(" \t\r\n", rune(next[0])):
+			reader.Discard(1)
+		case len(next) > 0 && next[0] == 0xef:
+			// UTF-8 byte order mark
+			reader.Discard(3)
+		case string(next) == "mode:":
+			return parseCoverprofile(reader)
+		case next[0] == '<':
+			return parseCobertura(reader)
+		default:
+			return nil, fmt.Errorf("%w: expected a Go coverprofile or Cobertura XML", ErrInvalidReport)
+		}
+	}
+}
+
+// A block of statements in a coverprofile
+type block struct {
+	file       string
+	position   string
+	statements int
+}
+
+/*
+Statements covered in a Go coverprofile, e.g. written by `go test -coverprofile`.
+
+Each line is `<file>:<start line>.<column>,<end line>.<column> <statements> <count>`.
+Blocks listed several times, e.g. with `-coverpkg`, are covered when any of
+their counts is.
+*/
+func parseCoverprofile(content io.Reader) ([]models.FileCoverage, error) {
+	scanner := bufio.NewScanner(content)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	covered := map[block]bool{}
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if line == 1 || text == "" {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 3 || !strings.Contains(fields[0], ":") {
+			return nil, fmt.Errorf("%w: line %d is not a coverprofile block", ErrInvalidReport, line)
+		}
+		// file paths may hold colons, positions never do
+		separator := strings.LastIndex(fields[0], ":")
+		file, position := fields[0][:separator], fields[0][separator+1:]
+		if file == "" || position == "" {
+			return nil, fmt.Errorf("%w: line %d is not a coverprofile block", ErrInvalidReport, line)
+		}
+		statements, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid statement count on line %d", ErrInvalidReport, line)
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid count on line %d", ErrInvalidReport, line)
+		}
+		key := block{file: file, position: position, statements: statements}
+		covered[key] = covered[key] || count > 0
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidReport, err)
+	}
+	files := map[string]*models.FileCoverage{}
+	for key, isCovered := range covered {
+		file := fileIn(files, key.file)
+		file.Total += key.statements
+		if isCovered {
+			file.Covered += key.statements
+		}
+	}
+	return sortedFiles(files), nil
+}
+
+type cobertura struct {
+	XMLName  xml.Name           `xml:"coverage"`
+	Packages []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Classes []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Filename string          `xml:"filename,attr"`
+	Lines    []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number int `xml:"number,attr"`
+	Hits   int `xml:"hits,attr"`
+}
+
+// Lines covered in a Cobertura report; a line listed by several classes is covered when any of them hits it
+func parseCobertura(content io.Reader) ([]models.FileCoverage, error) {
+	report := cobertura{}
+	err := xml.NewDecoder(content).Decode(&report)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidReport, err)
+	}
+	lines := map[string]map[int]bool{}
+	for _, pkg := range report.Packages {
+		for _, class := range pkg.Classes {
+			if lines[class.Filename] == nil {
+				lines[class.Filename] = map[int]bool{}
+			}
+			for _, line := range class.Lines {
+				lines[class.Filename][line.Number] = lines[class.Filename][line.Number] || line.Hits > 0
+			}
+		}
+	}
+	files := map[string]*models.FileCoverage{}
+	for path, fileLines := range lines {
+		file := fileIn(files, path)
+		for _, isCovered := range fileLines {
+			file.Total++
+			if isCovered {
+				file.Covered++
+			}
+		}
+	}
+	return sortedFiles(files), nil
+}
+
+func fileIn(files map[string]*models.FileCoverage, path string) *models.FileCoverage {
+	file, ok := files[path]
+	if !ok {
+		file = &models.FileCoverage{Path: path}
+		files[path] = file
+	}
+	return file
+}
+
+func sortedFiles(files map[string]*models.FileCoverage) []models.FileCoverage {
+	fileList := make([]models.FileCoverage, 0, len(files))
+	for _, file := range files {
+		file.Percent = percent(file.Covered, file.Total)
+		fileList = append(fileList, *file)
+	}
+	sort.Slice(fileList, func(i, j int) bool {
+		return fileList[i].Path < fileList[j].Path
+	})
+	return fileList
+}
+
+func percent(covered, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(covered)*10000/float64(total)) / 100
+}
+
+// Totals of files
+func Total(files []models.FileCoverage) models.Coverage {
+	total := models.Coverage{}
+	for _, file := range files {
+		total.Covered += file.Covered
+		total.Total += file.Total
+	}
+	total.Percent = percent(total.Covered, total.Total)
+	return total
+}
@@ -0,0 +1,92 @@
+package coverage
+
+import (
+	"strings"
+	"testing"
+
+	"api/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const coverprofile string = `mode: atomic
+api/main.go:3.14,5.2 2 4
+api/main.go:7.14,9.2 1 0
+api/store/store.go:10.1,12.2 3 0
+api/store/store.go:10.1,12.2 3 1
+`
+
+const coberturaReport string = `<?xml version="1.0" ?>
+<coverage line-rate="0.5">
+  <packages>
+    <package name="app">
+      <classes>
+        <class name="App" filename="app/app.py">
+          <lines>
+            <line number="1" hits="1"/>
+            <line number="2" hits="0"/>
+          </lines>
+        </class>
+        <class name="Helper" filename="app/app.py">
+          <lines>
+            <line number="2" hits="3"/>
+            <line number="3" hits="0"/>
+          </lines>
+        </class>
+        <class name="Util" filename="app/util.py">
+          <lines>
+            <line number="1" hits="0"/>
+          </lines>
+        </class>
+      </classes>
+    </package>
+  </packages>
+</coverage>`
+
+func TestParse(t *testing.T) {
+	examples := []struct {
+		name   string
+		report string
+		files  []models.FileCoverage
+	}{
+		{
+			name:   "coverprofile",
+			report: coverprofile,
+			files: []models.FileCoverage{
+				{Path: "api/main.go", Coverage: models.Coverage{Covered: 2, Total: 3, Percent: 66.67}},
+				{Path: "api/store/store.go", Coverage: models.Coverage{Covered: 3, Total: 3, Percent: 100}},
+			},
+		},
+		{
+			name:   "cobertura",
+			report: "\ufeff" + coberturaReport,
+			files: []models.FileCoverage{
+				{Path: "app/app.py", Coverage: models.Coverage{Covered: 2, Total: 3, Percent: 66.67}},
+				{Path: "app/util.py", Coverage: models.Coverage{Covered: 0, Total: 1, Percent: 0}},
+			},
+		},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			files, err := Parse(strings.NewReader(example.report))
+			require.NoError(t, err)
+			assert.Equal(t, example.files, files)
+		})
+	}
+	assert.Equal(t, models.Coverage{Covered: 5, Total: 6, Percent: 83.33}, Total(examples[0].files))
+}
+
+func TestParseRejections(t *testing.T) {
+	for _, report := range []string{
+		"",
+		"  \n",
+		`{"Action":"pass"}`,
+		"mode: set\napi/main.go 1 1",
+		"mode: set\napi/main.go:3.14,5.2 two 1",
+		"<testsuite name=\"api\"/>",
+	} {
+		_, err := Parse(strings.NewReader(report))
+		assert.ErrorIs(t, err, ErrInvalidReport, report)
+	}
+}
@@ -0,0 +1,342 @@
+package coverage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"api/clients/githubclient"
+	"api/logger"
+	"api/models"
+	"api/paths"
+	"api/runs"
+	"api/store"
+)
+
+const ReportsBucket string = "coverage-reports"
+
+const (
+	// Larger reports are rejected rather than parsed
+	MaxReportBytes int64 = 64 << 20
+	// Runs in the coverage time series of a pipeline
+	DefaultHistory int = 30
+	MaxHistory     int = 500
+	// Files listed in a pull request comment, largest changes first
+	maxCommentFiles int = 20
+)
+
+// The report was rejected: invalid name, too large or in an unknown format
+var ErrInvalidReport = errors.New("invalid coverage report")
+
+// Returned for runs without any coverage report
+var ErrNoCoverage = errors.New("no coverage")
+
+// Comments on the pull requests of a branch, e.g. the GitHub service
+type PullRequestCommenter interface {
+	ListPullRequests(ctx context.Context, repoURL, branch string) ([]githubclient.PullRequest, error)
+	UpsertComment(ctx context.Context, repoURL string, number int, marker, body string) error
+}
+
+type Service struct {
+	store     store.Store
+	pipelines *store.Pipelines
+	runs      *store.Runs
+	comments  PullRequestCommenter
+	now       func() time.Time
+}
+
+func NewService(s store.Store) *Service {
+	return &Service{
+		store:     s,
+		pipelines: store.NewPipelines(s),
+		runs:      store.NewRuns(s),
+		now:       time.Now,
+	}
+}
+
+// Comment the coverage delta on the pull requests of the runs finished from now on
+func (s *Service) ReportPullRequests(commenter PullRequestCommenter) {
+	s.comments = commenter
+}
+
+/*
+Parse and store a coverage report uploaded by a job.
+
+Uploading the same name again from the same job replaces the report.
+
+[IN] ctx: request context
+
+[IN] runId: run of the job
+
+[IN] job: job uploading the report
+
+[IN] name: path of the report relative to the job working directory
+
+[IN] content: Go coverprofile or Cobertura XML
+
+[OUT] *models.Coverage: totals of the report
+
+[OUT] error: ErrInvalidReport when the report was rejected
+*/
+func (s *Service) Ingest(ctx context.Context, runId, job, name string, content io.Reader) (*models.Coverage, error) {
+	if !paths.Valid(name) {
+		return nil, fmt.Errorf("%w: invalid name %q", ErrInvalidReport, name)
+	}
+	limited := &io.LimitedReader{R: content, N: MaxReportBytes + 1}
+	files, err := Parse(limited)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", name, err)
+	}
+	if limited.N == 0 {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrInvalidReport, name, MaxReportBytes)
+	}
+	report := models.CoverageReport{
+		RunId:     runId,
+		Job:       job,
+		Name:      name,
+		Files:     files,
+		CreatedAt: s.now().UTC(),
+	}
+	err = store.Put(ctx, s.store, ReportsBucket, runId+"/"+job+"/"+name, report)
+	if err != nil {
+		return nil, fmt.Errorf("unable to record coverage report %s: %w", name, err)
+	}
+	total := Total(files)
+	logger.FromContext(ctx).Infof("Stored coverage report %s of job %s in run %s: %.2f%%", name, job, runId, total.Percent)
+	return &total, nil
+}
+
+/*
+Coverage of a run with its files.
+
+The reports of every job are merged, including those of the jobs reused by
+a re-run. A file found in several reports keeps its best coverage, since
+reports only tell how much of a file was covered, not which parts.
+
+[IN] ctx: request context
+
+[IN] runId: the run
+
+[OUT] *models.RunCoverage: coverage of the run
+
+[OUT] error: store.ErrNotFound when the run does not exist, ErrNoCoverage when it has no report
+*/
+func (s *Service) Run(ctx context.Context, runId string) (*models.RunCoverage, error) {
+	run, err := s.runs.Get(ctx, runId)
+	if err != nil {
+		return nil, err
+	}
+	reports, err := store.List[models.CoverageReport](ctx, s.store, ReportsBucket)
+	if err != nil {
+		return nil, err
+	}
+	return runCoverage(run, reports)
+}
+
+func runCoverage(run *models.Run, reports []models.CoverageReport) (*models.RunCoverage, error) {
+	sources := runs.JobSources(run)
+	found := false
+	files := map[string]*models.FileCoverage{}
+	for _, report := range reports {
+		if sources[report.Job] != report.RunId {
+			continue
+		}
+		found = true
+		for _, file := range report.Files {
+			merged := fileIn(files, file.Path)
+			if file.Covered > merged.Covered || (file.Covered == merged.Covered && file.Total > merged.Total) {
+				*merged = file
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: run %s has no coverage report", ErrNoCoverage, run.Id)
+	}
+	fileList := sortedFiles(files)
+	return &models.RunCoverage{
+		RunId:     run.Id,
+		Branch:    run.Branch,
+		CommitSha: run.CommitSha,
+		CreatedAt: run.CreatedAt,
+		Coverage:  Total(fileList),
+		Files:     fileList,
+	}, nil
+}
+
+/*
+Coverage time series of a pipeline, oldest run first and without files.
+
+[IN] ctx: request context
+
+[IN] pipelineId: the pipeline
+
+[IN] branch: only the runs of this branch; every run when empty
+
+[IN] limit: number of most recent runs with coverage; DefaultHistory when 0
+
+[OUT] []models.RunCoverage: coverage of the runs
+*/
+func (s *Service) History(ctx context.Context, pipelineId, branch string, limit int) ([]models.RunCoverage, error) {
+	if limit <= 0 {
+		limit = DefaultHistory
+	}
+	runList, err := s.runs.ListByPipeline(ctx, pipelineId)
+	if err != nil {
+		return nil, err
+	}
+	reports, err := store.List[models.CoverageReport](ctx, s.store, ReportsBucket)
+	if err != nil {
+		return nil, err
+	}
+	history := []models.RunCoverage{}
+	for i := range runList {
+		if len(history) == limit {
+			break
+		}
+		if branch != "" && runList[i].Branch != branch {
+			continue
+		}
+		coverage, err := runCoverage(&runList[i], reports)
+		if errors.Is(err, ErrNoCoverage) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		coverage.Files = nil
+		history = append(history, *coverage)
+	}
+	// runs come most recent first
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	return history, nil
+}
+
+/*
+Comment the coverage of a run on the open pull requests of its branch.
+
+The comment compares the run with the latest run of the pull request base
+branch having coverage, and is updated rather than posted again by the next
+runs. Nothing is posted without a commenter or when the job uploaded no
+coverage report.
+
+[IN] ctx: request context
+
+[IN] run: run of the job
+
+[IN] job: the finished job
+
+[OUT] error: for error propagation
+*/
+func (s *Service) PublishDelta(ctx context.Context, run *models.Run, job string) error {
+	if s.comments == nil || run.Branch == "" {
+		return nil
+	}
+	reports, err := store.List[models.CoverageReport](ctx, s.store, ReportsBucket)
+	if err != nil {
+		return err
+	}
+	uploaded := false
+	for _, report := range reports {
+		uploaded = uploaded || (report.RunId == run.Id && report.Job == job)
+	}
+	if !uploaded {
+		return nil
+	}
+	current, err := runCoverage(run, reports)
+	if err != nil {
+		return err
+	}
+	p, err := s.pipelines.Get(ctx, run.PipelineId)
+	if err != nil {
+		return err
+	}
+	pullRequests, err := s.comments.ListPullRequests(ctx, p.Url, run.Branch)
+	if err != nil {
+		return err
+	}
+	for _, pullRequest := range pullRequests {
+		base, err := s.History(ctx, p.Id, pullRequest.BaseBranch, 1)
+		if err != nil {
+			return err
+		}
+		var baseCoverage *models.RunCoverage
+		if len(base) > 0 {
+			baseCoverage, err = s.Run(ctx, base[0].RunId)
+			if err != nil {
+				return err
+			}
+		}
+		marker := fmt.Sprintf("<!-- aeternum-coverage:%s -->", p.Name)
+		err = s.comments.UpsertComment(ctx, p.Url, pullRequest.Number, marker, deltaComment(p.Name, pullRequest.BaseBranch, current, baseCoverage))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Markdown comparing the coverage of a run with the one of the base branch, when known
+func deltaComment(pipelineName, baseBranch string, current, base *models.RunCoverage) string {
+	text := &strings.Builder{}
+	fmt.Fprintf(text, "### Coverage of %s\n\n", pipelineName)
+	if base == nil {
+		fmt.Fprintf(text, "**%.2f%%** (%d/%d) at %s; %s has no coverage yet.\n", current.Percent, current.Covered, current.Total, shortSha(current.CommitSha), baseBranch)
+		return text.String()
+	}
+	fmt.Fprintf(text, "**%.2f%%** (%s) at %s, compared with %.2f%% on %s at %s.\n", current.Percent, signed(current.Percent-base.Percent), shortSha(current.CommitSha), base.Percent, baseBranch, shortSha(base.CommitSha))
+
+	baseFiles := map[string]models.FileCoverage{}
+	for _, file := range base.Files {
+		baseFiles[file.Path] = file
+	}
+	type fileDelta struct {
+		path    string
+		percent float64
+		delta   float64
+	}
+	changed := []fileDelta{}
+	for _, file := range current.Files {
+		previous, ok := baseFiles[file.Path]
+		if ok && previous.Covered == file.Covered && previous.Total == file.Total {
+			continue
+		}
+		changed = append(changed, fileDelta{path: file.Path, percent: file.Percent, delta: file.Percent - previous.Percent})
+	}
+	if len(changed) == 0 {
+		return text.String()
+	}
+	sort.SliceStable(changed, func(i, j int) bool {
+		return math.Abs(changed[i].delta) > math.Abs(changed[j].delta)
+	})
+	fmt.Fprintf(text, "\n| File | Coverage | Change |\n|---|---|---|\n")
+	for i, file := range changed {
+		if i == maxCommentFiles {
+			fmt.Fprintf(text, "\n... and %d more files\n", len(changed)-i)
+			break
+		}
+		fmt.Fprintf(text, "| `%s` | %.2f%% | %s |\n", file.path, file.percent, signed(file.delta))
+	}
+	return text.String()
+}
+
+func signed(delta float64) string {
+	delta = math.Round(delta*100) / 100
+	if delta >= 0 {
+		return fmt.Sprintf("+%.2f%%", delta)
+	}
+	return fmt.Sprintf("%.2f%%", delta)
+}
+
+func shortSha(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
@@ -0,0 +1,169 @@
+package coverage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"api/clients/githubclient"
+	"api/models"
+	"api/store"
+	"api/store/storetest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeComment struct {
+	repoURL string
+	number  int
+	marker  string
+	body    string
+}
+
+type fakeCommenter struct {
+	pullRequests map[string][]githubclient.PullRequest
+	comments     []fakeComment
+}
+
+func (f *fakeCommenter) ListPullRequests(ctx context.Context, repoURL, branch string) ([]githubclient.PullRequest, error) {
+	return f.pullRequests[branch], nil
+}
+
+func (f *fakeCommenter) UpsertComment(ctx context.Context, repoURL string, number int, marker, body string) error {
+	f.comments = append(f.comments, fakeComment{repoURL: repoURL, number: number, marker: marker, body: body})
+	return nil
+}
+
+func newTestService(t *testing.T) (*Service, *store.Runs) {
+	dataStore := storetest.NewStore(t)
+	service := NewService(dataStore)
+	service.now = func() time.Time { return storetest.Now }
+	return service, store.NewRuns(dataStore)
+}
+
+// A coverprofile with one block of `total` statements per file, `covered` of them in a covered block
+func profile(files map[string][2]int) string {
+	report := "mode: set\n"
+	for path, counts := range files {
+		report += fmt.Sprintf("%s:1.1,2.2 %d 1\n%s:3.1,4.2 %d 0\n", path, counts[0], path, counts[1]-counts[0])
+	}
+	return report
+}
+
+func ingest(t *testing.T, service *Service, runId, job, name, report string) models.Coverage {
+	total, err := service.Ingest(context.Background(), runId, job, name, strings.NewReader(report))
+	require.NoError(t, err)
+	return *total
+}
+
+func TestIngestAndRun(t *testing.T) {
+	ctx := context.Background()
+	service, runs := newTestService(t)
+	require.NoError(t, runs.Create(ctx, models.Run{Id: "run-1", PipelineId: "pipeline-1", Jobs: []models.Job{{Name: "unit"}, {Name: "e2e"}}}))
+	require.NoError(t, runs.Create(ctx, models.Run{Id: "run-2", PipelineId: "pipeline-1", Jobs: []models.Job{{Name: "unit", ReusedFrom: "run-1"}, {Name: "e2e"}}}))
+
+	total := ingest(t, service, "run-1", "unit", "coverage.out", profile(map[string][2]int{"api/a.go": {1, 4}, "api/b.go": {2, 2}}))
+	assert.Equal(t, models.Coverage{Covered: 3, Total: 6, Percent: 50}, total)
+	ingest(t, service, "run-1", "e2e", "coverage.out", profile(map[string][2]int{"api/a.go": {0, 4}}))
+	ingest(t, service, "run-2", "e2e", "coverage.out", profile(map[string][2]int{"api/a.go": {2, 4}}))
+
+	runCoverage, err := service.Run(ctx, "run-2")
+	require.NoError(t, err)
+	assert.Equal(t, models.Coverage{Covered: 4, Total: 6, Percent: 66.67}, runCoverage.Coverage, "files keep their best coverage across jobs, reused ones included")
+	assert.Equal(t, []models.FileCoverage{
+		{Path: "api/a.go", Coverage: models.Coverage{Covered: 2, Total: 4, Percent: 50}},
+		{Path: "api/b.go", Coverage: models.Coverage{Covered: 2, Total: 2, Percent: 100}},
+	}, runCoverage.Files)
+
+	require.NoError(t, runs.Create(ctx, models.Run{Id: "run-3", PipelineId: "pipeline-1", Jobs: []models.Job{{Name: "unit"}}}))
+	_, err = service.Run(ctx, "run-3")
+	assert.ErrorIs(t, err, ErrNoCoverage)
+	_, err = service.Run(ctx, "run-4")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestIngestRejections(t *testing.T) {
+	service, _ := newTestService(t)
+	for _, name := range []string{"", "/tmp/coverage.out", "../coverage.out", "reports//coverage.out"} {
+		_, err := service.Ingest(context.Background(), "run-1", "unit", name, strings.NewReader(coverprofile))
+		assert.ErrorIs(t, err, ErrInvalidReport, name)
+	}
+	_, err := service.Ingest(context.Background(), "run-1", "unit", "report.json", strings.NewReader(`{"Action":"pass"}`))
+	assert.ErrorIs(t, err, ErrInvalidReport)
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	service, runs := newTestService(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, branch := range []string{"main", "feature", "main", "main"} {
+		runId := fmt.Sprintf("run-%d", i)
+		require.NoError(t, runs.Create(ctx, models.Run{Id: runId, PipelineId: "pipeline-1", Branch: branch, CreatedAt: start.Add(time.Duration(i) * time.Hour), Jobs: []models.Job{{Name: "unit"}}}))
+		if i == 2 {
+			continue
+		}
+		ingest(t, service, runId, "unit", "coverage.out", profile(map[string][2]int{"api/a.go": {i, 4}}))
+	}
+
+	examples := []struct {
+		name   string
+		branch string
+		limit  int
+		runs   []string
+	}{
+		{name: "all", runs: []string{"run-0", "run-1", "run-3"}},
+		{name: "branch", branch: "main", runs: []string{"run-0", "run-3"}},
+		{name: "limit", limit: 1, runs: []string{"run-3"}},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			history, err := service.History(ctx, "pipeline-1", example.branch, example.limit)
+			require.NoError(t, err)
+			runIds := []string{}
+			for _, runCoverage := range history {
+				assert.Nil(t, runCoverage.Files)
+				runIds = append(runIds, runCoverage.RunId)
+			}
+			assert.Equal(t, example.runs, runIds)
+		})
+	}
+}
+
+func TestPublishDelta(t *testing.T) {
+	ctx := context.Background()
+	service, runs := newTestService(t)
+	base := models.Run{Id: "run-1", PipelineId: "pipeline-1", Branch: "main", CommitSha: "1111111aaa", Jobs: []models.Job{{Name: "unit"}}}
+	require.NoError(t, runs.Create(ctx, base))
+	ingest(t, service, "run-1", "unit", "coverage.out", profile(map[string][2]int{"api/a.go": {2, 4}, "api/b.go": {1, 2}}))
+	run := models.Run{Id: "run-2", PipelineId: "pipeline-1", Branch: "feature", CommitSha: "2222222bbb", CreatedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Jobs: []models.Job{{Name: "unit"}, {Name: "lint"}}}
+	require.NoError(t, runs.Create(ctx, run))
+	ingest(t, service, "run-2", "unit", "coverage.out", profile(map[string][2]int{"api/a.go": {3, 4}, "api/b.go": {1, 2}, "api/c.go": {0, 2}}))
+
+	// nothing is posted until a commenter is configured
+	require.NoError(t, service.PublishDelta(ctx, &run, "unit"))
+	commenter := &fakeCommenter{pullRequests: map[string][]githubclient.PullRequest{
+		"feature": {{Number: 7, HeadBranch: "feature", BaseBranch: "main"}, {Number: 8, HeadBranch: "feature", BaseBranch: "release"}},
+	}}
+	service.ReportPullRequests(commenter)
+	require.NoError(t, service.PublishDelta(ctx, &run, "lint"), "jobs without coverage post nothing")
+	require.NoError(t, service.PublishDelta(ctx, &run, "unit"))
+
+	assert.Equal(t, []fakeComment{
+		{
+			repoURL: "https://github.com/some-user/my-project",
+			number:  7,
+			marker:  "<!-- aeternum-coverage:api -->",
+			body: "### Coverage of api\n\n**50.00%** (+0.00%) at 2222222, compared with 50.00% on main at 1111111.\n" +
+				"\n| File | Coverage | Change |\n|---|---|---|\n| `api/a.go` | 75.00% | +25.00% |\n| `api/c.go` | 0.00% | +0.00% |\n",
+		},
+		{
+			repoURL: "https://github.com/some-user/my-project",
+			number:  8,
+			marker:  "<!-- aeternum-coverage:api -->",
+			body:    "### Coverage of api\n\n**50.00%** (4/8) at 2222222; release has no coverage yet.\n",
+		},
+	}, commenter.comments)
+}
@@ -15,7 +15,9 @@ type AboutInfo struct {
 	Languages    []string `json:"languages"`
 }
 
-type BasicErrorInfo struct {
-	StatusCode int
-	Message    string
+// A route registered on the router, e.g. GET /v0/pipelines/:id
+type RouteInfo struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Handler string `json:"handler"`
 }
@@ -3,8 +3,28 @@ package errors
 import (
 	"context"
 	"fmt"
+	"time"
 )
 
+// Machine-readable codes of the errors, for clients to tell them apart without parsing messages
+const (
+	CodeInvalidInput     string = "invalid_input"
+	CodeUnauthorized     string = "unauthorized"
+	CodeForbidden        string = "forbidden"
+	CodeNotFound         string = "not_found"
+	CodeMethodNotAllowed string = "method_not_allowed"
+	CodeConflict         string = "conflict"
+	CodeRateLimited      string = "rate_limited"
+	CodeUpstreamError    string = "upstream_error"
+)
+
+// An error the caller can act on, carrying the request context it happened in
+type CodedError interface {
+	error
+	Code() string
+	Context() context.Context
+}
+
 type InputError struct {
 	message string
 	ctx     context.Context
@@ -18,6 +38,203 @@ func (e InputError) Context() context.Context {
 	return e.ctx
 }
 
+func (e InputError) Code() string {
+	return CodeInvalidInput
+}
+
 func NewInputError(ctx context.Context, format string, a ...any) InputError {
 	return InputError{ctx: ctx, message: fmt.Errorf(format, a...).Error()}
 }
+
+// The caller could not be authenticated
+type UnauthorizedError struct {
+	message string
+	ctx     context.Context
+}
+
+func (e UnauthorizedError) Error() string {
+	return e.message
+}
+
+func (e UnauthorizedError) Context() context.Context {
+	return e.ctx
+}
+
+func (e UnauthorizedError) Code() string {
+	return CodeUnauthorized
+}
+
+func NewUnauthorizedError(ctx context.Context, format string, a ...any) UnauthorizedError {
+	return UnauthorizedError{ctx: ctx, message: fmt.Errorf(format, a...).Error()}
+}
+
+// The caller is authenticated but lacks the permission
+type ForbiddenError struct {
+	message string
+	ctx     context.Context
+}
+
+func (e ForbiddenError) Error() string {
+	return e.message
+}
+
+func (e ForbiddenError) Context() context.Context {
+	return e.ctx
+}
+
+func (e ForbiddenError) Code() string {
+	return CodeForbidden
+}
+
+func NewForbiddenError(ctx context.Context, format string, a ...any) ForbiddenError {
+	return ForbiddenError{ctx: ctx, message: fmt.Errorf(format, a...).Error()}
+}
+
+// The resource named by the request does not exist
+type NotFoundError struct {
+	message string
+	ctx     context.Context
+}
+
+func (e NotFoundError) Error() string {
+	return e.message
+}
+
+func (e NotFoundError) Context() context.Context {
+	return e.ctx
+}
+
+func (e NotFoundError) Code() string {
+	return CodeNotFound
+}
+
+func NewNotFoundError(ctx context.Context, format string, a ...any) NotFoundError {
+	return NotFoundError{ctx: ctx, message: fmt.Errorf(format, a...).Error()}
+}
+
+// The endpoint exists but does not accept the method of the request
+type MethodNotAllowedError struct {
+	message string
+	ctx     context.Context
+}
+
+func (e MethodNotAllowedError) Error() string {
+	return e.message
+}
+
+func (e MethodNotAllowedError) Context() context.Context {
+	return e.ctx
+}
+
+func (e MethodNotAllowedError) Code() string {
+	return CodeMethodNotAllowed
+}
+
+func NewMethodNotAllowedError(ctx context.Context, format string, a ...any) MethodNotAllowedError {
+	return MethodNotAllowedError{ctx: ctx, message: fmt.Errorf(format, a...).Error()}
+}
+
+// The request conflicts with the current state of the resource, e.g. cancelling a finished run
+type ConflictError struct {
+	message string
+	ctx     context.Context
+}
+
+func (e ConflictError) Error() string {
+	return e.message
+}
+
+func (e ConflictError) Context() context.Context {
+	return e.ctx
+}
+
+func (e ConflictError) Code() string {
+	return CodeConflict
+}
+
+func NewConflictError(ctx context.Context, format string, a ...any) ConflictError {
+	return ConflictError{ctx: ctx, message: fmt.Errorf(format, a...).Error()}
+}
+
+// Too many requests; the caller should retry later
+type RateLimitedError struct {
+	message string
+	ctx     context.Context
+	// Zero when unknown
+	retryAfter time.Duration
+}
+
+func (e RateLimitedError) Error() string {
+	return e.message
+}
+
+func (e RateLimitedError) Context() context.Context {
+	return e.ctx
+}
+
+func (e RateLimitedError) Code() string {
+	return CodeRateLimited
+}
+
+// How long to wait before retrying; zero when unknown
+func (e RateLimitedError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+func NewRateLimitedError(ctx context.Context, retryAfter time.Duration, format string, a ...any) RateLimitedError {
+	return RateLimitedError{ctx: ctx, retryAfter: retryAfter, message: fmt.Errorf(format, a...).Error()}
+}
+
+// A service the API depends on, such as GitHub, failed
+type UpstreamError struct {
+	ctx     context.Context
+	service string
+	// HTTP status of the upstream response; zero when there was no response
+	status int
+	err    error
+}
+
+func (e UpstreamError) Error() string {
+	if e.status == 0 {
+		return fmt.Sprintf("%s failed: %v", e.service, e.err)
+	}
+	return fmt.Sprintf("%s failed with status %d: %v", e.service, e.status, e.err)
+}
+
+func (e UpstreamError) Context() context.Context {
+	return e.ctx
+}
+
+func (e UpstreamError) Code() string {
+	return CodeUpstreamError
+}
+
+func (e UpstreamError) Unwrap() error {
+	return e.err
+}
+
+func (e UpstreamError) Service() string {
+	return e.service
+}
+
+// HTTP status of the upstream response; zero when there was no response
+func (e UpstreamError) Status() int {
+	return e.status
+}
+
+/*
+Wrap the failure of a service the API depends on.
+
+[IN] ctx: request context
+
+[IN] service: name of the upstream service, e.g. GitHub
+
+[IN] status: HTTP status of its response; zero when there was none
+
+[IN] err: the failure
+
+[OUT] UpstreamError: the wrapped failure
+*/
+func NewUpstreamError(ctx context.Context, service string, status int, err error) UpstreamError {
+	return UpstreamError{ctx: ctx, service: service, status: status, err: err}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -30,3 +31,64 @@ func TestInputErrorNewWrappedError(t *testing.T) {
 	assert.ErrorAs(t, err, &expectedError)
 	assert.Equal(t, "This is an input error: This is the root", err.Error())
 }
+
+func TestUnauthorizedError(t *testing.T) {
+	err := NewUnauthorizedError(context.Background(), "Invalid token: %w", fmt.Errorf("expired"))
+
+	var expectedError UnauthorizedError
+	assert.ErrorAs(t, err, &expectedError)
+	assert.Equal(t, "Invalid token: expired", err.Error())
+}
+
+func TestForbiddenError(t *testing.T) {
+	err := NewForbiddenError(context.Background(), "Role %s required", "admin")
+
+	var expectedError ForbiddenError
+	assert.ErrorAs(t, err, &expectedError)
+	assert.Equal(t, "Role admin required", err.Error())
+}
+
+func TestCodedErrors(t *testing.T) {
+	ctx := context.Background()
+	examples := []struct {
+		name string
+		err  CodedError
+		code string
+	}{
+		{name: "input", err: NewInputError(ctx, "Invalid"), code: CodeInvalidInput},
+		{name: "unauthorized", err: NewUnauthorizedError(ctx, "Invalid token"), code: CodeUnauthorized},
+		{name: "forbidden", err: NewForbiddenError(ctx, "Forbidden"), code: CodeForbidden},
+		{name: "not found", err: NewNotFoundError(ctx, "Pipeline %s not found", "abc"), code: CodeNotFound},
+		{name: "method not allowed", err: NewMethodNotAllowedError(ctx, "Use GET"), code: CodeMethodNotAllowed},
+		{name: "conflict", err: NewConflictError(ctx, "Run is finished"), code: CodeConflict},
+		{name: "rate limited", err: NewRateLimitedError(ctx, time.Minute, "Slow down"), code: CodeRateLimited},
+		{name: "upstream", err: NewUpstreamError(ctx, "GitHub", 500, fmt.Errorf("boom")), code: CodeUpstreamError},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			var coded CodedError
+			assert.ErrorAs(t, fmt.Errorf("Outer: %w", example.err), &coded)
+			assert.Equal(t, example.code, coded.Code())
+		})
+	}
+}
+
+func TestRateLimitedError(t *testing.T) {
+	err := NewRateLimitedError(context.Background(), 90*time.Second, "GitHub rate limit reached")
+
+	assert.Equal(t, "GitHub rate limit reached", err.Error())
+	assert.Equal(t, 90*time.Second, err.RetryAfter())
+}
+
+func TestUpstreamError(t *testing.T) {
+	root := fmt.Errorf("repository is archived")
+
+	err := NewUpstreamError(context.Background(), "GitHub", 422, root)
+	assert.Equal(t, "GitHub failed with status 422: repository is archived", err.Error())
+	assert.ErrorIs(t, err, root)
+	assert.Equal(t, "GitHub", err.Service())
+	assert.Equal(t, 422, err.Status())
+
+	unreachable := NewUpstreamError(context.Background(), "GitHub", 0, root)
+	assert.Equal(t, "GitHub failed: repository is archived", unreachable.Error())
+}
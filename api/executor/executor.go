@@ -0,0 +1,93 @@
+// Package executor runs the shell commands of job steps on the runner host.
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Time left to a step to exit after SIGTERM, before it is killed
+const DefaultGracePeriod time.Duration = 10 * time.Second
+
+// Variables of the runner environment steps inherit; the rest, e.g. the AETERNUM_* tokens, stay with the runner
+var inheritedVariables = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "LC_ALL", "LC_CTYPE", "TZ", "TMPDIR", "TERM"}
+
+// Used when the runner has no PATH
+const defaultPath string = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// Minimal environment of the steps, taken from the one of the runner
+func baseEnvironment() []string {
+	env := []string{}
+	for _, name := range inheritedVariables {
+		value, found := os.LookupEnv(name)
+		if name == "PATH" && !found {
+			value, found = defaultPath, true
+		}
+		if found {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+type Executor struct {
+	// Command prefix receiving the step script as its last argument
+	Shell       []string
+	GracePeriod time.Duration
+}
+
+func New() *Executor {
+	return &Executor{Shell: []string{"sh", "-e", "-c"}, GracePeriod: DefaultGracePeriod}
+}
+
+/*
+Run a step script to completion.
+
+The script runs in its own process group, so cancelling the context stops
+every process it started, not only the shell: the group receives SIGTERM,
+then SIGKILL after the grace period.
+
+[IN] ctx: cancelling it stops the step
+
+[IN] script: shell script of the step
+
+[IN] dir: working directory
+
+[IN] env: environment variables of the job, as KEY=value, added to a minimal base environment
+
+[IN] output: receives stdout and stderr
+
+[OUT] int: exit code of the script
+
+[OUT] error: set when the script could not run or was stopped
+*/
+func (e *Executor) Run(ctx context.Context, script string, dir string, env []string, output io.Writer) (int, error) {
+	args := append(append([]string{}, e.Shell[1:]...), script)
+	cmd := exec.CommandContext(ctx, e.Shell[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(baseEnvironment(), env...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// backstop for processes that left the group while holding the output open
+	cmd.WaitDelay = 2 * e.GracePeriod
+	cleanup := isolateProcessGroup(cmd, e.GracePeriod)
+
+	err := cmd.Run()
+	cleanup()
+	if ctx.Err() != nil {
+		return -1, fmt.Errorf("step stopped: %w", ctx.Err())
+	}
+	exitErr := &exec.ExitError{}
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, fmt.Errorf("unable to run the step: %w", err)
+	}
+	return 0, nil
+}
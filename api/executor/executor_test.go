@@ -0,0 +1,108 @@
+//go:build unix
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunReportsExitCodeAndOutput(t *testing.T) {
+	examples := []struct {
+		name     string
+		script   string
+		exitCode int
+		output   string
+	}{
+		{name: "success", script: "echo hello $GREETING", exitCode: 0, output: "hello world\n"},
+		{name: "failure", script: "echo oops >&2; exit 3", exitCode: 3, output: "oops\n"},
+		{name: "stops at the first failing command", script: "false\necho unreachable", exitCode: 1, output: ""},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			exitCode, err := New().Run(context.Background(), example.script, t.TempDir(), []string{"GREETING=world"}, output)
+			require.NoError(t, err)
+			assert.Equal(t, example.exitCode, exitCode)
+			assert.Equal(t, example.output, output.String())
+		})
+	}
+}
+
+func TestRunDoesNotLeakRunnerEnvironment(t *testing.T) {
+	t.Setenv("AETERNUM_GITHUB_TOKEN", "ghp_runner") // pragma: allowlist secret
+	t.Setenv("AETERNUM_RUNNER_REGISTRATION_TOKEN", "registration")
+	t.Setenv("SOME_RUNNER_VARIABLE", "runner")
+	t.Setenv("HOME", "/home/runner")
+	output := &bytes.Buffer{}
+
+	exitCode, err := New().Run(context.Background(), "env", t.TempDir(), []string{"JOB_VARIABLE=job"}, output)
+	require.NoError(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.NotContains(t, output.String(), "AETERNUM_")
+	assert.NotContains(t, output.String(), "SOME_RUNNER_VARIABLE")
+	assert.Contains(t, output.String(), "HOME=/home/runner\n")
+	assert.Contains(t, output.String(), "JOB_VARIABLE=job\n")
+	assert.Contains(t, output.String(), "PATH=")
+}
+
+func TestRunUsesWorkingDirectory(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "marker"), []byte("found"), 0644))
+	output := &bytes.Buffer{}
+	exitCode, err := New().Run(context.Background(), "cat marker", dir, nil, output)
+	require.NoError(t, err)
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "found", output.String())
+}
+
+func TestRunCancelKillsProcessGroup(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	executor := &Executor{Shell: []string{"sh", "-c"}, GracePeriod: time.Second}
+
+	started := time.Now()
+	// the background child keeps the output open unless the whole group is killed
+	_, err := executor.Run(ctx, "(sleep 2; touch leaked) & sleep 30", dir, nil, &bytes.Buffer{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(started), 2*time.Second)
+
+	time.Sleep(2500 * time.Millisecond)
+	assert.NoFileExists(t, filepath.Join(dir, "leaked"))
+}
+
+func TestRunCancelGracePeriod(t *testing.T) {
+	examples := []struct {
+		name       string
+		script     string
+		output     string
+		minElapsed time.Duration
+	}{
+		{name: "exits on SIGTERM", script: "trap 'echo stopping; exit 0' TERM; sleep 30 & wait", output: "stopping\n"},
+		{name: "killed after the grace period", script: "trap '' TERM; sleep 30", minElapsed: 500 * time.Millisecond},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			executor := &Executor{Shell: []string{"sh", "-c"}, GracePeriod: 500 * time.Millisecond}
+			output := &bytes.Buffer{}
+
+			started := time.Now()
+			_, err := executor.Run(ctx, example.script, t.TempDir(), nil, output)
+			elapsed := time.Since(started)
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+			assert.Equal(t, example.output, output.String())
+			assert.GreaterOrEqual(t, elapsed, 200*time.Millisecond+example.minElapsed)
+			assert.Less(t, elapsed, 5*time.Second)
+		})
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package executor
+
+import (
+	"os/exec"
+	"time"
+)
+
+// Process groups are unix-only; elsewhere only the shell itself is killed
+func isolateProcessGroup(cmd *exec.Cmd, grace time.Duration) func() {
+	return func() {}
+}
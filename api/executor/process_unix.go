@@ -0,0 +1,44 @@
+//go:build unix
+
+package executor
+
+import (
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+/*
+Start the command in a new process group and stop the whole group on cancellation.
+
+The group receives SIGTERM first, then SIGKILL once the grace period is over.
+
+[IN] cmd: command not started yet
+
+[IN] grace: time left to the processes to exit after SIGTERM
+
+[OUT] func(): call once the command returned to kill the processes it left behind
+*/
+func isolateProcessGroup(cmd *exec.Cmd, grace time.Duration) func() {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	var mu sync.Mutex
+	var kill *time.Timer
+	cmd.Cancel = func() error {
+		group := -cmd.Process.Pid
+		mu.Lock()
+		defer mu.Unlock()
+		kill = time.AfterFunc(grace, func() {
+			syscall.Kill(group, syscall.SIGKILL)
+		})
+		return syscall.Kill(group, syscall.SIGTERM)
+	}
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if kill != nil && kill.Stop() {
+			// the shell exited within the grace period; don't leave its children running
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+	}
+}
@@ -38,6 +38,7 @@ func FromContext(ctx context.Context) *logrus.Entry {
 		context_settings.Version,
 		context_settings.Environment,
 		context_settings.Origin,
+		context_settings.Caller,
 	}
 
 	for _, field := range fields {
@@ -38,6 +38,11 @@ func TestLoggerCanBeCreated(t *testing.T) {
 			context:        context.WithValue(context.Background(), context_settings.Origin, "vertex-studio@1.2.3"),
 			expectedFields: map[string]string{context_settings.Origin: "vertex-studio@1.2.3"},
 		},
+		{
+			description:    "Background context with caller",
+			context:        context.WithValue(context.Background(), context_settings.Caller, "some-user"),
+			expectedFields: map[string]string{context_settings.Caller: "some-user"},
+		},
 	}
 
 	for _, example := range examples {
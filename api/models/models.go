@@ -1,6 +1,425 @@
 package models
 
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"api/pipeline"
+)
+
 type Pipeline struct {
-	Id  string `json:"id"`
-	Url string `json:"url"`
+	Id         string              `json:"id"`
+	Url        string              `json:"url"`
+	Name       string              `json:"name"`
+	Definition pipeline.Definition `json:"definition"`
+	CreatedAt  time.Time           `json:"createdAt"`
+}
+
+// Organisation and owner/repo of the repository of the pipeline
+func (p *Pipeline) Repository() (string, string) {
+	return RepositoryOf(p.Url)
+}
+
+// Organisation and owner/repo of a repository URL, e.g. https://github.com/some-user/my-project; empty when the URL has no owner and repo
+func RepositoryOf(repoURL string) (string, string) {
+	parsed, err := url.Parse(repoURL)
+	if err != nil {
+		return "", ""
+	}
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	if len(segments) < 2 || segments[0] == "" || segments[1] == "" {
+		return "", ""
+	}
+	repo := strings.TrimSuffix(segments[1], ".git")
+	return segments[0], segments[0] + "/" + repo
+}
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+	StatusSkipped   Status = "skipped"
+)
+
+// Whether no further transitions are expected
+func (s Status) IsFinal() bool {
+	switch s {
+	case StatusSucceeded, StatusFailed, StatusCancelled, StatusSkipped:
+		return true
+	}
+	return false
+}
+
+// Reason recorded on runs whose push did not touch any filtered path
+const ReasonNoMatchingChanges string = "skipped: no matching changes"
+
+// A single execution of a pipeline
+type Run struct {
+	Id         string `json:"id"`
+	PipelineId string `json:"pipelineId"`
+	Status     Status `json:"status"`
+	Reason     string `json:"reason,omitempty"`
+	Trigger    string `json:"trigger"`
+	Branch     string `json:"branch,omitempty"`
+	CommitSha  string `json:"commitSha,omitempty"`
+	// Starts at 1 and grows with every re-run
+	Attempt int `json:"attempt"`
+	// Previous attempt, for re-runs
+	RerunOf    string     `json:"rerunOf,omitempty"`
+	Jobs       []Job      `json:"jobs"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+type Job struct {
+	Name     string   `json:"name"`
+	Status   Status   `json:"status"`
+	Needs    []string `json:"needs,omitempty"`
+	RunsOn   []string `json:"runsOn,omitempty"`
+	RunnerId string   `json:"runnerId,omitempty"`
+	// Run that executed the job, when a re-run reused its result
+	ReusedFrom string `json:"reusedFrom,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// Failed flaky tests that did not fail the job
+	Quarantined []string     `json:"quarantined,omitempty"`
+	Steps       []StepResult `json:"steps,omitempty"`
+	StartedAt   *time.Time   `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time   `json:"finishedAt,omitempty"`
+}
+
+type StepResult struct {
+	Name     string `json:"name"`
+	Status   Status `json:"status"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+}
+
+// Machine executing jobs on behalf of the API
+type Runner struct {
+	Id           string    `json:"id"`
+	Name         string    `json:"name"`
+	Labels       []string  `json:"labels"`
+	Version      string    `json:"version,omitempty"`
+	RegisteredAt time.Time `json:"registeredAt"`
+	LastSeenAt   time.Time `json:"lastSeenAt"`
+	// Derived from LastSeenAt when the runner is read
+	Status     RunnerStatus `json:"status"`
+	CurrentJob *RunnerJob   `json:"currentJob,omitempty"`
+}
+
+type RunnerStatus string
+
+const (
+	RunnerOnline  RunnerStatus = "online"
+	RunnerOffline RunnerStatus = "offline"
+)
+
+// Job being executed by a runner
+type RunnerJob struct {
+	AssignmentId string `json:"assignmentId"`
+	RunId        string `json:"runId"`
+	Job          string `json:"job"`
+}
+
+// Payload of the job queue messages
+type QueuedJob struct {
+	RunId      string   `json:"runId"`
+	PipelineId string   `json:"pipelineId"`
+	Job        string   `json:"job"`
+	RunsOn     []string `json:"runsOn,omitempty"`
+}
+
+// File uploaded by a job, e.g. a binary or a test report
+type Artifact struct {
+	// Path relative to the job working directory
+	Name  string `json:"name"`
+	RunId string `json:"runId"`
+	Job   string `json:"job"`
+	Size  int64  `json:"size"`
+	// Hex-encoded SHA-256 of the contents
+	Sha256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type TestStatus string
+
+const (
+	TestPassed  TestStatus = "passed"
+	TestFailed  TestStatus = "failed"
+	TestSkipped TestStatus = "skipped"
+)
+
+// Outcome of a test, parsed from a JUnit XML or `go test -json` report uploaded by a job
+type TestResult struct {
+	RunId string `json:"runId"`
+	Job   string `json:"job"`
+	// Report the result was parsed from, relative to the job working directory
+	Report string `json:"report"`
+	// Index of the step that wrote the report; nil when the runner did not tell
+	Step    *int       `json:"step,omitempty"`
+	Package string     `json:"package,omitempty"`
+	Name    string     `json:"name"`
+	Status  TestStatus `json:"status"`
+	// In seconds
+	Duration float64 `json:"duration"`
+	// Failure or skip message, followed by the output of failed tests
+	Message string `json:"message,omitempty"`
+}
+
+// Test results of a report, stored together
+type TestReport struct {
+	RunId     string       `json:"runId"`
+	Job       string       `json:"job"`
+	Name      string       `json:"name"`
+	Results   []TestResult `json:"results"`
+	CreatedAt time.Time    `json:"createdAt"`
+}
+
+type TestSummary struct {
+	Total   int `json:"total"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+	// Sum of the test durations, in seconds
+	Duration float64 `json:"duration"`
+}
+
+// Test that both passed and failed on a commit, or often flipped over the recent runs of a pipeline
+type FlakyTest struct {
+	Job     string `json:"job"`
+	Package string `json:"package,omitempty"`
+	Name    string `json:"name"`
+	// Passed or failed results in the analysed runs
+	Results  int `json:"results"`
+	Failures int `json:"failures"`
+	// Changes between passed and failed from one result to the next
+	Flips int `json:"flips"`
+	// Flips per pair of consecutive results
+	FlakeRate float64 `json:"flakeRate"`
+	// Commits on which the test both passed and failed
+	Commits []string `json:"commits,omitempty"`
+	// Failures no longer fail the jobs of the pipeline
+	Quarantined bool `json:"quarantined"`
+}
+
+// Covered statements, for Go coverprofiles, or lines, for Cobertura reports
+type Coverage struct {
+	Covered int `json:"covered"`
+	Total   int `json:"total"`
+	// Rounded to two decimals; 0 without anything to cover
+	Percent float64 `json:"percent"`
+}
+
+type FileCoverage struct {
+	Path string `json:"path"`
+	Coverage
+}
+
+// Coverage report uploaded by a job
+type CoverageReport struct {
+	RunId     string         `json:"runId"`
+	Job       string         `json:"job"`
+	Name      string         `json:"name"`
+	Files     []FileCoverage `json:"files"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+// Coverage of a run, merged from the reports of its jobs
+type RunCoverage struct {
+	RunId     string    `json:"runId"`
+	Branch    string    `json:"branch,omitempty"`
+	CommitSha string    `json:"commitSha,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	Coverage
+	// Sorted by path; left out of time series
+	Files []FileCoverage `json:"files,omitempty"`
+}
+
+// Archive of the cached paths of a job, shared by the runs of a pipeline
+type CacheEntry struct {
+	PipelineId string `json:"pipelineId"`
+	Key        string `json:"key"`
+	// Size of the compressed archive
+	Size       int64     `json:"size"`
+	Sha256     string    `json:"sha256"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+}
+
+// What a secret is shared with
+type SecretScope string
+
+const (
+	SecretScopeOrganisation SecretScope = "organisation"
+	SecretScopeRepository   SecretScope = "repository"
+	SecretScopePipeline     SecretScope = "pipeline"
+)
+
+// A secret as the API shows it; its value is never returned
+type Secret struct {
+	Name  string      `json:"name"`
+	Scope SecretScope `json:"scope"`
+	// Organisation, owner/repo or pipeline id
+	ScopeId   string    `json:"scopeId"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// How a caller of the API authenticated
+type AuthMethod string
+
+const (
+	AuthMethodToken AuthMethod = "token"
+	AuthMethodJWT   AuthMethod = "jwt"
+)
+
+// The authenticated caller of the API
+type Identity struct {
+	// Owner of the API token, or subject of the JWT
+	Subject string     `json:"subject"`
+	Method  AuthMethod `json:"method"`
+	// Name of the API token, or name or email of the JWT
+	Name    string `json:"name,omitempty"`
+	Issuer  string `json:"issuer,omitempty"`
+	TokenId string `json:"tokenId,omitempty"`
+	// Groups claimed by the JWT
+	Groups []string `json:"groups,omitempty"`
+	// When the API token or JWT stops being accepted; nil for tokens that never expire
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// A personal API token; only the hash of its value is stored
+type ApiToken struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	// Never expires when nil
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// Roles on a repository or a pipeline, each granting the permissions of the previous ones
+type Role string
+
+const (
+	// Read pipelines, runs, logs and artifacts
+	RoleViewer Role = "viewer"
+	// Trigger, cancel and re-run
+	RoleDeveloper Role = "developer"
+	// Manage pipelines, secrets and caches
+	RoleMaintainer Role = "maintainer"
+	// Manage the role bindings
+	RoleAdmin Role = "admin"
+)
+
+var roleRanks = map[Role]int{RoleViewer: 1, RoleDeveloper: 2, RoleMaintainer: 3, RoleAdmin: 4}
+
+func (r Role) IsValid() bool {
+	return roleRanks[r] > 0
+}
+
+// Whether the role grants the permissions of another
+func (r Role) Includes(other Role) bool {
+	return r.IsValid() && roleRanks[r] >= roleRanks[other]
+}
+
+type PrincipalType string
+
+const (
+	// Subject of an API token or JWT
+	PrincipalUser PrincipalType = "user"
+	// Group claimed by the JWTs of its members
+	PrincipalTeam PrincipalType = "team"
+)
+
+type RoleBindingScope string
+
+const (
+	RoleBindingScopeRepository RoleBindingScope = "repository"
+	RoleBindingScopePipeline   RoleBindingScope = "pipeline"
+)
+
+// A role granted to a user or team on a repository or pipeline
+type RoleBinding struct {
+	Id            string           `json:"id"`
+	Principal     string           `json:"principal"`
+	PrincipalType PrincipalType    `json:"principalType"`
+	Role          Role             `json:"role"`
+	Scope         RoleBindingScope `json:"scope"`
+	// owner/repo or pipeline id
+	ScopeId   string    `json:"scopeId"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type PermissionAction string
+
+const (
+	PermissionGranted PermissionAction = "granted"
+	PermissionRevoked PermissionAction = "revoked"
+)
+
+// An entry of the audit trail of the role bindings
+type PermissionChange struct {
+	Id      string           `json:"id"`
+	Action  PermissionAction `json:"action"`
+	Binding RoleBinding      `json:"binding"`
+	// Role the principal had before a grant replaced it
+	PreviousRole Role      `json:"previousRole,omitempty"`
+	Actor        string    `json:"actor,omitempty"`
+	At           time.Time `json:"at"`
+}
+
+// What a caller did, as <resource>.<verb>
+type AuditAction string
+
+const (
+	AuditPipelineCreate AuditAction = "pipeline.create"
+	AuditRunTrigger     AuditAction = "run.trigger"
+	AuditRunCancel      AuditAction = "run.cancel"
+	AuditRunRerun       AuditAction = "run.rerun"
+	AuditSecretPut      AuditAction = "secret.put"
+	AuditSecretDelete   AuditAction = "secret.delete"
+	AuditCacheDelete    AuditAction = "cache.delete"
+	AuditTokenCreate    AuditAction = "token.create"
+	AuditTokenRevoke    AuditAction = "token.revoke"
+	AuditRoleGrant      AuditAction = "role.grant"
+	AuditRoleRevoke     AuditAction = "role.revoke"
+	AuditRunnerRegister AuditAction = "runner.register"
+	AuditRunnerDelete   AuditAction = "runner.delete"
+)
+
+// Kind of resource the action changed, e.g. pipeline
+func (a AuditAction) Resource() string {
+	resource, _, _ := strings.Cut(string(a), ".")
+	return resource
+}
+
+// A field changed by an audited action, as a dotted JSON path
+type FieldChange struct {
+	Field string `json:"field"`
+	// Absent when the field was added
+	Before any `json:"before,omitempty"`
+	// Absent when the field was removed
+	After any `json:"after,omitempty"`
+}
+
+// An entry of the audit log of the mutating API actions
+type AuditEvent struct {
+	Id         string      `json:"id"`
+	At         time.Time   `json:"at"`
+	Actor      string      `json:"actor,omitempty"`
+	Action     AuditAction `json:"action"`
+	Resource   string      `json:"resource"`
+	ResourceId string      `json:"resourceId,omitempty"`
+	RequestId  string      `json:"requestId,omitempty"`
+	// Client sending the request, from its X-Origin-Info header
+	Origin  string        `json:"origin,omitempty"`
+	Changes []FieldChange `json:"changes,omitempty"`
 }
@@ -0,0 +1,17 @@
+// Package paths validates the relative paths runners upload files under.
+package paths
+
+import "strings"
+
+// Relative slash-separated path without empty, `.` or `..` segments, so it stays inside the directory it is joined to
+func Valid(name string) bool {
+	if name == "" || strings.ContainsRune(name, '\\') {
+		return false
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
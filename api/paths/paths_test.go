@@ -0,0 +1,16 @@
+package paths
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValid(t *testing.T) {
+	for _, name := range []string{"coverage.out", "reports/unit.xml", "run-1/.hidden", "run-1/a b"} {
+		assert.True(t, Valid(name), name)
+	}
+	for _, name := range []string{"", "/etc/passwd", "../secrets", "reports//unit.xml", "./unit.xml", `reports\unit.xml`, "reports/"} {
+		assert.False(t, Valid(name), name)
+	}
+}
@@ -0,0 +1,129 @@
+package pipeline
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Longest cache key once its expressions are expanded
+const maxCacheKeyLength int = 512
+
+var (
+	cacheExpressionRegex = regexp.MustCompile(`\$\{\{\s*(.*?)\s*\}\}`)
+	hashFilesRegex       = regexp.MustCompile(`^hashFiles\((.*)\)$`)
+	quotedArgumentRegex  = regexp.MustCompile(`^'([^']*)'$`)
+)
+
+// Files saved once a job succeeded and restored before the following runs of the pipeline
+type Cache struct {
+	// May depend on file contents through ${{ hashFiles('<glob>', ...) }}, e.g. go-${{ hashFiles('**/go.sum') }}
+	Key string `yaml:"key" json:"key"`
+	// Key prefixes to fall back to when nothing matches the key, most preferred first
+	RestoreKeys []string `yaml:"restore-keys" json:"restoreKeys,omitempty"`
+	// Files and directories relative to the working directory, or to the runner home with `~/`
+	Paths []string `yaml:"paths" json:"paths"`
+}
+
+/*
+Expand the expressions of the key and the restore keys.
+
+[IN] hashFiles: hash of the files matching the glob patterns, relative to the working directory
+
+[OUT] string: the key
+
+[OUT] []string: the restore keys
+
+[OUT] error: when hashing fails or the key ends up too long
+*/
+func (c Cache) ExpandKeys(hashFiles func(patterns []string) (string, error)) (string, []string, error) {
+	key, err := expandCacheKey(c.Key, hashFiles)
+	if err != nil {
+		return "", nil, err
+	}
+	restoreKeys := []string{}
+	for _, restoreKey := range c.RestoreKeys {
+		expanded, err := expandCacheKey(restoreKey, hashFiles)
+		if err != nil {
+			return "", nil, err
+		}
+		restoreKeys = append(restoreKeys, expanded)
+	}
+	return key, restoreKeys, nil
+}
+
+func (c Cache) validate(job string) error {
+	if strings.TrimSpace(c.Key) == "" {
+		return fmt.Errorf("a cache of job %s has no key", job)
+	}
+	if len(c.Paths) == 0 {
+		return fmt.Errorf("the cache %s of job %s has no paths", c.Key, job)
+	}
+	for _, key := range append([]string{c.Key}, c.RestoreKeys...) {
+		_, err := expandCacheKey(key, func(patterns []string) (string, error) { return "", nil })
+		if err != nil {
+			return fmt.Errorf("invalid cache key %q in job %s: %w", key, job, err)
+		}
+	}
+	for _, cachePath := range c.Paths {
+		if !ValidCachePath(cachePath) {
+			return fmt.Errorf("invalid cache path %q in job %s: use a relative path without '..', or one starting with ~/", cachePath, job)
+		}
+	}
+	return nil
+}
+
+// Whether a cache path stays inside the working directory or the runner home
+func ValidCachePath(cachePath string) bool {
+	relative := strings.TrimPrefix(cachePath, "~/")
+	if relative == "" || strings.HasPrefix(relative, "/") || strings.Contains(relative, "\\") {
+		return false
+	}
+	if path.Clean(relative) != strings.TrimSuffix(relative, "/") {
+		return false
+	}
+	return relative != "." && relative != ".." && !strings.HasPrefix(relative, "../")
+}
+
+func expandCacheKey(key string, hashFiles func(patterns []string) (string, error)) (string, error) {
+	var expandErr error
+	expanded := cacheExpressionRegex.ReplaceAllStringFunc(key, func(expression string) string {
+		inner := cacheExpressionRegex.FindStringSubmatch(expression)[1]
+		patterns, err := hashFilesPatterns(inner)
+		if err != nil {
+			expandErr = err
+			return ""
+		}
+		hash, err := hashFiles(patterns)
+		if err != nil {
+			expandErr = fmt.Errorf("unable to hash %s: %w", strings.Join(patterns, ", "), err)
+			return ""
+		}
+		return hash
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+	if len(expanded) > maxCacheKeyLength {
+		return "", fmt.Errorf("the cache key is longer than %d characters", maxCacheKeyLength)
+	}
+	return expanded, nil
+}
+
+// Patterns of a hashFiles('<glob>', ...) call, the only supported expression
+func hashFilesPatterns(expression string) ([]string, error) {
+	call := hashFilesRegex.FindStringSubmatch(expression)
+	if call == nil {
+		return nil, fmt.Errorf("unsupported expression %q, only hashFiles('<glob>', ...) is", expression)
+	}
+	patterns := []string{}
+	for _, argument := range strings.Split(call[1], ",") {
+		quoted := quotedArgumentRegex.FindStringSubmatch(strings.TrimSpace(argument))
+		if quoted == nil || quoted[1] == "" {
+			return nil, fmt.Errorf("hashFiles takes single-quoted glob patterns, got %q", argument)
+		}
+		patterns = append(patterns, quoted[1])
+	}
+	return patterns, nil
+}
@@ -0,0 +1,41 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheExpandKeys(t *testing.T) {
+	cache := Cache{
+		Key:         "go-${{ hashFiles('**/go.sum', '!vendor/**') }}-v1",
+		RestoreKeys: []string{"go-", "${{hashFiles('go.mod')}}"},
+		Paths:       []string{".gomodcache"},
+	}
+	hashed := [][]string{}
+	key, restoreKeys, err := cache.ExpandKeys(func(patterns []string) (string, error) {
+		hashed = append(hashed, patterns)
+		return fmt.Sprintf("hash%d", len(hashed)), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "go-hash1-v1", key)
+	assert.Equal(t, []string{"go-", "hash2"}, restoreKeys)
+	assert.Equal(t, [][]string{{"**/go.sum", "!vendor/**"}, {"go.mod"}}, hashed)
+
+	_, _, err = cache.ExpandKeys(func(patterns []string) (string, error) {
+		return strings.Repeat("a", 600), nil
+	})
+	assert.ErrorContains(t, err, "longer than 512 characters")
+}
+
+func TestValidCachePath(t *testing.T) {
+	for _, valid := range []string{".gomodcache", "node_modules/", "~/go/pkg/mod", "build/cache"} {
+		assert.True(t, ValidCachePath(valid), valid)
+	}
+	for _, invalid := range []string{"", "~/", "/root/go", "../shared", "a/../../b", ".", "a//b", "./a", `a\b`} {
+		assert.False(t, ValidCachePath(invalid), invalid)
+	}
+}
@@ -0,0 +1,112 @@
+package pipeline
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Whether a push to the branch should start the pipeline
+func (t *PushTrigger) MatchesBranch(branch string) bool {
+	if len(t.Branches) > 0 && !matchesPatterns(t.Branches, branch) {
+		return false
+	}
+	return !(len(t.BranchesIgnore) > 0 && matchesPatterns(t.BranchesIgnore, branch))
+}
+
+/*
+Whether the changed files of a push should start the pipeline.
+
+A file is relevant when it matches `paths` (or there are none) and does not
+match `paths-ignore`; the pipeline runs when at least one file is relevant.
+
+[IN] changedFiles: paths changed by the push; nil when they could not be determined
+
+[OUT] bool: true if the pipeline should run
+*/
+func (t *PushTrigger) MatchesPaths(changedFiles []string) bool {
+	if len(t.Paths) == 0 && len(t.PathsIgnore) == 0 {
+		return true
+	}
+	// without the list of changes, running is safer than skipping
+	if changedFiles == nil {
+		return true
+	}
+	for _, file := range changedFiles {
+		if len(t.Paths) > 0 && !matchesPatterns(t.Paths, file) {
+			continue
+		}
+		if len(t.PathsIgnore) > 0 && matchesPatterns(t.PathsIgnore, file) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// Whether a file, relative to the job working directory, is an artifact
+func (a *Artifacts) Matches(path string) bool {
+	return matchesPatterns(a.Paths, path)
+}
+
+// Whether a file matches glob patterns with `!` exclusions, e.g. those of hashFiles
+func MatchesFiles(patterns []string, path string) bool {
+	return matchesPatterns(patterns, path)
+}
+
+// Patterns are evaluated in order and a `!` prefix negates a previous match,
+// so ["docs/**", "!docs/internal/**"] matches docs outside docs/internal.
+func matchesPatterns(patterns []string, value string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		if negated {
+			pattern = pattern[1:]
+		}
+		if globToRegex(pattern).MatchString(value) {
+			matched = !negated
+		}
+	}
+	return matched
+}
+
+// Translate a glob into an anchored regular expression:
+// `**` matches anything, `*` anything but `/`, `?` a single non-`/` character.
+func globToRegex(pattern string) *regexp.Regexp {
+	builder := strings.Builder{}
+	builder.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		char := pattern[i]
+		switch {
+		case char == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			i++
+			// "**/" also matches zero directories
+			if i+1 < len(pattern) && pattern[i+1] == '/' {
+				i++
+				builder.WriteString("(.*/)?")
+			} else {
+				builder.WriteString(".*")
+			}
+		case char == '*':
+			builder.WriteString("[^/]*")
+		case char == '?':
+			builder.WriteString("[^/]")
+		case char == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				builder.WriteString(regexp.QuoteMeta(string(char)))
+				continue
+			}
+			builder.WriteString(pattern[i : i+end+1])
+			i += end
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+	builder.WriteString("$")
+	compiled, err := regexp.Compile(builder.String())
+	if err != nil {
+		// malformed character classes match nothing rather than everything
+		return regexp.MustCompile(`^\b$`)
+	}
+	return compiled
+}
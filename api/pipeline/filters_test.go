@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlobPatterns(t *testing.T) {
+	examples := []struct {
+		pattern string
+		value   string
+		match   bool
+	}{
+		{"docs/*", "docs/index.md", true},
+		{"docs/*", "docs/guide/index.md", false},
+		{"docs/**", "docs/guide/index.md", true},
+		{"**/*.md", "README.md", true},
+		{"**/*.md", "api/docs/README.md", true},
+		{"**/*.md", "api/main.go", false},
+		{"api/**/*_test.go", "api/store/store_test.go", true},
+		{"api/**/*_test.go", "api/store_test.go", true},
+		{"file?.go", "file1.go", true},
+		{"file?.go", "file/.go", false},
+		{"v[0-9].go", "v1.go", true},
+		{"v[0-9].go", "va.go", false},
+		{"release/*", "release/1.0", true},
+		{"main", "main", true},
+		{"main", "maintenance", false},
+		{"*.go", "a+b.go", true},
+		{"v[0-9.go", "v[0-9.go", true},
+	}
+	for _, example := range examples {
+		assert.Equal(t, example.match, globToRegex(example.pattern).MatchString(example.value), "%s ~ %s", example.pattern, example.value)
+	}
+}
+
+func TestNegatedPatterns(t *testing.T) {
+	patterns := []string{"docs/**", "!docs/internal/**"}
+	assert.True(t, matchesPatterns(patterns, "docs/index.md"))
+	assert.False(t, matchesPatterns(patterns, "docs/internal/notes.md"))
+	assert.False(t, matchesPatterns(patterns, "api/main.go"))
+}
+
+func TestMatchesBranch(t *testing.T) {
+	examples := []struct {
+		trigger PushTrigger
+		branch  string
+		match   bool
+	}{
+		{PushTrigger{}, "anything", true},
+		{PushTrigger{Branches: []string{"main", "release/**"}}, "release/1.x/rc", true},
+		{PushTrigger{Branches: []string{"main"}}, "feature/x", false},
+		{PushTrigger{BranchesIgnore: []string{"dependabot/**"}}, "dependabot/go/x", false},
+		{PushTrigger{BranchesIgnore: []string{"dependabot/**"}}, "main", true},
+	}
+	for _, example := range examples {
+		assert.Equal(t, example.match, example.trigger.MatchesBranch(example.branch), "%+v on %s", example.trigger, example.branch)
+	}
+}
+
+func TestMatchesPaths(t *testing.T) {
+	examples := []struct {
+		name    string
+		trigger PushTrigger
+		files   []string
+		match   bool
+	}{
+		{"no filters", PushTrigger{}, []string{"README.md"}, true},
+		{"unknown changes", PushTrigger{Paths: []string{"api/**"}}, nil, true},
+		{"no changes", PushTrigger{Paths: []string{"api/**"}}, []string{}, false},
+		{"matching path", PushTrigger{Paths: []string{"api/**"}}, []string{"README.md", "api/main.go"}, true},
+		{"no matching path", PushTrigger{Paths: []string{"api/**"}}, []string{"README.md"}, false},
+		{"only ignored", PushTrigger{PathsIgnore: []string{"**/*.md", "docs/**"}}, []string{"README.md", "docs/a.png"}, false},
+		{"some not ignored", PushTrigger{PathsIgnore: []string{"**/*.md"}}, []string{"README.md", "go.work"}, true},
+		{"matching but ignored", PushTrigger{Paths: []string{"api/**"}, PathsIgnore: []string{"**/*.md"}}, []string{"api/README.md", "docs/x.go"}, false},
+		{"matching and not ignored", PushTrigger{Paths: []string{"api/**"}, PathsIgnore: []string{"**/*.md"}}, []string{"api/README.md", "api/x.go"}, true},
+	}
+	for _, example := range examples {
+		assert.Equal(t, example.match, example.trigger.MatchesPaths(example.files), example.name)
+	}
+}
@@ -0,0 +1,67 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	// the server image has no zoneinfo, so timezones are resolved from the copy built into the binary
+	_ "time/tzdata"
+
+	"github.com/robfig/cron/v3"
+)
+
+// A recurring trigger using a standard five-field cron expression, e.g. "30 2 * * 1-5".
+// Descriptors such as @daily are accepted too.
+type Schedule struct {
+	Cron string `yaml:"cron" json:"cron"`
+	// IANA time zone the expression is evaluated in; UTC when empty
+	Timezone string `yaml:"timezone" json:"timezone,omitempty"`
+}
+
+// Expressions such as "0 0 30 2 *" parse but match no date, so they are rejected too
+func (s Schedule) Validate() error {
+	_, err := s.Next(time.Now())
+	return err
+}
+
+// First fire time strictly after the given time; an error when there is none
+func (s Schedule) Next(after time.Time) (time.Time, error) {
+	schedule, err := s.parse()
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := schedule.Next(after)
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("invalid cron expression %q: it never fires", s.Cron)
+	}
+	return next, nil
+}
+
+func (s Schedule) location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.UTC, nil
+	}
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule timezone %s: %w", s.Timezone, err)
+	}
+	return location, nil
+}
+
+func (s Schedule) parse() (cron.Schedule, error) {
+	if strings.HasPrefix(s.Cron, "TZ=") || strings.HasPrefix(s.Cron, "CRON_TZ=") {
+		return nil, fmt.Errorf("invalid cron expression %q: use the timezone field instead", s.Cron)
+	}
+	location, err := s.location()
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := cron.ParseStandard(s.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", s.Cron, err)
+	}
+	if spec, ok := schedule.(*cron.SpecSchedule); ok {
+		spec.Location = location
+	}
+	return schedule, nil
+}
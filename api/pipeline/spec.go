@@ -0,0 +1,222 @@
+// Package pipeline defines the YAML format describing a CI pipeline.
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Location of the pipeline definition inside a repository, unless told otherwise
+const DefaultDefinitionPath string = ".aeternum/pipeline.yaml"
+
+// Applies to jobs without timeout-minutes
+const DefaultJobTimeoutMinutes int = 360
+
+// Job names end up in URLs and log file names
+var jobNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+type Definition struct {
+	Name string   `yaml:"name" json:"name"`
+	On   Triggers `yaml:"on" json:"on"`
+	// Maximum duration of a run once its first job started; 0 for no limit
+	TimeoutMinutes int `yaml:"timeout-minutes" json:"timeoutMinutes,omitempty"`
+	// Cancel the unfinished runs of a branch when a push starts a new one
+	CancelSuperseded bool `yaml:"cancel-superseded" json:"cancelSuperseded,omitempty"`
+	// Let jobs succeed when their only failed tests are known to be flaky
+	QuarantineFlakyTests bool           `yaml:"quarantine-flaky-tests" json:"quarantineFlakyTests,omitempty"`
+	Jobs                 map[string]Job `yaml:"jobs" json:"jobs"`
+}
+
+// Events that start the pipeline
+type Triggers struct {
+	Push     *PushTrigger `yaml:"push" json:"push,omitempty"`
+	Schedule []Schedule   `yaml:"schedule" json:"schedule,omitempty"`
+}
+
+// Filters restricting which pushes start the pipeline. Every filter is a list
+// of glob patterns where `*` matches within a path segment and `**` across them.
+type PushTrigger struct {
+	Branches       []string `yaml:"branches" json:"branches,omitempty"`
+	BranchesIgnore []string `yaml:"branches-ignore" json:"branchesIgnore,omitempty"`
+	Paths          []string `yaml:"paths" json:"paths,omitempty"`
+	PathsIgnore    []string `yaml:"paths-ignore" json:"pathsIgnore,omitempty"`
+}
+
+type Job struct {
+	Needs []string `yaml:"needs" json:"needs,omitempty"`
+	// Labels a runner must all have to execute the job
+	RunsOn []string `yaml:"runs-on" json:"runsOn,omitempty"`
+	// Defaults to DefaultJobTimeoutMinutes
+	TimeoutMinutes int    `yaml:"timeout-minutes" json:"timeoutMinutes,omitempty"`
+	Steps          []Step `yaml:"steps" json:"steps"`
+	// Files uploaded once the steps are over, whatever their outcome
+	Artifacts *Artifacts `yaml:"artifacts" json:"artifacts,omitempty"`
+	Cache     []Cache    `yaml:"cache" json:"cache,omitempty"`
+	// Glob patterns of the JUnit XML or `go test -json` reports written by the steps
+	TestReports []string `yaml:"test-reports" json:"testReports,omitempty"`
+	// Glob patterns of the Go coverprofiles or Cobertura XML reports written by the steps
+	CoverageReports []string `yaml:"coverage-reports" json:"coverageReports,omitempty"`
+}
+
+// Outputs of a job kept after its workspace is gone, e.g. binaries and test reports
+type Artifacts struct {
+	// Glob patterns relative to the working directory, with `!` exclusions
+	Paths []string `yaml:"paths" json:"paths"`
+	// Days the files are kept; the server default applies when 0
+	RetentionDays int `yaml:"retention-days" json:"retentionDays,omitempty"`
+}
+
+// Maximum duration of the job on a runner
+func (j Job) Timeout() time.Duration {
+	if j.TimeoutMinutes == 0 {
+		return time.Duration(DefaultJobTimeoutMinutes) * time.Minute
+	}
+	return time.Duration(j.TimeoutMinutes) * time.Minute
+}
+
+type Step struct {
+	Name string `yaml:"name" json:"name,omitempty"`
+	Run  string `yaml:"run" json:"run"`
+}
+
+// Parse and validate a pipeline definition
+func Parse(data []byte) (*Definition, error) {
+	definition := &Definition{}
+	err := yaml.Unmarshal(data, definition)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline YAML: %w", err)
+	}
+	err = definition.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return definition, nil
+}
+
+func (d *Definition) Validate() error {
+	if d.Name == "" {
+		return fmt.Errorf("the pipeline needs a name")
+	}
+	if len(d.Jobs) == 0 {
+		return fmt.Errorf("the pipeline %s has no jobs", d.Name)
+	}
+	if d.TimeoutMinutes < 0 {
+		return fmt.Errorf("the pipeline timeout-minutes cannot be negative")
+	}
+	for _, schedule := range d.On.Schedule {
+		err := schedule.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	for name, job := range d.Jobs {
+		if !jobNameRegex.MatchString(name) {
+			return fmt.Errorf("invalid job name %q: use letters, digits, '.', '_' and '-'", name)
+		}
+		if len(job.Steps) == 0 {
+			return fmt.Errorf("the job %s has no steps", name)
+		}
+		if job.TimeoutMinutes < 0 {
+			return fmt.Errorf("the timeout-minutes of job %s cannot be negative", name)
+		}
+		for i, step := range job.Steps {
+			if step.Run == "" {
+				return fmt.Errorf("step %d of job %s has nothing to run", i+1, name)
+			}
+		}
+		if job.Artifacts != nil {
+			err := job.Artifacts.validate(name)
+			if err != nil {
+				return err
+			}
+		}
+		for _, cache := range job.Cache {
+			err := cache.validate(name)
+			if err != nil {
+				return err
+			}
+		}
+		for _, pattern := range job.TestReports {
+			if strings.TrimSpace(strings.TrimPrefix(pattern, "!")) == "" {
+				return fmt.Errorf("the job %s has an empty test-reports path", name)
+			}
+		}
+		for _, pattern := range job.CoverageReports {
+			if strings.TrimSpace(strings.TrimPrefix(pattern, "!")) == "" {
+				return fmt.Errorf("the job %s has an empty coverage-reports path", name)
+			}
+		}
+		for _, label := range job.RunsOn {
+			if strings.TrimSpace(label) == "" {
+				return fmt.Errorf("the job %s has an empty runs-on label", name)
+			}
+		}
+		for _, need := range job.Needs {
+			if _, ok := d.Jobs[need]; !ok {
+				return fmt.Errorf("the job %s needs the unknown job %s", name, need)
+			}
+		}
+	}
+	_, err := d.JobOrder()
+	return err
+}
+
+func (a *Artifacts) validate(job string) error {
+	if len(a.Paths) == 0 {
+		return fmt.Errorf("the artifacts of job %s have no paths", job)
+	}
+	for _, pattern := range a.Paths {
+		if strings.TrimSpace(strings.TrimPrefix(pattern, "!")) == "" {
+			return fmt.Errorf("the job %s has an empty artifact path", job)
+		}
+	}
+	if a.RetentionDays < 0 {
+		return fmt.Errorf("the artifact retention-days of job %s cannot be negative", job)
+	}
+	return nil
+}
+
+// Job names sorted so that every job comes after the jobs it needs
+func (d *Definition) JobOrder() ([]string, error) {
+	names := make([]string, 0, len(d.Jobs))
+	for name := range d.Jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	order := make([]string, 0, len(names))
+	state := map[string]int{} // 1: visiting, 2: done
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("the jobs have a dependency cycle: %v", append(path, name))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		needs := append([]string{}, d.Jobs[name].Needs...)
+		sort.Strings(needs)
+		for _, need := range needs {
+			err := visit(need, append(path, name))
+			if err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range names {
+		err := visit(name, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
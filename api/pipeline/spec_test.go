@@ -0,0 +1,106 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDefinition(t *testing.T) {
+	definition, err := Parse([]byte(`
+name: build
+on:
+  push:
+    branches: [main]
+    paths: ["api/**"]
+    paths-ignore: ["**/*.md"]
+jobs:
+  test:
+    steps:
+      - run: go test ./...
+  build:
+    needs: [test]
+    timeout-minutes: 30
+    steps:
+      - name: compile
+        run: go build ./...
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "build", definition.Name)
+	assert.Equal(t, []string{"main"}, definition.On.Push.Branches)
+	assert.Equal(t, []string{"api/**"}, definition.On.Push.Paths)
+	assert.Equal(t, []string{"**/*.md"}, definition.On.Push.PathsIgnore)
+	assert.Equal(t, 30*time.Minute, definition.Jobs["build"].Timeout())
+	assert.Equal(t, 6*time.Hour, definition.Jobs["test"].Timeout())
+
+	order, err := definition.JobOrder()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test", "build"}, order)
+}
+
+func TestParseInvalidDefinition(t *testing.T) {
+	examples := []struct {
+		definition string
+		err        string
+	}{
+		{"name: [", "invalid pipeline YAML"},
+		{"jobs: {a: {steps: [{run: x}]}}", "needs a name"},
+		{"name: p", "has no jobs"},
+		{"name: p\njobs: {a: {}}", "job a has no steps"},
+		{"name: p\njobs: {../a: {steps: [{run: x}]}}", "invalid job name"},
+		{"name: p\njobs: {a: {steps: [{name: x}]}}", "step 1 of job a has nothing to run"},
+		{"name: p\njobs: {a: {needs: [b], steps: [{run: x}]}}", "needs the unknown job b"},
+		{"name: p\njobs: {a: {runs-on: [linux, ' '], steps: [{run: x}]}}", "empty runs-on label"},
+		{"name: p\ntimeout-minutes: -1\njobs: {a: {steps: [{run: x}]}}", "pipeline timeout-minutes cannot be negative"},
+		{"name: p\njobs: {a: {timeout-minutes: -5, steps: [{run: x}]}}", "timeout-minutes of job a cannot be negative"},
+		{"name: p\njobs: {a: {artifacts: {}, steps: [{run: x}]}}", "artifacts of job a have no paths"},
+		{"name: p\njobs: {a: {artifacts: {paths: ['!']}, steps: [{run: x}]}}", "empty artifact path"},
+		{"name: p\njobs: {a: {artifacts: {paths: [bin/*], retention-days: -1}, steps: [{run: x}]}}", "retention-days of job a cannot be negative"},
+		{"name: p\njobs: {a: {cache: [{paths: [vendor]}], steps: [{run: x}]}}", "a cache of job a has no key"},
+		{"name: p\njobs: {a: {cache: [{key: go}], steps: [{run: x}]}}", "cache go of job a has no paths"},
+		{"name: p\njobs: {a: {cache: [{key: '${{ env.HOME }}', paths: [vendor]}], steps: [{run: x}]}}", "unsupported expression"},
+		{"name: p\njobs: {a: {cache: [{key: '${{ hashFiles(go.sum) }}', paths: [vendor]}], steps: [{run: x}]}}", "single-quoted glob patterns"},
+		{"name: p\njobs: {a: {cache: [{key: go, paths: [../vendor]}], steps: [{run: x}]}}", "invalid cache path"},
+		{"name: p\njobs: {a: {test-reports: [' '], steps: [{run: x}]}}", "empty test-reports path"},
+		{"name: p\njobs: {a: {coverage-reports: ['!'], steps: [{run: x}]}}", "empty coverage-reports path"},
+		{"name: p\njobs: {a: {needs: [b], steps: [{run: x}]}, b: {needs: [a], steps: [{run: x}]}}", "dependency cycle"},
+		{"name: p\non: {schedule: [{cron: '61 * * * *'}]}\njobs: {a: {steps: [{run: x}]}}", "invalid cron expression"},
+		{"name: p\non: {schedule: [{cron: 'TZ=UTC 0 * * * *'}]}\njobs: {a: {steps: [{run: x}]}}", "use the timezone field"},
+		{"name: p\non: {schedule: [{cron: '@daily', timezone: Mars/Olympus}]}\njobs: {a: {steps: [{run: x}]}}", "invalid schedule timezone"},
+		{"name: p\non: {schedule: [{cron: '0 0 30 2 *'}]}\njobs: {a: {steps: [{run: x}]}}", "never fires"},
+	}
+	for _, example := range examples {
+		_, err := Parse([]byte(example.definition))
+		assert.ErrorContains(t, err, example.err, example.definition)
+	}
+}
+
+func TestParseScheduleTimezones(t *testing.T) {
+	for _, timezone := range []string{"UTC", "Europe/Berlin", "Asia/Kolkata", "America/Sao_Paulo"} {
+		definition, err := Parse([]byte("name: p\non: {schedule: [{cron: '@daily', timezone: " + timezone + "}]}\njobs: {a: {steps: [{run: x}]}}"))
+		require.NoError(t, err, timezone)
+		assert.Equal(t, timezone, definition.On.Schedule[0].Timezone)
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	examples := []struct {
+		schedule Schedule
+		after    time.Time
+		next     time.Time
+	}{
+		{Schedule{Cron: "30 2 * * 1-5"}, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), time.Date(2024, 3, 4, 2, 30, 0, 0, time.UTC)},
+		{Schedule{Cron: "@daily", Timezone: "America/New_York"}, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), time.Date(2024, 3, 2, 5, 0, 0, 0, time.UTC)},
+		{Schedule{Cron: "0 * * * *"}, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 13, 0, 0, 0, time.UTC)},
+		// 03:00 in Berlin is 01:00 UTC once summer time started on March 31
+		{Schedule{Cron: "0 3 * * *", Timezone: "Europe/Berlin"}, time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC), time.Date(2024, 4, 1, 1, 0, 0, 0, time.UTC)},
+		{Schedule{Cron: "30 9 * * *", Timezone: "Asia/Kolkata"}, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), time.Date(2024, 3, 2, 4, 0, 0, 0, time.UTC)},
+	}
+	for _, example := range examples {
+		next, err := example.schedule.Next(example.after)
+		require.NoError(t, err)
+		assert.Equal(t, example.next, next.UTC(), example.schedule.Cron)
+	}
+}
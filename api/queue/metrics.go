@@ -0,0 +1,39 @@
+package queue
+
+import (
+	"context"
+
+	"api/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var queueDepthDesc = prometheus.NewDesc(
+	"queue_depth",
+	"Number of pending messages in a job queue",
+	[]string{"queue", "lane"}, nil,
+)
+
+// Reports the depth of a queue when scraped, so every replica shows the shared state
+type DepthCollector struct {
+	queue *StoreQueue
+}
+
+func NewDepthCollector(q *StoreQueue) *DepthCollector {
+	return &DepthCollector{queue: q}
+}
+
+func (c *DepthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+}
+
+func (c *DepthCollector) Collect(ch chan<- prometheus.Metric) {
+	depth, err := c.queue.Depth(context.Background())
+	if err != nil {
+		logger.FromContext(context.Background()).Warnf("Unable to collect the queue depth: %v", err)
+		return
+	}
+	for _, lane := range Lanes {
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(depth[lane]), c.queue.Name(), string(lane))
+	}
+}
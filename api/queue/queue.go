@@ -0,0 +1,91 @@
+// Package queue provides a durable job queue with at-least-once delivery.
+//
+// Consumers lease a message for a visibility timeout and must ack it before
+// the timeout expires, extending it with heartbeats for long jobs. Messages
+// whose lease expires are delivered again; after too many attempts they are
+// moved to the dead-letter list for inspection.
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Priority lanes, consumed in this order
+type Lane string
+
+const (
+	LaneHigh   Lane = "high"
+	LaneNormal Lane = "normal"
+	LaneLow    Lane = "low"
+)
+
+var Lanes = []Lane{LaneHigh, LaneNormal, LaneLow}
+
+func (l Lane) priority() int {
+	for i, lane := range Lanes {
+		if lane == l {
+			return i
+		}
+	}
+	return len(Lanes)
+}
+
+const (
+	DefaultVisibilityTimeout time.Duration = 5 * time.Minute
+	DefaultMaxAttempts       int           = 3
+)
+
+// Returned when acting on a message whose lease expired or was taken over
+var ErrLeaseLost = errors.New("the message lease was lost")
+
+type Message struct {
+	Id      string          `json:"id"`
+	Lane    Lane            `json:"lane"`
+	Payload json.RawMessage `json:"payload"`
+	// Number of times the message was leased
+	Attempts    int       `json:"attempts"`
+	MaxAttempts int       `json:"maxAttempts"`
+	EnqueuedAt  time.Time `json:"enqueuedAt"`
+	// The message is not delivered before this time, e.g. after a nack with delay
+	AvailableAt    time.Time  `json:"availableAt"`
+	LeaseId        string     `json:"leaseId,omitempty"`
+	LeasedBy       string     `json:"leasedBy,omitempty"`
+	LeaseExpiresAt *time.Time `json:"leaseExpiresAt,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+}
+
+// Decode the payload into the given value
+func (m *Message) Decode(value any) error {
+	return json.Unmarshal(m.Payload, value)
+}
+
+type EnqueueOptions struct {
+	Lane Lane
+	// Defaults to DefaultMaxAttempts
+	MaxAttempts int
+	// Delay before the first delivery
+	Delay time.Duration
+}
+
+// Tells whether a consumer accepts a message; nil accepts every message
+type Filter func(message *Message) bool
+
+type Queue interface {
+	Enqueue(ctx context.Context, payload any, options EnqueueOptions) (*Message, error)
+	// Lease the next available message accepted by the filter for the visibility timeout; nil when there is none
+	Lease(ctx context.Context, consumer string, visibility time.Duration, accept Filter) (*Message, error)
+	// Whether Lease has anything to do for the filter, checked without writing so idle consumers can poll
+	Leasable(ctx context.Context, accept Filter) (bool, error)
+	// Extend the lease of a message being processed
+	Heartbeat(ctx context.Context, id, leaseId string, visibility time.Duration) error
+	// Remove a processed message
+	Ack(ctx context.Context, id, leaseId string) error
+	// Return a message for another attempt after the delay, or dead-letter it once out of attempts
+	Nack(ctx context.Context, id, leaseId string, reason string, delay time.Duration) error
+	DeadLetters(ctx context.Context) ([]Message, error)
+	// Number of pending messages, leased or not, per lane
+	Depth(ctx context.Context) (map[Lane]int, error)
+}
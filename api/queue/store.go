@@ -0,0 +1,253 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"api/logger"
+	"api/store"
+
+	"github.com/google/uuid"
+)
+
+// Queue persisted in a store bucket, shared by every replica using the store.
+// Dead letters stay in the same bucket so moving a message is atomic.
+type StoreQueue struct {
+	store  store.Store
+	name   string
+	bucket string
+	now    func() time.Time
+}
+
+func NewStoreQueue(s store.Store, name string) *StoreQueue {
+	return &StoreQueue{store: s, name: name, bucket: "queue-" + name, now: time.Now}
+}
+
+// Replace the clock of the leases, e.g. to expire them in the tests of the packages using the queue
+func (q *StoreQueue) SetClock(now func() time.Time) {
+	q.now = now
+}
+
+func (q *StoreQueue) Name() string {
+	return q.name
+}
+
+// Persisted message, with the dead-letter state kept out of the public type
+type record struct {
+	Message
+	DeadAt *time.Time `json:"deadAt,omitempty"`
+}
+
+func (q *StoreQueue) Enqueue(ctx context.Context, payload any, options EnqueueOptions) (*Message, error) {
+	lane := options.Lane
+	if lane == "" {
+		lane = LaneNormal
+	}
+	if lane.priority() == len(Lanes) {
+		return nil, fmt.Errorf("unknown queue lane %s", lane)
+	}
+	maxAttempts := options.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode the message payload: %w", err)
+	}
+
+	now := q.now().UTC()
+	message := Message{
+		Id:          uuid.NewString(),
+		Lane:        lane,
+		Payload:     encoded,
+		MaxAttempts: maxAttempts,
+		EnqueuedAt:  now,
+		AvailableAt: now.Add(options.Delay),
+	}
+	err = store.Insert(ctx, q.store, q.bucket, message.Id, record{Message: message})
+	if err != nil {
+		return nil, fmt.Errorf("unable to enqueue in %s: %w", q.name, err)
+	}
+	return &message, nil
+}
+
+func (q *StoreQueue) Lease(ctx context.Context, consumer string, visibility time.Duration, accept Filter) (*Message, error) {
+	log := logger.FromContext(ctx)
+	var leased *Message
+	err := q.store.Update(ctx, q.bucket, func(b store.Bucket) error {
+		now := q.now().UTC()
+		candidates, err := q.available(b, now)
+		if err != nil {
+			return err
+		}
+		for _, candidate := range candidates {
+			if candidate.Attempts >= candidate.MaxAttempts {
+				// the last consumer died without acking
+				log.Warnf("Dead-lettering message %s of %s after %d attempts", candidate.Id, q.name, candidate.Attempts)
+				candidate.LastError = "lease expired on the last attempt"
+				err = q.kill(b, candidate, now)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if accept != nil && !accept(&candidate.Message) {
+				continue
+			}
+			expiresAt := now.Add(visibility)
+			candidate.Attempts++
+			candidate.LeaseId = uuid.NewString()
+			candidate.LeasedBy = consumer
+			candidate.LeaseExpiresAt = &expiresAt
+			err = store.Encode(b, candidate.Id, *candidate)
+			if err != nil {
+				return err
+			}
+			leased = &candidate.Message
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to lease from %s: %w", q.name, err)
+	}
+	return leased, nil
+}
+
+func (q *StoreQueue) Leasable(ctx context.Context, accept Filter) (bool, error) {
+	leasable := false
+	err := q.store.View(ctx, q.bucket, func(b store.Bucket) error {
+		candidates, err := q.available(b, q.now().UTC())
+		if err != nil {
+			return err
+		}
+		for _, candidate := range candidates {
+			// out of attempts, Lease dead-letters it whatever the filter
+			if candidate.Attempts >= candidate.MaxAttempts || accept == nil || accept(&candidate.Message) {
+				leasable = true
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("unable to check %s for messages: %w", q.name, err)
+	}
+	return leasable, nil
+}
+
+func (q *StoreQueue) Heartbeat(ctx context.Context, id, leaseId string, visibility time.Duration) error {
+	return q.withLease(ctx, id, leaseId, func(b store.Bucket, r *record, now time.Time) error {
+		expiresAt := now.Add(visibility)
+		r.LeaseExpiresAt = &expiresAt
+		return store.Encode(b, id, *r)
+	})
+}
+
+func (q *StoreQueue) Ack(ctx context.Context, id, leaseId string) error {
+	return q.withLease(ctx, id, leaseId, func(b store.Bucket, r *record, now time.Time) error {
+		b.Delete(id)
+		return nil
+	})
+}
+
+func (q *StoreQueue) Nack(ctx context.Context, id, leaseId string, reason string, delay time.Duration) error {
+	return q.withLease(ctx, id, leaseId, func(b store.Bucket, r *record, now time.Time) error {
+		r.LastError = reason
+		if r.Attempts >= r.MaxAttempts {
+			logger.FromContext(ctx).Warnf("Dead-lettering message %s of %s after %d attempts: %s", id, q.name, r.Attempts, reason)
+			return q.kill(b, r, now)
+		}
+		r.LeaseId = ""
+		r.LeasedBy = ""
+		r.LeaseExpiresAt = nil
+		r.AvailableAt = now.Add(delay)
+		return store.Encode(b, id, *r)
+	})
+}
+
+func (q *StoreQueue) DeadLetters(ctx context.Context) ([]Message, error) {
+	records, err := store.List[record](ctx, q.store, q.bucket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the dead letters of %s: %w", q.name, err)
+	}
+	messages := []Message{}
+	for _, r := range records {
+		if r.DeadAt != nil {
+			messages = append(messages, r.Message)
+		}
+	}
+	return messages, nil
+}
+
+func (q *StoreQueue) Depth(ctx context.Context) (map[Lane]int, error) {
+	records, err := store.List[record](ctx, q.store, q.bucket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to count the messages of %s: %w", q.name, err)
+	}
+	depth := map[Lane]int{}
+	for _, lane := range Lanes {
+		depth[lane] = 0
+	}
+	for _, r := range records {
+		if r.DeadAt == nil {
+			depth[r.Lane]++
+		}
+	}
+	return depth, nil
+}
+
+// Deliverable messages in delivery order: by lane, then oldest first
+func (q *StoreQueue) available(b store.Bucket, now time.Time) ([]*record, error) {
+	candidates := []*record{}
+	for _, key := range b.Keys() {
+		r, err := store.Decode[record](b, key)
+		if err != nil {
+			return nil, err
+		}
+		if r.DeadAt != nil || r.AvailableAt.After(now) {
+			continue
+		}
+		if r.LeaseExpiresAt != nil && r.LeaseExpiresAt.After(now) {
+			continue
+		}
+		candidates = append(candidates, r)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Lane != b.Lane {
+			return a.Lane.priority() < b.Lane.priority()
+		}
+		if !a.AvailableAt.Equal(b.AvailableAt) {
+			return a.AvailableAt.Before(b.AvailableAt)
+		}
+		return a.EnqueuedAt.Before(b.EnqueuedAt)
+	})
+	return candidates, nil
+}
+
+func (q *StoreQueue) kill(b store.Bucket, r *record, now time.Time) error {
+	r.DeadAt = &now
+	r.LeaseId = ""
+	r.LeasedBy = ""
+	r.LeaseExpiresAt = nil
+	return store.Encode(b, r.Id, *r)
+}
+
+// Run fn on a message only if the caller still holds its lease
+func (q *StoreQueue) withLease(ctx context.Context, id, leaseId string, fn func(b store.Bucket, r *record, now time.Time) error) error {
+	return q.store.Update(ctx, q.bucket, func(b store.Bucket) error {
+		now := q.now().UTC()
+		r, err := store.Decode[record](b, id)
+		if err != nil {
+			return fmt.Errorf("%w: message %s: %v", ErrLeaseLost, id, err)
+		}
+		if r.DeadAt != nil || r.LeaseId != leaseId || r.LeaseExpiresAt == nil || !r.LeaseExpiresAt.After(now) {
+			return fmt.Errorf("%w: message %s", ErrLeaseLost, id)
+		}
+		return fn(b, r, now)
+	})
+}
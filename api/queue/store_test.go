@@ -0,0 +1,285 @@
+package queue
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api/store"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	mu      sync.Mutex
+	current time.Time
+}
+
+func (f *fakeClock) now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.current
+}
+
+func (f *fakeClock) advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.current = f.current.Add(d)
+}
+
+func newTestQueue(t *testing.T) (*StoreQueue, *fakeClock) {
+	clock := &fakeClock{current: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	q := NewStoreQueue(store.NewMemoryStore(), "jobs")
+	q.now = clock.now
+	return q, clock
+}
+
+func leasePayload(t *testing.T, q *StoreQueue) (*Message, string) {
+	message, err := q.Lease(context.Background(), "worker", time.Minute, nil)
+	require.NoError(t, err)
+	if message == nil {
+		return nil, ""
+	}
+	payload := ""
+	require.NoError(t, message.Decode(&payload))
+	return message, payload
+}
+
+func TestQueueDeliveryOrder(t *testing.T) {
+	ctx := context.Background()
+	q, clock := newTestQueue(t)
+	examples := []struct {
+		payload string
+		lane    Lane
+	}{
+		{"low", LaneLow},
+		{"normal-1", LaneNormal},
+		{"high", LaneHigh},
+		{"normal-2", ""},
+	}
+	for _, example := range examples {
+		_, err := q.Enqueue(ctx, example.payload, EnqueueOptions{Lane: example.lane})
+		require.NoError(t, err)
+		clock.advance(time.Second)
+	}
+	_, err := q.Enqueue(ctx, "unknown", EnqueueOptions{Lane: "urgent"})
+	assert.ErrorContains(t, err, "unknown queue lane")
+
+	depth, err := q.Depth(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[Lane]int{LaneHigh: 1, LaneNormal: 2, LaneLow: 1}, depth)
+
+	for _, expected := range []string{"high", "normal-1", "normal-2", "low"} {
+		message, payload := leasePayload(t, q)
+		require.NotNil(t, message)
+		assert.Equal(t, expected, payload)
+		assert.Equal(t, 1, message.Attempts)
+		require.NoError(t, q.Ack(ctx, message.Id, message.LeaseId))
+	}
+	message, _ := leasePayload(t, q)
+	assert.Nil(t, message)
+}
+
+func TestQueueLeaseFilter(t *testing.T) {
+	ctx := context.Background()
+	q, clock := newTestQueue(t)
+	for _, payload := range []string{"gpu", "cpu"} {
+		_, err := q.Enqueue(ctx, payload, EnqueueOptions{})
+		require.NoError(t, err)
+		clock.advance(time.Second)
+	}
+	cpuOnly := func(message *Message) bool {
+		payload := ""
+		return message.Decode(&payload) == nil && payload == "cpu"
+	}
+
+	message, err := q.Lease(ctx, "cpu-worker", time.Minute, cpuOnly)
+	require.NoError(t, err)
+	require.NotNil(t, message)
+	payload := ""
+	require.NoError(t, message.Decode(&payload))
+	assert.Equal(t, "cpu", payload, "rejected messages are passed over")
+	message, err = q.Lease(ctx, "cpu-worker", time.Minute, cpuOnly)
+	require.NoError(t, err)
+	assert.Nil(t, message)
+
+	message, payload = leasePayload(t, q)
+	require.NotNil(t, message)
+	assert.Equal(t, "gpu", payload)
+	assert.Equal(t, 1, message.Attempts, "rejections don't count as attempts")
+}
+
+func TestQueueLeasable(t *testing.T) {
+	ctx := context.Background()
+	q, clock := newTestQueue(t)
+	cpuOnly := func(message *Message) bool {
+		payload := ""
+		return message.Decode(&payload) == nil && payload == "cpu"
+	}
+	leasable, err := q.Leasable(ctx, nil)
+	require.NoError(t, err)
+	assert.False(t, leasable, "empty queue")
+
+	_, err = q.Enqueue(ctx, "gpu", EnqueueOptions{MaxAttempts: 1})
+	require.NoError(t, err)
+	leasable, err = q.Leasable(ctx, cpuOnly)
+	require.NoError(t, err)
+	assert.False(t, leasable, "rejected by the filter")
+	leasable, err = q.Leasable(ctx, nil)
+	require.NoError(t, err)
+	assert.True(t, leasable)
+
+	message, _ := leasePayload(t, q)
+	require.NotNil(t, message)
+	leasable, err = q.Leasable(ctx, nil)
+	require.NoError(t, err)
+	assert.False(t, leasable, "leased")
+
+	clock.advance(2 * time.Minute)
+	leasable, err = q.Leasable(ctx, cpuOnly)
+	require.NoError(t, err)
+	assert.True(t, leasable, "out of attempts, for Lease to dead-letter it")
+}
+
+func TestQueueVisibilityTimeout(t *testing.T) {
+	ctx := context.Background()
+	q, clock := newTestQueue(t)
+	_, err := q.Enqueue(ctx, "job", EnqueueOptions{})
+	require.NoError(t, err)
+
+	first, _ := leasePayload(t, q)
+	require.NotNil(t, first)
+	other, _ := leasePayload(t, q)
+	assert.Nil(t, other, "leased messages are invisible")
+
+	clock.advance(50 * time.Second)
+	require.NoError(t, q.Heartbeat(ctx, first.Id, first.LeaseId, time.Minute))
+	clock.advance(50 * time.Second)
+	other, _ = leasePayload(t, q)
+	assert.Nil(t, other, "the heartbeat extended the lease")
+
+	clock.advance(11 * time.Second)
+	second, _ := leasePayload(t, q)
+	require.NotNil(t, second, "the message is redelivered once the lease expires")
+	assert.Equal(t, first.Id, second.Id)
+	assert.Equal(t, 2, second.Attempts)
+
+	assert.ErrorIs(t, q.Ack(ctx, first.Id, first.LeaseId), ErrLeaseLost)
+	assert.ErrorIs(t, q.Heartbeat(ctx, first.Id, first.LeaseId, time.Minute), ErrLeaseLost)
+	require.NoError(t, q.Ack(ctx, second.Id, second.LeaseId))
+	assert.ErrorIs(t, q.Ack(ctx, second.Id, second.LeaseId), ErrLeaseLost)
+}
+
+func TestQueueNackAndDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	q, clock := newTestQueue(t)
+	_, err := q.Enqueue(ctx, "flaky", EnqueueOptions{MaxAttempts: 2})
+	require.NoError(t, err)
+
+	message, _ := leasePayload(t, q)
+	require.NoError(t, q.Nack(ctx, message.Id, message.LeaseId, "exit code 1", 10*time.Second))
+	other, _ := leasePayload(t, q)
+	assert.Nil(t, other, "nacked messages wait for the delay")
+
+	clock.advance(10 * time.Second)
+	message, _ = leasePayload(t, q)
+	require.NotNil(t, message)
+	assert.Equal(t, "exit code 1", message.LastError)
+	require.NoError(t, q.Nack(ctx, message.Id, message.LeaseId, "exit code 2", 0))
+
+	other, _ = leasePayload(t, q)
+	assert.Nil(t, other, "out of attempts")
+	deadLetters, err := q.DeadLetters(ctx)
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, "exit code 2", deadLetters[0].LastError)
+	assert.Equal(t, 2, deadLetters[0].Attempts)
+
+	depth, err := q.Depth(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, depth[LaneNormal])
+}
+
+func TestQueueDeadLettersExpiredLastAttempt(t *testing.T) {
+	ctx := context.Background()
+	q, clock := newTestQueue(t)
+	_, err := q.Enqueue(ctx, "crashing", EnqueueOptions{MaxAttempts: 1})
+	require.NoError(t, err)
+
+	message, _ := leasePayload(t, q)
+	require.NotNil(t, message)
+	clock.advance(2 * time.Minute)
+	message, _ = leasePayload(t, q)
+	assert.Nil(t, message)
+
+	deadLetters, err := q.DeadLetters(ctx)
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, "lease expired on the last attempt", deadLetters[0].LastError)
+}
+
+func TestQueueConcurrentConsumers(t *testing.T) {
+	ctx := context.Background()
+	// two replicas sharing the same data directory
+	dir := t.TempDir()
+	dataStore, err := store.NewFileStore(dir)
+	require.NoError(t, err)
+	producer := NewStoreQueue(dataStore, "jobs")
+	otherStore, err := store.NewFileStore(dir)
+	require.NoError(t, err)
+	consumers := []*StoreQueue{producer, NewStoreQueue(otherStore, "jobs")}
+
+	for i := 0; i < 20; i++ {
+		_, err := producer.Enqueue(ctx, i, EnqueueOptions{})
+		require.NoError(t, err)
+	}
+
+	mu := sync.Mutex{}
+	delivered := map[string]int{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(q *StoreQueue) {
+			defer wg.Done()
+			for {
+				message, err := q.Lease(ctx, "worker", time.Minute, nil)
+				assert.NoError(t, err)
+				if message == nil {
+					return
+				}
+				mu.Lock()
+				delivered[message.Id]++
+				mu.Unlock()
+				assert.NoError(t, q.Ack(ctx, message.Id, message.LeaseId))
+			}
+		}(consumers[i%2])
+	}
+	wg.Wait()
+
+	assert.Len(t, delivered, 20)
+	for id, count := range delivered {
+		assert.Equal(t, 1, count, id)
+	}
+}
+
+func TestDepthCollector(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQueue(t)
+	_, err := q.Enqueue(ctx, "a", EnqueueOptions{Lane: LaneHigh})
+	require.NoError(t, err)
+	_, err = q.Enqueue(ctx, "b", EnqueueOptions{Lane: LaneHigh})
+	require.NoError(t, err)
+
+	expected := `
+# HELP queue_depth Number of pending messages in a job queue
+# TYPE queue_depth gauge
+queue_depth{lane="high",queue="jobs"} 2
+queue_depth{lane="low",queue="jobs"} 0
+queue_depth{lane="normal",queue="jobs"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(NewDepthCollector(q), strings.NewReader(expected)))
+}
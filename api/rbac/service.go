@@ -0,0 +1,286 @@
+// Package rbac authorizes the callers of the HTTP API with roles bound to
+// users and teams on a repository or a pipeline.
+//
+// A pipeline inherits the bindings of its repository, the highest role
+// winning. Administrators named in the configuration hold the admin role
+// everywhere, so that the first bindings can be granted. Every grant and
+// revocation is recorded in an audit trail.
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"api/logger"
+	"api/models"
+	"api/store"
+
+	"github.com/google/uuid"
+)
+
+const (
+	BindingsBucket string = "role-bindings"
+	ChangesBucket  string = "permission-changes"
+)
+
+var (
+	// The caller lacks the role required for an action
+	ErrForbidden = errors.New("forbidden")
+	// Unknown role, principal type or scope
+	ErrInvalidBinding = errors.New("invalid role binding")
+)
+
+type Service struct {
+	store     store.Store
+	pipelines *store.Pipelines
+	// Subjects holding the admin role everywhere
+	admins []string
+	now    func() time.Time
+}
+
+/*
+Create the authorization service.
+
+[IN] s: store holding the role bindings and their audit trail
+
+[IN] admins: subjects holding the admin role on every repository and pipeline
+
+[OUT] *Service: the authorization service
+*/
+func NewService(s store.Store, admins []string) *Service {
+	return &Service{store: s, pipelines: store.NewPipelines(s), admins: admins, now: time.Now}
+}
+
+// Whether the identity is one of the configured administrators
+func (s *Service) IsAdmin(identity *models.Identity) bool {
+	return identity != nil && slices.Contains(s.admins, identity.Subject)
+}
+
+/*
+Highest role of an identity on a repository or pipeline.
+
+[IN] ctx: request context
+
+[IN] identity: the caller
+
+[IN] scope: repository or pipeline
+
+[IN] scopeId: owner/repo or pipeline id
+
+[OUT] models.Role: empty when the identity has no role there
+
+[OUT] error: store.ErrNotFound when the pipeline does not exist
+*/
+func (s *Service) Role(ctx context.Context, identity *models.Identity, scope models.RoleBindingScope, scopeId string) (models.Role, error) {
+	if s.IsAdmin(identity) {
+		return models.RoleAdmin, nil
+	}
+	scopes := map[models.RoleBindingScope]string{scope: scopeId}
+	if scope == models.RoleBindingScopePipeline {
+		p, err := s.pipelines.Get(ctx, scopeId)
+		if err != nil {
+			return "", err
+		}
+		_, repository := p.Repository()
+		if repository != "" {
+			scopes[models.RoleBindingScopeRepository] = repository
+		}
+	}
+	bindings, err := store.List[models.RoleBinding](ctx, s.store, BindingsBucket)
+	if err != nil {
+		return "", err
+	}
+	var role models.Role
+	for _, binding := range bindings {
+		if scopes[binding.Scope] != binding.ScopeId || !binds(binding, identity) {
+			continue
+		}
+		if !role.Includes(binding.Role) {
+			role = binding.Role
+		}
+	}
+	return role, nil
+}
+
+/*
+Check that an identity holds a role on a repository or pipeline.
+
+[IN] ctx: request context
+
+[IN] identity: the caller
+
+[IN] scope: repository or pipeline
+
+[IN] scopeId: owner/repo or pipeline id
+
+[IN] required: the lowest role allowed
+
+[OUT] error: ErrForbidden when the identity lacks the role, store.ErrNotFound for unknown pipelines
+*/
+func (s *Service) Authorize(ctx context.Context, identity *models.Identity, scope models.RoleBindingScope, scopeId string, required models.Role) error {
+	role, err := s.Role(ctx, identity, scope, scopeId)
+	if err != nil {
+		return err
+	}
+	if !role.Includes(required) {
+		return fmt.Errorf("%w: the %s role on %s %s is required", ErrForbidden, required, scope, scopeId)
+	}
+	return nil
+}
+
+// Whether a binding applies to an identity, directly or through one of its teams
+func binds(binding models.RoleBinding, identity *models.Identity) bool {
+	if identity == nil {
+		return false
+	}
+	switch binding.PrincipalType {
+	case models.PrincipalUser:
+		return binding.Principal == identity.Subject
+	case models.PrincipalTeam:
+		return slices.Contains(identity.Groups, binding.Principal)
+	default:
+		return false
+	}
+}
+
+// Bindings on a repository or pipeline, oldest first
+func (s *Service) Bindings(ctx context.Context, scope models.RoleBindingScope, scopeId string) ([]models.RoleBinding, error) {
+	bindings, err := store.List[models.RoleBinding](ctx, s.store, BindingsBucket)
+	if err != nil {
+		return nil, err
+	}
+	matching := []models.RoleBinding{}
+	for _, binding := range bindings {
+		if binding.Scope == scope && binding.ScopeId == scopeId {
+			matching = append(matching, binding)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return matching[i].CreatedAt.Before(matching[j].CreatedAt)
+	})
+	return matching, nil
+}
+
+/*
+Grant a role to a user or team, replacing the role it had on the same repository or pipeline.
+
+[IN] ctx: request context
+
+[IN] actor: subject granting the role, for the audit trail
+
+[IN] binding: principal, role and scope to bind
+
+[OUT] *models.RoleBinding: the stored binding
+
+[OUT] error: ErrInvalidBinding for unknown roles, principal types or scopes
+*/
+func (s *Service) Grant(ctx context.Context, actor string, binding models.RoleBinding) (*models.RoleBinding, error) {
+	err := validate(binding)
+	if err != nil {
+		return nil, err
+	}
+	binding.Id = uuid.NewString()
+	binding.CreatedBy = actor
+	binding.CreatedAt = s.now().UTC()
+	var previousRole models.Role
+	err = s.store.Update(ctx, BindingsBucket, func(b store.Bucket) error {
+		for _, id := range b.Keys() {
+			existing, err := store.Decode[models.RoleBinding](b, id)
+			if err != nil {
+				return err
+			}
+			if existing.Scope == binding.Scope && existing.ScopeId == binding.ScopeId &&
+				existing.PrincipalType == binding.PrincipalType && existing.Principal == binding.Principal {
+				previousRole = existing.Role
+				b.Delete(id)
+			}
+		}
+		return store.Encode(b, binding.Id, binding)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to grant %s to %s %s: %w", binding.Role, binding.PrincipalType, binding.Principal, err)
+	}
+	err = s.record(ctx, models.PermissionChange{Action: models.PermissionGranted, Binding: binding, PreviousRole: previousRole, Actor: actor})
+	if err != nil {
+		return nil, err
+	}
+	logger.FromContext(ctx).Infof("Granted %s on %s %s to %s %s", binding.Role, binding.Scope, binding.ScopeId, binding.PrincipalType, binding.Principal)
+	return &binding, nil
+}
+
+// Revoke a binding of a repository or pipeline; store.ErrNotFound when it has none with the id
+func (s *Service) Revoke(ctx context.Context, actor string, scope models.RoleBindingScope, scopeId, id string) error {
+	var revoked models.RoleBinding
+	err := s.store.Update(ctx, BindingsBucket, func(b store.Bucket) error {
+		binding, err := store.Decode[models.RoleBinding](b, id)
+		if err != nil {
+			return err
+		}
+		if binding.Scope != scope || binding.ScopeId != scopeId {
+			return fmt.Errorf("%w: role binding %s", store.ErrNotFound, id)
+		}
+		revoked = *binding
+		b.Delete(id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = s.record(ctx, models.PermissionChange{Action: models.PermissionRevoked, Binding: revoked, Actor: actor})
+	if err != nil {
+		return err
+	}
+	logger.FromContext(ctx).Infof("Revoked %s on %s %s from %s %s", revoked.Role, scope, scopeId, revoked.PrincipalType, revoked.Principal)
+	return nil
+}
+
+// Audit trail of the bindings of a repository or pipeline, oldest first
+func (s *Service) Changes(ctx context.Context, scope models.RoleBindingScope, scopeId string) ([]models.PermissionChange, error) {
+	changes, err := store.List[models.PermissionChange](ctx, s.store, ChangesBucket)
+	if err != nil {
+		return nil, err
+	}
+	matching := []models.PermissionChange{}
+	for _, change := range changes {
+		if change.Binding.Scope == scope && change.Binding.ScopeId == scopeId {
+			matching = append(matching, change)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].At.Before(matching[j].At)
+	})
+	return matching, nil
+}
+
+func (s *Service) record(ctx context.Context, change models.PermissionChange) error {
+	change.Id = uuid.NewString()
+	change.At = s.now().UTC()
+	err := store.Insert(ctx, s.store, ChangesBucket, change.Id, change)
+	if err != nil {
+		return fmt.Errorf("unable to record the permission change: %w", err)
+	}
+	return nil
+}
+
+func validate(binding models.RoleBinding) error {
+	if !binding.Role.IsValid() {
+		return fmt.Errorf("%w: unknown role %q", ErrInvalidBinding, binding.Role)
+	}
+	if binding.PrincipalType != models.PrincipalUser && binding.PrincipalType != models.PrincipalTeam {
+		return fmt.Errorf("%w: unknown principal type %q", ErrInvalidBinding, binding.PrincipalType)
+	}
+	if binding.Principal == "" {
+		return fmt.Errorf("%w: the principal is required", ErrInvalidBinding)
+	}
+	if binding.Scope != models.RoleBindingScopeRepository && binding.Scope != models.RoleBindingScopePipeline {
+		return fmt.Errorf("%w: unknown scope %q", ErrInvalidBinding, binding.Scope)
+	}
+	if binding.ScopeId == "" {
+		return fmt.Errorf("%w: the %s is required", ErrInvalidBinding, binding.Scope)
+	}
+	return nil
+}
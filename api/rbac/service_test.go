@@ -0,0 +1,131 @@
+package rbac
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"api/models"
+	"api/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestService(t *testing.T) *Service {
+	dataStore := store.NewMemoryStore()
+	require.NoError(t, store.NewPipelines(dataStore).Create(context.Background(), models.Pipeline{
+		Id:  "pipeline-1",
+		Url: "https://github.com/some-user/my-project",
+	}))
+	service := NewService(dataStore, []string{"root"})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	service.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	return service
+}
+
+func grant(t *testing.T, service *Service, principalType models.PrincipalType, principal string, role models.Role, scope models.RoleBindingScope, scopeId string) *models.RoleBinding {
+	binding, err := service.Grant(context.Background(), "root", models.RoleBinding{
+		Principal:     principal,
+		PrincipalType: principalType,
+		Role:          role,
+		Scope:         scope,
+		ScopeId:       scopeId,
+	})
+	require.NoError(t, err)
+	return binding
+}
+
+func TestRole(t *testing.T) {
+	service := newTestService(t)
+	grant(t, service, models.PrincipalUser, "alice", models.RoleViewer, models.RoleBindingScopeRepository, "some-user/my-project")
+	grant(t, service, models.PrincipalUser, "alice", models.RoleMaintainer, models.RoleBindingScopePipeline, "pipeline-1")
+	grant(t, service, models.PrincipalTeam, "ops", models.RoleDeveloper, models.RoleBindingScopeRepository, "some-user/my-project")
+	grant(t, service, models.PrincipalUser, "bob", models.RoleAdmin, models.RoleBindingScopeRepository, "some-user/other-project")
+
+	examples := []struct {
+		name     string
+		identity models.Identity
+		scope    models.RoleBindingScope
+		scopeId  string
+		expected models.Role
+	}{
+		{name: "repository binding", identity: models.Identity{Subject: "alice"}, scope: models.RoleBindingScopeRepository, scopeId: "some-user/my-project", expected: models.RoleViewer},
+		{name: "highest binding wins", identity: models.Identity{Subject: "alice"}, scope: models.RoleBindingScopePipeline, scopeId: "pipeline-1", expected: models.RoleMaintainer},
+		{name: "team inherited from the repository", identity: models.Identity{Subject: "carol", Groups: []string{"ops"}}, scope: models.RoleBindingScopePipeline, scopeId: "pipeline-1", expected: models.RoleDeveloper},
+		{name: "other repository", identity: models.Identity{Subject: "bob"}, scope: models.RoleBindingScopePipeline, scopeId: "pipeline-1", expected: ""},
+		{name: "team name is not a subject", identity: models.Identity{Subject: "ops"}, scope: models.RoleBindingScopePipeline, scopeId: "pipeline-1", expected: ""},
+		{name: "administrator", identity: models.Identity{Subject: "root"}, scope: models.RoleBindingScopeRepository, scopeId: "any/repo", expected: models.RoleAdmin},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			role, err := service.Role(context.Background(), &example.identity, example.scope, example.scopeId)
+			require.NoError(t, err)
+			assert.Equal(t, example.expected, role)
+		})
+	}
+
+	_, err := service.Role(context.Background(), &models.Identity{Subject: "alice"}, models.RoleBindingScopePipeline, "unknown")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestAuthorize(t *testing.T) {
+	service := newTestService(t)
+	grant(t, service, models.PrincipalUser, "alice", models.RoleDeveloper, models.RoleBindingScopePipeline, "pipeline-1")
+	alice := &models.Identity{Subject: "alice"}
+
+	assert.NoError(t, service.Authorize(context.Background(), alice, models.RoleBindingScopePipeline, "pipeline-1", models.RoleViewer))
+	assert.NoError(t, service.Authorize(context.Background(), alice, models.RoleBindingScopePipeline, "pipeline-1", models.RoleDeveloper))
+	err := service.Authorize(context.Background(), alice, models.RoleBindingScopePipeline, "pipeline-1", models.RoleMaintainer)
+	assert.ErrorIs(t, err, ErrForbidden)
+	err = service.Authorize(context.Background(), alice, models.RoleBindingScopeRepository, "some-user/my-project", models.RoleViewer)
+	assert.ErrorIs(t, err, ErrForbidden, "pipeline bindings do not extend to the repository")
+}
+
+func TestGrantAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+	first := grant(t, service, models.PrincipalUser, "alice", models.RoleViewer, models.RoleBindingScopePipeline, "pipeline-1")
+	second := grant(t, service, models.PrincipalUser, "alice", models.RoleMaintainer, models.RoleBindingScopePipeline, "pipeline-1")
+	team := grant(t, service, models.PrincipalTeam, "alice", models.RoleDeveloper, models.RoleBindingScopePipeline, "pipeline-1")
+
+	bindings, err := service.Bindings(ctx, models.RoleBindingScopePipeline, "pipeline-1")
+	require.NoError(t, err)
+	assert.Equal(t, []models.RoleBinding{*second, *team}, bindings, "a grant replaces the role of the principal")
+	assert.Equal(t, "root", second.CreatedBy)
+
+	assert.ErrorIs(t, service.Revoke(ctx, "root", models.RoleBindingScopePipeline, "pipeline-1", first.Id), store.ErrNotFound)
+	assert.ErrorIs(t, service.Revoke(ctx, "root", models.RoleBindingScopeRepository, "some-user/my-project", second.Id), store.ErrNotFound)
+	require.NoError(t, service.Revoke(ctx, "bob", models.RoleBindingScopePipeline, "pipeline-1", second.Id))
+
+	changes, err := service.Changes(ctx, models.RoleBindingScopePipeline, "pipeline-1")
+	require.NoError(t, err)
+	require.Len(t, changes, 4)
+	assert.Equal(t, models.PermissionGranted, changes[1].Action)
+	assert.Equal(t, models.RoleViewer, changes[1].PreviousRole)
+	assert.Equal(t, models.PermissionRevoked, changes[3].Action)
+	assert.Equal(t, "bob", changes[3].Actor)
+	assert.Equal(t, *second, changes[3].Binding)
+}
+
+func TestGrantInvalidBinding(t *testing.T) {
+	examples := []struct {
+		name    string
+		binding models.RoleBinding
+	}{
+		{name: "unknown role", binding: models.RoleBinding{Principal: "alice", PrincipalType: models.PrincipalUser, Role: "owner", Scope: models.RoleBindingScopePipeline, ScopeId: "pipeline-1"}},
+		{name: "unknown principal type", binding: models.RoleBinding{Principal: "alice", PrincipalType: "robot", Role: models.RoleViewer, Scope: models.RoleBindingScopePipeline, ScopeId: "pipeline-1"}},
+		{name: "without principal", binding: models.RoleBinding{PrincipalType: models.PrincipalUser, Role: models.RoleViewer, Scope: models.RoleBindingScopePipeline, ScopeId: "pipeline-1"}},
+		{name: "unknown scope", binding: models.RoleBinding{Principal: "alice", PrincipalType: models.PrincipalUser, Role: models.RoleViewer, Scope: "organisation", ScopeId: "some-user"}},
+	}
+	service := newTestService(t)
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			_, err := service.Grant(context.Background(), "root", example.binding)
+			assert.ErrorIs(t, err, ErrInvalidBinding)
+		})
+	}
+}
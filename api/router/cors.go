@@ -1,9 +1,16 @@
 package router
 
 import (
+	"context"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
 
+	"api/config"
 	"api/env"
+	"api/logger"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -17,27 +24,104 @@ const (
 	API_URL_PROD  = "https://www.aeternum-ci.com"
 )
 
+// Routes called by servers rather than browsers, which reject cross-origin requests unless configured otherwise
+var defaultRouteOrigins = map[string][]string{
+	"/v0/webhooks": {},
+}
+
 func getAllowedOrigins(environment string) []string {
-	// TODO: Once more stable, remove local -> dev/stage/prod. For now it is useful for quick testing.
+	// a local frontend may call dev for quick testing, but any page served on localhost must not use stage or prod credentials
 	switch environment {
 	case env.APPLICATION_ENV_DEV:
 		return []string{API_URL_LOCAL, API_URL_DEV}
 	case env.APPLICATION_ENV_STAGE:
-		return []string{API_URL_LOCAL, API_URL_STAGE}
+		return []string{API_URL_STAGE}
 	case env.APPLICATION_ENV_PROD:
-		return []string{API_URL_LOCAL, API_URL_BETA, API_URL_PROD}
+		return []string{API_URL_BETA, API_URL_PROD}
 	default:
 		return []string{API_URL_LOCAL}
 	}
 }
 
-func GetCors() gin.HandlerFunc {
+// Whether an origin is allowed by a pattern, either an exact origin or one whose host starts with `*.` to allow any of its subdomains
+func originMatches(pattern, origin string) bool {
+	if strings.EqualFold(pattern, origin) {
+		return true
+	}
+	allowed, err := url.Parse(pattern)
+	if err != nil || !strings.HasPrefix(allowed.Host, "*.") {
+		return false
+	}
+	requested, err := url.Parse(origin)
+	if err != nil || requested.Scheme != allowed.Scheme || requested.Port() != allowed.Port() || requested.Path != "" {
+		return false
+	}
+	// the parent domain itself is not one of its subdomains
+	suffix := strings.ToLower(strings.TrimPrefix(allowed.Hostname(), "*"))
+	host := strings.ToLower(requested.Hostname())
+	return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+}
+
+// CORS handler accepting the origins matching one of the patterns; browsers may send credentials to them
+func newCorsHandler(patterns []string) gin.HandlerFunc {
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			// credentials must never be sent along with requests from any origin
+			logger.FromContext(context.Background()).Warn("Ignoring the * CORS origin, list the allowed origins instead")
+		}
+	}
 	return cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{http.MethodGet, http.MethodPost, http.MethodOptions},
-		AllowHeaders:     []string{"*"},
+		AllowOriginFunc: func(origin string) bool {
+			for _, pattern := range patterns {
+				if originMatches(pattern, origin) {
+					return true
+				}
+			}
+			return false
+		},
+		AllowMethods:     []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Origin-Info"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
-		AllowWildcard:    true,
+		MaxAge:           12 * time.Hour,
+	})
+}
+
+/*
+Create the CORS middleware of the API.
+
+[IN] environment: application environment, selecting the default allowed origins
+
+[IN] settings: origins allowed on top of the defaults, and per route prefix
+
+[OUT] gin.HandlerFunc: the CORS middleware
+*/
+func GetCors(environment string, settings config.CorsConfig) gin.HandlerFunc {
+	global := newCorsHandler(append(getAllowedOrigins(environment), settings.AllowedOrigins...))
+	routeOrigins := map[string][]string{}
+	for prefix, origins := range defaultRouteOrigins {
+		routeOrigins[prefix] = origins
+	}
+	for prefix, origins := range settings.Routes {
+		routeOrigins[prefix] = origins
+	}
+	prefixes := []string{}
+	routes := map[string]gin.HandlerFunc{}
+	for prefix, origins := range routeOrigins {
+		prefixes = append(prefixes, prefix)
+		routes[prefix] = newCorsHandler(origins)
+	}
+	// the most specific route wins
+	sort.Slice(prefixes, func(i, j int) bool {
+		return len(prefixes[i]) > len(prefixes[j])
 	})
+	return func(c *gin.Context) {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(c.Request.URL.Path, prefix) {
+				routes[prefix](c)
+				return
+			}
+		}
+		global(c)
+	}
 }
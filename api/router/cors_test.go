@@ -0,0 +1,122 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api/config"
+	"api/env"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Send a request from a browser page of the origin and return the response
+func corsRequest(handler gin.HandlerFunc, method, path, origin string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(handler)
+	engine.GET("/v0/pipelines", func(c *gin.Context) { c.Status(http.StatusOK) })
+	engine.POST("/v0/webhooks/github", func(c *gin.Context) { c.Status(http.StatusAccepted) })
+	request := httptest.NewRequest(method, path, nil)
+	request.Host = "api.aeternum-ci.test"
+	request.Header.Set("Origin", origin)
+	if method == http.MethodOptions {
+		request.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	}
+	response := httptest.NewRecorder()
+	engine.ServeHTTP(response, request)
+	return response
+}
+
+func TestCorsPerEnvironment(t *testing.T) {
+	examples := []struct {
+		environment string
+		origin      string
+		allowed     bool
+	}{
+		{environment: env.APPLICATION_ENV_LOCAL, origin: API_URL_LOCAL, allowed: true},
+		{environment: env.APPLICATION_ENV_LOCAL, origin: API_URL_PROD, allowed: false},
+		{environment: env.APPLICATION_ENV_DEV, origin: API_URL_DEV, allowed: true},
+		{environment: env.APPLICATION_ENV_DEV, origin: API_URL_LOCAL, allowed: true},
+		{environment: env.APPLICATION_ENV_DEV, origin: API_URL_STAGE, allowed: false},
+		{environment: env.APPLICATION_ENV_STAGE, origin: API_URL_STAGE, allowed: true},
+		{environment: env.APPLICATION_ENV_STAGE, origin: API_URL_PROD, allowed: false},
+		{environment: env.APPLICATION_ENV_STAGE, origin: API_URL_LOCAL, allowed: false},
+		{environment: env.APPLICATION_ENV_PROD, origin: API_URL_PROD, allowed: true},
+		{environment: env.APPLICATION_ENV_PROD, origin: API_URL_BETA, allowed: true},
+		{environment: env.APPLICATION_ENV_PROD, origin: API_URL_DEV, allowed: false},
+		{environment: env.APPLICATION_ENV_PROD, origin: API_URL_LOCAL, allowed: false},
+		{environment: env.APPLICATION_ENV_PROD, origin: "https://evil.example.com", allowed: false},
+	}
+	for _, example := range examples {
+		t.Run(example.environment+" "+example.origin, func(t *testing.T) {
+			response := corsRequest(GetCors(example.environment, config.CorsConfig{}), http.MethodGet, "/v0/pipelines", example.origin)
+			if !example.allowed {
+				assert.Equal(t, http.StatusForbidden, response.Code)
+				assert.Empty(t, response.Header().Get("Access-Control-Allow-Origin"))
+				return
+			}
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, example.origin, response.Header().Get("Access-Control-Allow-Origin"), "never a wildcard")
+			assert.Equal(t, "true", response.Header().Get("Access-Control-Allow-Credentials"))
+		})
+	}
+}
+
+func TestCorsConfiguredOrigins(t *testing.T) {
+	settings := config.CorsConfig{AllowedOrigins: []string{"https://*.example.com", "http://localhost:8081", "*"}}
+	handler := GetCors(env.APPLICATION_ENV_PROD, settings)
+
+	examples := []struct {
+		origin  string
+		allowed bool
+	}{
+		{origin: "https://app.example.com", allowed: true},
+		{origin: "https://a.b.example.com", allowed: true},
+		{origin: "https://APP.example.com", allowed: true},
+		{origin: "https://example.com", allowed: false},
+		{origin: "http://app.example.com", allowed: false},
+		{origin: "https://app.example.com:8443", allowed: false},
+		{origin: "https://app.example.com.evil.com", allowed: false},
+		{origin: "https://appexample.com", allowed: false},
+		{origin: "http://localhost:8081", allowed: true},
+		{origin: "https://evil.com", allowed: false},
+		{origin: API_URL_PROD, allowed: true},
+	}
+	for _, example := range examples {
+		t.Run(example.origin, func(t *testing.T) {
+			response := corsRequest(handler, http.MethodGet, "/v0/pipelines", example.origin)
+			assert.Equal(t, example.allowed, response.Code == http.StatusOK, response.Code)
+		})
+	}
+}
+
+func TestCorsPreflight(t *testing.T) {
+	response := corsRequest(GetCors(env.APPLICATION_ENV_PROD, config.CorsConfig{}), http.MethodOptions, "/v0/pipelines", API_URL_PROD)
+
+	assert.Equal(t, http.StatusNoContent, response.Code)
+	assert.Equal(t, API_URL_PROD, response.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, response.Header().Get("Access-Control-Allow-Methods"), http.MethodDelete)
+	assert.Contains(t, response.Header().Get("Access-Control-Allow-Headers"), "Authorization")
+}
+
+func TestCorsRouteOverrides(t *testing.T) {
+	response := corsRequest(GetCors(env.APPLICATION_ENV_PROD, config.CorsConfig{}), http.MethodPost, "/v0/webhooks/github", API_URL_PROD)
+	assert.Equal(t, http.StatusForbidden, response.Code, "browsers never call webhooks")
+
+	response = corsRequest(GetCors(env.APPLICATION_ENV_PROD, config.CorsConfig{}), http.MethodPost, "/v0/webhooks/github", "")
+	assert.Equal(t, http.StatusAccepted, response.Code, "requests without an origin are not cross-origin")
+
+	settings := config.CorsConfig{Routes: map[string][]string{
+		"/v0/webhooks":        {"https://hooks.example.com"},
+		"/v0/webhooks/github": {"https://github.example.com"},
+	}}
+	response = corsRequest(GetCors(env.APPLICATION_ENV_PROD, settings), http.MethodPost, "/v0/webhooks/github", "https://github.example.com")
+	assert.Equal(t, http.StatusAccepted, response.Code)
+	response = corsRequest(GetCors(env.APPLICATION_ENV_PROD, settings), http.MethodPost, "/v0/webhooks/github", "https://hooks.example.com")
+	assert.Equal(t, http.StatusForbidden, response.Code, "the most specific route wins")
+	response = corsRequest(GetCors(env.APPLICATION_ENV_PROD, settings), http.MethodGet, "/v0/pipelines", "https://github.example.com")
+	assert.Equal(t, http.StatusForbidden, response.Code)
+}
@@ -3,6 +3,9 @@ package v0
 import (
 	"context"
 	"errors"
+	"math"
+	"net/http"
+	"strconv"
 
 	"api/context_settings"
 	core_errors "api/errors"
@@ -11,15 +14,44 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-type errorBody struct {
+// Media type of the error responses
+const ProblemContentType string = "application/problem+json"
+
+// Generic code of the unexpected errors, whose details are only logged
+const codeInternal string = "internal"
+
+// HTTP status of each error code
+var codeStatuses = map[string]int{
+	core_errors.CodeInvalidInput:     http.StatusBadRequest,
+	core_errors.CodeUnauthorized:     http.StatusUnauthorized,
+	core_errors.CodeForbidden:        http.StatusForbidden,
+	core_errors.CodeNotFound:         http.StatusNotFound,
+	core_errors.CodeMethodNotAllowed: http.StatusMethodNotAllowed,
+	core_errors.CodeConflict:         http.StatusConflict,
+	core_errors.CodeRateLimited:      http.StatusTooManyRequests,
+	core_errors.CodeUpstreamError:    http.StatusBadGateway,
+}
+
+// RFC 7807 problem details, keeping the message, requestId and serviceVersion members clients already read
+type ErrorBody struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Machine-readable, e.g. not_found
+	Code           string `json:"code,omitempty"`
 	Message        string `json:"message,omitempty"`
 	RequestID      string `json:"requestId,omitempty"`
 	ServiceVersion string `json:"serviceVersion,omitempty"`
+	// Status returned by the failing upstream service
+	UpstreamStatus int `json:"upstreamStatus,omitempty"`
 }
 
 type errorResponse struct {
-	Status int
-	Body   errorBody
+	Status  int
+	Body    ErrorBody
+	Headers map[string]string
 }
 
 func getContextField(ctx context.Context, fieldName string) string {
@@ -30,56 +62,81 @@ func getContextField(ctx context.Context, fieldName string) string {
 	return value
 }
 
-func getErrorMetadataFromContext(ctx context.Context) errorBody {
+func getErrorMetadataFromContext(ctx context.Context) ErrorBody {
 	requestId := getContextField(ctx, context_settings.RequestId)
 	serviceVersion := getContextField(ctx, context_settings.Version)
 
-	return errorBody{
+	return ErrorBody{
 		RequestID:      requestId,
 		ServiceVersion: serviceVersion,
 	}
 }
 
+// Problem details of a status; the message is also the detail
+func newErrorBody(ctx context.Context, status int, code string, message string) ErrorBody {
+	body := getErrorMetadataFromContext(ctx)
+	body.Type = "about:blank"
+	body.Title = http.StatusText(status)
+	body.Status = status
+	body.Code = code
+	body.Detail = message
+	body.Message = message
+	return body
+}
+
 // Get an error response from a core error.
-// Currently the messages are generic.
+// The messages of unexpected errors are generic, so that internals don't leak.
 func getErrorResponse(ctx context.Context, err error) errorResponse {
-
-	errorMessage := err.Error()
-
-	var inputErr core_errors.InputError
-	if errors.As(err, &inputErr) {
-		body := getErrorMetadataFromContext(inputErr.Context())
-		body.Message = errorMessage
-		return errorResponse{Status: 400, Body: body}
+	var codedErr core_errors.CodedError
+	if !errors.As(err, &codedErr) {
+		status := http.StatusInternalServerError
+		return errorResponse{Status: status, Body: newErrorBody(ctx, status, codeInternal, "Internal Server Error")}
 	}
-	body := getErrorMetadataFromContext(ctx)
-	body.Message = "Internal Server Error"
-	return errorResponse{Status: 500, Body: body}
-
+	status := codeStatuses[codedErr.Code()]
+	response := errorResponse{
+		Status: status,
+		Body:   newErrorBody(codedErr.Context(), status, codedErr.Code(), err.Error()),
+	}
+	var unauthorizedErr core_errors.UnauthorizedError
+	if errors.As(err, &unauthorizedErr) {
+		response.Headers = map[string]string{"WWW-Authenticate": "Bearer"}
+	}
+	var rateLimitedErr core_errors.RateLimitedError
+	if errors.As(err, &rateLimitedErr) && rateLimitedErr.RetryAfter() > 0 {
+		seconds := int(math.Ceil(rateLimitedErr.RetryAfter().Seconds()))
+		response.Headers = map[string]string{"Retry-After": strconv.Itoa(seconds)}
+	}
+	var upstreamErr core_errors.UpstreamError
+	if errors.As(err, &upstreamErr) {
+		response.Body.UpstreamStatus = upstreamErr.Status()
+	}
+	return response
 }
 
 // Generic error handling
 func handleError(c *gin.Context, err error) {
 	log := logger.FromContext(c)
 	log.Error(err)
-	errorResponse := getErrorResponse(c, err)
-	c.JSON(errorResponse.Status, errorResponse.Body)
+	writeErrorResponse(c, getErrorResponse(c, err))
 }
 
-func ServeError(c *gin.Context, status int, message string, err error) {
-	c.JSON(status, gin.H{
-		"status":    status,
-		"message":   message,
-		"traceback": err.Error(),
-	})
+// Send the problem details of an error response about the current request
+func writeErrorResponse(c *gin.Context, response errorResponse) {
+	response.Body.Instance = c.Request.URL.Path
+	for name, value := range response.Headers {
+		c.Header(name, value)
+	}
+	c.Header("Content-Type", ProblemContentType)
+	c.JSON(response.Status, response.Body)
 }
 
-// Wrapper for handlers that return errors
+// Wrapper for handlers and middlewares that return errors; the handlers after a failed middleware are skipped
 func WithErrorHandling(handler func(c *gin.Context) error) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		err := handler(c)
 		if err != nil {
 			handleError(c, err)
+			c.Abort()
 		}
 	}
 }
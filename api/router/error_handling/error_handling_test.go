@@ -2,24 +2,40 @@ package v0
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"api/context_settings"
 	core_errors "api/errors"
 
+	"github.com/gin-gonic/gin"
 	"github.com/go-playground/assert/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
+// Problem details of an error of the status, before the context fields are added
+func problem(status int, code string, message string) ErrorBody {
+	return ErrorBody{
+		Type:    "about:blank",
+		Title:   http.StatusText(status),
+		Status:  status,
+		Detail:  message,
+		Code:    code,
+		Message: message,
+	}
+}
+
 func TestHandeInputError(t *testing.T) {
 	t.Run("Simple input error", func(t *testing.T) {
 		inputErr := core_errors.NewInputError(context.Background(), "Some error")
 		response := getErrorResponse(context.Background(), inputErr)
 
 		assert.Equal(t, 400, response.Status)
-		assert.Equal(t, errorBody{
-			Message: "Some error",
-		}, response.Body)
+		assert.Equal(t, problem(400, "invalid_input", "Some error"), response.Body)
 
 	})
 
@@ -30,9 +46,7 @@ func TestHandeInputError(t *testing.T) {
 		response := getErrorResponse(context.Background(), err)
 
 		assert.Equal(t, 400, response.Status)
-		assert.Equal(t, errorBody{
-			Message: "Outer error: Some error",
-		}, response.Body)
+		assert.Equal(t, problem(400, "invalid_input", "Outer error: Some error"), response.Body)
 
 	})
 
@@ -43,9 +57,7 @@ func TestHandeInputError(t *testing.T) {
 		response := getErrorResponse(context.Background(), inputErr)
 
 		assert.Equal(t, 400, response.Status)
-		assert.Equal(t, errorBody{
-			Message: "Some error: Inner error",
-		}, response.Body)
+		assert.Equal(t, problem(400, "invalid_input", "Some error: Inner error"), response.Body)
 
 	})
 
@@ -56,10 +68,9 @@ func TestHandeInputError(t *testing.T) {
 		response := getErrorResponse(context.Background(), inputErr)
 
 		assert.Equal(t, 400, response.Status)
-		assert.Equal(t, errorBody{
-			Message:   "Some error",
-			RequestID: "4dfdcc88-2f3e-41ce-9757-4144cb3974a4",
-		}, response.Body)
+		expected := problem(400, "invalid_input", "Some error")
+		expected.RequestID = "4dfdcc88-2f3e-41ce-9757-4144cb3974a4"
+		assert.Equal(t, expected, response.Body)
 
 	})
 
@@ -70,11 +81,162 @@ func TestHandeInputError(t *testing.T) {
 		response := getErrorResponse(context.Background(), inputErr)
 
 		assert.Equal(t, 400, response.Status)
-		assert.Equal(t, errorBody{
-			Message:        "Some error",
-			ServiceVersion: "1.23.5",
-		}, response.Body)
+		expected := problem(400, "invalid_input", "Some error")
+		expected.ServiceVersion = "1.23.5"
+		assert.Equal(t, expected, response.Body)
 
 	})
 
 }
+
+func TestHandleUnauthorizedError(t *testing.T) {
+	ctx := context.WithValue(context.Background(), context_settings.RequestId, "4dfdcc88-2f3e-41ce-9757-4144cb3974a4")
+	err := fmt.Errorf("Outer error: %w", core_errors.NewUnauthorizedError(ctx, "Invalid token"))
+	response := getErrorResponse(context.Background(), err)
+
+	assert.Equal(t, 401, response.Status)
+	expected := problem(401, "unauthorized", "Outer error: Invalid token")
+	expected.RequestID = "4dfdcc88-2f3e-41ce-9757-4144cb3974a4"
+	assert.Equal(t, expected, response.Body)
+	assert.Equal(t, map[string]string{"WWW-Authenticate": "Bearer"}, response.Headers)
+}
+
+func TestHandleForbiddenError(t *testing.T) {
+	ctx := context.WithValue(context.Background(), context_settings.RequestId, "4dfdcc88-2f3e-41ce-9757-4144cb3974a4")
+	err := core_errors.NewForbiddenError(ctx, "The admin role is required")
+	response := getErrorResponse(context.Background(), err)
+
+	assert.Equal(t, 403, response.Status)
+	expected := problem(403, "forbidden", "The admin role is required")
+	expected.RequestID = "4dfdcc88-2f3e-41ce-9757-4144cb3974a4"
+	assert.Equal(t, expected, response.Body)
+}
+
+func TestHandleCodedErrors(t *testing.T) {
+	ctx := context.Background()
+	examples := []struct {
+		name     string
+		err      error
+		status   int
+		code     string
+		message  string
+		headers  map[string]string
+		upstream int
+	}{
+		{
+			name:    "not found",
+			err:     core_errors.NewNotFoundError(ctx, "Pipeline %s not found", "abc"),
+			status:  404,
+			code:    "not_found",
+			message: "Pipeline abc not found",
+		},
+		{
+			name:    "conflict",
+			err:     fmt.Errorf("Outer error: %w", core_errors.NewConflictError(ctx, "Run is finished")),
+			status:  409,
+			code:    "conflict",
+			message: "Outer error: Run is finished",
+		},
+		{
+			name:    "rate limited",
+			err:     core_errors.NewRateLimitedError(ctx, 1500*time.Millisecond, "GitHub rate limit reached"),
+			status:  429,
+			code:    "rate_limited",
+			message: "GitHub rate limit reached",
+			headers: map[string]string{"Retry-After": "2"},
+		},
+		{
+			name:    "rate limited without retry time",
+			err:     core_errors.NewRateLimitedError(ctx, 0, "GitHub rate limit reached"),
+			status:  429,
+			code:    "rate_limited",
+			message: "GitHub rate limit reached",
+		},
+		{
+			name:     "upstream",
+			err:      core_errors.NewUpstreamError(ctx, "GitHub", 503, fmt.Errorf("unavailable")),
+			status:   502,
+			code:     "upstream_error",
+			message:  "GitHub failed with status 503: unavailable",
+			upstream: 503,
+		},
+		{
+			name:    "unexpected",
+			err:     fmt.Errorf("open /data/pipelines: permission denied"),
+			status:  500,
+			code:    "internal",
+			message: "Internal Server Error",
+		},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			response := getErrorResponse(ctx, example.err)
+
+			expected := problem(example.status, example.code, example.message)
+			expected.UpstreamStatus = example.upstream
+			assert.Equal(t, example.status, response.Status)
+			assert.Equal(t, expected, response.Body)
+			assert.Equal(t, example.headers, response.Headers)
+		})
+	}
+}
+
+func TestWithErrorHandling(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/v0/pipelines/:id", WithErrorHandling(func(c *gin.Context) error {
+		return core_errors.NewNotFoundError(c, "Pipeline %s not found", c.Param("id"))
+	}))
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v0/pipelines/abc", nil))
+
+	assert.Equal(t, 404, recorder.Code)
+	assert.Equal(t, ProblemContentType, recorder.Header().Get("Content-Type"))
+	body := ErrorBody{}
+	assert.Equal(t, nil, json.Unmarshal(recorder.Body.Bytes(), &body))
+	assert.Equal(t, "/v0/pipelines/abc", body.Instance)
+	assert.Equal(t, "not_found", body.Code)
+	assert.Equal(t, "Pipeline abc not found", body.Detail)
+}
+
+func TestRecovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(context_settings.RequestId, "4dfdcc88-2f3e-41ce-9757-4144cb3974a4")
+		c.Set(context_settings.Version, "1.23.5")
+	})
+	router.Use(Recovery())
+	router.GET("/v0/pipelines/:id", func(c *gin.Context) {
+		var pipelines map[string]string
+		pipelines[c.Param("id")] = "crash"
+	})
+	router.GET("/v0/runs/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "partial")
+		panic("lost the run")
+	})
+	panics := testutil.ToFloat64(HttpPanicsTotal.WithLabelValues("/v0/pipelines/:id", http.MethodGet))
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v0/pipelines/abc", nil))
+
+	assert.Equal(t, 500, recorder.Code)
+	assert.Equal(t, ProblemContentType, recorder.Header().Get("Content-Type"))
+	body := ErrorBody{}
+	assert.Equal(t, nil, json.Unmarshal(recorder.Body.Bytes(), &body))
+	expected := problem(500, "internal", "Internal Server Error")
+	expected.Instance = "/v0/pipelines/abc"
+	expected.RequestID = "4dfdcc88-2f3e-41ce-9757-4144cb3974a4"
+	expected.ServiceVersion = "1.23.5"
+	assert.Equal(t, expected, body)
+	assert.Equal(t, panics+1, testutil.ToFloat64(HttpPanicsTotal.WithLabelValues("/v0/pipelines/:id", http.MethodGet)))
+
+	t.Run("Panic after the response started", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v0/runs/abc", nil))
+
+		assert.Equal(t, 200, recorder.Code)
+		assert.Equal(t, "partial", recorder.Body.String())
+	})
+}
@@ -0,0 +1,49 @@
+package v0
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"api/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	HttpPanicsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_panics_total",
+			Help: "Number of panics recovered while handling requests",
+		}, []string{"path", "method"},
+	)
+)
+
+// Recover from the panics of the handlers, logging their stack trace and answering with the standard error body
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				// the handler aborted the response on purpose, which the server handles quietly
+				panic(recovered)
+			}
+			HttpPanicsTotal.WithLabelValues(c.FullPath(), c.Request.Method).Inc()
+			logger.FromContext(c).
+				WithField("stack", string(debug.Stack())).
+				Errorf("Panic while handling [%s] %s: %v", c.Request.Method, c.Request.URL.Path, recovered)
+			if c.Writer.Written() {
+				// the client already got part of the response, so all we can do is stop
+				c.Abort()
+				return
+			}
+			status := http.StatusInternalServerError
+			writeErrorResponse(c, errorResponse{Status: status, Body: newErrorBody(c, status, codeInternal, "Internal Server Error")})
+			c.Abort()
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,262 @@
+/*
+Package openapi generates the OpenAPI document of the API from the table of its
+routes and the Go types of their request and response bodies.
+*/
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	error_handling "api/router/error_handling"
+)
+
+const Version string = "3.1.0"
+
+// Security schemes callers authenticate with
+const (
+	// API tokens and the JWTs of the OIDC provider
+	SecurityUser string = "bearerAuth"
+	// Token a runner got when it registered
+	SecurityRunner string = "runnerToken"
+	// Shared token allowing runners to register
+	SecurityRegistration string = "registrationToken"
+)
+
+// Name of the schema of the error responses
+const problemSchema string = "Problem"
+
+// An endpoint of the API, from which its part of the document is generated
+type Operation struct {
+	Method string
+	// As registered on gin, e.g. /v0/pipelines/:id
+	Path    string
+	Tag     string
+	Summary string
+	// Scheme the caller authenticates with; empty for public endpoints
+	Security string
+	// Query string and header parameters; the path parameters come from the path
+	Parameters []Parameter
+	// Value of the type of the JSON request body; nil when there is none
+	Request any
+	// Media type of raw request bodies, e.g. application/octet-stream
+	RequestType string
+	// Status of the successful response
+	Status int
+	// Value of the type of the JSON response body; nil when there is none
+	Response any
+	// Media type of raw response bodies, e.g. text/plain
+	ResponseType string
+	// Other successful statuses and what they mean, e.g. 204 when nothing was found
+	Alternatives map[int]string
+}
+
+type Parameter struct {
+	Name string
+	// query, the default, or header
+	In          string
+	Description string
+	// JSON type of the value, string by default
+	Type     string
+	Required bool
+}
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Operations of a path, keyed by lower case method
+type PathItem map[string]*OperationObject
+
+type OperationObject struct {
+	Tags        []string                  `json:"tags,omitempty"`
+	Summary     string                    `json:"summary"`
+	Parameters  []ParameterObject         `json:"parameters,omitempty"`
+	RequestBody *RequestBody              `json:"requestBody,omitempty"`
+	Responses   map[string]ResponseObject `json:"responses"`
+	Security    []map[string][]string     `json:"security,omitempty"`
+}
+
+type ParameterObject struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Content map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type ResponseObject struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme"`
+	Description string `json:"description,omitempty"`
+}
+
+// Path of the document matching a gin path, e.g. /v0/runs/{runId}/artifacts/{name} for /v0/runs/:runId/artifacts/*name
+func PathOf(ginPath string) string {
+	segments := strings.Split(ginPath, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Parameters named by the segments of a gin path
+func pathParameters(ginPath string) []ParameterObject {
+	parameters := []ParameterObject{}
+	for _, segment := range strings.Split(ginPath, "/") {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			parameters = append(parameters, ParameterObject{
+				Name:     segment[1:],
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+	}
+	return parameters
+}
+
+// Content of a body: the schema of its Go type when it is JSON, any string otherwise
+func (s *schemas) content(value any, mediaType string) map[string]MediaType {
+	if value != nil {
+		return map[string]MediaType{"application/json": {Schema: s.of(reflect.TypeOf(value))}}
+	}
+	if mediaType != "" {
+		return map[string]MediaType{mediaType: {Schema: &Schema{Type: "string"}}}
+	}
+	return nil
+}
+
+func (s *schemas) operation(operation Operation) *OperationObject {
+	object := &OperationObject{
+		Summary:    operation.Summary,
+		Parameters: pathParameters(operation.Path),
+		Responses: map[string]ResponseObject{
+			"default": {
+				Description: "Problem details of the error",
+				Content: map[string]MediaType{
+					error_handling.ProblemContentType: {Schema: &Schema{Ref: componentRef(problemSchema)}},
+				},
+			},
+		},
+	}
+	if operation.Tag != "" {
+		object.Tags = []string{operation.Tag}
+	}
+	if operation.Security != "" {
+		object.Security = []map[string][]string{{operation.Security: {}}}
+	}
+	for _, parameter := range operation.Parameters {
+		in := parameter.In
+		if in == "" {
+			in = "query"
+		}
+		valueType := parameter.Type
+		if valueType == "" {
+			valueType = "string"
+		}
+		object.Parameters = append(object.Parameters, ParameterObject{
+			Name:        parameter.Name,
+			In:          in,
+			Description: parameter.Description,
+			Required:    parameter.Required,
+			Schema:      &Schema{Type: valueType},
+		})
+	}
+	if content := s.content(operation.Request, operation.RequestType); content != nil {
+		for _, mediaType := range content {
+			optional(mediaType.Schema)
+		}
+		object.RequestBody = &RequestBody{Content: content}
+	}
+	object.Responses[strconv.Itoa(operation.Status)] = ResponseObject{
+		Description: http.StatusText(operation.Status),
+		Content:     s.content(operation.Response, operation.ResponseType),
+	}
+	for status, description := range operation.Alternatives {
+		object.Responses[strconv.Itoa(status)] = ResponseObject{Description: description}
+	}
+	return object
+}
+
+/*
+Generate the OpenAPI document of the API.
+
+[IN] version: version of the API, e.g. its release
+
+[IN] operations: every endpoint of the API
+
+[OUT] Document: the document, with the schemas of the bodies and errors
+*/
+func Build(version string, operations []Operation) Document {
+	s := newSchemas()
+	s.components[problemSchema] = s.of(reflect.TypeOf(error_handling.ErrorBody{}))
+	document := Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:       "Aeternum API",
+			Version:     version,
+			Description: "Continuous integration pipelines triggered by GitHub and executed by self-hosted runners.",
+		},
+		Paths: map[string]PathItem{},
+		Components: Components{
+			Schemas: s.components,
+			SecuritySchemes: map[string]SecurityScheme{
+				SecurityUser: {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "API token, or JWT of the OIDC provider",
+				},
+				SecurityRunner: {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "Token the runner got when it registered",
+				},
+				SecurityRegistration: {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "Registration token shared with the runners",
+				},
+			},
+		},
+	}
+	for _, operation := range operations {
+		path := PathOf(operation.Path)
+		if document.Paths[path] == nil {
+			document.Paths[path] = PathItem{}
+		}
+		document.Paths[path][strings.ToLower(operation.Method)] = s.operation(operation)
+	}
+	return document
+}
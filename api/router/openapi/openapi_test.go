@@ -0,0 +1,134 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"api/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathOf(t *testing.T) {
+	examples := []struct {
+		ginPath string
+		path    string
+	}{
+		{ginPath: "/healthz", path: "/healthz"},
+		{ginPath: "/v0/pipelines/:id", path: "/v0/pipelines/{id}"},
+		{ginPath: "/v0/runs/:runId/artifacts/*name", path: "/v0/runs/{runId}/artifacts/{name}"},
+	}
+	for _, example := range examples {
+		t.Run(example.ginPath, func(t *testing.T) {
+			assert.Equal(t, example.path, PathOf(example.ginPath))
+		})
+	}
+}
+
+type embedded struct {
+	Id string `json:"id"`
+}
+
+type example struct {
+	embedded
+	Name     string            `json:"name"`
+	Count    int               `json:"count,omitempty"`
+	Ratio    float64           `json:"ratio"`
+	Enabled  bool              `json:"enabled"`
+	At       *time.Time        `json:"at,omitempty"`
+	Labels   map[string]string `json:"labels"`
+	Payload  []byte            `json:"payload"`
+	Value    any               `json:"value"`
+	Run      models.Run        `json:"run"`
+	Children []example         `json:"children"`
+	Ignored  string            `json:"-"`
+	private  string
+}
+
+func TestSchemas(t *testing.T) {
+	s := newSchemas()
+	schema := s.of(reflect.TypeOf(example{}))
+
+	assert.Equal(t, "object", schema.Type)
+	assert.Equal(t, []string{"id", "name", "ratio", "enabled", "labels", "payload", "value", "run", "children"}, schema.Required)
+	assert.Equal(t, &Schema{Type: "string"}, schema.Properties["id"])
+	assert.Equal(t, &Schema{Type: "integer"}, schema.Properties["count"])
+	assert.Equal(t, &Schema{Type: "number"}, schema.Properties["ratio"])
+	assert.Equal(t, &Schema{Type: "boolean"}, schema.Properties["enabled"])
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time"}, schema.Properties["at"])
+	assert.Equal(t, &Schema{Type: "object", AdditionalProperties: &Schema{Type: "string"}}, schema.Properties["labels"])
+	assert.Equal(t, &Schema{Type: "string", Format: "byte"}, schema.Properties["payload"])
+	assert.Equal(t, &Schema{}, schema.Properties["value"])
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/Run"}, schema.Properties["run"])
+	// recursive types stop at the second level
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Type: "object"}}, schema.Properties["children"])
+	assert.NotContains(t, schema.Properties, "Ignored")
+	assert.NotContains(t, schema.Properties, "private")
+
+	// models become components along with the models they refer to
+	require.Contains(t, s.components, "Run")
+	require.Contains(t, s.components, "Job")
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Ref: "#/components/schemas/Job"}}, s.components["Run"].Properties["jobs"])
+	assert.Contains(t, s.components["Run"].Required, "pipelineId")
+	assert.NotContains(t, s.components["Run"].Required, "branch")
+}
+
+func TestBuild(t *testing.T) {
+	document := Build("1.2.3", []Operation{
+		{
+			Method:   http.MethodGet,
+			Path:     "/v0/pipelines/:id",
+			Tag:      "pipelines",
+			Summary:  "Get a pipeline",
+			Security: SecurityUser,
+			Status:   http.StatusOK,
+			Response: models.Pipeline{},
+		},
+		{
+			Method: http.MethodPost,
+			Path:   "/v0/tokens",
+			Request: struct {
+				Name string `json:"name"`
+			}{},
+			Status: http.StatusCreated,
+		},
+		{
+			Method: http.MethodPost,
+			Path:   "/v0/runners/jobs/request",
+			Parameters: []Parameter{
+				{Name: "wait", Type: "integer"},
+			},
+			Status:       http.StatusOK,
+			Alternatives: map[int]string{http.StatusNoContent: "No job"},
+		},
+	})
+
+	assert.Equal(t, "3.1.0", document.OpenAPI)
+	assert.Equal(t, "1.2.3", document.Info.Version)
+	assert.Contains(t, document.Components.Schemas, "Pipeline")
+	assert.Contains(t, document.Components.Schemas["Problem"].Properties, "requestId")
+	assert.Contains(t, document.Components.SecuritySchemes, SecurityUser)
+
+	getPipeline := document.Paths["/v0/pipelines/{id}"]["get"]
+	require.NotNil(t, getPipeline)
+	assert.Equal(t, []string{"pipelines"}, getPipeline.Tags)
+	assert.Equal(t, []map[string][]string{{SecurityUser: {}}}, getPipeline.Security)
+	assert.Equal(t, []ParameterObject{{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string"}}}, getPipeline.Parameters)
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/Pipeline"}, getPipeline.Responses["200"].Content["application/json"].Schema)
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/Problem"}, getPipeline.Responses["default"].Content["application/problem+json"].Schema)
+
+	createToken := document.Paths["/v0/tokens"]["post"]
+	require.NotNil(t, createToken)
+	// request bodies may leave any field out
+	assert.Equal(t, &Schema{Type: "object", Properties: map[string]*Schema{"name": {Type: "string"}}}, createToken.RequestBody.Content["application/json"].Schema)
+
+	requestJob := document.Paths["/v0/runners/jobs/request"]["post"]
+	require.NotNil(t, requestJob)
+	assert.Nil(t, requestJob.Security)
+	assert.Equal(t, []ParameterObject{{Name: "wait", In: "query", Schema: &Schema{Type: "integer"}}}, requestJob.Parameters)
+	assert.Equal(t, ResponseObject{Description: "No job"}, requestJob.Responses["204"])
+	assert.Nil(t, requestJob.Responses["200"].Content)
+}
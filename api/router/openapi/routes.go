@@ -0,0 +1,53 @@
+package openapi
+
+import (
+	"embed"
+	"net/http"
+
+	"api/env"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Swagger UI browsing the document
+//
+//go:embed swagger.html
+var swaggerPage []byte
+
+// Scripts and styles of Swagger UI, vendored so the page loads nothing from a CDN
+//
+//go:embed swagger-ui/swagger-ui-bundle.js swagger-ui/swagger-ui.css
+var swaggerAssets embed.FS
+
+func DocumentHandler(document Document) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, document)
+	}
+}
+
+func SwaggerHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", swaggerPage)
+}
+
+// Serve the Swagger UI files the page loads
+func SwaggerAssetsHandler(c *gin.Context) {
+	c.FileFromFS("swagger-ui"+c.Param("filepath"), http.FS(swaggerAssets))
+}
+
+// Serve the document, and Swagger UI to browse it outside production
+func SetRoutes(route *gin.Engine, document Document, environment string) {
+	route.GET("/openapi.json", DocumentHandler(document))
+	if environment != env.APPLICATION_ENV_PROD {
+		route.GET("/docs", SwaggerHandler)
+		route.GET("/docs/swagger-ui/*filepath", SwaggerAssetsHandler)
+	}
+}
+
+// The endpoints serving the document
+func Operations() []Operation {
+	return []Operation{
+		{Method: http.MethodGet, Path: "/openapi.json", Tag: "system", Summary: "Get this OpenAPI document", Status: http.StatusOK, ResponseType: "application/json"},
+		{Method: http.MethodGet, Path: "/docs", Tag: "system", Summary: "Browse this document in Swagger UI, outside production", Status: http.StatusOK, ResponseType: "text/html"},
+		{Method: http.MethodGet, Path: "/docs/swagger-ui/*filepath", Tag: "system", Summary: "Get a script or stylesheet of Swagger UI, outside production", Status: http.StatusOK, ResponseType: "application/octet-stream"},
+	}
+}
@@ -0,0 +1,135 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Package whose structs are shared by several endpoints, so they become named schemas; the other types are inlined
+const modelsPackage string = "api/models"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// JSON schema of a body, named when it is a reference to a component
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+}
+
+func componentRef(name string) string {
+	return "#/components/schemas/" + name
+}
+
+// Schemas of the Go types as encoding/json serialises them
+type schemas struct {
+	components map[string]*Schema
+	// Inlined structs being described, to stop on recursive ones
+	visiting map[reflect.Type]bool
+}
+
+func newSchemas() *schemas {
+	return &schemas{components: map[string]*Schema{}, visiting: map[reflect.Type]bool{}}
+}
+
+func (s *schemas) of(t reflect.Type) *Schema {
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.of(t.Elem())
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoded in base64
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.of(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.of(t.Elem())}
+	case reflect.Struct:
+		return s.structure(t)
+	}
+	// interfaces hold any JSON value
+	return &Schema{}
+}
+
+func (s *schemas) structure(t reflect.Type) *Schema {
+	if t.PkgPath() == modelsPackage && t.Name() != "" {
+		_, found := s.components[t.Name()]
+		if !found {
+			// registered before its fields, which may refer to it
+			s.components[t.Name()] = &Schema{}
+			*s.components[t.Name()] = *s.object(t)
+		}
+		return &Schema{Ref: componentRef(t.Name())}
+	}
+	if s.visiting[t] {
+		return &Schema{Type: "object"}
+	}
+	s.visiting[t] = true
+	defer delete(s.visiting, t)
+	return s.object(t)
+}
+
+func (s *schemas) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	s.addFields(schema, t)
+	return schema
+}
+
+// Add the properties of the fields of a struct, flattening the embedded structs like encoding/json does
+func (s *schemas) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			s.addFields(schema, fieldType)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = s.of(field.Type)
+		if !strings.Contains(","+options+",", ",omitempty,") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// Let every property of an inlined schema be omitted, as the request bodies are decoded into zero values
+func optional(schema *Schema) {
+	if schema == nil {
+		return
+	}
+	schema.Required = nil
+	for _, property := range schema.Properties {
+		optional(property)
+	}
+	optional(schema.Items)
+	optional(schema.AdditionalProperties)
+}
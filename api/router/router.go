@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"os"
 
+	"api/config"
 	"api/context_settings"
 	"api/env"
 	"api/logger"
+	error_handling "api/router/error_handling"
 	"api/router/headers"
+	"api/router/openapi"
 	system "api/router/system"
 	v0 "api/router/v0"
 
@@ -65,14 +68,21 @@ func logRequest() gin.HandlerFunc {
 }
 
 // Configure the router adding routes and middlewares
-func getRouter() *gin.Engine {
-	router := gin.Default()
+func getRouter(deps v0.Dependencies, corsSettings config.CorsConfig) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Logger())
 	router.Use(addLoggerFields())
+	// after addLoggerFields, so the error body and log of a panic have the request id
+	router.Use(error_handling.Recovery())
 	router.Use(logRequest())
-	router.Use(GetCors())
+	router.Use(GetCors(env.GetApplicationEnv(), corsSettings))
 	router.Use(system.PrometheusMiddleware())
 	system.SetSystemRoutes(router)
-	v0.SetRoutes(router)
+	v0.SetRoutes(router, deps)
+	operations := append(system.Operations(), openapi.Operations()...)
+	operations = append(operations, v0.Operations()...)
+	document := openapi.Build(env.GetEnvWithDefault(env.ENV_KEY_VERSION, "dev"), operations)
+	openapi.SetRoutes(router, document, env.GetApplicationEnv())
 
 	return router
 }
@@ -82,10 +92,14 @@ Create a backend service instance.
 
 [IN] port: server port to listen on
 
+[IN] deps: backends used by the API handlers
+
+[IN] corsSettings: origins allowed to call the API from browsers
+
 [OUT] *Service: new backend service instance
 */
-func CreateNewService(port int) *Service {
-	router := getRouter()
+func CreateNewService(port int, deps v0.Dependencies, corsSettings config.CorsConfig) *Service {
+	router := getRouter(deps, corsSettings)
 	return &Service{
 		Router: router,
 		Port:   port,
@@ -0,0 +1,168 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"api/audit"
+	"api/auth"
+	"api/config"
+	"api/data"
+	"api/env"
+	"api/models"
+	"api/queue"
+	"api/rbac"
+	"api/router/openapi"
+	v0 "api/router/v0"
+	"api/runner"
+	"api/scheduler"
+	"api/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Router of the API in dev mode, so that every route is registered
+func newTestRouter(t *testing.T) *gin.Engine {
+	previous := gin.Mode()
+	gin.SetMode(gin.DebugMode)
+	t.Cleanup(func() {
+		gin.SetMode(previous)
+	})
+	dataStore := store.NewMemoryStore()
+	jobs := queue.NewStoreQueue(dataStore, "jobs")
+	runners := runner.NewService(dataStore, jobs, runner.NewFileLogs(t.TempDir()), "")
+	return getRouter(v0.Dependencies{Runners: runners}, config.CorsConfig{})
+}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	router := newTestRouter(t)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, response.Code)
+	document := openapi.Document{}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &document))
+	assert.Equal(t, openapi.Version, document.OpenAPI)
+
+	for _, route := range router.Routes() {
+		operation := document.Paths[openapi.PathOf(route.Path)][strings.ToLower(route.Method)]
+		assert.NotNil(t, operation, "%s %s is missing from the OpenAPI document", route.Method, route.Path)
+	}
+}
+
+func TestSwaggerUI(t *testing.T) {
+	router := newTestRouter(t)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/docs", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), `url: "/openapi.json"`)
+	assert.NotContains(t, response.Body.String(), "https://", "the page loads nothing from a CDN")
+
+	for _, asset := range []string{"/docs/swagger-ui/swagger-ui-bundle.js", "/docs/swagger-ui/swagger-ui.css"} {
+		response = httptest.NewRecorder()
+		router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, asset, nil))
+		assert.Equal(t, http.StatusOK, response.Code, asset)
+		assert.NotEmpty(t, response.Body.Bytes(), asset)
+	}
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/docs/swagger-ui/../swagger.html", nil))
+	assert.NotEqual(t, http.StatusOK, response.Code)
+}
+
+func TestRoutesListing(t *testing.T) {
+	router := newTestRouter(t)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/routes", nil))
+	require.Equal(t, http.StatusOK, response.Code)
+	routes := []data.RouteInfo{}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &routes))
+
+	assert.Len(t, routes, len(router.Routes()))
+	assert.Contains(t, routes, data.RouteInfo{
+		Method:  http.MethodGet,
+		Path:    "/v0/pipelines/:id",
+		Handler: "api/router/error_handling.WithErrorHandling.func1",
+	})
+}
+
+func TestUnsignedWebhooksOutsideLocal(t *testing.T) {
+	examples := []struct {
+		environment string
+		status      int
+	}{
+		{environment: env.APPLICATION_ENV_LOCAL, status: http.StatusOK},
+		{environment: env.APPLICATION_ENV_DEV, status: http.StatusForbidden},
+		{environment: env.APPLICATION_ENV_PROD, status: http.StatusForbidden},
+	}
+	for _, example := range examples {
+		t.Run(example.environment, func(t *testing.T) {
+			t.Setenv(env.ENV_KEY_ENVIRONMENT, example.environment)
+			router := newTestRouter(t)
+			request := httptest.NewRequest(http.MethodPost, "/v0/webhooks/github", strings.NewReader(`{"zen":"Keep it logically awesome."}`))
+			request.Header.Set("X-GitHub-Event", "ping")
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+
+			assert.Equal(t, example.status, response.Code, response.Body.String())
+		})
+	}
+}
+
+func TestRunnerRegistrationIsAudited(t *testing.T) {
+	dataStore := store.NewMemoryStore()
+	jobs := queue.NewStoreQueue(dataStore, "jobs")
+	runners := runner.NewService(dataStore, jobs, runner.NewFileLogs(t.TempDir()), "registration-token") // pragma: allowlist secret
+	auditLog := audit.NewService(filepath.Join(t.TempDir(), "audit.jsonl"))
+	router := getRouter(v0.Dependencies{Runners: runners, Audit: auditLog}, config.CorsConfig{})
+
+	request := httptest.NewRequest(http.MethodPost, "/v0/runners/register", strings.NewReader(`{"name": "builder-1", "labels": ["linux"]}`))
+	request.Header.Set("Authorization", "Bearer registration-token")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	require.Equal(t, http.StatusCreated, response.Code, response.Body.String())
+	registered := runner.RegisterResponse{}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &registered))
+
+	events, err := auditLog.Query(context.Background(), audit.Filter{Action: models.AuditRunnerRegister})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, registered.RunnerId, events[0].ResourceId)
+	assert.Equal(t, "runner", events[0].Actor)
+	assert.NotContains(t, fmt.Sprint(events[0].Changes), registered.Token)
+}
+
+func TestAdminOnlyListings(t *testing.T) {
+	dataStore := store.NewMemoryStore()
+	authService := auth.NewService(dataStore, nil)
+	deps := v0.Dependencies{
+		Auth:      authService,
+		Rbac:      rbac.NewService(dataStore, []string{"admin"}),
+		Runners:   runner.NewService(dataStore, queue.NewStoreQueue(dataStore, "jobs"), runner.NewFileLogs(t.TempDir()), ""),
+		Scheduler: scheduler.New(dataStore, queue.NewStoreQueue(dataStore, "jobs"), "replica-1"),
+	}
+	router := getRouter(deps, config.CorsConfig{})
+	tokens := map[string]string{}
+	for _, subject := range []string{"admin", "developer"} {
+		_, token, err := authService.CreateToken(context.Background(), subject, "test", 0)
+		require.NoError(t, err)
+		tokens[subject] = token
+	}
+
+	for _, path := range []string{"/v0/runners", "/v0/schedules"} {
+		for subject, status := range map[string]int{"admin": http.StatusOK, "developer": http.StatusForbidden} {
+			request := httptest.NewRequest(http.MethodGet, path, nil)
+			request.Header.Set("Authorization", "Bearer "+tokens[subject])
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			assert.Equal(t, status, response.Code, "%s as %s", path, subject)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package system
+
+import (
+	"net/http"
+
+	"api/data"
+	"api/router/openapi"
+)
+
+// The system endpoints, for the OpenAPI document
+func Operations() []openapi.Operation {
+	return []openapi.Operation{
+		{Method: http.MethodGet, Path: "/", Tag: "system", Summary: "Welcome message", Status: http.StatusOK, Response: map[string]string{}},
+		{Method: http.MethodGet, Path: "/service-info", Tag: "system", Summary: "Describe the service", Status: http.StatusOK, Response: data.AboutInfo{}},
+		{Method: http.MethodGet, Path: "/healthz", Tag: "system", Summary: "Check the health of the service", Status: http.StatusOK, Response: data.HealthStatus{}},
+		{Method: http.MethodGet, Path: "/metrics", Tag: "system", Summary: "Prometheus metrics", Status: http.StatusOK, ResponseType: "text/plain"},
+		{Method: http.MethodGet, Path: "/routes", Tag: "system", Summary: "List the registered routes, in dev mode", Status: http.StatusOK, Response: []data.RouteInfo{}},
+	}
+}
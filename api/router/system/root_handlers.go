@@ -1,13 +1,13 @@
 package system
 
 import (
-	"fmt"
 	"net/http"
+	"sort"
 	"time"
 
 	"api/data"
 	"api/env"
-	"api/logger"
+	"api/errors"
 
 	"github.com/gin-gonic/gin"
 )
@@ -37,15 +37,33 @@ func HealthCheckHandler(c *gin.Context) {
 	})
 }
 
-func NotFoundHandler(c *gin.Context) {
-	log := logger.FromContext(c)
-	log.Errorf("Non-existent endpoint accessed: %s", c.Request.URL.Path)
-	c.JSON(http.StatusNotFound, newMissingEndpoint(c.Request.URL.Path))
+func NotFoundHandler(c *gin.Context) error {
+	return errors.NewNotFoundError(c, "Endpoint '%s' does not exist", c.Request.URL.Path)
 }
 
-func newMissingEndpoint(endpoint string) data.BasicErrorInfo {
-	return data.BasicErrorInfo{
-		StatusCode: http.StatusNotFound,
-		Message:    fmt.Sprintf("Endpoint '%s' does not exist", endpoint),
+// Called when the path exists for other methods, which gin lists in the Allow header
+func MethodNotAllowedHandler(c *gin.Context) error {
+	allowed := c.Writer.Header().Get("Allow")
+	return errors.NewMethodNotAllowedError(c, "Endpoint '%s' does not accept %s, use %s", c.Request.URL.Path, c.Request.Method, allowed)
+}
+
+// List the registered routes, to find out what the API serves in dev mode
+func RoutesHandler(engine *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		routes := []data.RouteInfo{}
+		for _, route := range engine.Routes() {
+			routes = append(routes, data.RouteInfo{
+				Method:  route.Method,
+				Path:    route.Path,
+				Handler: route.Handler,
+			})
+		}
+		sort.Slice(routes, func(i, j int) bool {
+			if routes[i].Path != routes[j].Path {
+				return routes[i].Path < routes[j].Path
+			}
+			return routes[i].Method < routes[j].Method
+		})
+		c.JSON(http.StatusOK, routes)
 	}
 }
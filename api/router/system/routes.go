@@ -3,6 +3,8 @@ package system
 import (
 	"time"
 
+	error_handling "api/router/error_handling"
+
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -18,5 +20,11 @@ func SetSystemRoutes(route *gin.Engine) {
 	route.GET("/service-info", ServiceInfoHandler)
 	route.GET("/healthz", HealthCheckHandler)
 	route.GET("/metrics", gin.WrapH(promhttp.Handler()))
-	route.NoRoute(NotFoundHandler)
+	if gin.IsDebugging() {
+		route.GET("/routes", RoutesHandler(route))
+	}
+	route.NoRoute(error_handling.WithErrorHandling(NotFoundHandler))
+	// answer with 405 and an Allow header rather than 404 when only the method is wrong
+	route.HandleMethodNotAllowed = true
+	route.NoMethod(error_handling.WithErrorHandling(MethodNotAllowedHandler))
 }
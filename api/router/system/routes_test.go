@@ -0,0 +1,104 @@
+package system
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api/data"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Router of the system routes, in the gin mode given
+func newTestRouter(t *testing.T, mode string) *gin.Engine {
+	previous := gin.Mode()
+	gin.SetMode(mode)
+	t.Cleanup(func() {
+		gin.SetMode(previous)
+	})
+	router := gin.New()
+	SetSystemRoutes(router)
+	return router
+}
+
+func serve(router *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(method, path, nil))
+	return response
+}
+
+func TestUnknownRoutes(t *testing.T) {
+	router := newTestRouter(t, gin.TestMode)
+	examples := []struct {
+		name    string
+		method  string
+		path    string
+		status  int
+		code    string
+		message string
+		allow   string
+	}{
+		{
+			name:    "missing endpoint",
+			method:  http.MethodGet,
+			path:    "/v0/nothing",
+			status:  http.StatusNotFound,
+			code:    "not_found",
+			message: "Endpoint '/v0/nothing' does not exist",
+		},
+		{
+			name:    "wrong method",
+			method:  http.MethodPatch,
+			path:    "/healthz",
+			status:  http.StatusMethodNotAllowed,
+			code:    "method_not_allowed",
+			message: "Endpoint '/healthz' does not accept PATCH, use GET",
+			allow:   "GET",
+		},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			response := serve(router, example.method, example.path)
+
+			assert.Equal(t, example.status, response.Code)
+			assert.Equal(t, example.allow, response.Header().Get("Allow"))
+			assert.Equal(t, "application/problem+json", response.Header().Get("Content-Type"))
+			body := map[string]any{}
+			require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, example.code, body["code"])
+			assert.Equal(t, example.message, body["message"])
+			assert.Equal(t, example.path, body["instance"])
+			assert.EqualValues(t, example.status, body["status"])
+		})
+	}
+}
+
+func TestRoutesListing(t *testing.T) {
+	t.Run("Dev mode", func(t *testing.T) {
+		response := serve(newTestRouter(t, gin.DebugMode), http.MethodGet, "/routes")
+
+		assert.Equal(t, http.StatusOK, response.Code)
+		routes := []data.RouteInfo{}
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &routes))
+		assert.Contains(t, routes, data.RouteInfo{
+			Method:  http.MethodGet,
+			Path:    "/healthz",
+			Handler: "api/router/system.HealthCheckHandler",
+		})
+		assert.Contains(t, routes, data.RouteInfo{
+			Method:  http.MethodGet,
+			Path:    "/routes",
+			Handler: "api/router/system.RoutesHandler.func1",
+		})
+	})
+
+	t.Run("Release mode", func(t *testing.T) {
+		response := serve(newTestRouter(t, gin.ReleaseMode), http.MethodGet, "/routes")
+
+		assert.Equal(t, http.StatusNotFound, response.Code)
+	})
+}
@@ -0,0 +1,80 @@
+package v0
+
+import (
+	goerrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"api/artifacts"
+	"api/errors"
+	"api/runner"
+	"api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Receive a file from the runner executing a job; the body is the raw file contents
+func uploadArtifact(service *runner.Service, artifactService *artifacts.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		assignment, err := service.Assignment(c, currentRunner(c), c.Param("assignmentId"))
+		if err != nil {
+			return runnerError(c, err)
+		}
+		name := c.Query("name")
+		artifact, err := artifactService.Upload(c, assignment.RunId, assignment.Job, name, c.Request.Body, c.GetHeader(artifacts.ChecksumHeader))
+		if goerrors.Is(err, artifacts.ErrInvalidArtifact) {
+			return errors.NewInputError(c, "%w", err)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to store artifact %s: %w", name, err)
+		}
+		c.JSON(http.StatusCreated, artifact)
+		return nil
+	}
+}
+
+func listArtifacts(artifactService *artifacts.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		runId := c.Param("runId")
+		artifactList, err := artifactService.List(c, runId)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Run %s not found", runId)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to list the artifacts of run %s: %w", runId, err)
+		}
+		c.JSON(http.StatusOK, artifactList)
+		return nil
+	}
+}
+
+// Stream an artifact; names are paths, so they come from a catch-all parameter
+func downloadArtifact(artifactService *artifacts.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		runId := c.Param("runId")
+		name := strings.TrimPrefix(c.Param("name"), "/")
+		artifact, reader, err := artifactService.Open(c, runId, name)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Run %s not found", runId)
+		}
+		if goerrors.Is(err, artifacts.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Artifact %s not found in run %s", name, runId)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to open artifact %s: %w", name, err)
+		}
+		defer reader.Close()
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Length", strconv.FormatInt(artifact.Size, 10))
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(artifact.Name)))
+		c.Header("ETag", strconv.Quote(artifact.Sha256))
+		c.Header(artifacts.ChecksumHeader, artifact.Sha256)
+		c.Status(http.StatusOK)
+		_, err = io.Copy(c.Writer, reader)
+		return err
+	}
+}
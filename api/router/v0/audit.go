@@ -0,0 +1,141 @@
+package v0
+
+import (
+	"encoding/json"
+	goerrors "errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"api/audit"
+	"api/errors"
+	"api/logger"
+	"api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Events the handler of a mutating request wants recorded once it succeeded
+const pendingAuditKey string = "auditEvents"
+
+const jsonLinesContentType string = "application/x-ndjson"
+
+var errAuditDisabled = goerrors.New("The audit log is disabled")
+
+/*
+Describe the change made by the current request, for the audit log.
+
+[IN] c: request context
+
+[IN] event: action and resource; the caller, request id and origin are filled in when recorded
+
+[IN] before: the resource before the change; nil when it was created
+
+[IN] after: the resource after the change; nil when it was deleted
+*/
+func auditChange(c *gin.Context, event models.AuditEvent, before, after any) {
+	changes, err := audit.Diff(before, after)
+	if err != nil {
+		logger.FromContext(c).Warnf("Unable to compute the changes of %s: %v", event.Action, err)
+	}
+	event.Changes = changes
+	c.Set(pendingAuditKey, append(pendingAuditEvents(c), event))
+}
+
+func pendingAuditEvents(c *gin.Context) []models.AuditEvent {
+	value, _ := c.Get(pendingAuditKey)
+	events, _ := value.([]models.AuditEvent)
+	return events
+}
+
+// Record the changes of the successful mutating requests in the audit log
+func recordAudit(service *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if service == nil || c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			return
+		}
+		if c.Writer.Status() >= http.StatusBadRequest {
+			return
+		}
+		for _, event := range pendingAuditEvents(c) {
+			_, err := service.Record(c, event)
+			if err != nil {
+				// the action already happened, so only the log knows about it
+				logger.FromContext(c).Errorf("Failed to audit %s of %s: %v", event.Action, event.ResourceId, err)
+			}
+		}
+	}
+}
+
+// Parse an optional RFC 3339 time of the query string
+func queryTime(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.NewInputError(c, "Invalid %s %q: use an RFC 3339 time", name, value)
+	}
+	return parsed, nil
+}
+
+/*
+Query the audit log, newest first.
+
+Filters on the from and to times, actor and action query parameters. With
+format=jsonl or an Accept header of application/x-ndjson, every matching event
+is exported as JSON Lines unless a limit is given.
+*/
+func listAuditEvents(service *audit.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		if service == nil {
+			return errAuditDisabled
+		}
+		from, err := queryTime(c, "from")
+		if err != nil {
+			return err
+		}
+		to, err := queryTime(c, "to")
+		if err != nil {
+			return err
+		}
+		jsonLines := c.Query("format") == "jsonl" || c.GetHeader("Accept") == jsonLinesContentType
+		limit := audit.DefaultLimit
+		if jsonLines {
+			limit = 0
+		}
+		if c.Query("limit") != "" {
+			limit, err = strconv.Atoi(c.Query("limit"))
+			if err != nil || limit < 1 || limit > audit.MaxLimit {
+				return errors.NewInputError(c, "Invalid limit %q: use a number between 1 and %d", c.Query("limit"), audit.MaxLimit)
+			}
+		}
+		events, err := service.Query(c, audit.Filter{
+			From:   from,
+			To:     to,
+			Actor:  c.Query("actor"),
+			Action: models.AuditAction(c.Query("action")),
+			Limit:  limit,
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to query the audit log: %w", err)
+		}
+		if !jsonLines {
+			c.JSON(http.StatusOK, events)
+			return nil
+		}
+		c.Header("Content-Type", jsonLinesContentType)
+		c.Status(http.StatusOK)
+		encoder := json.NewEncoder(c.Writer)
+		for _, event := range events {
+			err = encoder.Encode(event)
+			if err != nil {
+				return fmt.Errorf("Failed to export the audit log: %w", err)
+			}
+		}
+		return nil
+	}
+}
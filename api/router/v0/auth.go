@@ -0,0 +1,129 @@
+package v0
+
+import (
+	goerrors "errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"api/auth"
+	"api/context_settings"
+	"api/errors"
+	"api/models"
+	"api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Longest lifetime of an API token, in days
+const maxTokenDays int = 366
+
+var errAuthDisabled = goerrors.New("Authentication is disabled")
+
+type createTokenRequest struct {
+	Name string `json:"name"`
+	// The token never expires when 0
+	ExpiresInDays int `json:"expiresInDays"`
+}
+
+type createTokenResponse struct {
+	models.ApiToken
+	// Shown once; only its hash is stored
+	Token string `json:"token"`
+}
+
+// Authenticate the caller by its API token or JWT and store its identity in the request context
+func authenticate(service *auth.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		if service == nil {
+			// e.g. in tests
+			return nil
+		}
+		identity, err := service.Authenticate(c, bearerToken(c))
+		if goerrors.Is(err, auth.ErrUnauthorized) {
+			return errors.NewUnauthorizedError(c, "%w", err)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to authenticate the caller: %w", err)
+		}
+		c.Set(context_settings.Identity, identity)
+		c.Set(context_settings.Caller, identity.Subject)
+		return nil
+	}
+}
+
+// Identity of the caller, as the authentication middleware found it
+func currentCaller(c *gin.Context) (*models.Identity, error) {
+	identity := auth.Caller(c)
+	if identity == nil {
+		return nil, errAuthDisabled
+	}
+	return identity, nil
+}
+
+// Create an API token for the caller
+func createToken(service *auth.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		identity, err := currentCaller(c)
+		if err != nil {
+			return err
+		}
+		request := createTokenRequest{}
+		err = c.ShouldBindJSON(&request)
+		if err != nil {
+			return errors.NewInputError(c, "Invalid token request: %w", err)
+		}
+		if request.Name == "" {
+			return errors.NewInputError(c, "The token name is required")
+		}
+		if request.ExpiresInDays < 0 || request.ExpiresInDays > maxTokenDays {
+			return errors.NewInputError(c, "Invalid expiresInDays %d: use a number between 0 and %d", request.ExpiresInDays, maxTokenDays)
+		}
+		apiToken, token, err := service.CreateTokenFor(c, identity, request.Name, time.Duration(request.ExpiresInDays)*24*time.Hour)
+		if goerrors.Is(err, auth.ErrUnauthorized) {
+			return errors.NewUnauthorizedError(c, "%w", err)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to create token %s: %w", request.Name, err)
+		}
+		auditChange(c, models.AuditEvent{Action: models.AuditTokenCreate, ResourceId: apiToken.Id}, nil, apiToken)
+		c.JSON(http.StatusCreated, createTokenResponse{ApiToken: *apiToken, Token: token})
+		return nil
+	}
+}
+
+// API tokens of the caller, without their values
+func listTokens(service *auth.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		identity, err := currentCaller(c)
+		if err != nil {
+			return err
+		}
+		tokens, err := service.ListTokens(c, identity.Subject)
+		if err != nil {
+			return fmt.Errorf("Failed to list the tokens of %s: %w", identity.Subject, err)
+		}
+		c.JSON(http.StatusOK, tokens)
+		return nil
+	}
+}
+
+func revokeToken(service *auth.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		identity, err := currentCaller(c)
+		if err != nil {
+			return err
+		}
+		id := c.Param("id")
+		err = service.RevokeToken(c, identity.Subject, id)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Token %s not found", id)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to revoke token %s: %w", id, err)
+		}
+		auditChange(c, models.AuditEvent{Action: models.AuditTokenRevoke, ResourceId: id}, nil, nil)
+		c.Status(http.StatusNoContent)
+		return nil
+	}
+}
@@ -0,0 +1,110 @@
+package v0
+
+import (
+	goerrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"api/artifacts"
+	"api/cache"
+	"api/errors"
+	"api/models"
+	"api/runner"
+	"api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stream the archive of the cache entry matching the request, or answer 204 on a miss
+func restoreCache(service *runner.Service, cacheService *cache.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		assignment, err := service.Assignment(c, currentRunner(c), c.Param("assignmentId"))
+		if err != nil {
+			return runnerError(c, err)
+		}
+		request := runner.CacheRestoreRequest{}
+		err = c.ShouldBindJSON(&request)
+		if err != nil {
+			return errors.NewInputError(c, "Invalid cache restore request: %w", err)
+		}
+		entry, reader, err := cacheService.Restore(c, assignment.PipelineId, request.Key, request.RestoreKeys)
+		if err != nil {
+			return fmt.Errorf("Failed to restore cache %s: %w", request.Key, err)
+		}
+		if entry == nil {
+			c.Status(http.StatusNoContent)
+			return nil
+		}
+		defer reader.Close()
+		c.Header("Content-Type", "application/gzip")
+		c.Header("Content-Length", strconv.FormatInt(entry.Size, 10))
+		c.Header(runner.CacheKeyHeader, entry.Key)
+		c.Header(artifacts.ChecksumHeader, entry.Sha256)
+		c.Status(http.StatusOK)
+		_, err = io.Copy(c.Writer, reader)
+		return err
+	}
+}
+
+// Receive the archive of a cache entry; 201 when created, 200 when the key already existed
+func saveCache(service *runner.Service, cacheService *cache.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		assignment, err := service.Assignment(c, currentRunner(c), c.Param("assignmentId"))
+		if err != nil {
+			return runnerError(c, err)
+		}
+		key := c.Query("key")
+		entry, created, err := cacheService.Save(c, assignment.PipelineId, key, c.Request.Body, c.GetHeader(artifacts.ChecksumHeader))
+		if goerrors.Is(err, cache.ErrTooLarge) || goerrors.Is(err, cache.ErrInvalidEntry) {
+			return errors.NewInputError(c, "%w", err)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to save cache %s: %w", key, err)
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		c.JSON(status, entry)
+		return nil
+	}
+}
+
+func listCaches(pipelines *store.Pipelines, cacheService *cache.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		id := c.Param("id")
+		_, err := pipelines.Get(c, id)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Pipeline %s not found", id)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to get pipeline %s: %w", id, err)
+		}
+		entries, err := cacheService.List(c, id)
+		if err != nil {
+			return fmt.Errorf("Failed to list the caches of pipeline %s: %w", id, err)
+		}
+		c.JSON(http.StatusOK, entries)
+		return nil
+	}
+}
+
+// Drop a cache entry, e.g. one that got corrupted; the key comes from the query string
+func deleteCache(cacheService *cache.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		id := c.Param("id")
+		key := c.Query("key")
+		err := cacheService.Delete(c, id, key)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Cache %s not found in pipeline %s", key, id)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to delete cache %s: %w", key, err)
+		}
+		auditChange(c, models.AuditEvent{Action: models.AuditCacheDelete, ResourceId: id + "/" + key}, nil, nil)
+		c.Status(http.StatusNoContent)
+		return nil
+	}
+}
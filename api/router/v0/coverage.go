@@ -0,0 +1,94 @@
+package v0
+
+import (
+	goerrors "errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"api/coverage"
+	"api/errors"
+	"api/models"
+	"api/runner"
+	"api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Coverage trend of a pipeline
+type coverageHistoryResponse struct {
+	// Most recent run with coverage; nil when there is none
+	Latest *models.RunCoverage  `json:"latest"`
+	Series []models.RunCoverage `json:"series"`
+}
+
+// Receive a coverage report from the runner executing a job; the body is the raw report
+func uploadCoverage(service *runner.Service, reports *coverage.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		assignment, err := service.Assignment(c, currentRunner(c), c.Param("assignmentId"))
+		if err != nil {
+			return runnerError(c, err)
+		}
+		name := c.Query("name")
+		total, err := reports.Ingest(c, assignment.RunId, assignment.Job, name, c.Request.Body)
+		if goerrors.Is(err, coverage.ErrInvalidReport) {
+			return errors.NewInputError(c, "%w", err)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to store coverage report %s: %w", name, err)
+		}
+		c.JSON(http.StatusCreated, total)
+		return nil
+	}
+}
+
+// Coverage of a run with its files
+func getRunCoverage(reports *coverage.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		runId := c.Param("runId")
+		runCoverage, err := reports.Run(c, runId)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Run %s not found", runId)
+		}
+		if goerrors.Is(err, coverage.ErrNoCoverage) {
+			return errors.NewNotFoundError(c, "Run %s has no coverage report", runId)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to get the coverage of run %s: %w", runId, err)
+		}
+		c.JSON(http.StatusOK, runCoverage)
+		return nil
+	}
+}
+
+// Coverage of the recent runs of a pipeline, ?runs= of them, optionally on a ?branch=
+func getPipelineCoverage(pipelines *store.Pipelines, reports *coverage.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		id := c.Param("id")
+		limit := coverage.DefaultHistory
+		if value := c.Query("runs"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > coverage.MaxHistory {
+				return errors.NewInputError(c, "Invalid runs %s: use a number between 1 and %d", value, coverage.MaxHistory)
+			}
+		}
+		_, err := pipelines.Get(c, id)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Pipeline %s not found", id)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to get pipeline %s: %w", id, err)
+		}
+		series, err := reports.History(c, id, c.Query("branch"), limit)
+		if err != nil {
+			return fmt.Errorf("Failed to get the coverage of pipeline %s: %w", id, err)
+		}
+		response := coverageHistoryResponse{Series: series}
+		if len(series) > 0 {
+			response.Latest = &series[len(series)-1]
+		}
+		c.JSON(http.StatusOK, response)
+		return nil
+	}
+}
@@ -0,0 +1,42 @@
+package v0
+
+import (
+	"api/artifacts"
+	"api/audit"
+	"api/auth"
+	"api/cache"
+	"api/clients/githubclient"
+	"api/coverage"
+	"api/queue"
+	"api/rbac"
+	"api/runner"
+	"api/scheduler"
+	"api/secrets"
+	"api/store"
+	"api/testreport"
+)
+
+// Backends used by the v0 handlers
+type Dependencies struct {
+	// Nil when no GitHub token was configured
+	Github      *githubclient.GithubService
+	Pipelines   *store.Pipelines
+	Runs        *store.Runs
+	Jobs        queue.Queue
+	Scheduler   *scheduler.Scheduler
+	Runners     *runner.Service
+	Artifacts   *artifacts.Service
+	Cache       *cache.Service
+	TestReports *testreport.Service
+	Coverage    *coverage.Service
+	// Nil when no master key was configured
+	Secrets *secrets.Service
+	// Nil when the API is not authenticated, e.g. in tests
+	Auth *auth.Service
+	// Nil when the API is not authenticated; every caller is then allowed everything
+	Rbac *rbac.Service
+	// Nil in tests; mutating requests are then not audited
+	Audit *audit.Service
+	// Empty when webhook deliveries are not signed
+	WebhookSecret string
+}
@@ -3,27 +3,48 @@ package v0
 import (
 	"fmt"
 	"net/http"
-	"strconv"
+	"time"
 
+	"api/clients/githubclient"
 	"api/errors"
 
-	"api/models"
-
 	"github.com/gin-gonic/gin"
 )
 
-func getPipeline() func(c *gin.Context) error {
+func compareRefs(github *githubclient.GithubService) func(c *gin.Context) error {
 	return func(c *gin.Context) error {
-		value := c.Param("id")
-		number, err := strconv.Atoi(value)
-		if err != nil {
-			return errors.NewInputError(c, fmt.Sprintf("Failed to parse ID: %v", err))
+		repoURL := c.Query("repo")
+		base := c.Query("base")
+		head := c.Query("head")
+		if repoURL == "" || base == "" || head == "" {
+			return errors.NewInputError(c, "The repo, base and head query parameters are required")
 		}
-		pipeline := &models.Pipeline{
-			Id:  fmt.Sprintf("sample-id-string-%d", number),
-			Url: "www.example.com",
+		if github == nil {
+			return errors.NewInputError(c, "GitHub integration is not configured, refs cannot be compared")
+		}
+		comparison, err := github.CompareRefs(c, repoURL, base, head)
+		if err != nil {
+			return githubError(c, err, "Failed to compare %s...%s", base, head)
 		}
-		c.JSON(http.StatusOK, pipeline)
+		c.JSON(http.StatusOK, comparison)
 		return nil
 	}
 }
+
+// Translate a failed GitHub call into a rate limit, a missing resource, an invalid request or an upstream failure
+func githubError(c *gin.Context, err error, format string, a ...any) error {
+	message := fmt.Sprintf(format, a...)
+	retryAfter, rateLimited := githubclient.RetryAfter(err, time.Now())
+	if rateLimited {
+		return errors.NewRateLimitedError(c, retryAfter, "%s: the GitHub rate limit was exceeded", message)
+	}
+	status, fromGithub := githubclient.ResponseStatus(err)
+	switch {
+	case !fromGithub:
+		return errors.NewInputError(c, "%s: %w", message, err)
+	case status == http.StatusNotFound:
+		return errors.NewNotFoundError(c, "%s: %w", message, err)
+	default:
+		return errors.NewUpstreamError(c, "GitHub", status, fmt.Errorf("%s: %w", message, err))
+	}
+}
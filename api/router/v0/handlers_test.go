@@ -0,0 +1,24 @@
+package v0
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api/errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareRefsWithoutGithub(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/v0/repos/compare?repo=https://github.com/some-user/my-project&base=main&head=feature", nil)
+
+	err := compareRefs(nil)(c)
+
+	coded, ok := err.(errors.CodedError)
+	if assert.True(t, ok, "%v is not an API error", err) {
+		assert.Equal(t, errors.CodeInvalidInput, coded.Code())
+	}
+}
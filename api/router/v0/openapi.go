@@ -0,0 +1,486 @@
+package v0
+
+import (
+	"net/http"
+
+	"api/artifacts"
+	"api/clients/githubclient"
+	"api/models"
+	"api/router/openapi"
+	"api/runner"
+	"api/scheduler"
+)
+
+// Secrets of the organisation, repository or pipeline a path prefix names
+func secretOperations(prefix string) []openapi.Operation {
+	return []openapi.Operation{
+		{
+			Method:   http.MethodGet,
+			Path:     prefix + "/secrets",
+			Tag:      "secrets",
+			Summary:  "List the secrets, without their values",
+			Security: openapi.SecurityUser,
+			Status:   http.StatusOK,
+			Response: []models.Secret{},
+		},
+		{
+			Method:   http.MethodPut,
+			Path:     prefix + "/secrets/:name",
+			Tag:      "secrets",
+			Summary:  "Create or replace a secret",
+			Security: openapi.SecurityUser,
+			Request:  putSecretRequest{},
+			Status:   http.StatusOK,
+			Response: models.Secret{},
+		},
+		{
+			Method:   http.MethodDelete,
+			Path:     prefix + "/secrets/:name",
+			Tag:      "secrets",
+			Summary:  "Delete a secret",
+			Security: openapi.SecurityUser,
+			Status:   http.StatusNoContent,
+		},
+	}
+}
+
+// Role bindings of the repository or pipeline a path prefix names
+func roleOperations(prefix string) []openapi.Operation {
+	return []openapi.Operation{
+		{
+			Method:   http.MethodGet,
+			Path:     prefix + "/roles",
+			Tag:      "roles",
+			Summary:  "List the role bindings",
+			Security: openapi.SecurityUser,
+			Status:   http.StatusOK,
+			Response: []models.RoleBinding{},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     prefix + "/roles",
+			Tag:      "roles",
+			Summary:  "Grant a role to a user or team, replacing the role it had",
+			Security: openapi.SecurityUser,
+			Request:  grantRoleRequest{},
+			Status:   http.StatusCreated,
+			Response: models.RoleBinding{},
+		},
+		{
+			Method:   http.MethodDelete,
+			Path:     prefix + "/roles/:bindingId",
+			Tag:      "roles",
+			Summary:  "Revoke a role binding",
+			Security: openapi.SecurityUser,
+			Status:   http.StatusNoContent,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     prefix + "/roles/changes",
+			Tag:      "roles",
+			Summary:  "List the grants and revocations, oldest first",
+			Security: openapi.SecurityUser,
+			Status:   http.StatusOK,
+			Response: []models.PermissionChange{},
+		},
+	}
+}
+
+// Raw report of a job uploaded by its runner
+func reportOperation(path string, tag string, summary string, response any) openapi.Operation {
+	return openapi.Operation{
+		Method:   http.MethodPost,
+		Path:     path,
+		Tag:      tag,
+		Summary:  summary,
+		Security: openapi.SecurityRunner,
+		Parameters: []openapi.Parameter{
+			{Name: "name", Description: "Name of the report file", Required: true},
+		},
+		RequestType: "application/octet-stream",
+		Status:      http.StatusCreated,
+		Response:    response,
+	}
+}
+
+// Upload of a test report, which also tells the step that wrote it
+func testReportOperation() openapi.Operation {
+	operation := reportOperation("/v0/runners/jobs/:assignmentId/test-reports", "tests", "Upload a JUnit XML or go test -json report of a job", models.TestSummary{})
+	operation.Parameters = append(operation.Parameters, openapi.Parameter{
+		Name:        "step",
+		Description: "Index of the step that wrote the report",
+		Type:        "integer",
+	})
+	return operation
+}
+
+// The v0 endpoints, for the OpenAPI document
+func Operations() []openapi.Operation {
+	operations := []openapi.Operation{
+		{
+			Method:   http.MethodPost,
+			Path:     "/v0/pipelines",
+			Tag:      "pipelines",
+			Summary:  "Create a pipeline from its inline definition or the one of its repository",
+			Security: openapi.SecurityUser,
+			Request:  createPipelineRequest{},
+			Status:   http.StatusCreated,
+			Response: models.Pipeline{},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v0/pipelines",
+			Tag:      "pipelines",
+			Summary:  "List the pipelines the caller is allowed to view",
+			Security: openapi.SecurityUser,
+			Status:   http.StatusOK,
+			Response: []models.Pipeline{},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v0/pipelines/:id",
+			Tag:      "pipelines",
+			Summary:  "Get a pipeline",
+			Security: openapi.SecurityUser,
+			Status:   http.StatusOK,
+			Response: models.Pipeline{},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v0/pipelines/:id/runs",
+			Tag:      "runs",
+			Summary:  "List the runs of a pipeline",
+			Security: openapi.SecurityUser,
+			Status:   http.StatusOK,
+			Response: []models.Run{},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v0/pipelines/:id/caches",
+			Tag:      "caches",
+			Summary:  "List the cache entries of a pipeline",
+			Security: openapi.SecurityUser,
+			Status:   http.StatusOK,
+			Response: []models.CacheEntry{},
+		},
+		{
+			Method:   http.MethodDelete,
+			Path:     "/v0/pipelines/:id/caches",
+			Tag:      "caches",
+			Summary:  "Delete a cache entry, e.g. one that got corrupted",
+			Security: openapi.SecurityUser,
+			Parameters: []openapi.Parameter{
+				{Name: "key", Description: "Key of the entry", Required: true},
+			},
+			Status: http.StatusNoContent,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v0/pipelines/:id/flaky-tests",
+			Tag:      "tests",
+			Summary:  "List the tests that passed and failed on a commit, or often flipped over the recent runs",
+			Security: openapi.SecurityUser,
+			Parameters: []openapi.Parameter{
+				{Name: "runs", Description: "Number of recent runs to look at", Type: "integer"},
+			},
+			Status:   http.StatusOK,
+			Response: []models.FlakyTest{},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v0/pipelines/:id/coverage",
+			Tag:      "coverage",
+			Summary:  "Get the coverage trend of a pipeline",
+			Security: openapi.SecurityUser,
+			Parameters: []openapi.Parameter{
+				{Name: "runs", Description: "Number of recent runs to look at", Type: "integer"},
+				{Name: "branch", Description: "Only look at the runs of this branch"},
+			},
+			Status:   http.StatusOK,
+			Response: coverageHistoryResponse{},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v0/runs/:runId",
+			Tag:      "runs",
+			Summary:  "Get a run and its jobs",
+			Security: openapi.SecurityUser,
+			Status:   http.StatusOK,
+			Response: models.Run{},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/v0/runs/:runId/cancel",
+			Tag:      "runs",
+			Summary:  "Cancel an unfinished run",
+			Security: openapi.SecurityUser,
+			Request:  cancelRunRequest{},
+			Status:   http.StatusOK,
+			Response: models.Run{},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/v0/runs/:runId/rerun",
+			Tag:      "runs",
+			Summary:  "Run a finished run again, as a new attempt",
+			Security: openapi.SecurityUser,
+			Request:  rerunRequest{},
+			Status:   http.StatusCreated,
+			Response: models.Run{},
+		},
+		{
+			Method:       http.MethodGet,
+			Path:         "/v0/runs/:runId/jobs/:job/logs",
+			Tag:          "runs",
+			Summary:      "Get the logs of a job",
+			Security:     openapi.SecurityUser,
+			Status:       http.StatusOK,
+			ResponseType: "text/plain",
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v0/runs/:runId/artifacts",
+			Tag:      "artifacts",
+			Summary:  "List the artifacts of a run",
+			Security: openapi.SecurityUser,
+			Status:   http.StatusOK,
+			Response: []models.Artifact{},
+		},
+		{
+			Method:       http.MethodGet,
+			Path:         "/v0/runs/:runId/artifacts/*name",
+			Tag:          "artifacts",
+			Summary:      "Download an artifact",
+			Security:     openapi.SecurityUser,
+			Status:       http.StatusOK,
+			ResponseType: "application/octet-stream",
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v0/runs/:runId/tests",
+			Tag:      "tests",
+			Summary:  "List the test results of a run with their counts",
+			Security: openapi.SecurityUser,
+			Parameters: []openapi.Parameter{
+				{Name: "job", Description: "Only list the results of this job"},
+				{Name: "status", Description: "Only list the results with this status, e.g. failed"},
+			},
+			Status:   http.StatusOK,
+			Response: testResultsResponse{},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v0/runs/:runId/coverage",
+			Tag:      "coverage",
+			Summary:  "Get the coverage of a run",
+			Security: openapi.SecurityUser,
+			Status:   http.StatusOK,
+			Response: models.RunCoverage{},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v0/runners",
+			Tag:      "runners",
+			Summary:  "List the registered runners, for administrators",
+			Security: openapi.SecurityUser,
+			Status:   http.StatusOK,
+			Response: []models.Runner{},
+		},
+		{
+			Method:   http.MethodDelete,
+			Path:     "/v0/runners/:id",
+			Tag:      "runners",
+			Summary:  "Remove a runner",
+			Security: openapi.SecurityUser,
+			Status:   http.StatusNoContent,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/v0/runners/register",
+			Tag:      "runners",
+			Summary:  "Register a runner and get its token",
+			Security: openapi.SecurityRegistration,
+			Request:  runner.RegisterRequest{},
+			Status:   http.StatusCreated,
+			Response: runner.RegisterResponse{},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/v0/runners/heartbeat",
+			Tag:      "runners",
+			Summary:  "Tell the runner is alive and extend the lease of its job",
+			Security: openapi.SecurityRunner,
+			Request:  runner.HeartbeatRequest{},
+			Status:   http.StatusNoContent,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/v0/runners/jobs/request",
+			Tag:      "runners",
+			Summary:  "Wait for a job the runner can execute",
+			Security: openapi.SecurityRunner,
+			Parameters: []openapi.Parameter{
+				{Name: "wait", Description: "Seconds to wait for a job, at most 60", Type: "integer"},
+			},
+			Status:       http.StatusOK,
+			Response:     runner.JobSpec{},
+			Alternatives: map[int]string{http.StatusNoContent: "No job became available in time"},
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/v0/runners/jobs/:assignmentId/logs",
+			Tag:         "runners",
+			Summary:     "Append a chunk to the logs of a job",
+			Security:    openapi.SecurityRunner,
+			RequestType: "text/plain",
+			Status:      http.StatusNoContent,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/v0/runners/jobs/:assignmentId/steps",
+			Tag:      "runners",
+			Summary:  "Report the status of a step",
+			Security: openapi.SecurityRunner,
+			Request:  runner.StepUpdate{},
+			Status:   http.StatusNoContent,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/v0/runners/jobs/:assignmentId/artifacts",
+			Tag:      "artifacts",
+			Summary:  "Upload an artifact of a job",
+			Security: openapi.SecurityRunner,
+			Parameters: []openapi.Parameter{
+				{Name: "name", Description: "Path of the artifact", Required: true},
+				{Name: artifacts.ChecksumHeader, In: "header", Description: "SHA-256 of the content, checked once received"},
+			},
+			RequestType: "application/octet-stream",
+			Status:      http.StatusCreated,
+			Response:    models.Artifact{},
+		},
+		testReportOperation(),
+		reportOperation("/v0/runners/jobs/:assignmentId/coverage", "coverage", "Upload a Go coverprofile or Cobertura XML report of a job", models.Coverage{}),
+		{
+			Method:       http.MethodPost,
+			Path:         "/v0/runners/jobs/:assignmentId/cache/restore",
+			Tag:          "caches",
+			Summary:      "Download the archive of the cache entry matching the key or restore keys",
+			Security:     openapi.SecurityRunner,
+			Request:      runner.CacheRestoreRequest{},
+			Status:       http.StatusOK,
+			ResponseType: "application/gzip",
+			Alternatives: map[int]string{http.StatusNoContent: "No cache entry matched"},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/v0/runners/jobs/:assignmentId/cache",
+			Tag:      "caches",
+			Summary:  "Upload the archive of a cache entry",
+			Security: openapi.SecurityRunner,
+			Parameters: []openapi.Parameter{
+				{Name: "key", Description: "Key of the entry", Required: true},
+				{Name: artifacts.ChecksumHeader, In: "header", Description: "SHA-256 of the archive, checked once received"},
+			},
+			RequestType:  "application/gzip",
+			Status:       http.StatusCreated,
+			Response:     models.CacheEntry{},
+			Alternatives: map[int]string{http.StatusOK: "The key already existed, so the archive was discarded"},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/v0/runners/jobs/:assignmentId/complete",
+			Tag:      "runners",
+			Summary:  "Report the result of a job",
+			Security: openapi.SecurityRunner,
+			Request:  runner.CompleteRequest{},
+			Status:   http.StatusNoContent,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v0/schedules",
+			Tag:      "pipelines",
+			Summary:  "List the schedules of the pipelines with their next fire time, for administrators",
+			Security: openapi.SecurityUser,
+			Status:   http.StatusOK,
+			Response: []scheduler.Entry{},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v0/audit",
+			Tag:      "audit",
+			Summary:  "Query the audit log, newest first",
+			Security: openapi.SecurityUser,
+			Parameters: []openapi.Parameter{
+				{Name: "from", Description: "RFC 3339 time of the oldest event"},
+				{Name: "to", Description: "RFC 3339 time of the newest event"},
+				{Name: "actor", Description: "Only list the events of this caller"},
+				{Name: "action", Description: "Only list the events of this action, e.g. secret.put"},
+				{Name: "limit", Description: "Maximum number of events, at most 1000", Type: "integer"},
+				{Name: "format", Description: "jsonl to export the events as JSON Lines"},
+			},
+			Status:   http.StatusOK,
+			Response: []models.AuditEvent{},
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/v0/tokens",
+			Tag:      "tokens",
+			Summary:  "Create an API token for the caller; the token is only shown in this response",
+			Security: openapi.SecurityUser,
+			Request:  createTokenRequest{},
+			Status:   http.StatusCreated,
+			Response: createTokenResponse{},
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v0/tokens",
+			Tag:      "tokens",
+			Summary:  "List the API tokens of the caller",
+			Security: openapi.SecurityUser,
+			Status:   http.StatusOK,
+			Response: []models.ApiToken{},
+		},
+		{
+			Method:   http.MethodDelete,
+			Path:     "/v0/tokens/:id",
+			Tag:      "tokens",
+			Summary:  "Revoke an API token of the caller",
+			Security: openapi.SecurityUser,
+			Status:   http.StatusNoContent,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v0/repos/compare",
+			Tag:      "repositories",
+			Summary:  "Compare two refs of a repository",
+			Security: openapi.SecurityUser,
+			Parameters: []openapi.Parameter{
+				{Name: "repo", Description: "URL of the repository", Required: true},
+				{Name: "base", Description: "Base branch, tag or commit", Required: true},
+				{Name: "head", Description: "Head branch, tag or commit", Required: true},
+			},
+			Status:   http.StatusOK,
+			Response: githubclient.RefComparison{},
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/v0/webhooks/github",
+			Tag:     "webhooks",
+			Summary: "Receive a GitHub webhook delivery and start the pipelines listening to it",
+			Parameters: []openapi.Parameter{
+				{Name: "X-GitHub-Event", In: "header", Description: "Type of the event, e.g. push", Required: true},
+				{Name: "X-Hub-Signature-256", In: "header", Description: "HMAC of the payload with the webhook secret"},
+			},
+			RequestType:  "application/json",
+			Status:       http.StatusAccepted,
+			Response:     webhookResponse{},
+			Alternatives: map[int]string{http.StatusOK: "Answer to ping events"},
+		},
+	}
+	operations = append(operations, secretOperations("/v0/pipelines/:id")...)
+	operations = append(operations, secretOperations("/v0/repos/:owner/:repo")...)
+	operations = append(operations, secretOperations("/v0/orgs/:org")...)
+	operations = append(operations, roleOperations("/v0/pipelines/:id")...)
+	operations = append(operations, roleOperations("/v0/repos/:owner/:repo")...)
+	return operations
+}
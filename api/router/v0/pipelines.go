@@ -0,0 +1,248 @@
+package v0
+
+import (
+	goerrors "errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"api/auth"
+	"api/clients/githubclient"
+	"api/errors"
+	"api/models"
+	"api/pipeline"
+	"api/queue"
+	"api/rbac"
+	"api/runner"
+	"api/runs"
+	"api/store"
+	"api/triggers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type createPipelineRequest struct {
+	Url  string `json:"url"`
+	Name string `json:"name"`
+	// Inline YAML definition; fetched from the repository when empty
+	Definition string `json:"definition"`
+	Path       string `json:"path"`
+	Ref        string `json:"ref"`
+}
+
+func createPipeline(pipelines *store.Pipelines, github *githubclient.GithubService, access *rbac.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		request := createPipelineRequest{}
+		err := c.ShouldBindJSON(&request)
+		if err != nil {
+			return errors.NewInputError(c, "Invalid pipeline request: %w", err)
+		}
+		if request.Url == "" {
+			return errors.NewInputError(c, "The pipeline url is required")
+		}
+		err = authorizeRepository(c, access, request.Url, models.RoleMaintainer)
+		if err != nil {
+			return err
+		}
+		if request.Definition == "" {
+			request.Definition, err = fetchDefinition(c, github, request)
+			if err != nil {
+				return err
+			}
+		}
+		definition, err := pipeline.Parse([]byte(request.Definition))
+		if err != nil {
+			return errors.NewInputError(c, "Invalid pipeline definition: %w", err)
+		}
+		name := request.Name
+		if name == "" {
+			name = definition.Name
+		}
+
+		newPipeline := models.Pipeline{
+			Id:         uuid.NewString(),
+			Url:        request.Url,
+			Name:       name,
+			Definition: *definition,
+			CreatedAt:  time.Now().UTC(),
+		}
+		err = pipelines.Create(c, newPipeline)
+		if err != nil {
+			return fmt.Errorf("Failed to store pipeline: %w", err)
+		}
+		auditChange(c, models.AuditEvent{Action: models.AuditPipelineCreate, ResourceId: newPipeline.Id}, nil, newPipeline)
+		c.JSON(http.StatusCreated, newPipeline)
+		return nil
+	}
+}
+
+// Read the definition committed in the repository, on the default branch unless a ref is given
+func fetchDefinition(c *gin.Context, github *githubclient.GithubService, request createPipelineRequest) (string, error) {
+	if github == nil {
+		return "", errors.NewInputError(c, "GitHub integration is not configured, the definition must be sent inline")
+	}
+	path := request.Path
+	if path == "" {
+		path = pipeline.DefaultDefinitionPath
+	}
+	ref := request.Ref
+	if ref == "" {
+		defaultBranch, err := github.GetDefaultBranchName(c, request.Url)
+		if err != nil {
+			return "", githubError(c, err, "Failed to get the default branch of %s", request.Url)
+		}
+		ref = defaultBranch
+	}
+	contents, err := github.GetFileLatest(c, request.Url, ref, path)
+	if err != nil {
+		return "", githubError(c, err, "Failed to read %s at %s", path, ref)
+	}
+	return contents, nil
+}
+
+// Pipelines the caller is allowed to view
+func listPipelines(pipelines *store.Pipelines, access *rbac.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		pipelineList, err := pipelines.List(c)
+		if err != nil {
+			return fmt.Errorf("Failed to list pipelines: %w", err)
+		}
+		identity := auth.Caller(c)
+		if access != nil && identity != nil {
+			visible := []models.Pipeline{}
+			for _, p := range pipelineList {
+				role, err := access.Role(c, identity, models.RoleBindingScopePipeline, p.Id)
+				if err != nil {
+					return fmt.Errorf("Failed to authorize the caller on pipeline %s: %w", p.Id, err)
+				}
+				if role.Includes(models.RoleViewer) {
+					visible = append(visible, p)
+				}
+			}
+			pipelineList = visible
+		}
+		c.JSON(http.StatusOK, pipelineList)
+		return nil
+	}
+}
+
+func getPipeline(pipelines *store.Pipelines) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		id := c.Param("id")
+		found, err := pipelines.Get(c, id)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Pipeline %s not found", id)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to get pipeline %s: %w", id, err)
+		}
+		c.JSON(http.StatusOK, found)
+		return nil
+	}
+}
+
+func listPipelineRuns(pipelines *store.Pipelines, runs *store.Runs) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		id := c.Param("id")
+		_, err := pipelines.Get(c, id)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Pipeline %s not found", id)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to get pipeline %s: %w", id, err)
+		}
+		runList, err := runs.ListByPipeline(c, id)
+		if err != nil {
+			return fmt.Errorf("Failed to list runs of pipeline %s: %w", id, err)
+		}
+		c.JSON(http.StatusOK, runList)
+		return nil
+	}
+}
+
+func getRun(runs *store.Runs) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		id := c.Param("runId")
+		run, err := runs.Get(c, id)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Run %s not found", id)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to get run %s: %w", id, err)
+		}
+		c.JSON(http.StatusOK, run)
+		return nil
+	}
+}
+
+type cancelRunRequest struct {
+	Reason string `json:"reason"`
+}
+
+func cancelRun(service *runner.Service, runStore *store.Runs) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		id := c.Param("runId")
+		request := cancelRunRequest{}
+		if c.Request.ContentLength != 0 {
+			err := c.ShouldBindJSON(&request)
+			if err != nil {
+				return errors.NewInputError(c, "Invalid cancellation request: %w", err)
+			}
+		}
+		if request.Reason == "" {
+			request.Reason = "cancelled on request"
+		}
+		before, err := runStore.Get(c, id)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Run %s not found", id)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to get run %s: %w", id, err)
+		}
+		run, err := service.Cancel(c, id, request.Reason)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Run %s not found", id)
+		}
+		if goerrors.Is(err, runs.ErrInvalidTransition) {
+			return errors.NewConflictError(c, "Run %s already finished", id)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to cancel run %s: %w", id, err)
+		}
+		auditChange(c, models.AuditEvent{Action: models.AuditRunCancel, ResourceId: id}, before, run)
+		c.JSON(http.StatusOK, run)
+		return nil
+	}
+}
+
+type rerunRequest struct {
+	// Only run the failed and cancelled jobs again, and the jobs needing them
+	FailedOnly bool `json:"failedOnly"`
+}
+
+func rerunRun(pipelines *store.Pipelines, runStore *store.Runs, jobs queue.Queue) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		id := c.Param("runId")
+		request := rerunRequest{}
+		if c.Request.ContentLength != 0 {
+			err := c.ShouldBindJSON(&request)
+			if err != nil {
+				return errors.NewInputError(c, "Invalid re-run request: %w", err)
+			}
+		}
+		run, err := triggers.Rerun(c, pipelines, runStore, jobs, id, request.FailedOnly)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Run %s not found", id)
+		}
+		if goerrors.Is(err, triggers.ErrNotRerunnable) {
+			return errors.NewConflictError(c, "%w", err)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to re-run run %s: %w", id, err)
+		}
+		auditChange(c, models.AuditEvent{Action: models.AuditRunRerun, ResourceId: run.Id}, nil, run)
+		c.JSON(http.StatusCreated, run)
+		return nil
+	}
+}
@@ -0,0 +1,255 @@
+package v0
+
+import (
+	goerrors "errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"api/auth"
+	"api/errors"
+	"api/models"
+	"api/rbac"
+	"api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errRbacDisabled = goerrors.New("Role bindings are disabled: the API is not authenticated")
+
+// Repository or pipeline a request acts on; routes without a scope id authorize in their handler
+type resourceResolver func(c *gin.Context) (models.RoleBindingScope, string, error)
+
+// Roles required by the routes needing more than the default of their method
+var requiredRoles = map[string]models.Role{
+	"DELETE /v0/pipelines/:id/caches":                models.RoleMaintainer,
+	"GET /v0/pipelines/:id/secrets":                  models.RoleMaintainer,
+	"PUT /v0/pipelines/:id/secrets/:name":            models.RoleMaintainer,
+	"DELETE /v0/pipelines/:id/secrets/:name":         models.RoleMaintainer,
+	"GET /v0/pipelines/:id/roles":                    models.RoleMaintainer,
+	"POST /v0/pipelines/:id/roles":                   models.RoleAdmin,
+	"DELETE /v0/pipelines/:id/roles/:bindingId":      models.RoleAdmin,
+	"GET /v0/pipelines/:id/roles/changes":            models.RoleAdmin,
+	"GET /v0/repos/:owner/:repo/secrets":             models.RoleMaintainer,
+	"PUT /v0/repos/:owner/:repo/secrets/:name":       models.RoleMaintainer,
+	"DELETE /v0/repos/:owner/:repo/secrets/:name":    models.RoleMaintainer,
+	"GET /v0/repos/:owner/:repo/roles":               models.RoleMaintainer,
+	"POST /v0/repos/:owner/:repo/roles":              models.RoleAdmin,
+	"DELETE /v0/repos/:owner/:repo/roles/:bindingId": models.RoleAdmin,
+	"GET /v0/repos/:owner/:repo/roles/changes":       models.RoleAdmin,
+}
+
+// Role required by a route: viewers read, developers trigger, cancel and re-run
+func requiredRole(c *gin.Context) models.Role {
+	role, ok := requiredRoles[c.Request.Method+" "+c.FullPath()]
+	if ok {
+		return role
+	}
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		return models.RoleViewer
+	}
+	return models.RoleDeveloper
+}
+
+// Check that the caller holds the role the route requires on the repository or pipeline it acts on
+func authorize(service *rbac.Service, resolve resourceResolver) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		identity := auth.Caller(c)
+		if service == nil || identity == nil {
+			// authentication is disabled
+			return nil
+		}
+		scope, scopeId, err := resolve(c)
+		if err != nil {
+			return err
+		}
+		if scopeId == "" {
+			return nil
+		}
+		return authorizationError(c, service.Authorize(c, identity, scope, scopeId, requiredRole(c)), scope, scopeId)
+	}
+}
+
+// Only let the configured administrators through, e.g. for organisations which have no role bindings
+func requireAdmin(service *rbac.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		identity := auth.Caller(c)
+		if service == nil || identity == nil || service.IsAdmin(identity) {
+			return nil
+		}
+		return errors.NewForbiddenError(c, "Only administrators are allowed to %s %s", c.Request.Method, c.FullPath())
+	}
+}
+
+// Translate the result of an authorization into an API error
+func authorizationError(c *gin.Context, err error, scope models.RoleBindingScope, scopeId string) error {
+	if goerrors.Is(err, rbac.ErrForbidden) {
+		return errors.NewForbiddenError(c, "%w", err)
+	}
+	if goerrors.Is(err, store.ErrNotFound) {
+		return errors.NewNotFoundError(c, "%s %s not found", scopeTitle(scope), scopeId)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to authorize the caller on %s %s: %w", scope, scopeId, err)
+	}
+	return nil
+}
+
+// Kind of a scope at the start of a message, e.g. Repository
+func scopeTitle(scope models.RoleBindingScope) string {
+	if scope == "" {
+		return ""
+	}
+	return strings.ToUpper(string(scope[:1])) + string(scope[1:])
+}
+
+func pipelineResource(c *gin.Context) (models.RoleBindingScope, string, error) {
+	return models.RoleBindingScopePipeline, c.Param("id"), nil
+}
+
+// Pipeline of the run named by the path
+func runResource(runs *store.Runs) resourceResolver {
+	return func(c *gin.Context) (models.RoleBindingScope, string, error) {
+		id := c.Param("runId")
+		run, err := runs.Get(c, id)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return "", "", errors.NewNotFoundError(c, "Run %s not found", id)
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("Failed to get run %s: %w", id, err)
+		}
+		return models.RoleBindingScopePipeline, run.PipelineId, nil
+	}
+}
+
+// Repository named by the path, or by the repo query parameter of comparisons
+func repositoryResource(c *gin.Context) (models.RoleBindingScope, string, error) {
+	if c.Param("owner") != "" {
+		return models.RoleBindingScopeRepository, c.Param("owner") + "/" + c.Param("repo"), nil
+	}
+	_, repository := models.RepositoryOf(c.Query("repo"))
+	if repository == "" {
+		return "", "", errors.NewInputError(c, "The repo query parameter must be a repository URL")
+	}
+	return models.RoleBindingScopeRepository, repository, nil
+}
+
+// Check a role on the repository of a URL; only administrators act on URLs without an owner and repo
+func authorizeRepository(c *gin.Context, service *rbac.Service, repoURL string, role models.Role) error {
+	identity := auth.Caller(c)
+	if service == nil || identity == nil || service.IsAdmin(identity) {
+		return nil
+	}
+	_, repository := models.RepositoryOf(repoURL)
+	if repository == "" {
+		return errors.NewForbiddenError(c, "Only administrators are allowed to use repository %s", repoURL)
+	}
+	err := service.Authorize(c, identity, models.RoleBindingScopeRepository, repository, role)
+	return authorizationError(c, err, models.RoleBindingScopeRepository, repository)
+}
+
+type grantRoleRequest struct {
+	Principal     string               `json:"principal"`
+	PrincipalType models.PrincipalType `json:"principalType"`
+	Role          models.Role          `json:"role"`
+}
+
+// owner/repo or pipeline id named by the path of the request
+func roleScopeId(c *gin.Context, scope models.RoleBindingScope) string {
+	if scope == models.RoleBindingScopeRepository {
+		return c.Param("owner") + "/" + c.Param("repo")
+	}
+	return c.Param("id")
+}
+
+func listRoleBindings(service *rbac.Service, scope models.RoleBindingScope) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		if service == nil {
+			return errRbacDisabled
+		}
+		scopeId := roleScopeId(c, scope)
+		bindings, err := service.Bindings(c, scope, scopeId)
+		if err != nil {
+			return fmt.Errorf("Failed to list the role bindings of %s %s: %w", scope, scopeId, err)
+		}
+		c.JSON(http.StatusOK, bindings)
+		return nil
+	}
+}
+
+// Grant a role to a user or team, replacing the role it had there
+func grantRole(service *rbac.Service, scope models.RoleBindingScope) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		if service == nil {
+			return errRbacDisabled
+		}
+		identity, err := currentCaller(c)
+		if err != nil {
+			return err
+		}
+		request := grantRoleRequest{}
+		err = c.ShouldBindJSON(&request)
+		if err != nil {
+			return errors.NewInputError(c, "Invalid role binding request: %w", err)
+		}
+		if request.PrincipalType == "" {
+			request.PrincipalType = models.PrincipalUser
+		}
+		binding, err := service.Grant(c, identity.Subject, models.RoleBinding{
+			Principal:     request.Principal,
+			PrincipalType: request.PrincipalType,
+			Role:          request.Role,
+			Scope:         scope,
+			ScopeId:       roleScopeId(c, scope),
+		})
+		if goerrors.Is(err, rbac.ErrInvalidBinding) {
+			return errors.NewInputError(c, "%w", err)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to grant role %s: %w", request.Role, err)
+		}
+		auditChange(c, models.AuditEvent{Action: models.AuditRoleGrant, ResourceId: binding.Id}, nil, binding)
+		c.JSON(http.StatusCreated, binding)
+		return nil
+	}
+}
+
+func revokeRole(service *rbac.Service, scope models.RoleBindingScope) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		if service == nil {
+			return errRbacDisabled
+		}
+		identity, err := currentCaller(c)
+		if err != nil {
+			return err
+		}
+		scopeId := roleScopeId(c, scope)
+		id := c.Param("bindingId")
+		err = service.Revoke(c, identity.Subject, scope, scopeId, id)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Role binding %s not found in %s %s", id, scope, scopeId)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to revoke role binding %s: %w", id, err)
+		}
+		auditChange(c, models.AuditEvent{Action: models.AuditRoleRevoke, ResourceId: id}, nil, nil)
+		c.Status(http.StatusNoContent)
+		return nil
+	}
+}
+
+// Audit trail of the role bindings, oldest first
+func listPermissionChanges(service *rbac.Service, scope models.RoleBindingScope) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		if service == nil {
+			return errRbacDisabled
+		}
+		scopeId := roleScopeId(c, scope)
+		changes, err := service.Changes(c, scope, scopeId)
+		if err != nil {
+			return fmt.Errorf("Failed to list the permission changes of %s %s: %w", scope, scopeId, err)
+		}
+		c.JSON(http.StatusOK, changes)
+		return nil
+	}
+}
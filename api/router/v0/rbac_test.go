@@ -0,0 +1,67 @@
+package v0
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"api/errors"
+	"api/models"
+	"api/rbac"
+	"api/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorizationError(t *testing.T) {
+	examples := []struct {
+		name    string
+		err     error
+		scope   models.RoleBindingScope
+		scopeId string
+		code    string
+		message string
+	}{
+		{
+			name:    "unknown pipeline",
+			err:     fmt.Errorf("%w: pipeline pipeline-1", store.ErrNotFound),
+			scope:   models.RoleBindingScopePipeline,
+			scopeId: "pipeline-1",
+			code:    errors.CodeNotFound,
+			message: "Pipeline pipeline-1 not found",
+		},
+		{
+			name:    "unknown repository",
+			err:     fmt.Errorf("%w: repository some-user/my-project", store.ErrNotFound),
+			scope:   models.RoleBindingScopeRepository,
+			scopeId: "some-user/my-project",
+			code:    errors.CodeNotFound,
+			message: "Repository some-user/my-project not found",
+		},
+		{
+			name:    "missing role",
+			err:     fmt.Errorf("%w: the admin role on repository some-user/my-project is required", rbac.ErrForbidden),
+			scope:   models.RoleBindingScopeRepository,
+			scopeId: "some-user/my-project",
+			code:    errors.CodeForbidden,
+			message: "forbidden: the admin role on repository some-user/my-project is required",
+		},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+			err := authorizationError(c, example.err, example.scope, example.scopeId)
+
+			coded, ok := err.(errors.CodedError)
+			if assert.True(t, ok, "%v is not an API error", err) {
+				assert.Equal(t, example.code, coded.Code())
+			}
+			assert.EqualError(t, err, example.message)
+		})
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	assert.NoError(t, authorizationError(c, nil, models.RoleBindingScopeRepository, "some-user/my-project"))
+}
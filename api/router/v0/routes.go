@@ -1,18 +1,105 @@
 package v0
 
 import (
+	"api/models"
 	errors "api/router/error_handling"
+	"api/triggers"
 
 	"github.com/gin-gonic/gin"
 )
 
 // Adds v0 routes to the router.
-func SetRoutes(route *gin.Engine) {
+func SetRoutes(route *gin.Engine, deps Dependencies) {
+	var comparer triggers.Comparer
+	if deps.Github != nil {
+		comparer = deps.Github
+	}
+	var canceller triggers.Canceller
+	if deps.Runners != nil {
+		canceller = deps.Runners
+	}
+	dispatcher := triggers.NewDispatcher(deps.Pipelines, deps.Runs, deps.Jobs, canceller)
+
+	// runners and webhooks have their own credentials
+	userAuth := errors.WithErrorHandling(authenticate(deps.Auth))
+	audited := recordAudit(deps.Audit)
+
 	v0 := route.Group("/v0")
 	{
-		ciRoutes := v0.Group("/pipelines")
+		ciRoutes := v0.Group("/pipelines", userAuth, audited, errors.WithErrorHandling(authorize(deps.Rbac, pipelineResource)))
+		{
+			ciRoutes.POST("", errors.WithErrorHandling(createPipeline(deps.Pipelines, deps.Github, deps.Rbac)))
+			ciRoutes.GET("", errors.WithErrorHandling(listPipelines(deps.Pipelines, deps.Rbac)))
+			ciRoutes.GET("/:id", errors.WithErrorHandling(getPipeline(deps.Pipelines)))
+			ciRoutes.GET("/:id/runs", errors.WithErrorHandling(listPipelineRuns(deps.Pipelines, deps.Runs)))
+			ciRoutes.GET("/:id/caches", errors.WithErrorHandling(listCaches(deps.Pipelines, deps.Cache)))
+			ciRoutes.DELETE("/:id/caches", errors.WithErrorHandling(deleteCache(deps.Cache)))
+			ciRoutes.GET("/:id/flaky-tests", errors.WithErrorHandling(listFlakyTests(deps.Pipelines, deps.TestReports)))
+			ciRoutes.GET("/:id/coverage", errors.WithErrorHandling(getPipelineCoverage(deps.Pipelines, deps.Coverage)))
+			ciRoutes.GET("/:id/secrets", errors.WithErrorHandling(listSecrets(deps.Secrets, models.SecretScopePipeline)))
+			ciRoutes.PUT("/:id/secrets/:name", errors.WithErrorHandling(putSecret(deps.Secrets, models.SecretScopePipeline)))
+			ciRoutes.DELETE("/:id/secrets/:name", errors.WithErrorHandling(deleteSecret(deps.Secrets, models.SecretScopePipeline)))
+			ciRoutes.GET("/:id/roles", errors.WithErrorHandling(listRoleBindings(deps.Rbac, models.RoleBindingScopePipeline)))
+			ciRoutes.POST("/:id/roles", errors.WithErrorHandling(grantRole(deps.Rbac, models.RoleBindingScopePipeline)))
+			ciRoutes.DELETE("/:id/roles/:bindingId", errors.WithErrorHandling(revokeRole(deps.Rbac, models.RoleBindingScopePipeline)))
+			ciRoutes.GET("/:id/roles/changes", errors.WithErrorHandling(listPermissionChanges(deps.Rbac, models.RoleBindingScopePipeline)))
+		}
+		runRoutes := v0.Group("/runs", userAuth, audited, errors.WithErrorHandling(authorize(deps.Rbac, runResource(deps.Runs))))
+		{
+			runRoutes.GET("/:runId", errors.WithErrorHandling(getRun(deps.Runs)))
+			runRoutes.POST("/:runId/cancel", errors.WithErrorHandling(cancelRun(deps.Runners, deps.Runs)))
+			runRoutes.POST("/:runId/rerun", errors.WithErrorHandling(rerunRun(deps.Pipelines, deps.Runs, deps.Jobs)))
+			runRoutes.GET("/:runId/jobs/:job/logs", errors.WithErrorHandling(getJobLogs(deps.Runs, deps.Runners.Logs())))
+			runRoutes.GET("/:runId/artifacts", errors.WithErrorHandling(listArtifacts(deps.Artifacts)))
+			runRoutes.GET("/:runId/artifacts/*name", errors.WithErrorHandling(downloadArtifact(deps.Artifacts)))
+			runRoutes.GET("/:runId/tests", errors.WithErrorHandling(listTestResults(deps.TestReports)))
+			runRoutes.GET("/:runId/coverage", errors.WithErrorHandling(getRunCoverage(deps.Coverage)))
+		}
+		runnerRoutes := v0.Group("/runners")
+		{
+			runnerRoutes.GET("", userAuth, errors.WithErrorHandling(requireAdmin(deps.Rbac)), errors.WithErrorHandling(listRunners(deps.Runners)))
+			runnerRoutes.DELETE("/:id", userAuth, audited, errors.WithErrorHandling(requireAdmin(deps.Rbac)), errors.WithErrorHandling(deleteRunner(deps.Runners)))
+			runnerRoutes.POST("/register", audited, errors.WithErrorHandling(registerRunner(deps.Runners)))
+			authenticated := runnerRoutes.Group("", errors.WithErrorHandling(runnerAuth(deps.Runners)))
+			authenticated.POST("/heartbeat", errors.WithErrorHandling(runnerHeartbeat(deps.Runners)))
+			authenticated.POST("/jobs/request", errors.WithErrorHandling(requestJob(deps.Runners)))
+			authenticated.POST("/jobs/:assignmentId/logs", errors.WithErrorHandling(appendJobLog(deps.Runners)))
+			authenticated.POST("/jobs/:assignmentId/steps", errors.WithErrorHandling(updateJobStep(deps.Runners)))
+			authenticated.POST("/jobs/:assignmentId/artifacts", errors.WithErrorHandling(uploadArtifact(deps.Runners, deps.Artifacts)))
+			authenticated.POST("/jobs/:assignmentId/test-reports", errors.WithErrorHandling(uploadTestReport(deps.Runners, deps.TestReports)))
+			authenticated.POST("/jobs/:assignmentId/coverage", errors.WithErrorHandling(uploadCoverage(deps.Runners, deps.Coverage)))
+			authenticated.POST("/jobs/:assignmentId/cache/restore", errors.WithErrorHandling(restoreCache(deps.Runners, deps.Cache)))
+			authenticated.POST("/jobs/:assignmentId/cache", errors.WithErrorHandling(saveCache(deps.Runners, deps.Cache)))
+			authenticated.POST("/jobs/:assignmentId/complete", errors.WithErrorHandling(completeJob(deps.Runners)))
+		}
+		v0.GET("/schedules", userAuth, errors.WithErrorHandling(requireAdmin(deps.Rbac)), errors.WithErrorHandling(listSchedules(deps.Scheduler)))
+		v0.GET("/audit", userAuth, errors.WithErrorHandling(requireAdmin(deps.Rbac)), errors.WithErrorHandling(listAuditEvents(deps.Audit)))
+		tokenRoutes := v0.Group("/tokens", userAuth, audited)
+		{
+			tokenRoutes.POST("", errors.WithErrorHandling(createToken(deps.Auth)))
+			tokenRoutes.GET("", errors.WithErrorHandling(listTokens(deps.Auth)))
+			tokenRoutes.DELETE("/:id", errors.WithErrorHandling(revokeToken(deps.Auth)))
+		}
+		repoRoutes := v0.Group("/repos", userAuth, audited, errors.WithErrorHandling(authorize(deps.Rbac, repositoryResource)))
+		{
+			repoRoutes.GET("/compare", errors.WithErrorHandling(compareRefs(deps.Github)))
+			repoRoutes.GET("/:owner/:repo/secrets", errors.WithErrorHandling(listSecrets(deps.Secrets, models.SecretScopeRepository)))
+			repoRoutes.PUT("/:owner/:repo/secrets/:name", errors.WithErrorHandling(putSecret(deps.Secrets, models.SecretScopeRepository)))
+			repoRoutes.DELETE("/:owner/:repo/secrets/:name", errors.WithErrorHandling(deleteSecret(deps.Secrets, models.SecretScopeRepository)))
+			repoRoutes.GET("/:owner/:repo/roles", errors.WithErrorHandling(listRoleBindings(deps.Rbac, models.RoleBindingScopeRepository)))
+			repoRoutes.POST("/:owner/:repo/roles", errors.WithErrorHandling(grantRole(deps.Rbac, models.RoleBindingScopeRepository)))
+			repoRoutes.DELETE("/:owner/:repo/roles/:bindingId", errors.WithErrorHandling(revokeRole(deps.Rbac, models.RoleBindingScopeRepository)))
+			repoRoutes.GET("/:owner/:repo/roles/changes", errors.WithErrorHandling(listPermissionChanges(deps.Rbac, models.RoleBindingScopeRepository)))
+		}
+		orgRoutes := v0.Group("/orgs", userAuth, audited, errors.WithErrorHandling(requireAdmin(deps.Rbac)))
+		{
+			orgRoutes.GET("/:org/secrets", errors.WithErrorHandling(listSecrets(deps.Secrets, models.SecretScopeOrganisation)))
+			orgRoutes.PUT("/:org/secrets/:name", errors.WithErrorHandling(putSecret(deps.Secrets, models.SecretScopeOrganisation)))
+			orgRoutes.DELETE("/:org/secrets/:name", errors.WithErrorHandling(deleteSecret(deps.Secrets, models.SecretScopeOrganisation)))
+		}
+		webhookRoutes := v0.Group("/webhooks", audited)
 		{
-			ciRoutes.GET("/:id", errors.WithErrorHandling(getPipeline()))
+			webhookRoutes.POST("/github", errors.WithErrorHandling(githubWebhook(dispatcher, comparer, deps.WebhookSecret)))
 		}
 	}
 }
@@ -0,0 +1,248 @@
+package v0
+
+import (
+	goerrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/errors"
+	"api/models"
+	"api/runner"
+	"api/runs"
+	"api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	runnerContextKey string = "runner"
+	// Upper bound of the wait query parameter of job requests
+	maxJobRequestWait time.Duration = 60 * time.Second
+	jobRequestPoll    time.Duration = time.Second
+	maxLogChunkBytes  int64         = 1 << 20
+)
+
+func bearerToken(c *gin.Context) string {
+	token, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return token
+}
+
+// Authenticate runners by their token and store them in the request context
+func runnerAuth(service *runner.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		authenticated, err := service.Authenticate(c, bearerToken(c))
+		if goerrors.Is(err, runner.ErrUnauthorized) {
+			return errors.NewUnauthorizedError(c, "%w", err)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to authenticate runner: %w", err)
+		}
+		c.Set(runnerContextKey, authenticated)
+		return nil
+	}
+}
+
+func currentRunner(c *gin.Context) *models.Runner {
+	return c.MustGet(runnerContextKey).(*models.Runner)
+}
+
+// Translate the runner protocol errors into the status codes runners act upon
+func runnerError(c *gin.Context, err error) error {
+	switch {
+	case goerrors.Is(err, runner.ErrUnauthorized):
+		return errors.NewUnauthorizedError(c, "%w", err)
+	case goerrors.Is(err, runner.ErrAssignmentLost):
+		// runners give the job up on a conflict
+		return errors.NewConflictError(c, "%w", err)
+	case goerrors.Is(err, runs.ErrInvalidTransition):
+		return errors.NewInputError(c, "%w", err)
+	}
+	return err
+}
+
+func listRunners(service *runner.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		runnerList, err := service.List(c)
+		if err != nil {
+			return fmt.Errorf("Failed to list runners: %w", err)
+		}
+		c.JSON(http.StatusOK, runnerList)
+		return nil
+	}
+}
+
+func deleteRunner(service *runner.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		id := c.Param("id")
+		err := service.Deregister(c, id)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Runner %s not found", id)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to remove runner %s: %w", id, err)
+		}
+		auditChange(c, models.AuditEvent{Action: models.AuditRunnerDelete, ResourceId: id}, nil, nil)
+		c.Status(http.StatusNoContent)
+		return nil
+	}
+}
+
+func registerRunner(service *runner.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		request := runner.RegisterRequest{}
+		err := c.ShouldBindJSON(&request)
+		if err != nil {
+			return errors.NewInputError(c, "Invalid registration request: %w", err)
+		}
+		if request.Name == "" {
+			return errors.NewInputError(c, "The runner name is required")
+		}
+		response, err := service.Register(c, bearerToken(c), request)
+		if err != nil {
+			return runnerError(c, err)
+		}
+		// the response holds the runner token, so only the request is recorded
+		auditChange(c, models.AuditEvent{Action: models.AuditRunnerRegister, Actor: "runner", ResourceId: response.RunnerId}, nil, request)
+		c.JSON(http.StatusCreated, response)
+		return nil
+	}
+}
+
+// Long-poll for a job: answer as soon as one is assigned, or with 204 once the wait is over
+func requestJob(service *runner.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		wait := maxJobRequestWait / 2
+		if value := c.Query("wait"); value != "" {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 0 {
+				return errors.NewInputError(c, "Invalid wait parameter %s", value)
+			}
+			wait = min(time.Duration(seconds)*time.Second, maxJobRequestWait)
+		}
+		// once per request rather than per poll, which only reads the queue until a job shows up
+		err := service.Heartbeat(c, currentRunner(c), runner.HeartbeatRequest{})
+		if err != nil {
+			return runnerError(c, err)
+		}
+		deadline := time.Now().Add(wait)
+		ticker := time.NewTicker(jobRequestPoll)
+		defer ticker.Stop()
+		for {
+			spec, err := service.RequestJob(c, currentRunner(c))
+			if err != nil {
+				return runnerError(c, fmt.Errorf("Failed to assign a job: %w", err))
+			}
+			if spec != nil {
+				c.JSON(http.StatusOK, spec)
+				return nil
+			}
+			if time.Now().After(deadline) {
+				c.Status(http.StatusNoContent)
+				return nil
+			}
+			select {
+			case <-c.Request.Context().Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+func runnerHeartbeat(service *runner.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		request := runner.HeartbeatRequest{}
+		err := c.ShouldBindJSON(&request)
+		if err != nil {
+			return errors.NewInputError(c, "Invalid heartbeat: %w", err)
+		}
+		err = service.Heartbeat(c, currentRunner(c), request)
+		if err != nil {
+			return runnerError(c, err)
+		}
+		c.Status(http.StatusNoContent)
+		return nil
+	}
+}
+
+func appendJobLog(service *runner.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxLogChunkBytes))
+		if err != nil {
+			return fmt.Errorf("Failed to read the log chunk: %w", err)
+		}
+		err = service.AppendLog(c, currentRunner(c), c.Param("assignmentId"), data)
+		if err != nil {
+			return runnerError(c, err)
+		}
+		c.Status(http.StatusNoContent)
+		return nil
+	}
+}
+
+func updateJobStep(service *runner.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		update := runner.StepUpdate{}
+		err := c.ShouldBindJSON(&update)
+		if err != nil {
+			return errors.NewInputError(c, "Invalid step update: %w", err)
+		}
+		err = service.UpdateStep(c, currentRunner(c), c.Param("assignmentId"), update)
+		if err != nil {
+			return runnerError(c, err)
+		}
+		c.Status(http.StatusNoContent)
+		return nil
+	}
+}
+
+func completeJob(service *runner.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		request := runner.CompleteRequest{}
+		err := c.ShouldBindJSON(&request)
+		if err != nil {
+			return errors.NewInputError(c, "Invalid job result: %w", err)
+		}
+		err = service.Complete(c, currentRunner(c), c.Param("assignmentId"), request)
+		if err != nil {
+			return runnerError(c, err)
+		}
+		c.Status(http.StatusNoContent)
+		return nil
+	}
+}
+
+func getJobLogs(runStore *store.Runs, logs *runner.FileLogs) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		runId := c.Param("runId")
+		jobName := c.Param("job")
+		run, err := runStore.Get(c, runId)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Run %s not found", runId)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to get run %s: %w", runId, err)
+		}
+		job, err := runs.FindJob(run, jobName)
+		if err != nil {
+			return errors.NewInputError(c, "%w", err)
+		}
+		logsRunId := run.Id
+		if job.ReusedFrom != "" {
+			logsRunId = job.ReusedFrom
+		}
+		reader, err := logs.Open(logsRunId, jobName)
+		if err != nil {
+			return fmt.Errorf("Failed to read the logs: %w", err)
+		}
+		defer reader.Close()
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		c.Status(http.StatusOK)
+		_, err = io.Copy(c.Writer, reader)
+		return err
+	}
+}
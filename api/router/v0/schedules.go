@@ -0,0 +1,21 @@
+package v0
+
+import (
+	"fmt"
+	"net/http"
+
+	"api/scheduler"
+
+	"github.com/gin-gonic/gin"
+)
+
+func listSchedules(sched *scheduler.Scheduler) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		entries, err := sched.Entries(c)
+		if err != nil {
+			return fmt.Errorf("Failed to list schedules: %w", err)
+		}
+		c.JSON(http.StatusOK, entries)
+		return nil
+	}
+}
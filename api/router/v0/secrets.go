@@ -0,0 +1,129 @@
+package v0
+
+import (
+	goerrors "errors"
+	"fmt"
+	"net/http"
+
+	"api/errors"
+	"api/models"
+	"api/secrets"
+	"api/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Without a master key, secrets can neither be stored nor read
+var errSecretsDisabled = goerrors.New("Secrets are disabled: no master key was configured")
+
+type putSecretRequest struct {
+	Value string `json:"value"`
+}
+
+// Organisation, owner/repo or pipeline id named by the path of the request
+func secretScopeId(c *gin.Context, scope models.SecretScope) string {
+	switch scope {
+	case models.SecretScopeOrganisation:
+		return c.Param("org")
+	case models.SecretScopeRepository:
+		return c.Param("owner") + "/" + c.Param("repo")
+	default:
+		return c.Param("id")
+	}
+}
+
+// Input error for invalid secrets and unknown pipelines; nil otherwise
+func secretInputError(c *gin.Context, scope models.SecretScope, scopeId string, err error) error {
+	if goerrors.Is(err, secrets.ErrInvalidSecret) {
+		return errors.NewInputError(c, "%w", err)
+	}
+	if scope == models.SecretScopePipeline && goerrors.Is(err, store.ErrNotFound) {
+		return errors.NewNotFoundError(c, "Pipeline %s not found", scopeId)
+	}
+	return nil
+}
+
+// Secret of an organisation, repository or pipeline; nil when it has none with the name
+func findSecret(c *gin.Context, service *secrets.Service, scope models.SecretScope, scopeId, name string) (*models.Secret, error) {
+	secretList, err := service.List(c, scope, scopeId)
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range secretList {
+		if secret.Name == name {
+			return &secret, nil
+		}
+	}
+	return nil, nil
+}
+
+// Secrets of an organisation, repository or pipeline, without their values
+func listSecrets(service *secrets.Service, scope models.SecretScope) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		if service == nil {
+			return errSecretsDisabled
+		}
+		scopeId := secretScopeId(c, scope)
+		secretList, err := service.List(c, scope, scopeId)
+		if inputErr := secretInputError(c, scope, scopeId, err); inputErr != nil {
+			return inputErr
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to list the secrets of %s %s: %w", scope, scopeId, err)
+		}
+		c.JSON(http.StatusOK, secretList)
+		return nil
+	}
+}
+
+// Create or replace a secret; the response leaves its value out
+func putSecret(service *secrets.Service, scope models.SecretScope) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		if service == nil {
+			return errSecretsDisabled
+		}
+		request := putSecretRequest{}
+		err := c.ShouldBindJSON(&request)
+		if err != nil {
+			return errors.NewInputError(c, "Invalid secret request: %w", err)
+		}
+		scopeId := secretScopeId(c, scope)
+		before, err := findSecret(c, service, scope, scopeId, c.Param("name"))
+		if inputErr := secretInputError(c, scope, scopeId, err); inputErr != nil {
+			return inputErr
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to read secret %s: %w", c.Param("name"), err)
+		}
+		secret, err := service.Put(c, scope, scopeId, c.Param("name"), request.Value)
+		if inputErr := secretInputError(c, scope, scopeId, err); inputErr != nil {
+			return inputErr
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to store secret %s: %w", c.Param("name"), err)
+		}
+		auditChange(c, models.AuditEvent{Action: models.AuditSecretPut, ResourceId: scopeId + "/" + secret.Name}, before, secret)
+		c.JSON(http.StatusOK, secret)
+		return nil
+	}
+}
+
+func deleteSecret(service *secrets.Service, scope models.SecretScope) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		if service == nil {
+			return errSecretsDisabled
+		}
+		scopeId := secretScopeId(c, scope)
+		name := c.Param("name")
+		err := service.Delete(c, scope, scopeId, name)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Secret %s not found in %s %s", name, scope, scopeId)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to delete secret %s: %w", name, err)
+		}
+		auditChange(c, models.AuditEvent{Action: models.AuditSecretDelete, ResourceId: scopeId + "/" + name}, nil, nil)
+		c.Status(http.StatusNoContent)
+		return nil
+	}
+}
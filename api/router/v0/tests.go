@@ -0,0 +1,100 @@
+package v0
+
+import (
+	goerrors "errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"api/errors"
+	"api/models"
+	"api/runner"
+	"api/store"
+	"api/testreport"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Test results of a run with their counts
+type testResultsResponse struct {
+	Summary models.TestSummary  `json:"summary"`
+	Tests   []models.TestResult `json:"tests"`
+}
+
+// Receive a test report from the runner executing a job; the body is the raw report
+func uploadTestReport(service *runner.Service, reports *testreport.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		assignment, err := service.Assignment(c, currentRunner(c), c.Param("assignmentId"))
+		if err != nil {
+			return runnerError(c, err)
+		}
+		name := c.Query("name")
+		var step *int
+		if value := c.Query("step"); value != "" {
+			index, err := strconv.Atoi(value)
+			if err != nil || index < 0 {
+				return errors.NewInputError(c, "Invalid step %s: use the index of a step", value)
+			}
+			step = &index
+		}
+		summary, err := reports.Ingest(c, assignment.RunId, assignment.Job, name, step, c.Request.Body)
+		if goerrors.Is(err, testreport.ErrInvalidReport) {
+			return errors.NewInputError(c, "%w", err)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to store test report %s: %w", name, err)
+		}
+		c.JSON(http.StatusCreated, summary)
+		return nil
+	}
+}
+
+// Test results of a run, optionally filtered with ?job= and ?status=
+func listTestResults(reports *testreport.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		runId := c.Param("runId")
+		filter := testreport.Filter{Job: c.Query("job"), Status: models.TestStatus(c.Query("status"))}
+		switch filter.Status {
+		case "", models.TestPassed, models.TestFailed, models.TestSkipped:
+		default:
+			return errors.NewInputError(c, "Invalid status %s: use passed, failed or skipped", filter.Status)
+		}
+		results, err := reports.List(c, runId, filter)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Run %s not found", runId)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to list the test results of run %s: %w", runId, err)
+		}
+		c.JSON(http.StatusOK, testResultsResponse{Summary: testreport.Summarize(results), Tests: results})
+		return nil
+	}
+}
+
+// Flaky tests of the recent runs of a pipeline, ?runs= of them
+func listFlakyTests(pipelines *store.Pipelines, reports *testreport.Service) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		id := c.Param("id")
+		window := testreport.DefaultFlakyWindow
+		if value := c.Query("runs"); value != "" {
+			var err error
+			window, err = strconv.Atoi(value)
+			if err != nil || window < 1 || window > testreport.MaxFlakyWindow {
+				return errors.NewInputError(c, "Invalid runs %s: use a number between 1 and %d", value, testreport.MaxFlakyWindow)
+			}
+		}
+		_, err := pipelines.Get(c, id)
+		if goerrors.Is(err, store.ErrNotFound) {
+			return errors.NewNotFoundError(c, "Pipeline %s not found", id)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to get pipeline %s: %w", id, err)
+		}
+		flaky, err := reports.FlakyTests(c, id, window)
+		if err != nil {
+			return fmt.Errorf("Failed to analyse the tests of pipeline %s: %w", id, err)
+		}
+		c.JSON(http.StatusOK, flaky)
+		return nil
+	}
+}
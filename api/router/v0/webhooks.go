@@ -0,0 +1,91 @@
+package v0
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"api/config"
+	"api/env"
+	"api/errors"
+	"api/logger"
+	"api/models"
+	"api/triggers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-github/v56/github"
+)
+
+// GitHub caps deliveries at 25MB; anything longer is truncated and fails to parse
+const maxWebhookPayloadBytes int64 = 25 << 20
+
+type webhookResponse struct {
+	Message string       `json:"message"`
+	Runs    []models.Run `json:"runs,omitempty"`
+}
+
+/*
+Receive GitHub webhook deliveries and start the pipelines listening to them.
+
+[IN] dispatcher: creates the runs of the matching pipelines
+
+[IN] comparer: lists the changes of pushes too large for the payload; may be nil
+
+[IN] secret: webhook secret; when empty, signatures are only skipped in the local environment and
+deliveries are rejected elsewhere
+*/
+func githubWebhook(dispatcher *triggers.Dispatcher, comparer triggers.Comparer, secret string) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		log := logger.FromContext(c)
+		payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookPayloadBytes))
+		if err != nil {
+			return fmt.Errorf("Failed to read webhook payload: %w", err)
+		}
+		if secret == "" && !env.IsLocalEnvironment() {
+			return errors.NewForbiddenError(c, "Rejected webhook delivery: %s is not set, so its signature cannot be checked", config.EnvVarGithubWebhookSecret)
+		}
+		if secret != "" {
+			err = triggers.ValidateSignature(secret, c.GetHeader(github.SHA256SignatureHeader), payload)
+			if err != nil {
+				return errors.NewInputError(c, "Rejected webhook delivery: %w", err)
+			}
+		}
+
+		eventType := github.WebHookType(c.Request)
+		switch eventType {
+		case "ping":
+			c.JSON(http.StatusOK, webhookResponse{Message: "pong"})
+			return nil
+		case "push":
+		default:
+			log.Debugf("Ignoring %s webhook event", eventType)
+			c.JSON(http.StatusAccepted, webhookResponse{Message: fmt.Sprintf("Ignored %s event", eventType)})
+			return nil
+		}
+
+		event, err := github.ParseWebHook(eventType, payload)
+		if err != nil {
+			return errors.NewInputError(c, "Invalid %s payload: %w", eventType, err)
+		}
+		push, err := triggers.PushFromGithub(c, event.(*github.PushEvent), comparer)
+		if err != nil {
+			return errors.NewInputError(c, "Invalid push payload: %w", err)
+		}
+		if push == nil {
+			c.JSON(http.StatusAccepted, webhookResponse{Message: "Ignored push without a branch head"})
+			return nil
+		}
+		runList, err := dispatcher.Push(c, *push)
+		if err != nil {
+			return fmt.Errorf("Failed to trigger pipelines: %w", err)
+		}
+		for _, run := range runList {
+			auditChange(c, models.AuditEvent{Action: models.AuditRunTrigger, Actor: "github", ResourceId: run.Id}, nil, run)
+		}
+		c.JSON(http.StatusAccepted, webhookResponse{
+			Message: fmt.Sprintf("Created %d runs", len(runList)),
+			Runs:    runList,
+		})
+		return nil
+	}
+}
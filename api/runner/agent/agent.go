@@ -0,0 +1,482 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"api/executor"
+	"api/logger"
+	"api/models"
+	"api/pipeline"
+	"api/runner"
+	"api/secrets"
+	"api/workspace"
+)
+
+const (
+	DefaultPollWait          time.Duration = 30 * time.Second
+	DefaultHeartbeatInterval time.Duration = 15 * time.Second
+	logFlushInterval         time.Duration = time.Second
+	logFlushBytes            int           = 16 << 10
+)
+
+var errJobTimedOut = errors.New("the job timed out")
+
+// Prepare the working directory of a job and return it with its cleanup
+type Checkout func(ctx context.Context, spec *runner.JobSpec) (string, func(), error)
+
+type Agent struct {
+	client            *Client
+	executor          *executor.Executor
+	checkout          Checkout
+	pollWait          time.Duration
+	heartbeatInterval time.Duration
+}
+
+/*
+Create a runner agent.
+
+[IN] client: authenticated API client
+
+[IN] exec: executes the step scripts
+
+[IN] checkout: prepares the job working directory
+
+[OUT] *Agent: the agent; call Run to start polling
+*/
+func New(client *Client, exec *executor.Executor, checkout Checkout) *Agent {
+	return &Agent{
+		client:            client,
+		executor:          exec,
+		checkout:          checkout,
+		pollWait:          DefaultPollWait,
+		heartbeatInterval: DefaultHeartbeatInterval,
+	}
+}
+
+// Execute jobs one at a time until the context is cancelled
+func (a *Agent) Run(ctx context.Context) error {
+	log := logger.FromContext(ctx)
+	for ctx.Err() == nil {
+		spec, err := a.client.RequestJob(ctx, a.pollWait)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Warnf("Unable to request a job: %v", err)
+			sleep(ctx, 5*time.Second)
+			continue
+		}
+		if spec == nil {
+			continue
+		}
+		a.Execute(ctx, spec)
+	}
+	return ctx.Err()
+}
+
+// Run the steps of an assigned job and report their outcome
+func (a *Agent) Execute(ctx context.Context, spec *runner.JobSpec) {
+	log := logger.FromContext(ctx)
+	log.Infof("Running job %s of run %s", spec.Job, spec.RunId)
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if spec.TimeoutMinutes > 0 {
+		var stop context.CancelFunc
+		jobCtx, stop = context.WithTimeoutCause(jobCtx, time.Duration(spec.TimeoutMinutes)*time.Minute, errJobTimedOut)
+		defer stop()
+	}
+	go a.heartbeat(jobCtx, cancel, spec.AssignmentId)
+
+	status, reason := a.runSteps(jobCtx, spec)
+	switch cause := context.Cause(jobCtx); {
+	case errors.Is(cause, ErrAssignmentLost):
+		log.Warnf("Job %s of run %s was cancelled or reassigned, dropping it", spec.Job, spec.RunId)
+		return
+	case errors.Is(cause, errJobTimedOut):
+		status, reason = models.StatusFailed, fmt.Sprintf("timed out after %d minutes", spec.TimeoutMinutes)
+	}
+	err := a.client.Complete(ctx, spec.AssignmentId, runner.CompleteRequest{Status: status, Error: reason})
+	if err != nil {
+		log.Errorf("Unable to report the outcome of job %s: %v", spec.Job, err)
+		return
+	}
+	log.Infof("Job %s of run %s %s", spec.Job, spec.RunId, status)
+}
+
+func (a *Agent) runSteps(ctx context.Context, spec *runner.JobSpec) (models.Status, string) {
+	output := newLogStream(ctx, a.client, spec.AssignmentId, secrets.NewMasker(spec.Secrets))
+	defer output.Close()
+
+	dir, cleanup, err := a.checkout(ctx, spec)
+	if err != nil {
+		fmt.Fprintf(output, "Checkout failed: %v\n", err)
+		return models.StatusFailed, fmt.Sprintf("checkout failed: %v", err)
+	}
+	defer cleanup()
+
+	caches := a.restoreCaches(ctx, spec, dir, output)
+	status, reason, writers := a.executeSteps(ctx, spec, dir, output)
+	// like a failed job, a cancelled one may have left the cached paths half-written
+	if status == models.StatusSucceeded && ctx.Err() == nil {
+		a.saveCaches(ctx, spec, dir, output, caches)
+	}
+	// test reports matter most when the steps failed, so they and artifacts are always collected
+	if len(spec.TestReports) > 0 && ctx.Err() == nil {
+		a.uploadTestReports(ctx, spec, dir, output, writers)
+	}
+	// coverage of steps that stopped early would drag the trend down
+	if len(spec.CoverageReports) > 0 && status == models.StatusSucceeded && ctx.Err() == nil {
+		a.uploadCoverage(ctx, spec, dir, output)
+	}
+	if spec.Artifacts != nil && ctx.Err() == nil {
+		err = a.uploadArtifacts(ctx, spec, dir, output)
+		if err != nil && status == models.StatusSucceeded {
+			status, reason = models.StatusFailed, err.Error()
+		}
+	}
+	return status, reason
+}
+
+// Run the steps until one fails, returning the index of the step that last wrote each test report
+func (a *Agent) executeSteps(ctx context.Context, spec *runner.JobSpec, dir string, output io.Writer) (models.Status, string, map[string]int) {
+	env := []string{
+		"CI=true",
+		"AETERNUM_RUN_ID=" + spec.RunId,
+		"AETERNUM_JOB=" + spec.Job,
+		"AETERNUM_BRANCH=" + spec.Branch,
+		"AETERNUM_COMMIT_SHA=" + spec.CommitSha,
+	}
+	names := make([]string, 0, len(spec.Secrets))
+	for name := range spec.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+spec.Secrets[name])
+	}
+	writers := map[string]int{}
+	reports := reportFiles(spec, dir)
+	for i, step := range spec.Steps {
+		a.reportStep(ctx, spec.AssignmentId, runner.StepUpdate{Index: i, Status: models.StatusRunning})
+		fmt.Fprintf(output, "==> %s\n", stepName(step.Name, i))
+		exitCode, err := a.executor.Run(ctx, step.Run, dir, env, output)
+		if err != nil {
+			a.reportStep(ctx, spec.AssignmentId, runner.StepUpdate{Index: i, Status: models.StatusFailed})
+			return models.StatusFailed, err.Error(), writers
+		}
+		reports = updateWriters(writers, reports, reportFiles(spec, dir), i)
+		status := models.StatusSucceeded
+		if exitCode != 0 {
+			status = models.StatusFailed
+		}
+		a.reportStep(ctx, spec.AssignmentId, runner.StepUpdate{Index: i, Status: status, ExitCode: &exitCode})
+		if exitCode != 0 {
+			return models.StatusFailed, fmt.Sprintf("%s exited with code %d", stepName(step.Name, i), exitCode), writers
+		}
+	}
+	return models.StatusSucceeded, "", writers
+}
+
+// A file as last seen, to tell whether a step wrote it
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Files of the working directory matching the test reports of the job; nil when it has none
+func reportFiles(spec *runner.JobSpec, dir string) map[string]fileState {
+	if len(spec.TestReports) == 0 {
+		return nil
+	}
+	names, err := matchingFiles(dir, func(name string) bool {
+		return pipeline.MatchesFiles(spec.TestReports, name)
+	})
+	if err != nil {
+		return nil
+	}
+	files := map[string]fileState{}
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if err == nil {
+			files[name] = fileState{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return files
+}
+
+// Record the step as the writer of the files created or changed since the previous snapshot, returning the new one
+func updateWriters(writers map[string]int, before, after map[string]fileState, step int) map[string]fileState {
+	for name, state := range after {
+		previous, found := before[name]
+		if !found || previous != state {
+			writers[name] = step
+		}
+	}
+	return after
+}
+
+// Upload the files of the working directory matching the artifact paths of the job
+func (a *Agent) uploadArtifacts(ctx context.Context, spec *runner.JobSpec, dir string, output io.Writer) error {
+	names, err := matchingFiles(dir, spec.Artifacts.Matches)
+	if err != nil {
+		return fmt.Errorf("unable to collect the artifacts: %w", err)
+	}
+	if len(names) == 0 {
+		fmt.Fprintf(output, "==> No file matches the artifact paths %s\n", strings.Join(spec.Artifacts.Paths, ", "))
+		return nil
+	}
+	fmt.Fprintf(output, "==> Uploading %d artifacts\n", len(names))
+	for _, name := range names {
+		err = a.client.UploadArtifact(ctx, spec.AssignmentId, name, filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			fmt.Fprintf(output, "Unable to upload %s: %v\n", name, err)
+			return fmt.Errorf("unable to upload artifact %s: %w", name, err)
+		}
+		fmt.Fprintf(output, "%s\n", name)
+	}
+	return nil
+}
+
+// Upload the test reports of the job; like the results they hold, failures never fail the job
+func (a *Agent) uploadTestReports(ctx context.Context, spec *runner.JobSpec, dir string, output io.Writer, writers map[string]int) {
+	names, err := matchingFiles(dir, func(name string) bool {
+		return pipeline.MatchesFiles(spec.TestReports, name)
+	})
+	if err != nil {
+		fmt.Fprintf(output, "Unable to collect the test reports: %v\n", err)
+		return
+	}
+	if len(names) == 0 {
+		fmt.Fprintf(output, "==> No file matches the test reports %s\n", strings.Join(spec.TestReports, ", "))
+		return
+	}
+	fmt.Fprintf(output, "==> Uploading %d test reports\n", len(names))
+	for _, name := range names {
+		step, found := writers[name]
+		if !found {
+			step = -1
+		}
+		summary, err := a.client.UploadTestReport(ctx, spec.AssignmentId, name, filepath.Join(dir, filepath.FromSlash(name)), step)
+		if err != nil {
+			fmt.Fprintf(output, "Unable to upload %s: %v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(output, "%s: %d passed, %d failed, %d skipped\n", name, summary.Passed, summary.Failed, summary.Skipped)
+	}
+}
+
+// Upload the coverage reports of the job; failures never fail the job
+func (a *Agent) uploadCoverage(ctx context.Context, spec *runner.JobSpec, dir string, output io.Writer) {
+	names, err := matchingFiles(dir, func(name string) bool {
+		return pipeline.MatchesFiles(spec.CoverageReports, name)
+	})
+	if err != nil {
+		fmt.Fprintf(output, "Unable to collect the coverage reports: %v\n", err)
+		return
+	}
+	if len(names) == 0 {
+		fmt.Fprintf(output, "==> No file matches the coverage reports %s\n", strings.Join(spec.CoverageReports, ", "))
+		return
+	}
+	fmt.Fprintf(output, "==> Uploading %d coverage reports\n", len(names))
+	for _, name := range names {
+		total, err := a.client.UploadCoverage(ctx, spec.AssignmentId, name, filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			fmt.Fprintf(output, "Unable to upload %s: %v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(output, "%s: %.2f%% of %d statements covered\n", name, total.Percent, total.Total)
+	}
+}
+
+// Regular files of the working directory, outside .git, whose slash-separated path matches
+func matchingFiles(dir string, matches func(name string) bool) ([]string, error) {
+	names := []string{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return fs.SkipDir
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		if matches(name) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names, err
+}
+
+func (a *Agent) reportStep(ctx context.Context, assignmentId string, update runner.StepUpdate) {
+	// the failure of the step that was stopped is still worth reporting
+	err := a.client.UpdateStep(context.WithoutCancel(ctx), assignmentId, update)
+	if err != nil {
+		logger.FromContext(ctx).Warnf("Unable to report step %d: %v", update.Index, err)
+	}
+}
+
+// Keep the job lease alive; stop the job when the API cancelled or reassigned it
+func (a *Agent) heartbeat(ctx context.Context, cancel context.CancelCauseFunc, assignmentId string) {
+	ticker := time.NewTicker(a.heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := a.client.Heartbeat(ctx, assignmentId)
+		if errors.Is(err, ErrAssignmentLost) {
+			cancel(err)
+			return
+		}
+		if err != nil {
+			logger.FromContext(ctx).Warnf("Heartbeat failed: %v", err)
+		}
+	}
+}
+
+func stepName(name string, index int) string {
+	if name == "" {
+		return fmt.Sprintf("step %d", index+1)
+	}
+	return name
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+// Checkout into an empty temporary directory, for jobs that fetch their own sources
+func TempDirCheckout(root string) Checkout {
+	return func(ctx context.Context, spec *runner.JobSpec) (string, func(), error) {
+		dir, err := os.MkdirTemp(root, "job-")
+		if err != nil {
+			return "", nil, err
+		}
+		return dir, func() { os.RemoveAll(dir) }, nil
+	}
+}
+
+// Buffers the job output and ships it to the API periodically, with its secrets masked
+type logStream struct {
+	ctx          context.Context
+	client       *Client
+	assignmentId string
+	masker       *secrets.Masker
+
+	mu     sync.Mutex
+	buffer []byte
+	// keeps uploads in order when a full buffer is flushed by a writer
+	sending sync.Mutex
+	done    chan struct{}
+	closed  sync.WaitGroup
+}
+
+func newLogStream(ctx context.Context, client *Client, assignmentId string, masker *secrets.Masker) *logStream {
+	stream := &logStream{ctx: ctx, client: client, assignmentId: assignmentId, masker: masker, done: make(chan struct{})}
+	stream.closed.Add(1)
+	go stream.loop()
+	return stream
+}
+
+func (s *logStream) Write(data []byte) (int, error) {
+	s.mu.Lock()
+	s.buffer = append(s.buffer, data...)
+	full := len(s.buffer) >= logFlushBytes
+	s.mu.Unlock()
+	if full {
+		s.flush(false)
+	}
+	return len(data), nil
+}
+
+func (s *logStream) loop() {
+	defer s.closed.Done()
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			s.flush(true)
+			return
+		case <-ticker.C:
+			s.flush(false)
+		}
+	}
+}
+
+// Upload the buffered output; until the last flush, what may be the beginning of a secret waits for the rest of it
+func (s *logStream) flush(last bool) {
+	s.sending.Lock()
+	defer s.sending.Unlock()
+	s.mu.Lock()
+	data := s.masker.Mask(s.buffer)
+	s.buffer = nil
+	if !last {
+		pending := s.masker.Partial(data)
+		s.buffer = append(s.buffer, data[len(data)-pending:]...)
+		data = data[:len(data)-pending]
+	}
+	s.mu.Unlock()
+	if len(data) == 0 {
+		return
+	}
+	// logs are best effort: the job result matters more than its output
+	err := s.client.AppendLog(context.WithoutCancel(s.ctx), s.assignmentId, data)
+	if err != nil {
+		logger.FromContext(s.ctx).Warnf("Unable to upload %d bytes of logs: %v", len(data), err)
+	}
+}
+
+func (s *logStream) Close() error {
+	close(s.done)
+	s.closed.Wait()
+	return nil
+}
+
+// Checkout the commit of the job from GitHub through the workspace manager
+func WorkspaceCheckout(manager *workspace.Manager) Checkout {
+	return func(ctx context.Context, spec *runner.JobSpec) (string, func(), error) {
+		ref := spec.CommitSha
+		if ref == "" {
+			// scheduled runs build the tip of the default branch
+			ref = "HEAD"
+			if spec.Branch != "" {
+				ref = spec.Branch
+			}
+		}
+		checkout, err := manager.Checkout(ctx, spec.AssignmentId, spec.RepoURL, ref)
+		if err != nil {
+			return "", nil, err
+		}
+		cleanup := func() {
+			err := checkout.Cleanup()
+			if err != nil {
+				logger.FromContext(ctx).Warnf("Unable to clean the workspace of job %s: %v", spec.Job, err)
+			}
+		}
+		return checkout.Dir, cleanup, nil
+	}
+}
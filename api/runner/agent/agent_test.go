@@ -0,0 +1,357 @@
+//go:build unix
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"api/artifacts"
+	"api/cache"
+	"api/coverage"
+	"api/executor"
+	"api/models"
+	"api/pipeline"
+	"api/queue"
+	v0 "api/router/v0"
+	"api/runner"
+	"api/secrets"
+	"api/store"
+	"api/testreport"
+	"api/triggers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRegistrationToken string = "registration-secret"
+
+const testDefinition string = `
+name: api
+jobs:
+  greet:
+    steps:
+      - name: hello
+        run: echo "hello from $AETERNUM_JOB"
+  check:
+    needs: [greet]
+    steps:
+      - run: test "$CI" = true
+      - run: exit 4
+      - run: echo unreachable
+`
+
+func newTestAPI(t *testing.T) (*httptest.Server, *store.Runs, models.Run, *runner.Service) {
+	gin.SetMode(gin.TestMode)
+	dataStore := store.NewMemoryStore()
+	pipelines := store.NewPipelines(dataStore)
+	runs := store.NewRuns(dataStore)
+	jobs := queue.NewStoreQueue(dataStore, triggers.JobQueueName)
+	service := runner.NewService(dataStore, jobs, runner.NewFileLogs(t.TempDir()), testRegistrationToken)
+	artifactStore, err := artifacts.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	secretService, err := secrets.NewService(dataStore, bytes.Repeat([]byte{7}, secrets.KeyBytes))
+	require.NoError(t, err)
+	service.InjectSecrets(secretService)
+
+	definition, err := pipeline.Parse([]byte(testDefinition))
+	require.NoError(t, err)
+	p := models.Pipeline{Id: "pipeline-1", Url: "https://github.com/some-user/my-project", Name: "api", Definition: *definition}
+	require.NoError(t, pipelines.Create(context.Background(), p))
+	run := triggers.NewRun(p, triggers.TriggerManual, time.Now())
+	require.NoError(t, triggers.Start(context.Background(), runs, jobs, run))
+
+	router := gin.New()
+	v0.SetRoutes(router, v0.Dependencies{
+		Pipelines:   pipelines,
+		Runs:        runs,
+		Jobs:        jobs,
+		Runners:     service,
+		Artifacts:   artifacts.NewService(dataStore, artifactStore, 0),
+		Cache:       cache.NewService(dataStore, artifactStore, 0, 0),
+		TestReports: testreport.NewService(dataStore),
+		Coverage:    coverage.NewService(dataStore),
+		Secrets:     secretService,
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, runs, run, service
+}
+
+func TestAgentExecutesJobs(t *testing.T) {
+	ctx := context.Background()
+	server, runs, run, service := newTestAPI(t)
+	client := NewClient(server.URL, "")
+	_, err := client.Register(ctx, testRegistrationToken, runner.RegisterRequest{Name: "runner-1", Labels: []string{"linux"}})
+	require.NoError(t, err)
+	agent := New(client, executor.New(), TempDirCheckout(t.TempDir()))
+
+	for _, job := range []string{"greet", "check"} {
+		spec, err := client.RequestJob(ctx, 0)
+		require.NoError(t, err)
+		require.NotNil(t, spec)
+		assert.Equal(t, job, spec.Job)
+		agent.Execute(ctx, spec)
+	}
+	spec, err := client.RequestJob(ctx, 0)
+	require.NoError(t, err)
+	assert.Nil(t, spec)
+
+	stored, err := runs.Get(ctx, run.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusFailed, stored.Status)
+	assert.Equal(t, models.StatusSucceeded, stored.Jobs[0].Status)
+	check := stored.Jobs[1]
+	assert.Equal(t, models.StatusFailed, check.Status)
+	assert.Equal(t, "step 2 exited with code 4", check.Error)
+	assert.Equal(t, models.StatusSucceeded, check.Steps[0].Status)
+	assert.Equal(t, models.StatusFailed, check.Steps[1].Status)
+	assert.Equal(t, 4, *check.Steps[1].ExitCode)
+	assert.Equal(t, models.StatusQueued, check.Steps[2].Status)
+
+	logs, err := service.Logs().Open(run.Id, "greet")
+	require.NoError(t, err)
+	defer logs.Close()
+	content, err := io.ReadAll(logs)
+	require.NoError(t, err)
+	assert.Equal(t, "==> hello\nhello from greet\n", string(content))
+}
+
+func TestClientRejectsInvalidTokens(t *testing.T) {
+	server, _, _, _ := newTestAPI(t)
+	_, err := NewClient(server.URL, "").Register(context.Background(), "guess", runner.RegisterRequest{Name: "runner-1"})
+	assert.ErrorContains(t, err, "status 401")
+	_, err = NewClient(server.URL, "unknown").RequestJob(context.Background(), 0)
+	assert.ErrorContains(t, err, "status 401")
+}
+
+func TestClientReportsLostAssignments(t *testing.T) {
+	ctx := context.Background()
+	server, _, _, _ := newTestAPI(t)
+	client := NewClient(server.URL, "")
+	_, err := client.Register(ctx, testRegistrationToken, runner.RegisterRequest{Name: "runner-1"})
+	require.NoError(t, err)
+	assert.ErrorIs(t, client.Heartbeat(ctx, "unknown-assignment"), ErrAssignmentLost)
+}
+
+func TestAgentStopsCancelledJobs(t *testing.T) {
+	ctx := context.Background()
+	server, runs, run, service := newTestAPI(t)
+	client := NewClient(server.URL, "")
+	_, err := client.Register(ctx, testRegistrationToken, runner.RegisterRequest{Name: "runner-1"})
+	require.NoError(t, err)
+	agent := New(client, executor.New(), TempDirCheckout(t.TempDir()))
+	agent.heartbeatInterval = 50 * time.Millisecond
+
+	spec, err := client.RequestJob(ctx, 0)
+	require.NoError(t, err)
+	require.NotNil(t, spec)
+	spec.Steps = []pipeline.Step{{Run: "sleep 30"}}
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		_, err := service.Cancel(ctx, run.Id, "cancelled on request")
+		assert.NoError(t, err)
+	}()
+
+	started := time.Now()
+	agent.Execute(ctx, spec)
+	assert.Less(t, time.Since(started), 5*time.Second, "the step was stopped")
+	stored, err := runs.Get(ctx, run.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCancelled, stored.Status)
+	assert.Equal(t, "cancelled on request", stored.Jobs[0].Error)
+}
+
+func TestAgentUploadsArtifacts(t *testing.T) {
+	ctx := context.Background()
+	server, _, run, _ := newTestAPI(t)
+	client := NewClient(server.URL, "")
+	_, err := client.Register(ctx, testRegistrationToken, runner.RegisterRequest{Name: "runner-1"})
+	require.NoError(t, err)
+	agent := New(client, executor.New(), TempDirCheckout(t.TempDir()))
+
+	spec, err := client.RequestJob(ctx, 0)
+	require.NoError(t, err)
+	require.NotNil(t, spec)
+	spec.Steps = []pipeline.Step{{Run: "mkdir -p bin/debug && echo app > bin/app && echo symbols > bin/debug/app.sym && touch notes.txt && exit 1"}}
+	spec.Artifacts = &pipeline.Artifacts{Paths: []string{"bin/**", "!bin/debug/*.sym", "*.txt"}}
+	agent.Execute(ctx, spec)
+
+	response, err := http.Get(server.URL + "/v0/runs/" + run.Id + "/artifacts")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	artifactList := []models.Artifact{}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&artifactList))
+	require.Len(t, artifactList, 2, "artifacts are uploaded even when the job fails")
+	assert.Equal(t, "bin/app", artifactList[0].Name)
+	assert.Equal(t, "notes.txt", artifactList[1].Name)
+	assert.Equal(t, int64(0), artifactList[1].Size)
+
+	download, err := http.Get(server.URL + "/v0/runs/" + run.Id + "/artifacts/bin/app")
+	require.NoError(t, err)
+	defer download.Body.Close()
+	content, err := io.ReadAll(download.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, download.StatusCode)
+	assert.Equal(t, "app\n", string(content))
+	assert.Equal(t, artifactList[0].Sha256, download.Header.Get(artifacts.ChecksumHeader))
+	assert.Equal(t, `attachment; filename="app"`, download.Header.Get("Content-Disposition"))
+
+	missing, err := http.Get(server.URL + "/v0/runs/" + run.Id + "/artifacts/bin/debug/app.sym")
+	require.NoError(t, err)
+	missing.Body.Close()
+	assert.Equal(t, http.StatusNotFound, missing.StatusCode)
+}
+
+func TestAgentUploadsTestReports(t *testing.T) {
+	ctx := context.Background()
+	server, _, run, service := newTestAPI(t)
+	completed := []string{}
+	service.OnJobCompleted(func(ctx context.Context, run *models.Run, job string) error {
+		completed = append(completed, job)
+		return nil
+	})
+	client := NewClient(server.URL, "")
+	_, err := client.Register(ctx, testRegistrationToken, runner.RegisterRequest{Name: "runner-1"})
+	require.NoError(t, err)
+	agent := New(client, executor.New(), TempDirCheckout(t.TempDir()))
+
+	spec, err := client.RequestJob(ctx, 0)
+	require.NoError(t, err)
+	require.NotNil(t, spec)
+	spec.Steps = []pipeline.Step{{Run: "true"}, {Run: `mkdir -p reports && printf '%s\n' '{"Action":"pass","Package":"api","Test":"TestA"}' '{"Action":"fail","Package":"api","Test":"TestB"}' > reports/unit.json && echo nonsense > reports/broken.json && exit 1`}}
+	spec.TestReports = []string{"reports/*.json"}
+	agent.Execute(ctx, spec)
+	assert.Equal(t, []string{spec.Job}, completed)
+
+	response, err := http.Get(server.URL + "/v0/runs/" + run.Id + "/tests?status=failed")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	results := struct {
+		Summary models.TestSummary  `json:"summary"`
+		Tests   []models.TestResult `json:"tests"`
+	}{}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&results))
+	assert.Equal(t, models.TestSummary{Total: 1, Failed: 1}, results.Summary)
+	require.Len(t, results.Tests, 1, "invalid reports are skipped and reports are uploaded even when the job fails")
+	assert.Equal(t, "TestB", results.Tests[0].Name)
+	assert.Equal(t, "reports/unit.json", results.Tests[0].Report)
+	require.NotNil(t, results.Tests[0].Step)
+	assert.Equal(t, 1, *results.Tests[0].Step, "the report belongs to the step that wrote it")
+
+	invalid, err := http.Get(server.URL + "/v0/runs/" + run.Id + "/tests?status=broken")
+	require.NoError(t, err)
+	invalid.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, invalid.StatusCode)
+}
+
+func TestAgentUploadsCoverage(t *testing.T) {
+	ctx := context.Background()
+	server, _, run, _ := newTestAPI(t)
+	client := NewClient(server.URL, "")
+	_, err := client.Register(ctx, testRegistrationToken, runner.RegisterRequest{Name: "runner-1"})
+	require.NoError(t, err)
+	agent := New(client, executor.New(), TempDirCheckout(t.TempDir()))
+
+	spec, err := client.RequestJob(ctx, 0)
+	require.NoError(t, err)
+	require.NotNil(t, spec)
+	spec.Steps = []pipeline.Step{{Run: `printf '%s\n' 'mode: set' 'api/main.go:3.1,5.2 3 1' 'api/main.go:6.1,7.2 1 0' > coverage.out`}}
+	spec.CoverageReports = []string{"coverage.out"}
+	agent.Execute(ctx, spec)
+
+	response, err := http.Get(server.URL + "/v0/runs/" + run.Id + "/coverage")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	runCoverage := models.RunCoverage{}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&runCoverage))
+	assert.Equal(t, models.Coverage{Covered: 3, Total: 4, Percent: 75}, runCoverage.Coverage)
+	assert.Equal(t, []models.FileCoverage{{Path: "api/main.go", Coverage: models.Coverage{Covered: 3, Total: 4, Percent: 75}}}, runCoverage.Files)
+
+	history, err := http.Get(server.URL + "/v0/pipelines/pipeline-1/coverage?runs=0")
+	require.NoError(t, err)
+	history.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, history.StatusCode)
+}
+
+func TestAgentInjectsAndMasksSecrets(t *testing.T) {
+	ctx := context.Background()
+	server, _, run, service := newTestAPI(t)
+	request, err := http.NewRequest(http.MethodPut, server.URL+"/v0/pipelines/pipeline-1/secrets/DEPLOY_TOKEN", strings.NewReader(`{"value":"s3cr3t-value"}`))
+	require.NoError(t, err)
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.NotContains(t, string(body), "s3cr3t-value")
+
+	client := NewClient(server.URL, "")
+	_, err = client.Register(ctx, testRegistrationToken, runner.RegisterRequest{Name: "runner-1"})
+	require.NoError(t, err)
+	agent := New(client, executor.New(), TempDirCheckout(t.TempDir()))
+	spec, err := client.RequestJob(ctx, 0)
+	require.NoError(t, err)
+	require.NotNil(t, spec)
+	assert.Equal(t, map[string]string{"DEPLOY_TOKEN": "s3cr3t-value"}, spec.Secrets)
+	// runners that do not mask their output are masked by the API
+	require.NoError(t, client.AppendLog(ctx, spec.AssignmentId, []byte("raw s3cr3t-value\n")))
+	spec.Steps = []pipeline.Step{{Run: `echo "token is $DEPLOY_TOKEN" && printf '%s' "$DEPLOY_TOKEN" | base64`}}
+	agent.Execute(ctx, spec)
+
+	logs, err := service.Logs().Open(run.Id, spec.Job)
+	require.NoError(t, err)
+	defer logs.Close()
+	content, err := io.ReadAll(logs)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "raw ***\n")
+	assert.Contains(t, string(content), "token is ***\n")
+	assert.NotContains(t, string(content), "s3cr3t")
+	assert.NotContains(t, string(content), "czNjcjN0LXZhbHVl")
+}
+
+func TestAgentSavesAndRestoresCaches(t *testing.T) {
+	ctx := context.Background()
+	server, runs, run, service := newTestAPI(t)
+	client := NewClient(server.URL, "")
+	_, err := client.Register(ctx, testRegistrationToken, runner.RegisterRequest{Name: "runner-1"})
+	require.NoError(t, err)
+	agent := New(client, executor.New(), TempDirCheckout(t.TempDir()))
+	caches := []pipeline.Cache{{Key: "go-v1", RestoreKeys: []string{"go-"}, Paths: []string{".gomodcache"}}}
+
+	// greet fills the cache, check finds it in its own fresh working directory
+	steps := map[string]string{
+		"greet": "test ! -e .gomodcache && mkdir .gomodcache && echo downloaded > .gomodcache/modules.txt",
+		"check": `test "$(cat .gomodcache/modules.txt)" = downloaded`,
+	}
+	for _, job := range []string{"greet", "check"} {
+		spec, err := client.RequestJob(ctx, 0)
+		require.NoError(t, err)
+		require.NotNil(t, spec)
+		require.Equal(t, job, spec.Job)
+		spec.Steps = []pipeline.Step{{Run: steps[job]}}
+		spec.Cache = caches
+		agent.Execute(ctx, spec)
+	}
+
+	stored, err := runs.Get(ctx, run.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusSucceeded, stored.Status)
+	logs, err := service.Logs().Open(run.Id, "check")
+	require.NoError(t, err)
+	defer logs.Close()
+	content, err := io.ReadAll(logs)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "==> Restoring cache go-v1\nRestored cache go-v1\n")
+	assert.NotContains(t, string(content), "Saving cache", "exact hits are not saved again")
+}
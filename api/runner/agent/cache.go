@@ -0,0 +1,359 @@
+package agent
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"api/pipeline"
+	"api/runner"
+)
+
+// A cache of the job, with its key computed before the steps changed any file
+type jobCache struct {
+	cache pipeline.Cache
+	key   string
+	// Restored from the exact key, so there is nothing new to save
+	hit bool
+}
+
+// Restore the caches of the job; failures are reported in the output but never fail the job
+func (a *Agent) restoreCaches(ctx context.Context, spec *runner.JobSpec, dir string, output io.Writer) []jobCache {
+	caches := []jobCache{}
+	for _, cache := range spec.Cache {
+		key, restoreKeys, err := cache.ExpandKeys(hashFilesIn(dir))
+		if err != nil {
+			fmt.Fprintf(output, "Unable to compute the cache key %s: %v\n", cache.Key, err)
+			continue
+		}
+		fmt.Fprintf(output, "==> Restoring cache %s\n", key)
+		restored, err := a.restoreCache(ctx, spec.AssignmentId, cache, runner.CacheRestoreRequest{Key: key, RestoreKeys: restoreKeys}, dir)
+		switch {
+		case err != nil:
+			fmt.Fprintf(output, "Unable to restore the cache: %v\n", err)
+		case restored == "":
+			fmt.Fprintf(output, "Cache not found\n")
+		default:
+			fmt.Fprintf(output, "Restored cache %s\n", restored)
+		}
+		caches = append(caches, jobCache{cache: cache, key: key, hit: err == nil && restored == key})
+	}
+	return caches
+}
+
+func (a *Agent) restoreCache(ctx context.Context, assignmentId string, cache pipeline.Cache, request runner.CacheRestoreRequest, dir string) (string, error) {
+	archive, err := os.CreateTemp("", "cache-*.tar.gz")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+	restored, err := a.client.RestoreCache(ctx, assignmentId, request, archive)
+	if err != nil || restored == "" {
+		return "", err
+	}
+	_, err = archive.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	return restored, extractArchive(archive, dir, cache.Paths)
+}
+
+// Save the caches that were not restored from their exact key
+func (a *Agent) saveCaches(ctx context.Context, spec *runner.JobSpec, dir string, output io.Writer, caches []jobCache) {
+	for _, cache := range caches {
+		if cache.hit {
+			continue
+		}
+		fmt.Fprintf(output, "==> Saving cache %s\n", cache.key)
+		err := a.saveCache(ctx, spec.AssignmentId, cache, dir, output)
+		if err != nil {
+			fmt.Fprintf(output, "Unable to save the cache: %v\n", err)
+		}
+	}
+}
+
+func (a *Agent) saveCache(ctx context.Context, assignmentId string, cache jobCache, dir string, output io.Writer) error {
+	archive, err := os.CreateTemp("", "cache-*.tar.gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+	files, err := writeArchive(archive, dir, cache.cache.Paths)
+	if err != nil {
+		return err
+	}
+	if files == 0 {
+		fmt.Fprintf(output, "Nothing to cache: no file under %s\n", strings.Join(cache.cache.Paths, ", "))
+		return nil
+	}
+	err = a.client.SaveCache(ctx, assignmentId, cache.key, archive.Name())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(output, "Saved %d files\n", files)
+	return nil
+}
+
+// Hash of the files of the working directory matching the patterns; empty when none does
+func hashFilesIn(dir string) func(patterns []string) (string, error) {
+	return func(patterns []string) (string, error) {
+		hash := sha256.New()
+		matched := false
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() && entry.Name() == ".git" {
+				return fs.SkipDir
+			}
+			if !entry.Type().IsRegular() {
+				return nil
+			}
+			name, err := filepath.Rel(dir, path)
+			if err != nil || !pipeline.MatchesFiles(patterns, filepath.ToSlash(name)) {
+				return err
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			fileHash := sha256.New()
+			_, err = io.Copy(fileHash, file)
+			if err != nil {
+				return err
+			}
+			// walked in lexical order, so the hash is stable
+			hash.Write(fileHash.Sum(nil))
+			matched = true
+			return nil
+		})
+		if err != nil || !matched {
+			return "", err
+		}
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+}
+
+// Location of a cache path: under the runner home for `~/`, the working directory otherwise
+func resolveCachePath(dir string, cachePath string) (string, string, error) {
+	base := dir
+	relative, home := strings.CutPrefix(cachePath, "~/")
+	if home {
+		var err error
+		base, err = os.UserHomeDir()
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return base, filepath.Join(base, filepath.FromSlash(relative)), nil
+}
+
+/*
+Write the cached paths to a gzip-compressed tar archive.
+
+Entries are named after the cache paths as written in the pipeline, so the
+archive restores on runners with another home or working directory.
+
+[IN] archive: receives the archive
+
+[IN] dir: job working directory
+
+[IN] paths: cache paths; missing ones are skipped
+
+[OUT] int: number of files archived
+
+[OUT] error: for error propagation
+*/
+func writeArchive(archive io.Writer, dir string, paths []string) (int, error) {
+	compressed := gzip.NewWriter(archive)
+	writer := tar.NewWriter(compressed)
+	files := 0
+	for _, cachePath := range paths {
+		_, root, err := resolveCachePath(dir, cachePath)
+		if err != nil {
+			return 0, err
+		}
+		err = filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+			if os.IsNotExist(err) && path == root {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			relative, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			link := ""
+			if info.Mode()&fs.ModeSymlink != 0 {
+				link, err = os.Readlink(path)
+				if err != nil {
+					return err
+				}
+			}
+			header, err := tar.FileInfoHeader(info, link)
+			if err != nil {
+				return err
+			}
+			header.Name = strings.TrimSuffix(cachePath, "/")
+			if relative != "." {
+				header.Name += "/" + filepath.ToSlash(relative)
+			}
+			if info.IsDir() {
+				header.Name += "/"
+			}
+			header.Uname, header.Gname = "", ""
+			err = writer.WriteHeader(header)
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+			files++
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = io.Copy(writer, file)
+			return err
+		})
+		if err != nil {
+			return 0, fmt.Errorf("unable to archive %s: %w", cachePath, err)
+		}
+	}
+	err := writer.Close()
+	if err != nil {
+		return 0, err
+	}
+	return files, compressed.Close()
+}
+
+/*
+Extract a cache archive written by writeArchive.
+
+Every entry must belong to one of the cache paths and stay inside its base
+directory, even through the symbolic links extracted before it.
+
+[IN] archive: the gzip-compressed tar archive
+
+[IN] dir: job working directory
+
+[IN] paths: cache paths of the job
+
+[OUT] error: also when an entry is outside the cache paths
+*/
+func extractArchive(archive io.Reader, dir string, paths []string) error {
+	compressed, err := gzip.NewReader(archive)
+	if err != nil {
+		return fmt.Errorf("invalid cache archive: %w", err)
+	}
+	reader := tar.NewReader(compressed)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid cache archive: %w", err)
+		}
+		name := strings.TrimSuffix(header.Name, "/")
+		if !inCachePaths(name, paths) {
+			return fmt.Errorf("the cache archive has an unexpected entry %s", header.Name)
+		}
+		base, target, err := resolveCachePath(dir, name)
+		if err != nil {
+			return err
+		}
+		// check before creating anything, in case an extracted link leads elsewhere
+		err = checkInside(base, existingAncestor(filepath.Dir(target)))
+		if err != nil {
+			return fmt.Errorf("unable to extract %s: %w", header.Name, err)
+		}
+		err = os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return err
+		}
+		mode := header.FileInfo().Mode().Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, mode|0700)
+		case tar.TypeReg:
+			err = extractFile(reader, target, mode)
+		case tar.TypeSymlink:
+			os.Remove(target)
+			err = os.Symlink(header.Linkname, target)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to extract %s: %w", header.Name, err)
+		}
+	}
+}
+
+func extractFile(content io.Reader, target string, mode fs.FileMode) error {
+	// replace rather than write through whatever was there, e.g. a symbolic link
+	os.Remove(target)
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, content)
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// Whether an archive entry is one of the cache paths or below one, without `..`
+func inCachePaths(name string, paths []string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return false
+		}
+	}
+	for _, cachePath := range paths {
+		cachePath = strings.TrimSuffix(cachePath, "/")
+		if name == cachePath || strings.HasPrefix(name, cachePath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func existingAncestor(dir string) string {
+	for {
+		_, err := os.Lstat(dir)
+		parent := filepath.Dir(dir)
+		if err == nil || parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// Fail when dir, once its symbolic links are resolved, is outside base
+func checkInside(base string, dir string) error {
+	realBase, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		return err
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	relative, err := filepath.Rel(realBase, realDir)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is outside %s", dir, base)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+//go:build unix
+
+package agent
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	source := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(source, "vendor", "tools"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "vendor", "modules.txt"), []byte("modules"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "vendor", "tools", "lint"), []byte("#!/bin/sh"), 0755))
+	require.NoError(t, os.Symlink("modules.txt", filepath.Join(source, "vendor", "latest")))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "main.go"), []byte("package main"), 0644))
+
+	archive := &bytes.Buffer{}
+	files, err := writeArchive(archive, source, []string{"vendor/", "missing"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, files)
+
+	target := t.TempDir()
+	require.NoError(t, extractArchive(archive, target, []string{"vendor/", "missing"}))
+	content, err := os.ReadFile(filepath.Join(target, "vendor", "latest"))
+	require.NoError(t, err)
+	assert.Equal(t, "modules", string(content))
+	info, err := os.Stat(filepath.Join(target, "vendor", "tools", "lint"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	assert.NoFileExists(t, filepath.Join(target, "main.go"))
+}
+
+func TestExtractRejectsEscapingEntries(t *testing.T) {
+	outside := t.TempDir()
+	examples := []struct {
+		name    string
+		headers []tar.Header
+		err     string
+	}{
+		{
+			name:    "entry outside the cache paths",
+			headers: []tar.Header{{Name: "main.go", Typeflag: tar.TypeReg, Mode: 0644}},
+			err:     "unexpected entry main.go",
+		},
+		{
+			name:    "parent directory",
+			headers: []tar.Header{{Name: "vendor/../../escaped", Typeflag: tar.TypeReg, Mode: 0644}},
+			err:     "unexpected entry",
+		},
+		{
+			name: "through an extracted link",
+			headers: []tar.Header{
+				{Name: "vendor/", Typeflag: tar.TypeDir, Mode: 0755},
+				{Name: "vendor/link", Typeflag: tar.TypeSymlink, Linkname: outside},
+				{Name: "vendor/link/escaped", Typeflag: tar.TypeReg, Mode: 0644},
+			},
+			err: "is outside",
+		},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			archive := &bytes.Buffer{}
+			compressed := gzip.NewWriter(archive)
+			writer := tar.NewWriter(compressed)
+			for _, header := range example.headers {
+				require.NoError(t, writer.WriteHeader(&header))
+			}
+			require.NoError(t, writer.Close())
+			require.NoError(t, compressed.Close())
+
+			err := extractArchive(archive, t.TempDir(), []string{"vendor"})
+			assert.ErrorContains(t, err, example.err)
+			assert.NoFileExists(t, filepath.Join(outside, "escaped"))
+		})
+	}
+}
+
+func TestHashFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "api"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "api", "go.sum"), []byte("checksums"), 0644))
+	hashFiles := hashFilesIn(dir)
+
+	first, err := hashFiles([]string{"**/go.sum"})
+	require.NoError(t, err)
+	assert.Len(t, first, 64)
+	second, err := hashFiles([]string{"**/go.sum"})
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "api", "go.sum"), []byte("new checksums"), 0644))
+	changed, err := hashFiles([]string{"**/go.sum"})
+	require.NoError(t, err)
+	assert.NotEqual(t, first, changed)
+
+	none, err := hashFiles([]string{"**/package-lock.json"})
+	require.NoError(t, err)
+	assert.Empty(t, none)
+}
@@ -0,0 +1,275 @@
+// Package agent is the runner side of the runner protocol: it polls the API
+// for jobs and executes their steps locally.
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/artifacts"
+	"api/models"
+	"api/runner"
+)
+
+// Returned when the API no longer assigns the job to this runner
+var ErrAssignmentLost = errors.New("the job was reassigned")
+
+// HTTP client of the runner API
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+func NewClient(baseURL string, token string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		// long polls last up to a minute
+		httpClient: &http.Client{Timeout: 90 * time.Second},
+	}
+}
+
+func (c *Client) Token() string {
+	return c.token
+}
+
+// Exchange the registration token for a runner token, used by the following calls
+func (c *Client) Register(ctx context.Context, registrationToken string, request runner.RegisterRequest) (*runner.RegisterResponse, error) {
+	response := &runner.RegisterResponse{}
+	_, err := c.do(ctx, "/v0/runners/register", registrationToken, request, response)
+	if err != nil {
+		return nil, err
+	}
+	c.token = response.Token
+	return response, nil
+}
+
+// Wait up to the given time for a job; nil when none was assigned
+func (c *Client) RequestJob(ctx context.Context, wait time.Duration) (*runner.JobSpec, error) {
+	spec := &runner.JobSpec{}
+	path := fmt.Sprintf("/v0/runners/jobs/request?wait=%d", int(wait.Seconds()))
+	status, err := c.do(ctx, path, c.token, struct{}{}, spec)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNoContent {
+		return nil, nil
+	}
+	return spec, nil
+}
+
+func (c *Client) Heartbeat(ctx context.Context, assignmentId string) error {
+	_, err := c.do(ctx, "/v0/runners/heartbeat", c.token, runner.HeartbeatRequest{AssignmentId: assignmentId}, nil)
+	return err
+}
+
+func (c *Client) AppendLog(ctx context.Context, assignmentId string, data []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+jobPath(assignmentId, "logs"), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain")
+	_, err = c.send(request, c.token, nil)
+	return err
+}
+
+func (c *Client) UpdateStep(ctx context.Context, assignmentId string, update runner.StepUpdate) error {
+	_, err := c.do(ctx, jobPath(assignmentId, "steps"), c.token, update, nil)
+	return err
+}
+
+// Upload a file of the job working directory as an artifact, with its checksum
+func (c *Client) UploadArtifact(ctx context.Context, assignmentId string, name string, filePath string) error {
+	return c.uploadFile(ctx, jobPath(assignmentId, "artifacts")+"?name="+url.QueryEscape(name), filePath, nil)
+}
+
+// Upload a JUnit XML or `go test -json` report of the job working directory, written by the step at index step
+// unless it is negative
+func (c *Client) UploadTestReport(ctx context.Context, assignmentId string, name string, filePath string, step int) (*models.TestSummary, error) {
+	summary := &models.TestSummary{}
+	query := "?name=" + url.QueryEscape(name)
+	if step >= 0 {
+		query += "&step=" + strconv.Itoa(step)
+	}
+	err := c.uploadFile(ctx, jobPath(assignmentId, "test-reports")+query, filePath, summary)
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// Upload a Go coverprofile or Cobertura XML report of the job working directory
+func (c *Client) UploadCoverage(ctx context.Context, assignmentId string, name string, filePath string) (*models.Coverage, error) {
+	total := &models.Coverage{}
+	err := c.uploadFile(ctx, jobPath(assignmentId, "coverage")+"?name="+url.QueryEscape(name), filePath, total)
+	if err != nil {
+		return nil, err
+	}
+	return total, nil
+}
+
+/*
+Download the archive of the cache entry matching the request.
+
+[IN] ctx: request context
+
+[IN] assignmentId: job restoring the cache
+
+[IN] request: key and restore keys
+
+[IN] archive: receives the archive
+
+[OUT] string: key of the entry restored; empty on a miss
+
+[OUT] error: also when the archive does not match its checksum
+*/
+func (c *Client) RestoreCache(ctx context.Context, assignmentId string, request runner.CacheRestoreRequest, archive io.Writer) (string, error) {
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+jobPath(assignmentId, "cache/restore"), bytes.NewReader(encoded))
+	if err != nil {
+		return "", err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	result, err := c.open(httpRequest, c.token)
+	if err != nil {
+		return "", err
+	}
+	defer result.Body.Close()
+	if result.StatusCode == http.StatusNoContent {
+		return "", nil
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(archive, hash), result.Body)
+	if err != nil {
+		return "", fmt.Errorf("unable to download the cache: %w", err)
+	}
+	checksum := result.Header.Get(artifacts.ChecksumHeader)
+	if checksum != "" && checksum != hex.EncodeToString(hash.Sum(nil)) {
+		return "", fmt.Errorf("the cache archive does not match its checksum %s", checksum)
+	}
+	return result.Header.Get(runner.CacheKeyHeader), nil
+}
+
+// Upload the archive of a cache entry, with its checksum
+func (c *Client) SaveCache(ctx context.Context, assignmentId string, key string, archivePath string) error {
+	return c.uploadFile(ctx, jobPath(assignmentId, "cache")+"?key="+url.QueryEscape(key), archivePath, nil)
+}
+
+// POST the contents of a file along with their SHA-256, decoding the JSON response when given one
+func (c *Client) uploadFile(ctx context.Context, path string, filePath string, response any) error {
+	checksum, err := fileChecksum(filePath)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, file)
+	if err != nil {
+		return err
+	}
+	request.ContentLength = info.Size()
+	if info.Size() == 0 {
+		request.Body = http.NoBody
+	}
+	request.Header.Set("Content-Type", "application/octet-stream")
+	request.Header.Set(artifacts.ChecksumHeader, checksum)
+	_, err = c.send(request, c.token, response)
+	return err
+}
+
+func fileChecksum(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (c *Client) Complete(ctx context.Context, assignmentId string, request runner.CompleteRequest) error {
+	_, err := c.do(ctx, jobPath(assignmentId, "complete"), c.token, request, nil)
+	return err
+}
+
+func jobPath(assignmentId string, action string) string {
+	return fmt.Sprintf("/v0/runners/jobs/%s/%s", url.PathEscape(assignmentId), action)
+}
+
+// POST a JSON body and decode the JSON response, if any
+func (c *Client) do(ctx context.Context, path string, token string, body any, response any) (int, error) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(encoded))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	return c.send(request, token, response)
+}
+
+func (c *Client) send(request *http.Request, token string, response any) (int, error) {
+	result, err := c.open(request, token)
+	if err != nil {
+		if result != nil {
+			return result.StatusCode, err
+		}
+		return 0, err
+	}
+	defer result.Body.Close()
+	if response != nil && result.StatusCode != http.StatusNoContent {
+		err = json.NewDecoder(result.Body).Decode(response)
+		if err != nil {
+			return result.StatusCode, fmt.Errorf("invalid response from %s: %w", request.URL.Path, err)
+		}
+	}
+	return result.StatusCode, nil
+}
+
+// Send an authenticated request; on success the caller closes the response body
+func (c *Client) open(request *http.Request, token string) (*http.Response, error) {
+	request.Header.Set("Authorization", "Bearer "+token)
+	result, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("request to %s failed: %w", request.URL.Path, err)
+	}
+	if result.StatusCode == http.StatusConflict {
+		result.Body.Close()
+		return result, ErrAssignmentLost
+	}
+	if result.StatusCode >= 300 {
+		defer result.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(result.Body, 4096))
+		return result, fmt.Errorf("request to %s failed with status %d: %s", request.URL.Path, result.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return result, nil
+}
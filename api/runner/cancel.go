@@ -0,0 +1,128 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"api/clients/githubclient"
+	"api/logger"
+	"api/models"
+	"api/runs"
+	"api/store"
+)
+
+// Receives the commit statuses of cancelled runs, e.g. the GitHub service
+type StatusPoster interface {
+	SetCommitStatus(ctx context.Context, repoURL, sha string, status githubclient.CommitStatus) error
+}
+
+// Post the commit status of the runs cancelled from now on
+func (s *Service) ReportStatuses(poster StatusPoster) {
+	s.statuses = poster
+}
+
+/*
+Cancel a run.
+
+Its unfinished jobs are cancelled at once. Runners executing one of them
+lose their assignment, so their next heartbeat stops the job, and queued
+jobs are dropped when a runner leases them.
+
+[IN] ctx: request context
+
+[IN] runId: the run to cancel
+
+[IN] reason: why the run was cancelled, recorded on the run and its jobs
+
+[OUT] *models.Run: the cancelled run
+
+[OUT] error: runs.ErrInvalidTransition when the run already finished
+*/
+func (s *Service) Cancel(ctx context.Context, runId string, reason string) (*models.Run, error) {
+	log := logger.FromContext(ctx)
+	run, err := s.runs.Update(ctx, runId, func(run *models.Run) error {
+		return runs.CancelRun(run, reason, s.now().UTC())
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Cancelled run %s: %s", run.Id, reason)
+
+	assignments, err := store.List[Assignment](ctx, s.store, AssignmentsBucket)
+	if err != nil {
+		return nil, err
+	}
+	for _, assignment := range assignments {
+		if assignment.RunId != run.Id {
+			continue
+		}
+		err = s.jobs.Ack(ctx, assignment.Id, assignment.LeaseId)
+		if err != nil {
+			log.Warnf("Unable to acknowledge cancelled job %s of run %s: %v", assignment.Job, run.Id, err)
+		}
+		err = store.Delete(ctx, s.store, AssignmentsBucket, assignment.Id)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+		err = s.forgetJob(ctx, assignment.RunnerId)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+	}
+	s.postCancelledStatus(ctx, run)
+	return run, nil
+}
+
+// Statuses are informative, so failing to post one doesn't fail the cancellation
+func (s *Service) postCancelledStatus(ctx context.Context, run *models.Run) {
+	if s.statuses == nil || run.CommitSha == "" {
+		return
+	}
+	p, err := s.pipelines.Get(ctx, run.PipelineId)
+	if err != nil {
+		logger.FromContext(ctx).Warnf("Unable to post the status of run %s: %v", run.Id, err)
+		return
+	}
+	err = s.statuses.SetCommitStatus(ctx, p.Url, run.CommitSha, githubclient.CommitStatus{
+		State:       githubclient.CommitStateError,
+		Context:     "aeternum/" + p.Name,
+		Description: "Cancelled: " + run.Reason,
+	})
+	if err != nil {
+		logger.FromContext(ctx).Warnf("Unable to post the status of run %s: %v", run.Id, err)
+	}
+}
+
+// Cancel the started runs that outlived the timeout of their pipeline
+func (s *Service) cancelTimedOutRuns(ctx context.Context) error {
+	runList, err := s.runs.List(ctx)
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	timeouts := map[string]int{}
+	for _, run := range runList {
+		if run.Status.IsFinal() || run.StartedAt == nil {
+			continue
+		}
+		minutes, ok := timeouts[run.PipelineId]
+		if !ok {
+			p, err := s.pipelines.Get(ctx, run.PipelineId)
+			if err != nil {
+				return err
+			}
+			minutes = p.Definition.TimeoutMinutes
+			timeouts[run.PipelineId] = minutes
+		}
+		if minutes == 0 || now.Sub(*run.StartedAt) <= time.Duration(minutes)*time.Minute {
+			continue
+		}
+		_, err = s.Cancel(ctx, run.Id, fmt.Sprintf("timed out after %d minutes", minutes))
+		if err != nil && !errors.Is(err, runs.ErrInvalidTransition) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package runner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"api/clients/githubclient"
+	"api/models"
+	"api/pipeline"
+	"api/runs"
+	"api/triggers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type postedStatus struct {
+	repoURL string
+	sha     string
+	status  githubclient.CommitStatus
+}
+
+type fakeStatusPoster struct {
+	posted []postedStatus
+}
+
+func (f *fakeStatusPoster) SetCommitStatus(ctx context.Context, repoURL, sha string, status githubclient.CommitStatus) error {
+	f.posted = append(f.posted, postedStatus{repoURL: repoURL, sha: sha, status: status})
+	return nil
+}
+
+func TestCancel(t *testing.T) {
+	ctx := context.Background()
+	service, runStore, jobs := newTestService(t)
+	poster := &fakeStatusPoster{}
+	service.ReportStatuses(poster)
+	definition, err := pipeline.Parse([]byte(`
+name: api
+jobs:
+  lint:
+    steps: [{run: make lint}]
+  test:
+    steps: [{run: make test}]
+`))
+	require.NoError(t, err)
+	p := models.Pipeline{Id: "pipeline-1", Url: "https://github.com/some-user/my-project", Name: "api", Definition: *definition}
+	require.NoError(t, service.pipelines.Create(ctx, p))
+	run := triggers.NewRun(p, triggers.TriggerPush, time.Now())
+	run.CommitSha = "abc123"
+	require.NoError(t, triggers.Start(ctx, runStore, jobs, run))
+
+	runner := registerTestRunner(t, service, "runner-1")
+	spec, err := service.RequestJob(ctx, runner)
+	require.NoError(t, err)
+	require.NotNil(t, spec)
+
+	cancelled, err := service.Cancel(ctx, run.Id, "cancelled on request")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCancelled, cancelled.Status)
+	for _, job := range cancelled.Jobs {
+		assert.Equal(t, models.StatusCancelled, job.Status, job.Name)
+	}
+	assert.Equal(t, []postedStatus{{
+		repoURL: p.Url,
+		sha:     "abc123",
+		status: githubclient.CommitStatus{
+			State:       githubclient.CommitStateError,
+			Context:     "aeternum/api",
+			Description: "Cancelled: cancelled on request",
+		},
+	}}, poster.posted)
+
+	// the runner finds out on its next heartbeat
+	assert.ErrorIs(t, service.Heartbeat(ctx, runner, HeartbeatRequest{AssignmentId: spec.AssignmentId}), ErrAssignmentLost)
+	runnerList, err := service.List(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, runnerList[0].CurrentJob)
+	next, err := service.RequestJob(ctx, runner)
+	require.NoError(t, err)
+	assert.Nil(t, next, "the queued job of the cancelled run is dropped")
+
+	_, err = service.Cancel(ctx, run.Id, "again")
+	assert.ErrorIs(t, err, runs.ErrInvalidTransition)
+	assert.Len(t, poster.posted, 1)
+}
+
+func TestReapCancelsTimedOutRuns(t *testing.T) {
+	ctx := context.Background()
+	service, runStore, jobs := newTestService(t)
+	definition, err := pipeline.Parse([]byte(`
+name: api
+timeout-minutes: 30
+jobs:
+  test:
+    steps: [{run: make test}]
+`))
+	require.NoError(t, err)
+	p := models.Pipeline{Id: "pipeline-1", Url: "https://github.com/some-user/my-project", Name: "api", Definition: *definition}
+	require.NoError(t, service.pipelines.Create(ctx, p))
+	run := triggers.NewRun(p, triggers.TriggerManual, time.Now())
+	require.NoError(t, triggers.Start(ctx, runStore, jobs, run))
+	current := time.Now()
+	service.now = func() time.Time { return current }
+
+	runner := registerTestRunner(t, service, "runner-1")
+	spec, err := service.RequestJob(ctx, runner)
+	require.NoError(t, err)
+	assert.Equal(t, 360, spec.TimeoutMinutes, "jobs default to 6 hours")
+
+	current = current.Add(29 * time.Minute)
+	require.NoError(t, service.Heartbeat(ctx, runner, HeartbeatRequest{AssignmentId: spec.AssignmentId}))
+	require.NoError(t, service.Reap(ctx))
+	stored, err := runStore.Get(ctx, run.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusRunning, stored.Status)
+
+	current = current.Add(2 * time.Minute)
+	require.NoError(t, service.Heartbeat(ctx, runner, HeartbeatRequest{AssignmentId: spec.AssignmentId}))
+	require.NoError(t, service.Reap(ctx))
+	stored, err = runStore.Get(ctx, run.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCancelled, stored.Status)
+	assert.Equal(t, "timed out after 30 minutes", stored.Reason)
+}
@@ -0,0 +1,53 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Output of the jobs, stored as one file per job under the data directory
+type FileLogs struct {
+	dir string
+}
+
+func NewFileLogs(dir string) *FileLogs {
+	return &FileLogs{dir: dir}
+}
+
+func (l *FileLogs) path(runId, job string) string {
+	return filepath.Join(l.dir, filepath.Base(runId), filepath.Base(job)+".log")
+}
+
+func (l *FileLogs) Append(runId, job string, data []byte) error {
+	path := l.path(runId, job)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create the log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open the log of job %s: %w", job, err)
+	}
+	defer file.Close()
+	_, err = file.Write(data)
+	if err != nil {
+		return fmt.Errorf("unable to write the log of job %s: %w", job, err)
+	}
+	return nil
+}
+
+// Open the log of a job; empty when the job has not written anything yet
+func (l *FileLogs) Open(runId, job string) (io.ReadCloser, error) {
+	file, err := os.Open(l.path(runId, job))
+	if errors.Is(err, os.ErrNotExist) {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the log of job %s: %w", job, err)
+	}
+	return file, nil
+}
@@ -0,0 +1,82 @@
+// Package runner implements the API side of the protocol spoken by remote runners.
+//
+// Runners register once with the registration token and receive their own
+// token, then long-poll for jobs, stream logs and step results back while
+// heartbeating, and finally report the outcome of the job:
+//
+//	POST /v0/runners/register                RegisterRequest -> RegisterResponse
+//	POST /v0/runners/jobs/request            -> JobSpec, or 204 when no job is available
+//	POST /v0/runners/heartbeat               HeartbeatRequest
+//	POST /v0/runners/jobs/:id/logs           raw log output
+//	POST /v0/runners/jobs/:id/steps          StepUpdate
+//	POST /v0/runners/jobs/:id/artifacts      raw file contents, with ?name= and the X-Checksum-Sha256 header
+//	POST /v0/runners/jobs/:id/test-reports   JUnit XML or go test -json output, with ?name= and the ?step= that wrote it
+//	POST /v0/runners/jobs/:id/coverage       Go coverprofile or Cobertura XML, with ?name=
+//	POST /v0/runners/jobs/:id/cache/restore  CacheRestoreRequest -> archive with the X-Cache-Key header, or 204 on a miss
+//	POST /v0/runners/jobs/:id/cache          archive, with ?key= and the X-Checksum-Sha256 header
+//	POST /v0/runners/jobs/:id/complete       CompleteRequest
+package runner
+
+import (
+	"api/models"
+	"api/pipeline"
+)
+
+// Key of the cache entry a restore returned, which differs from the requested key on a fallback
+const CacheKeyHeader string = "X-Cache-Key"
+
+type RegisterRequest struct {
+	Name    string   `json:"name"`
+	Labels  []string `json:"labels"`
+	Version string   `json:"version"`
+}
+
+type RegisterResponse struct {
+	RunnerId string `json:"runnerId"`
+	// Shown once; only its hash is stored
+	Token string `json:"token"`
+}
+
+// A job assigned to a runner
+type JobSpec struct {
+	AssignmentId string `json:"assignmentId"`
+	RunId        string `json:"runId"`
+	PipelineId   string `json:"pipelineId"`
+	Job          string `json:"job"`
+	RepoURL      string `json:"repoUrl"`
+	Branch       string `json:"branch,omitempty"`
+	CommitSha    string `json:"commitSha,omitempty"`
+	// The runner stops the job and reports it failed after this long
+	TimeoutMinutes int             `json:"timeoutMinutes"`
+	Steps          []pipeline.Step `json:"steps"`
+	// Files to upload once the steps are over
+	Artifacts *pipeline.Artifacts `json:"artifacts,omitempty"`
+	Cache     []pipeline.Cache    `json:"cache,omitempty"`
+	// Glob patterns of the test reports to upload once the steps are over
+	TestReports []string `json:"testReports,omitempty"`
+	// Glob patterns of the coverage reports to upload once the steps succeeded
+	CoverageReports []string `json:"coverageReports,omitempty"`
+	// Environment variables holding the secrets of the pipeline, to mask in the logs
+	Secrets map[string]string `json:"secrets,omitempty"`
+}
+
+type HeartbeatRequest struct {
+	// Job being executed; its lease is extended
+	AssignmentId string `json:"assignmentId,omitempty"`
+}
+
+type StepUpdate struct {
+	Index    int           `json:"index"`
+	Status   models.Status `json:"status"`
+	ExitCode *int          `json:"exitCode,omitempty"`
+}
+
+type CompleteRequest struct {
+	Status models.Status `json:"status"`
+	Error  string        `json:"error,omitempty"`
+}
+
+type CacheRestoreRequest struct {
+	Key         string   `json:"key"`
+	RestoreKeys []string `json:"restoreKeys,omitempty"`
+}
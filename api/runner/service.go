@@ -0,0 +1,641 @@
+package runner
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"api/logger"
+	"api/models"
+	"api/queue"
+	"api/runs"
+	"api/secrets"
+	"api/store"
+	"api/triggers"
+
+	"github.com/google/uuid"
+)
+
+const AssignmentsBucket string = "assignments"
+
+const (
+	// How long a job stays assigned without a heartbeat from its runner
+	DefaultVisibilityTimeout time.Duration = 2 * time.Minute
+	// A runner silent for this long is offline and its job is requeued
+	DefaultOfflineAfter time.Duration = time.Minute
+	DefaultReapInterval time.Duration = 15 * time.Second
+)
+
+var (
+	ErrUnauthorized = errors.New("invalid runner credentials")
+	// The job was reassigned, e.g. after the runner missed its heartbeats
+	ErrAssignmentLost = errors.New("the job is no longer assigned to this runner")
+)
+
+// A queue message being executed by a runner
+type Assignment struct {
+	Id         string    `json:"id"`
+	LeaseId    string    `json:"leaseId"`
+	RunnerId   string    `json:"runnerId"`
+	RunId      string    `json:"runId"`
+	PipelineId string    `json:"pipelineId"`
+	Job        string    `json:"job"`
+	AssignedAt time.Time `json:"assignedAt"`
+	// Delivery attempt of the queue message; the last one fails the job instead of requeueing it
+	Attempt     int `json:"attempt"`
+	MaxAttempts int `json:"maxAttempts"`
+}
+
+type Service struct {
+	store             store.Store
+	pipelines         *store.Pipelines
+	runs              *store.Runs
+	runners           *store.Runners
+	jobs              queue.Queue
+	logs              *FileLogs
+	registrationToken string
+	visibility        time.Duration
+	offlineAfter      time.Duration
+	statuses          StatusPoster
+	completedHooks    []JobHook
+	quarantine        Quarantine
+	secrets           SecretSource
+	now               func() time.Time
+}
+
+/*
+Create the runner service.
+
+[IN] s: store shared by the API replicas
+
+[IN] jobs: queue of the jobs waiting for a runner
+
+[IN] logs: storage of the job output
+
+[IN] registrationToken: secret runners present to register; registration is disabled when empty
+
+[OUT] *Service: the runner service
+*/
+func NewService(s store.Store, jobs queue.Queue, logs *FileLogs, registrationToken string) *Service {
+	return &Service{
+		store:             s,
+		pipelines:         store.NewPipelines(s),
+		runs:              store.NewRuns(s),
+		runners:           store.NewRunners(s),
+		jobs:              jobs,
+		logs:              logs,
+		registrationToken: registrationToken,
+		visibility:        DefaultVisibilityTimeout,
+		offlineAfter:      DefaultOfflineAfter,
+		now:               time.Now,
+	}
+}
+
+// Called once a runner completed a job, e.g. to publish its test results
+type JobHook func(ctx context.Context, run *models.Run, job string) error
+
+// Call the hook after every job a runner completes; its failures are only logged
+func (s *Service) OnJobCompleted(hook JobHook) {
+	s.completedHooks = append(s.completedHooks, hook)
+}
+
+// Tells the failed jobs whose failed tests are all known to be flaky and reported by the failed step, e.g. the test
+// report service
+type Quarantine interface {
+	QuarantinedFailures(ctx context.Context, run *models.Run, job string, step int) ([]string, error)
+}
+
+// Let the jobs failing only on quarantined tests succeed from now on
+func (s *Service) QuarantineFlakyTests(quarantine Quarantine) {
+	s.quarantine = quarantine
+}
+
+// Decrypts the secrets of a pipeline, e.g. the secrets service
+type SecretSource interface {
+	Resolve(ctx context.Context, p *models.Pipeline) (map[string]string, error)
+}
+
+// Pass the secrets of their pipeline to the jobs assigned from now on, and mask them in their logs
+func (s *Service) InjectSecrets(source SecretSource) {
+	s.secrets = source
+}
+
+func (s *Service) Logs() *FileLogs {
+	return s.logs
+}
+
+func (s *Service) Register(ctx context.Context, registrationToken string, request RegisterRequest) (*RegisterResponse, error) {
+	if s.registrationToken == "" || subtle.ConstantTimeCompare([]byte(registrationToken), []byte(s.registrationToken)) != 1 {
+		return nil, ErrUnauthorized
+	}
+	if request.Name == "" {
+		return nil, fmt.Errorf("the runner needs a name")
+	}
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	labels := request.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+	runner := models.Runner{
+		Id:           uuid.NewString(),
+		Name:         request.Name,
+		Labels:       labels,
+		Version:      request.Version,
+		RegisteredAt: now,
+		LastSeenAt:   now,
+	}
+	err = s.runners.Create(ctx, runner, hashToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("unable to register runner %s: %w", request.Name, err)
+	}
+	logger.FromContext(ctx).Infof("Registered runner %s (%s) with labels %v", runner.Name, runner.Id, runner.Labels)
+	return &RegisterResponse{RunnerId: runner.Id, Token: token}, nil
+}
+
+// Find the runner owning a token
+func (s *Service) Authenticate(ctx context.Context, token string) (*models.Runner, error) {
+	if token == "" {
+		return nil, ErrUnauthorized
+	}
+	runner, err := s.runners.GetByTokenHash(ctx, hashToken(token))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.withStatus(runner), nil
+}
+
+// Registered runners, with their status derived from their last heartbeat
+func (s *Service) List(ctx context.Context) ([]models.Runner, error) {
+	runnerList, err := s.runners.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range runnerList {
+		s.withStatus(&runnerList[i])
+	}
+	return runnerList, nil
+}
+
+func (s *Service) withStatus(runner *models.Runner) *models.Runner {
+	runner.Status = models.RunnerOnline
+	if s.now().Sub(runner.LastSeenAt) > s.offlineAfter {
+		runner.Status = models.RunnerOffline
+	}
+	return runner
+}
+
+// Remove a runner, requeueing the job it was executing
+func (s *Service) Deregister(ctx context.Context, runnerId string) error {
+	runner, err := s.runners.Get(ctx, runnerId)
+	if err != nil {
+		return err
+	}
+	if runner.CurrentJob != nil {
+		err = s.release(ctx, runner, fmt.Sprintf("runner %s was removed", runner.Name))
+		if err != nil {
+			return err
+		}
+	}
+	err = s.runners.Delete(ctx, runnerId)
+	if err != nil {
+		return err
+	}
+	logger.FromContext(ctx).Infof("Removed runner %s (%s)", runner.Name, runner.Id)
+	return nil
+}
+
+/*
+Assign the next queued job to a runner.
+
+Messages whose run can no longer execute the job, e.g. a duplicate delivery
+of a finished job, are acknowledged and skipped. The queue is only leased from
+once it has a job for the runner, so polling an empty queue writes nothing.
+
+[IN] ctx: request context
+
+[IN] runner: the authenticated runner
+
+[OUT] *JobSpec: the assigned job, or nil when none is available
+
+[OUT] error: for error propagation
+*/
+func (s *Service) RequestJob(ctx context.Context, runner *models.Runner) (*JobSpec, error) {
+	log := logger.FromContext(ctx)
+	accept := acceptsLabels(runner.Labels)
+	for {
+		leasable, err := s.jobs.Leasable(ctx, accept)
+		if err != nil || !leasable {
+			return nil, err
+		}
+		message, err := s.jobs.Lease(ctx, runner.Id, s.visibility, accept)
+		if err != nil || message == nil {
+			return nil, err
+		}
+		spec, err := s.assign(ctx, runner, message)
+		if errors.Is(err, runs.ErrInvalidTransition) || errors.Is(err, store.ErrNotFound) {
+			log.Warnf("Dropping queued job %s: %v", message.Id, err)
+			err = s.jobs.Ack(ctx, message.Id, message.LeaseId)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return spec, err
+	}
+}
+
+// Only lease jobs whose runs-on labels the runner all has
+func acceptsLabels(labels []string) queue.Filter {
+	return func(message *queue.Message) bool {
+		queued := models.QueuedJob{}
+		if message.Decode(&queued) != nil {
+			// let assign drop the message
+			return true
+		}
+		for _, required := range queued.RunsOn {
+			if !slices.Contains(labels, required) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func (s *Service) assign(ctx context.Context, runner *models.Runner, message *queue.Message) (*JobSpec, error) {
+	queued := models.QueuedJob{}
+	err := message.Decode(&queued)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid queued job: %v", runs.ErrInvalidTransition, err)
+	}
+	p, err := s.pipelines.Get(ctx, queued.PipelineId)
+	if err != nil {
+		return nil, err
+	}
+	definition, ok := p.Definition.Jobs[queued.Job]
+	if !ok {
+		return nil, fmt.Errorf("%w: pipeline %s has no job %s", runs.ErrInvalidTransition, p.Id, queued.Job)
+	}
+	var jobSecrets map[string]string
+	if s.secrets != nil {
+		jobSecrets, err = s.secrets.Resolve(ctx, p)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the secrets of pipeline %s: %w", p.Id, err)
+		}
+	}
+	stepNames := []string{}
+	for i, step := range definition.Steps {
+		name := step.Name
+		if name == "" {
+			name = fmt.Sprintf("step %d", i+1)
+		}
+		stepNames = append(stepNames, name)
+	}
+
+	now := s.now().UTC()
+	run, err := s.runs.Update(ctx, queued.RunId, func(run *models.Run) error {
+		return runs.StartJob(run, queued.Job, runner.Id, stepNames, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	assignment := Assignment{
+		Id:          message.Id,
+		LeaseId:     message.LeaseId,
+		RunnerId:    runner.Id,
+		RunId:       run.Id,
+		PipelineId:  p.Id,
+		Job:         queued.Job,
+		AssignedAt:  now,
+		Attempt:     message.Attempts,
+		MaxAttempts: message.MaxAttempts,
+	}
+	err = store.Put(ctx, s.store, AssignmentsBucket, assignment.Id, assignment)
+	if err != nil {
+		return nil, fmt.Errorf("unable to record the assignment of job %s: %w", queued.Job, err)
+	}
+	err = s.touch(ctx, runner.Id, func(runner *models.Runner) {
+		runner.CurrentJob = &models.RunnerJob{AssignmentId: assignment.Id, RunId: run.Id, Job: queued.Job}
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.FromContext(ctx).Infof("Assigned job %s of run %s to runner %s", queued.Job, run.Id, runner.Name)
+	return &JobSpec{
+		AssignmentId:    assignment.Id,
+		RunId:           run.Id,
+		PipelineId:      p.Id,
+		Job:             queued.Job,
+		RepoURL:         p.Url,
+		Branch:          run.Branch,
+		CommitSha:       run.CommitSha,
+		Steps:           definition.Steps,
+		Artifacts:       definition.Artifacts,
+		Cache:           definition.Cache,
+		TestReports:     definition.TestReports,
+		CoverageReports: definition.CoverageReports,
+		Secrets:         jobSecrets,
+		TimeoutMinutes:  int(definition.Timeout() / time.Minute),
+	}, nil
+}
+
+// Record that the runner is alive and extend the lease of its job
+func (s *Service) Heartbeat(ctx context.Context, runner *models.Runner, request HeartbeatRequest) error {
+	err := s.touch(ctx, runner.Id, nil)
+	if err != nil || request.AssignmentId == "" {
+		return err
+	}
+	assignment, err := s.Assignment(ctx, runner, request.AssignmentId)
+	if err != nil {
+		return err
+	}
+	err = s.jobs.Heartbeat(ctx, assignment.Id, assignment.LeaseId, s.visibility)
+	if errors.Is(err, queue.ErrLeaseLost) {
+		return fmt.Errorf("%w: %v", ErrAssignmentLost, err)
+	}
+	return err
+}
+
+func (s *Service) AppendLog(ctx context.Context, runner *models.Runner, assignmentId string, data []byte) error {
+	assignment, err := s.Assignment(ctx, runner, assignmentId)
+	if err != nil {
+		return err
+	}
+	// runners mask the secrets already, but the archived logs must not depend on it
+	if s.secrets != nil {
+		p, err := s.pipelines.Get(ctx, assignment.PipelineId)
+		if err != nil {
+			return err
+		}
+		values, err := s.secrets.Resolve(ctx, p)
+		if err != nil {
+			return fmt.Errorf("unable to get the secrets of pipeline %s: %w", p.Id, err)
+		}
+		data = secrets.NewMasker(values).Mask(data)
+	}
+	return s.logs.Append(assignment.RunId, assignment.Job, data)
+}
+
+func (s *Service) UpdateStep(ctx context.Context, runner *models.Runner, assignmentId string, update StepUpdate) error {
+	assignment, err := s.Assignment(ctx, runner, assignmentId)
+	if err != nil {
+		return err
+	}
+	_, err = s.runs.Update(ctx, assignment.RunId, func(run *models.Run) error {
+		return runs.SetStep(run, assignment.Job, update.Index, update.Status, update.ExitCode)
+	})
+	return err
+}
+
+// Record the outcome of a job, enqueue the jobs it unblocks and release the queue message
+func (s *Service) Complete(ctx context.Context, runner *models.Runner, assignmentId string, request CompleteRequest) error {
+	log := logger.FromContext(ctx)
+	assignment, err := s.Assignment(ctx, runner, assignmentId)
+	if err != nil {
+		return err
+	}
+	if request.Status != models.StatusSucceeded && request.Status != models.StatusFailed {
+		return fmt.Errorf("%w: a runner cannot report the status %s", runs.ErrInvalidTransition, request.Status)
+	}
+
+	quarantined, err := s.quarantinedFailures(ctx, assignment, request)
+	if err != nil {
+		return err
+	}
+	if len(quarantined) > 0 {
+		log.Infof("Job %s of run %s only failed flaky tests: %s", assignment.Job, assignment.RunId, strings.Join(quarantined, ", "))
+		// the error stays to tell why the job would have failed
+		request.Status = models.StatusSucceeded
+	}
+
+	ready := []string{}
+	run, err := s.runs.Update(ctx, assignment.RunId, func(run *models.Run) error {
+		var err error
+		ready, err = runs.FinishJob(run, assignment.Job, request.Status, request.Error, s.now().UTC())
+		if err != nil {
+			return err
+		}
+		job, err := runs.FindJob(run, assignment.Job)
+		if err != nil {
+			return err
+		}
+		job.Quarantined = quarantined
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, job := range ready {
+		err = triggers.EnqueueJob(ctx, s.jobs, *run, job)
+		if err != nil {
+			return err
+		}
+	}
+	log.Infof("Job %s of run %s %s on runner %s", assignment.Job, run.Id, request.Status, runner.Name)
+
+	err = s.jobs.Ack(ctx, assignment.Id, assignment.LeaseId)
+	if err != nil {
+		log.Warnf("Unable to acknowledge job %s of run %s: %v", assignment.Job, run.Id, err)
+	}
+	err = store.Delete(ctx, s.store, AssignmentsBucket, assignment.Id)
+	if err != nil {
+		return err
+	}
+	for _, hook := range s.completedHooks {
+		err = hook(ctx, run, assignment.Job)
+		if err != nil {
+			log.Warnf("Unable to process the completion of job %s of run %s: %v", assignment.Job, run.Id, err)
+		}
+	}
+	return s.touch(ctx, runner.Id, clearCurrentJob)
+}
+
+// Failed tests of a failed job that are all quarantined; empty when the failure stands
+func (s *Service) quarantinedFailures(ctx context.Context, assignment *Assignment, request CompleteRequest) ([]string, error) {
+	if s.quarantine == nil || request.Status != models.StatusFailed {
+		return nil, nil
+	}
+	run, err := s.runs.Get(ctx, assignment.RunId)
+	if err != nil {
+		return nil, err
+	}
+	job, err := runs.FindJob(run, assignment.Job)
+	if err != nil {
+		return nil, err
+	}
+	// a checkout or artifact upload failure has no failed step, and never a flaky test behind it
+	for i, step := range job.Steps {
+		if step.Status != models.StatusFailed {
+			continue
+		}
+		// runners stop at the failed step, so the outputs of the later ones were never produced
+		if i != len(job.Steps)-1 {
+			return nil, nil
+		}
+		return s.quarantine.QuarantinedFailures(ctx, run, assignment.Job, i)
+	}
+	return nil, nil
+}
+
+// Requeue the jobs of the runners that stopped heartbeating and cancel the runs past their timeout
+func (s *Service) Reap(ctx context.Context) error {
+	err := s.cancelTimedOutRuns(ctx)
+	if err != nil {
+		return err
+	}
+	runnerList, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range runnerList {
+		runner := &runnerList[i]
+		if runner.Status != models.RunnerOffline || runner.CurrentJob == nil {
+			continue
+		}
+		err = s.release(ctx, runner, fmt.Sprintf("runner %s went offline", runner.Name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reap periodically until the context is cancelled
+func (s *Service) RunReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := s.Reap(ctx)
+		if err != nil {
+			logger.FromContext(ctx).Errorf("Failed to reap runners and runs: %v", err)
+		}
+	}
+}
+
+/*
+Take the current job away from a runner.
+
+The job goes back to the queue for another runner, unless the runner held
+the last delivery attempt, in which case the job fails.
+
+[IN] ctx: request context
+
+[IN] runner: runner executing the job
+
+[IN] reason: why the job was taken away
+
+[OUT] error: for error propagation
+*/
+func (s *Service) release(ctx context.Context, runner *models.Runner, reason string) error {
+	log := logger.FromContext(ctx)
+	assignment, err := s.Assignment(ctx, runner, runner.CurrentJob.AssignmentId)
+	if errors.Is(err, ErrAssignmentLost) {
+		// the job was already reassigned or completed
+		return s.forgetJob(ctx, runner.Id)
+	}
+	if err != nil {
+		return err
+	}
+
+	lastAttempt := assignment.Attempt >= assignment.MaxAttempts
+	_, err = s.runs.Update(ctx, assignment.RunId, func(run *models.Run) error {
+		if lastAttempt {
+			_, err := runs.FinishJob(run, assignment.Job, models.StatusFailed, reason, s.now().UTC())
+			return err
+		}
+		return runs.RequeueJob(run, assignment.Job, runner.Id, "requeued: "+reason)
+	})
+	if err != nil && !errors.Is(err, runs.ErrInvalidTransition) && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	if lastAttempt {
+		err = s.jobs.Ack(ctx, assignment.Id, assignment.LeaseId)
+	} else {
+		err = s.jobs.Nack(ctx, assignment.Id, assignment.LeaseId, reason, 0)
+	}
+	if err != nil && !errors.Is(err, queue.ErrLeaseLost) {
+		return err
+	}
+	err = store.Delete(ctx, s.store, AssignmentsBucket, assignment.Id)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	err = s.forgetJob(ctx, runner.Id)
+	if err != nil {
+		return err
+	}
+	log.Warnf("Released job %s of run %s: %s", assignment.Job, assignment.RunId, reason)
+	return nil
+}
+
+// Load an assignment, making sure it still belongs to the runner
+func (s *Service) Assignment(ctx context.Context, runner *models.Runner, assignmentId string) (*Assignment, error) {
+	assignment, err := store.Get[Assignment](ctx, s.store, AssignmentsBucket, assignmentId)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrAssignmentLost, assignmentId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if assignment.RunnerId != runner.Id {
+		return nil, fmt.Errorf("%w: %s", ErrAssignmentLost, assignmentId)
+	}
+	return assignment, nil
+}
+
+// Update the last heartbeat of a runner along with any other change
+func (s *Service) touch(ctx context.Context, runnerId string, update func(runner *models.Runner)) error {
+	_, err := s.runners.Update(ctx, runnerId, func(runner *models.Runner) error {
+		runner.LastSeenAt = s.now().UTC()
+		if update != nil {
+			update(runner)
+		}
+		return nil
+	})
+	return err
+}
+
+func clearCurrentJob(runner *models.Runner) {
+	runner.CurrentJob = nil
+}
+
+// Clear the current job of a runner without counting it as a heartbeat
+func (s *Service) forgetJob(ctx context.Context, runnerId string) error {
+	_, err := s.runners.Update(ctx, runnerId, func(runner *models.Runner) error {
+		clearCurrentJob(runner)
+		return nil
+	})
+	return err
+}
+
+func newToken() (string, error) {
+	buffer := make([]byte, 32)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate a runner token: %w", err)
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
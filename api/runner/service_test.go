@@ -0,0 +1,424 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"api/models"
+	"api/pipeline"
+	"api/queue"
+	"api/store"
+	"api/triggers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRegistrationToken string = "registration-secret"
+
+const testDefinition string = `
+name: api
+jobs:
+  test:
+    steps:
+      - name: unit
+        run: go test ./...
+      - run: go vet ./...
+  build:
+    needs: [test]
+    steps: [{run: go build ./...}]
+`
+
+func newTestService(t *testing.T) (*Service, *store.Runs, *queue.StoreQueue) {
+	dataStore := store.NewMemoryStore()
+	jobs := queue.NewStoreQueue(dataStore, triggers.JobQueueName)
+	return NewService(dataStore, jobs, NewFileLogs(t.TempDir()), testRegistrationToken), store.NewRuns(dataStore), jobs
+}
+
+func startTestRun(t *testing.T, service *Service, runs *store.Runs, jobs queue.Queue) models.Run {
+	definition, err := pipeline.Parse([]byte(testDefinition))
+	require.NoError(t, err)
+	p := models.Pipeline{Id: "pipeline-1", Url: "https://github.com/some-user/my-project", Name: "api", Definition: *definition}
+	require.NoError(t, service.pipelines.Create(context.Background(), p))
+	run := triggers.NewRun(p, triggers.TriggerManual, time.Now())
+	run.Branch = "main"
+	require.NoError(t, triggers.Start(context.Background(), runs, jobs, run))
+	return run
+}
+
+func registerTestRunner(t *testing.T, service *Service, name string) *models.Runner {
+	response, err := service.Register(context.Background(), testRegistrationToken, RegisterRequest{Name: name, Labels: []string{"linux"}})
+	require.NoError(t, err)
+	runner, err := service.Authenticate(context.Background(), response.Token)
+	require.NoError(t, err)
+	assert.Equal(t, response.RunnerId, runner.Id)
+	return runner
+}
+
+func TestRegister(t *testing.T) {
+	examples := []struct {
+		name              string
+		configured        string
+		registrationToken string
+		err               error
+	}{
+		{name: "valid token", configured: testRegistrationToken, registrationToken: testRegistrationToken},
+		{name: "wrong token", configured: testRegistrationToken, registrationToken: "guess", err: ErrUnauthorized},
+		{name: "registration disabled", configured: "", registrationToken: "", err: ErrUnauthorized},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			dataStore := store.NewMemoryStore()
+			service := NewService(dataStore, queue.NewStoreQueue(dataStore, "jobs"), NewFileLogs(t.TempDir()), example.configured)
+			response, err := service.Register(context.Background(), example.registrationToken, RegisterRequest{Name: "runner-1"})
+			if example.err != nil {
+				assert.ErrorIs(t, err, example.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEmpty(t, response.Token)
+		})
+	}
+}
+
+func TestAuthenticateRejectsUnknownTokens(t *testing.T) {
+	service, _, _ := newTestService(t)
+	registerTestRunner(t, service, "runner-1")
+	for _, token := range []string{"", "unknown"} {
+		_, err := service.Authenticate(context.Background(), token)
+		assert.ErrorIs(t, err, ErrUnauthorized)
+	}
+}
+
+// Store counting the writes, to check what polling costs
+type countingStore struct {
+	store.Store
+	updates int
+}
+
+func (s *countingStore) Update(ctx context.Context, bucket string, fn func(b store.Bucket) error) error {
+	s.updates++
+	return s.Store.Update(ctx, bucket, fn)
+}
+
+func TestRequestJobWithoutJobsWritesNothing(t *testing.T) {
+	dataStore := &countingStore{Store: store.NewMemoryStore()}
+	service := NewService(dataStore, queue.NewStoreQueue(dataStore, triggers.JobQueueName), NewFileLogs(t.TempDir()), testRegistrationToken)
+	runner := registerTestRunner(t, service, "runner-1")
+	dataStore.updates = 0
+
+	spec, err := service.RequestJob(context.Background(), runner)
+	require.NoError(t, err)
+	assert.Nil(t, spec)
+	assert.Zero(t, dataStore.updates)
+}
+
+func TestJobLifecycle(t *testing.T) {
+	ctx := context.Background()
+	service, runs, jobs := newTestService(t)
+	run := startTestRun(t, service, runs, jobs)
+	runner := registerTestRunner(t, service, "runner-1")
+
+	spec, err := service.RequestJob(ctx, runner)
+	require.NoError(t, err)
+	require.NotNil(t, spec)
+	assert.Equal(t, "test", spec.Job)
+	assert.Equal(t, run.Id, spec.RunId)
+	assert.Equal(t, "main", spec.Branch)
+	assert.Len(t, spec.Steps, 2)
+
+	next, err := service.RequestJob(ctx, runner)
+	require.NoError(t, err)
+	assert.Nil(t, next, "build waits for test")
+
+	exitCode := 0
+	require.NoError(t, service.Heartbeat(ctx, runner, HeartbeatRequest{AssignmentId: spec.AssignmentId}))
+	require.NoError(t, service.AppendLog(ctx, runner, spec.AssignmentId, []byte("ok\n")))
+	require.NoError(t, service.UpdateStep(ctx, runner, spec.AssignmentId, StepUpdate{Index: 0, Status: models.StatusSucceeded, ExitCode: &exitCode}))
+
+	stored, err := runs.Get(ctx, run.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusRunning, stored.Status)
+	assert.Equal(t, []models.StepResult{
+		{Name: "unit", Status: models.StatusSucceeded, ExitCode: &exitCode},
+		{Name: "step 2", Status: models.StatusQueued},
+	}, stored.Jobs[0].Steps)
+	assert.Equal(t, runner.Id, stored.Jobs[0].RunnerId)
+
+	require.NoError(t, service.Complete(ctx, runner, spec.AssignmentId, CompleteRequest{Status: models.StatusSucceeded}))
+	assert.ErrorIs(t, service.Complete(ctx, runner, spec.AssignmentId, CompleteRequest{Status: models.StatusSucceeded}), ErrAssignmentLost)
+
+	spec, err = service.RequestJob(ctx, runner)
+	require.NoError(t, err)
+	require.NotNil(t, spec)
+	assert.Equal(t, "build", spec.Job)
+	require.NoError(t, service.Complete(ctx, runner, spec.AssignmentId, CompleteRequest{Status: models.StatusFailed, Error: "exit 1"}))
+
+	stored, err = runs.Get(ctx, run.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusFailed, stored.Status)
+	assert.Equal(t, "exit 1", stored.Jobs[1].Error)
+
+	logs, err := service.Logs().Open(run.Id, "test")
+	require.NoError(t, err)
+	defer logs.Close()
+	content, err := io.ReadAll(logs)
+	require.NoError(t, err)
+	assert.Equal(t, "ok\n", string(content))
+
+	depth, err := jobs.Depth(ctx)
+	require.NoError(t, err)
+	for _, count := range depth {
+		assert.Zero(t, count, "every message was acknowledged")
+	}
+}
+
+// Quarantines the flaky tests reported by the step at index step
+type fakeQuarantine struct {
+	flaky []string
+	step  int
+}
+
+func (f *fakeQuarantine) QuarantinedFailures(ctx context.Context, run *models.Run, job string, step int) ([]string, error) {
+	if step != f.step {
+		return nil, nil
+	}
+	return f.flaky, nil
+}
+
+func TestCompleteQuarantinesFlakyFailures(t *testing.T) {
+	ctx := context.Background()
+	service, runs, jobs := newTestService(t)
+	quarantine := &fakeQuarantine{flaky: []string{"TestLease"}, step: 1}
+	service.QuarantineFlakyTests(quarantine)
+	completed := []models.Status{}
+	service.OnJobCompleted(func(ctx context.Context, run *models.Run, job string) error {
+		for _, finished := range run.Jobs {
+			if finished.Name == job {
+				completed = append(completed, finished.Status)
+			}
+		}
+		return nil
+	})
+	run := startTestRun(t, service, runs, jobs)
+	runner := registerTestRunner(t, service, "runner-1")
+
+	spec, err := service.RequestJob(ctx, runner)
+	require.NoError(t, err)
+	exitCode := 1
+	require.NoError(t, service.UpdateStep(ctx, runner, spec.AssignmentId, StepUpdate{Index: 1, Status: models.StatusFailed, ExitCode: &exitCode}))
+	require.NoError(t, service.Complete(ctx, runner, spec.AssignmentId, CompleteRequest{Status: models.StatusFailed, Error: "unit exited with code 1"}))
+	stored, err := runs.Get(ctx, run.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusSucceeded, stored.Jobs[0].Status)
+	assert.Equal(t, "unit exited with code 1", stored.Jobs[0].Error, "the quarantined failure keeps its error")
+	assert.Equal(t, []string{"TestLease"}, stored.Jobs[0].Quarantined)
+
+	// build failed with no failed step, e.g. on checkout, so its flaky tests do not matter
+	spec, err = service.RequestJob(ctx, runner)
+	require.NoError(t, err)
+	require.Equal(t, "build", spec.Job)
+	require.NoError(t, service.Complete(ctx, runner, spec.AssignmentId, CompleteRequest{Status: models.StatusFailed, Error: "exit 1"}))
+	stored, err = runs.Get(ctx, run.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusFailed, stored.Jobs[1].Status)
+	assert.Equal(t, []models.Status{models.StatusSucceeded, models.StatusFailed}, completed, "hooks see the finished jobs")
+}
+
+func TestCompleteKeepsFailuresBeforeTheLastStep(t *testing.T) {
+	ctx := context.Background()
+	service, runs, jobs := newTestService(t)
+	service.QuarantineFlakyTests(&fakeQuarantine{flaky: []string{"TestLease"}, step: 0})
+	run := startTestRun(t, service, runs, jobs)
+	runner := registerTestRunner(t, service, "runner-1")
+
+	spec, err := service.RequestJob(ctx, runner)
+	require.NoError(t, err)
+	exitCode := 1
+	require.NoError(t, service.UpdateStep(ctx, runner, spec.AssignmentId, StepUpdate{Index: 0, Status: models.StatusFailed, ExitCode: &exitCode}))
+	require.NoError(t, service.Complete(ctx, runner, spec.AssignmentId, CompleteRequest{Status: models.StatusFailed, Error: "unit exited with code 1"}))
+
+	stored, err := runs.Get(ctx, run.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusFailed, stored.Jobs[0].Status, "the steps after the flaky one never ran")
+	assert.Empty(t, stored.Jobs[0].Quarantined)
+	assert.Equal(t, models.StatusSkipped, stored.Jobs[1].Status)
+}
+
+func TestRequestJobDropsDuplicateDeliveries(t *testing.T) {
+	ctx := context.Background()
+	service, runs, jobs := newTestService(t)
+	run := startTestRun(t, service, runs, jobs)
+	runner := registerTestRunner(t, service, "runner-1")
+
+	spec, err := service.RequestJob(ctx, runner)
+	require.NoError(t, err)
+	require.NoError(t, service.Complete(ctx, runner, spec.AssignmentId, CompleteRequest{Status: models.StatusFailed}))
+	require.NoError(t, triggers.EnqueueJob(ctx, jobs, run, "test"))
+
+	spec, err = service.RequestJob(ctx, runner)
+	require.NoError(t, err)
+	assert.Nil(t, spec, "the finished job is not executed twice")
+}
+
+func TestReassignedJobIsLost(t *testing.T) {
+	ctx := context.Background()
+	service, runs, jobs := newTestService(t)
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return current }
+	service.now = clock
+	jobs.SetClock(clock)
+	startTestRun(t, service, runs, jobs)
+	first := registerTestRunner(t, service, "runner-1")
+	second := registerTestRunner(t, service, "runner-2")
+
+	spec, err := service.RequestJob(ctx, first)
+	require.NoError(t, err)
+	// the lease of the first runner expires
+	current = current.Add(service.visibility + time.Second)
+	reassigned, err := service.RequestJob(ctx, second)
+	require.NoError(t, err)
+	require.NotNil(t, reassigned)
+	assert.Equal(t, spec.Job, reassigned.Job)
+
+	assert.ErrorIs(t, service.Heartbeat(ctx, first, HeartbeatRequest{AssignmentId: spec.AssignmentId}), ErrAssignmentLost)
+	assert.ErrorIs(t, service.Complete(ctx, first, spec.AssignmentId, CompleteRequest{Status: models.StatusSucceeded}), ErrAssignmentLost)
+	require.NoError(t, service.Heartbeat(ctx, second, HeartbeatRequest{AssignmentId: reassigned.AssignmentId}))
+	require.NoError(t, service.Complete(ctx, second, reassigned.AssignmentId, CompleteRequest{Status: models.StatusSucceeded}))
+}
+
+func TestRequestJobMatchesRunsOnLabels(t *testing.T) {
+	ctx := context.Background()
+	service, runs, jobs := newTestService(t)
+	definition, err := pipeline.Parse([]byte(`
+name: gpu
+jobs:
+  train:
+    runs-on: [linux, gpu]
+    steps: [{run: make train}]
+`))
+	require.NoError(t, err)
+	p := models.Pipeline{Id: "pipeline-gpu", Url: "https://github.com/some-user/models", Name: "gpu", Definition: *definition}
+	require.NoError(t, service.pipelines.Create(ctx, p))
+	require.NoError(t, triggers.Start(ctx, runs, jobs, triggers.NewRun(p, triggers.TriggerManual, time.Now())))
+
+	cpu := registerTestRunner(t, service, "cpu")
+	spec, err := service.RequestJob(ctx, cpu)
+	require.NoError(t, err)
+	assert.Nil(t, spec, "the runner lacks the gpu label")
+
+	response, err := service.Register(ctx, testRegistrationToken, RegisterRequest{Name: "gpu", Labels: []string{"gpu", "linux", "large"}})
+	require.NoError(t, err)
+	gpu, err := service.Authenticate(ctx, response.Token)
+	require.NoError(t, err)
+	spec, err = service.RequestJob(ctx, gpu)
+	require.NoError(t, err)
+	require.NotNil(t, spec)
+	assert.Equal(t, "train", spec.Job)
+
+	runnerList, err := service.List(ctx)
+	require.NoError(t, err)
+	for _, runner := range runnerList {
+		assert.Equal(t, models.RunnerOnline, runner.Status)
+		if runner.Id == gpu.Id {
+			assert.Equal(t, &models.RunnerJob{AssignmentId: spec.AssignmentId, RunId: spec.RunId, Job: "train"}, runner.CurrentJob)
+		} else {
+			assert.Nil(t, runner.CurrentJob)
+		}
+	}
+}
+
+func TestReapRequeuesJobsOfOfflineRunners(t *testing.T) {
+	ctx := context.Background()
+	service, runs, jobs := newTestService(t)
+	run := startTestRun(t, service, runs, jobs)
+	offline := registerTestRunner(t, service, "offline")
+	online := registerTestRunner(t, service, "online")
+	current := time.Now()
+	service.now = func() time.Time { return current }
+
+	spec, err := service.RequestJob(ctx, offline)
+	require.NoError(t, err)
+	require.NotNil(t, spec)
+	require.NoError(t, service.Reap(ctx))
+	next, err := service.RequestJob(ctx, online)
+	require.NoError(t, err)
+	assert.Nil(t, next, "the runner is still online")
+
+	current = current.Add(DefaultOfflineAfter + time.Second)
+	require.NoError(t, service.Heartbeat(ctx, online, HeartbeatRequest{}))
+	require.NoError(t, service.Reap(ctx))
+
+	runnerList, err := service.List(ctx)
+	require.NoError(t, err)
+	statuses := map[string]models.RunnerStatus{}
+	for _, runner := range runnerList {
+		statuses[runner.Name] = runner.Status
+		assert.Nil(t, runner.CurrentJob)
+	}
+	assert.Equal(t, map[string]models.RunnerStatus{"offline": models.RunnerOffline, "online": models.RunnerOnline}, statuses)
+	stored, err := runs.Get(ctx, run.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusQueued, stored.Jobs[0].Status)
+	assert.Equal(t, "requeued: runner offline went offline", stored.Jobs[0].Error)
+
+	next, err = service.RequestJob(ctx, online)
+	require.NoError(t, err)
+	require.NotNil(t, next, "the job is handed to another runner")
+	assert.Equal(t, spec.Job, next.Job)
+	assert.ErrorIs(t, service.Complete(ctx, offline, spec.AssignmentId, CompleteRequest{Status: models.StatusSucceeded}), ErrAssignmentLost)
+}
+
+func TestReapFailsJobsOutOfAttempts(t *testing.T) {
+	ctx := context.Background()
+	service, runs, jobs := newTestService(t)
+	run := startTestRun(t, service, runs, jobs)
+	current := time.Now()
+	service.now = func() time.Time { return current }
+
+	for attempt := 1; attempt <= queue.DefaultMaxAttempts; attempt++ {
+		runner := registerTestRunner(t, service, fmt.Sprintf("runner-%d", attempt))
+		spec, err := service.RequestJob(ctx, runner)
+		require.NoError(t, err)
+		require.NotNil(t, spec, "attempt %d", attempt)
+		current = current.Add(DefaultOfflineAfter + time.Second)
+		require.NoError(t, service.Reap(ctx))
+	}
+
+	stored, err := runs.Get(ctx, run.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusFailed, stored.Status)
+	assert.Equal(t, "runner runner-3 went offline", stored.Jobs[0].Error)
+	assert.Equal(t, models.StatusSkipped, stored.Jobs[1].Status)
+	deadLetters, err := jobs.DeadLetters(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, deadLetters, "the failed job is acknowledged")
+}
+
+func TestDeregister(t *testing.T) {
+	ctx := context.Background()
+	service, runs, jobs := newTestService(t)
+	run := startTestRun(t, service, runs, jobs)
+	response, err := service.Register(ctx, testRegistrationToken, RegisterRequest{Name: "runner-1"})
+	require.NoError(t, err)
+	runner, err := service.Authenticate(ctx, response.Token)
+	require.NoError(t, err)
+	_, err = service.RequestJob(ctx, runner)
+	require.NoError(t, err)
+
+	require.NoError(t, service.Deregister(ctx, runner.Id))
+	_, err = service.Authenticate(ctx, response.Token)
+	assert.ErrorIs(t, err, ErrUnauthorized, "the token is revoked")
+	assert.ErrorIs(t, service.Deregister(ctx, runner.Id), store.ErrNotFound)
+
+	stored, err := runs.Get(ctx, run.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusQueued, stored.Jobs[0].Status)
+	other := registerTestRunner(t, service, "runner-2")
+	spec, err := service.RequestJob(ctx, other)
+	require.NoError(t, err)
+	assert.NotNil(t, spec)
+}
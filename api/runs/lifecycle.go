@@ -0,0 +1,228 @@
+// Package runs implements the status transitions of runs and their jobs.
+//
+// The functions mutate a run in place and are meant to be called inside
+// store.Runs.Update, so concurrent reports from runners are serialised.
+package runs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"api/models"
+)
+
+// Returned when a report does not apply to the current state of the run
+var ErrInvalidTransition = errors.New("invalid job transition")
+
+func FindJob(run *models.Run, name string) (*models.Job, error) {
+	for i := range run.Jobs {
+		if run.Jobs[i].Name == name {
+			return &run.Jobs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: run %s has no job %s", ErrInvalidTransition, run.Id, name)
+}
+
+// Mark a job as executed by a runner; a job whose runner died may be started again
+func StartJob(run *models.Run, name string, runnerId string, steps []string, now time.Time) error {
+	job, err := FindJob(run, name)
+	if err != nil {
+		return err
+	}
+	if job.Status.IsFinal() {
+		return fmt.Errorf("%w: job %s of run %s is already %s", ErrInvalidTransition, name, run.Id, job.Status)
+	}
+	startedAt := now
+	job.Status = models.StatusRunning
+	job.RunnerId = runnerId
+	job.Error = ""
+	job.StartedAt = &startedAt
+	job.Steps = make([]models.StepResult, 0, len(steps))
+	for _, step := range steps {
+		job.Steps = append(job.Steps, models.StepResult{Name: step, Status: models.StatusQueued})
+	}
+	if run.Status == models.StatusQueued {
+		run.Status = models.StatusRunning
+		run.StartedAt = &startedAt
+	}
+	return nil
+}
+
+// Put back a job whose runner went away, so the next runner starts it afresh
+func RequeueJob(run *models.Run, name string, runnerId string, reason string) error {
+	job, err := FindJob(run, name)
+	if err != nil {
+		return err
+	}
+	if job.Status != models.StatusRunning || job.RunnerId != runnerId {
+		return fmt.Errorf("%w: job %s of run %s is not running on runner %s", ErrInvalidTransition, name, run.Id, runnerId)
+	}
+	job.Status = models.StatusQueued
+	job.RunnerId = ""
+	job.Error = reason
+	job.Steps = nil
+	job.StartedAt = nil
+	return nil
+}
+
+// Record the progress of a step of a running job
+func SetStep(run *models.Run, name string, index int, status models.Status, exitCode *int) error {
+	job, err := FindJob(run, name)
+	if err != nil {
+		return err
+	}
+	if job.Status != models.StatusRunning {
+		return fmt.Errorf("%w: job %s of run %s is %s", ErrInvalidTransition, name, run.Id, job.Status)
+	}
+	if index < 0 || index >= len(job.Steps) {
+		return fmt.Errorf("%w: job %s has no step %d", ErrInvalidTransition, name, index)
+	}
+	job.Steps[index].Status = status
+	job.Steps[index].ExitCode = exitCode
+	return nil
+}
+
+/*
+Record the outcome of a job and settle the rest of the run.
+
+Jobs needing a job that did not succeed are skipped, and the run finishes
+once every job is final.
+
+[IN] run: the run to update
+
+[IN] name: the finished job
+
+[IN] status: final status of the job
+
+[IN] reason: error message, if any
+
+[IN] now: current time
+
+[OUT] []string: jobs whose needs are now all satisfied and must be enqueued
+
+[OUT] error: for error propagation
+*/
+func FinishJob(run *models.Run, name string, status models.Status, reason string, now time.Time) ([]string, error) {
+	job, err := FindJob(run, name)
+	if err != nil {
+		return nil, err
+	}
+	if !status.IsFinal() {
+		return nil, fmt.Errorf("%w: %s is not a final job status", ErrInvalidTransition, status)
+	}
+	if job.Status.IsFinal() {
+		return nil, fmt.Errorf("%w: job %s of run %s is already %s", ErrInvalidTransition, name, run.Id, job.Status)
+	}
+	finishedAt := now
+	job.Status = status
+	job.Error = reason
+	job.FinishedAt = &finishedAt
+
+	ready := []string{}
+	if status == models.StatusSucceeded {
+		ready = readyDependents(run, name)
+	} else {
+		skipDependents(run, name, now)
+	}
+	settleRun(run, now)
+	return ready, nil
+}
+
+// Cancel every unfinished job of a run and finish the run
+func CancelRun(run *models.Run, reason string, now time.Time) error {
+	if run.Status.IsFinal() {
+		return fmt.Errorf("%w: run %s is already %s", ErrInvalidTransition, run.Id, run.Status)
+	}
+	finishedAt := now
+	for i := range run.Jobs {
+		job := &run.Jobs[i]
+		if job.Status.IsFinal() {
+			continue
+		}
+		job.Status = models.StatusCancelled
+		job.Error = reason
+		job.FinishedAt = &finishedAt
+	}
+	run.Status = models.StatusCancelled
+	run.Reason = reason
+	run.FinishedAt = &finishedAt
+	return nil
+}
+
+// Queued jobs needing the given job whose needs all succeeded
+func readyDependents(run *models.Run, name string) []string {
+	statuses := map[string]models.Status{}
+	for _, job := range run.Jobs {
+		statuses[job.Name] = job.Status
+	}
+	ready := []string{}
+	for _, job := range run.Jobs {
+		if job.Status != models.StatusQueued || !contains(job.Needs, name) {
+			continue
+		}
+		satisfied := true
+		for _, need := range job.Needs {
+			satisfied = satisfied && statuses[need] == models.StatusSucceeded
+		}
+		if satisfied {
+			ready = append(ready, job.Name)
+		}
+	}
+	return ready
+}
+
+func skipDependents(run *models.Run, name string, now time.Time) {
+	for i := range run.Jobs {
+		job := &run.Jobs[i]
+		if job.Status == models.StatusQueued && contains(job.Needs, name) {
+			finishedAt := now
+			job.Status = models.StatusSkipped
+			job.Error = fmt.Sprintf("needs %s, which did not succeed", name)
+			job.FinishedAt = &finishedAt
+			skipDependents(run, job.Name, now)
+		}
+	}
+}
+
+// Finish the run once all its jobs are final
+func settleRun(run *models.Run, now time.Time) {
+	status := models.StatusSucceeded
+	for _, job := range run.Jobs {
+		switch job.Status {
+		case models.StatusFailed:
+			status = models.StatusFailed
+		case models.StatusCancelled:
+			if status != models.StatusFailed {
+				status = models.StatusCancelled
+			}
+		case models.StatusSucceeded, models.StatusSkipped:
+		default:
+			return
+		}
+	}
+	finishedAt := now
+	run.Status = status
+	run.FinishedAt = &finishedAt
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Run that executed each job of a run: the run itself, or the one a re-run reused the job from
+func JobSources(run *models.Run) map[string]string {
+	sources := map[string]string{}
+	for _, job := range run.Jobs {
+		sources[job.Name] = run.Id
+		if job.ReusedFrom != "" {
+			sources[job.Name] = job.ReusedFrom
+		}
+	}
+	return sources
+}
@@ -0,0 +1,145 @@
+package runs
+
+import (
+	"testing"
+	"time"
+
+	"api/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testNow = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newTestRun() *models.Run {
+	return &models.Run{
+		Id:     "run-1",
+		Status: models.StatusQueued,
+		Jobs: []models.Job{
+			{Name: "lint", Status: models.StatusQueued},
+			{Name: "test", Status: models.StatusQueued},
+			{Name: "build", Status: models.StatusQueued, Needs: []string{"lint", "test"}},
+			{Name: "deploy", Status: models.StatusQueued, Needs: []string{"build"}},
+		},
+	}
+}
+
+func TestStartJob(t *testing.T) {
+	run := newTestRun()
+	err := StartJob(run, "lint", "runner-1", []string{"vet", "fmt"}, testNow)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusRunning, run.Status)
+	assert.Equal(t, testNow, *run.StartedAt)
+	job, _ := FindJob(run, "lint")
+	assert.Equal(t, models.StatusRunning, job.Status)
+	assert.Equal(t, "runner-1", job.RunnerId)
+	assert.Equal(t, []models.StepResult{
+		{Name: "vet", Status: models.StatusQueued},
+		{Name: "fmt", Status: models.StatusQueued},
+	}, job.Steps)
+
+	exitCode := 0
+	require.NoError(t, SetStep(run, "lint", 1, models.StatusSucceeded, &exitCode))
+	assert.Equal(t, models.StatusSucceeded, job.Steps[1].Status)
+	assert.ErrorIs(t, SetStep(run, "lint", 2, models.StatusSucceeded, &exitCode), ErrInvalidTransition)
+	assert.ErrorIs(t, SetStep(run, "test", 0, models.StatusSucceeded, &exitCode), ErrInvalidTransition)
+	assert.ErrorIs(t, StartJob(run, "unknown", "runner-1", nil, testNow), ErrInvalidTransition)
+}
+
+func TestFinishJobEnqueuesDependentsOnceAllNeedsSucceeded(t *testing.T) {
+	run := newTestRun()
+	for _, name := range []string{"lint", "test"} {
+		require.NoError(t, StartJob(run, name, "runner-1", nil, testNow))
+	}
+
+	ready, err := FinishJob(run, "lint", models.StatusSucceeded, "", testNow)
+	require.NoError(t, err)
+	assert.Empty(t, ready)
+
+	ready, err = FinishJob(run, "test", models.StatusSucceeded, "", testNow)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"build"}, ready)
+	assert.Equal(t, models.StatusRunning, run.Status)
+
+	_, err = FinishJob(run, "test", models.StatusSucceeded, "", testNow)
+	assert.ErrorIs(t, err, ErrInvalidTransition, "a job finishes only once")
+}
+
+func TestFinishJobSettlesRun(t *testing.T) {
+	examples := []struct {
+		name        string
+		status      models.Status
+		runStatus   models.Status
+		buildStatus models.Status
+	}{
+		{name: "failure skips dependents", status: models.StatusFailed, runStatus: models.StatusFailed, buildStatus: models.StatusSkipped},
+		{name: "cancellation skips dependents", status: models.StatusCancelled, runStatus: models.StatusCancelled, buildStatus: models.StatusSkipped},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			run := newTestRun()
+			require.NoError(t, StartJob(run, "lint", "runner-1", nil, testNow))
+			require.NoError(t, StartJob(run, "test", "runner-1", nil, testNow))
+			_, err := FinishJob(run, "lint", example.status, "boom", testNow)
+			require.NoError(t, err)
+			assert.Nil(t, run.FinishedAt, "test is still running")
+
+			_, err = FinishJob(run, "test", models.StatusSucceeded, "", testNow)
+			require.NoError(t, err)
+			build, _ := FindJob(run, "build")
+			deploy, _ := FindJob(run, "deploy")
+			assert.Equal(t, example.buildStatus, build.Status)
+			assert.Equal(t, models.StatusSkipped, deploy.Status, "skips are transitive")
+			assert.Equal(t, example.runStatus, run.Status)
+			assert.Equal(t, testNow, *run.FinishedAt)
+		})
+	}
+}
+
+func TestFinishJobRejectsNonFinalStatus(t *testing.T) {
+	run := newTestRun()
+	require.NoError(t, StartJob(run, "lint", "runner-1", nil, testNow))
+	_, err := FinishJob(run, "lint", models.StatusRunning, "", testNow)
+	assert.ErrorIs(t, err, ErrInvalidTransition)
+}
+
+func TestRequeueJob(t *testing.T) {
+	run := newTestRun()
+	require.NoError(t, StartJob(run, "lint", "runner-1", []string{"vet"}, testNow))
+	assert.ErrorIs(t, RequeueJob(run, "lint", "runner-2", "gone"), ErrInvalidTransition, "only the runner's own job")
+	assert.ErrorIs(t, RequeueJob(run, "test", "runner-1", "gone"), ErrInvalidTransition, "only running jobs")
+
+	require.NoError(t, RequeueJob(run, "lint", "runner-1", "gone"))
+	job, _ := FindJob(run, "lint")
+	assert.Equal(t, models.Job{Name: "lint", Status: models.StatusQueued, Error: "gone"}, *job)
+	require.NoError(t, StartJob(run, "lint", "runner-2", []string{"vet"}, testNow))
+	assert.Empty(t, job.Error)
+}
+
+func TestCancelRun(t *testing.T) {
+	run := newTestRun()
+	require.NoError(t, StartJob(run, "lint", "runner-1", nil, testNow))
+	_, err := FinishJob(run, "lint", models.StatusSucceeded, "", testNow)
+	require.NoError(t, err)
+	require.NoError(t, StartJob(run, "test", "runner-1", nil, testNow))
+
+	require.NoError(t, CancelRun(run, "superseded", testNow))
+	assert.Equal(t, models.StatusCancelled, run.Status)
+	assert.Equal(t, "superseded", run.Reason)
+	assert.Equal(t, testNow, *run.FinishedAt)
+	statuses := []models.Status{}
+	for _, job := range run.Jobs {
+		statuses = append(statuses, job.Status)
+	}
+	assert.Equal(t, []models.Status{models.StatusSucceeded, models.StatusCancelled, models.StatusCancelled, models.StatusCancelled}, statuses)
+
+	assert.ErrorIs(t, CancelRun(run, "again", testNow), ErrInvalidTransition)
+	_, err = FinishJob(run, "test", models.StatusSucceeded, "", testNow)
+	assert.ErrorIs(t, err, ErrInvalidTransition, "late reports of cancelled jobs are rejected")
+}
+
+func TestJobSources(t *testing.T) {
+	run := &models.Run{Id: "run-2", Jobs: []models.Job{{Name: "lint", ReusedFrom: "run-1"}, {Name: "test"}}}
+	assert.Equal(t, map[string]string{"lint": "run-1", "test": "run-2"}, JobSources(run))
+}
@@ -0,0 +1,262 @@
+// Package scheduler starts pipeline runs on the cron schedules of their definitions.
+//
+// Every API replica runs a scheduler, but only the holder of the scheduler
+// lease fires runs. The last fire time of each schedule is also advanced
+// atomically in the store, so a run is never fired twice even when a lease
+// expires in the middle of a tick.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"api/logger"
+	"api/models"
+	"api/pipeline"
+	"api/queue"
+	"api/store"
+	"api/triggers"
+)
+
+const (
+	TriggerSchedule string = "schedule"
+	SchedulesBucket string = "schedules"
+	leaseName       string = "scheduler"
+)
+
+// How often due schedules are checked; the lease outlives a few missed ticks
+const (
+	DefaultInterval time.Duration = 15 * time.Second
+	leaseTTLFactor  int64         = 3
+)
+
+// Schedule of a pipeline and when it fires
+type Entry struct {
+	PipelineId   string     `json:"pipelineId"`
+	PipelineName string     `json:"pipelineName"`
+	Cron         string     `json:"cron"`
+	Timezone     string     `json:"timezone,omitempty"`
+	LastFiredAt  *time.Time `json:"lastFiredAt,omitempty"`
+	NextFireAt   *time.Time `json:"nextFireAt,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// Persisted progress of a single schedule
+type scheduleState struct {
+	// Changing the expression restarts the schedule from the time of the change
+	Cron     string `json:"cron"`
+	Timezone string `json:"timezone"`
+	// Occurrences after this time are due
+	Since       time.Time  `json:"since"`
+	LastFiredAt *time.Time `json:"lastFiredAt,omitempty"`
+}
+
+type Scheduler struct {
+	store     store.Store
+	pipelines *store.Pipelines
+	runs      *store.Runs
+	jobs      queue.Queue
+	holder    string
+	interval  time.Duration
+	now       func() time.Time
+}
+
+/*
+Create a scheduler.
+
+[IN] s: store shared by the API replicas
+
+[IN] jobs: queue receiving the jobs of the scheduled runs
+
+[IN] holder: unique identifier of this replica, used for the lease
+
+[OUT] *Scheduler: a scheduler; call Run to start it
+*/
+func New(s store.Store, jobs queue.Queue, holder string) *Scheduler {
+	return &Scheduler{
+		store:     s,
+		pipelines: store.NewPipelines(s),
+		runs:      store.NewRuns(s),
+		jobs:      jobs,
+		holder:    holder,
+		interval:  DefaultInterval,
+		now:       time.Now,
+	}
+}
+
+// Fire due schedules until the context is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	log := logger.FromContext(ctx)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	defer func() {
+		err := store.ReleaseLease(context.Background(), s.store, leaseName, s.holder)
+		if err != nil {
+			log.Warnf("Failed to release the scheduler lease: %v", err)
+		}
+	}()
+
+	for {
+		_, err := s.Tick(ctx)
+		if err != nil {
+			log.Errorf("Scheduler tick failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Create the runs of every due schedule, if this replica holds the lease
+func (s *Scheduler) Tick(ctx context.Context) ([]models.Run, error) {
+	now := s.now()
+	acquired, err := store.AcquireLease(ctx, s.store, leaseName, s.holder, s.interval*time.Duration(leaseTTLFactor), now)
+	if err != nil {
+		return nil, fmt.Errorf("unable to acquire the scheduler lease: %w", err)
+	}
+	if !acquired {
+		return nil, nil
+	}
+
+	pipelineList, err := s.pipelines.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list pipelines: %w", err)
+	}
+	log := logger.FromContext(ctx)
+	runList := []models.Run{}
+	for _, p := range pipelineList {
+		for i, schedule := range p.Definition.On.Schedule {
+			run, err := s.fire(ctx, p, i, schedule, now)
+			// a broken schedule must not hold back the others
+			if err != nil {
+				log.Errorf("Failed to fire schedule %d of pipeline %s: %v", i, p.Id, err)
+				continue
+			}
+			if run != nil {
+				runList = append(runList, *run)
+			}
+		}
+	}
+	return runList, nil
+}
+
+// Claim the latest missed fire time of a schedule and create its run; the claim is undone when the run cannot be created
+func (s *Scheduler) fire(ctx context.Context, p models.Pipeline, index int, schedule pipeline.Schedule, now time.Time) (*models.Run, error) {
+	log := logger.FromContext(ctx)
+	due := time.Time{}
+	var previous scheduleState
+	err := s.store.Update(ctx, SchedulesBucket, func(b store.Bucket) error {
+		state, err := store.Decode[scheduleState](b, scheduleKey(p.Id, index))
+		if errors.Is(err, store.ErrNotFound) || (err == nil && (state.Cron != schedule.Cron || state.Timezone != schedule.Timezone)) {
+			// new schedules start now rather than firing for the past
+			return putState(b, p.Id, index, scheduleState{Cron: schedule.Cron, Timezone: schedule.Timezone, Since: now})
+		}
+		if err != nil {
+			return err
+		}
+		next, err := schedule.Next(state.Since)
+		if err != nil {
+			return err
+		}
+		if next.After(now) {
+			return nil
+		}
+		// after a downtime, fire once for all the missed occurrences
+		for {
+			following, err := schedule.Next(next)
+			if err != nil {
+				return err
+			}
+			if following.After(now) {
+				break
+			}
+			next = following
+		}
+		previous = *state
+		due = next
+		state.Since = next
+		state.LastFiredAt = &due
+		return putState(b, p.Id, index, *state)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to update schedule %d of pipeline %s: %w", index, p.Id, err)
+	}
+	if due.IsZero() {
+		return nil, nil
+	}
+
+	run := triggers.NewRun(p, TriggerSchedule, now)
+	err = triggers.Start(ctx, s.runs, s.jobs, run)
+	if err != nil {
+		// the next tick fires it again
+		restoreErr := s.unclaim(ctx, p.Id, index, due, previous)
+		if restoreErr != nil {
+			log.Errorf("Unable to restore schedule %d of pipeline %s, the run due at %s is lost: %v", index, p.Id, due.Format(time.RFC3339), restoreErr)
+		}
+		return nil, fmt.Errorf("unable to create the scheduled run of pipeline %s: %w", p.Id, err)
+	}
+	log.Infof("Created run %s of pipeline %s scheduled at %s", run.Id, p.Id, due.Format(time.RFC3339))
+	return &run, nil
+}
+
+// Put back the state of a schedule before its claim of the due time, unless another claim replaced it since
+func (s *Scheduler) unclaim(ctx context.Context, pipelineId string, index int, due time.Time, previous scheduleState) error {
+	return s.store.Update(ctx, SchedulesBucket, func(b store.Bucket) error {
+		state, err := store.Decode[scheduleState](b, scheduleKey(pipelineId, index))
+		if err != nil {
+			return err
+		}
+		if !state.Since.Equal(due) {
+			return nil
+		}
+		return putState(b, pipelineId, index, previous)
+	})
+}
+
+// List every schedule with its next fire time
+func (s *Scheduler) Entries(ctx context.Context) ([]Entry, error) {
+	pipelineList, err := s.pipelines.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list pipelines: %w", err)
+	}
+	now := s.now()
+	entries := []Entry{}
+	for _, p := range pipelineList {
+		for i, schedule := range p.Definition.On.Schedule {
+			entry := Entry{
+				PipelineId:   p.Id,
+				PipelineName: p.Name,
+				Cron:         schedule.Cron,
+				Timezone:     schedule.Timezone,
+			}
+			after := now
+			state, err := store.Get[scheduleState](ctx, s.store, SchedulesBucket, scheduleKey(p.Id, i))
+			if err == nil && state.Cron == schedule.Cron && state.Timezone == schedule.Timezone {
+				entry.LastFiredAt = state.LastFiredAt
+				after = state.Since
+			} else if err != nil && !errors.Is(err, store.ErrNotFound) {
+				return nil, err
+			}
+			next, err := schedule.Next(after)
+			if err != nil {
+				entry.Error = err.Error()
+			} else {
+				entry.NextFireAt = &next
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func scheduleKey(pipelineId string, index int) string {
+	return fmt.Sprintf("%s.%d", pipelineId, index)
+}
+
+func putState(b store.Bucket, pipelineId string, index int, state scheduleState) error {
+	return store.Encode(b, scheduleKey(pipelineId, index), state)
+}
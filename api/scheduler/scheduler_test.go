@@ -0,0 +1,209 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"api/models"
+	"api/pipeline"
+	"api/queue"
+	"api/store"
+	"api/triggers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	current time.Time
+}
+
+func (f *fakeClock) now() time.Time {
+	return f.current
+}
+
+func newTestScheduler(dataStore store.Store, holder string, clock *fakeClock) *Scheduler {
+	sched := New(dataStore, queue.NewStoreQueue(dataStore, triggers.JobQueueName), holder)
+	sched.now = clock.now
+	return sched
+}
+
+func createScheduledPipeline(t *testing.T, dataStore store.Store, schedules ...pipeline.Schedule) {
+	definition, err := pipeline.Parse([]byte("name: nightly\njobs: {build: {steps: [{run: make}]}}"))
+	require.NoError(t, err)
+	definition.On.Schedule = schedules
+	require.NoError(t, definition.Validate())
+	err = store.NewPipelines(dataStore).Create(context.Background(), models.Pipeline{
+		Id:         "nightly",
+		Name:       definition.Name,
+		Definition: *definition,
+	})
+	require.NoError(t, err)
+}
+
+func TestSchedulerFiresDueSchedules(t *testing.T) {
+	ctx := context.Background()
+	dataStore := store.NewMemoryStore()
+	createScheduledPipeline(t, dataStore, pipeline.Schedule{Cron: "0 3 * * *", Timezone: "Europe/Berlin"})
+	clock := &fakeClock{current: time.Date(2024, 3, 1, 1, 0, 0, 0, time.UTC)}
+	sched := newTestScheduler(dataStore, "replica-1", clock)
+
+	runList, err := sched.Tick(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, runList)
+
+	entries, err := sched.Entries(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Nil(t, entries[0].LastFiredAt)
+	// 03:00 in Berlin is 02:00 UTC in winter
+	assert.Equal(t, time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC), entries[0].NextFireAt.UTC())
+
+	clock.current = time.Date(2024, 3, 1, 2, 0, 30, 0, time.UTC)
+	runList, err = sched.Tick(ctx)
+	require.NoError(t, err)
+	require.Len(t, runList, 1)
+	assert.Equal(t, TriggerSchedule, runList[0].Trigger)
+	assert.Equal(t, models.StatusQueued, runList[0].Status)
+
+	runList, err = sched.Tick(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, runList)
+
+	entries, err = sched.Entries(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC), entries[0].LastFiredAt.UTC())
+	assert.Equal(t, time.Date(2024, 3, 2, 2, 0, 0, 0, time.UTC), entries[0].NextFireAt.UTC())
+}
+
+func TestSchedulerFiresOnceAfterDowntime(t *testing.T) {
+	ctx := context.Background()
+	dataStore := store.NewMemoryStore()
+	createScheduledPipeline(t, dataStore, pipeline.Schedule{Cron: "*/5 * * * *"})
+	clock := &fakeClock{current: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}
+	sched := newTestScheduler(dataStore, "replica-1", clock)
+	_, err := sched.Tick(ctx)
+	require.NoError(t, err)
+
+	clock.current = clock.current.Add(time.Hour + time.Minute)
+	runList, err := sched.Tick(ctx)
+	require.NoError(t, err)
+	assert.Len(t, runList, 1)
+
+	entries, err := sched.Entries(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 1, 1, 0, 0, 0, time.UTC), entries[0].LastFiredAt.UTC())
+}
+
+func TestSchedulerLeaseAvoidsDuplicates(t *testing.T) {
+	ctx := context.Background()
+	dataStore := store.NewMemoryStore()
+	createScheduledPipeline(t, dataStore, pipeline.Schedule{Cron: "@hourly"})
+	clock := &fakeClock{current: time.Date(2024, 3, 1, 0, 59, 50, 0, time.UTC)}
+	first := newTestScheduler(dataStore, "replica-1", clock)
+	second := newTestScheduler(dataStore, "replica-2", clock)
+
+	_, err := first.Tick(ctx)
+	require.NoError(t, err)
+	clock.current = time.Date(2024, 3, 1, 1, 0, 10, 0, time.UTC)
+
+	runList, err := second.Tick(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, runList, "the lease is held by the first replica")
+	runList, err = first.Tick(ctx)
+	require.NoError(t, err)
+	assert.Len(t, runList, 1)
+
+	// the second replica takes over once the lease expires, without firing again
+	clock.current = clock.current.Add(time.Duration(leaseTTLFactor) * DefaultInterval)
+	runList, err = second.Tick(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, runList)
+
+	runs, err := store.NewRuns(dataStore).List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, runs, 1)
+}
+
+// Queue refusing new messages while failing is set
+type failingQueue struct {
+	queue.Queue
+	failing bool
+}
+
+func (f *failingQueue) Enqueue(ctx context.Context, payload any, options queue.EnqueueOptions) (*queue.Message, error) {
+	if f.failing {
+		return nil, errors.New("queue unavailable")
+	}
+	return f.Queue.Enqueue(ctx, payload, options)
+}
+
+func TestSchedulerRetriesFailedRuns(t *testing.T) {
+	ctx := context.Background()
+	dataStore := store.NewMemoryStore()
+	createScheduledPipeline(t, dataStore, pipeline.Schedule{Cron: "@hourly"})
+	clock := &fakeClock{current: time.Date(2024, 3, 1, 0, 30, 0, 0, time.UTC)}
+	sched := newTestScheduler(dataStore, "replica-1", clock)
+	jobs := &failingQueue{Queue: sched.jobs, failing: true}
+	sched.jobs = jobs
+	_, err := sched.Tick(ctx)
+	require.NoError(t, err)
+
+	clock.current = time.Date(2024, 3, 1, 1, 0, 10, 0, time.UTC)
+	runList, err := sched.Tick(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, runList)
+	entries, err := sched.Entries(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, entries[0].LastFiredAt, "the due time is not claimed by a run that failed to start")
+
+	jobs.failing = false
+	runList, err = sched.Tick(ctx)
+	require.NoError(t, err)
+	assert.Len(t, runList, 1)
+	entries, err = sched.Entries(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 1, 1, 0, 0, 0, time.UTC), entries[0].LastFiredAt.UTC())
+}
+
+func TestSchedulerSkipsSchedulesThatNeverFire(t *testing.T) {
+	ctx := context.Background()
+	dataStore := store.NewMemoryStore()
+	createScheduledPipeline(t, dataStore, pipeline.Schedule{Cron: "@hourly"})
+	// stored before such expressions were rejected
+	pipelines := store.NewPipelines(dataStore)
+	require.NoError(t, pipelines.Create(ctx, models.Pipeline{
+		Id:         "broken",
+		Name:       "broken",
+		Definition: pipeline.Definition{Name: "broken", On: pipeline.Triggers{Schedule: []pipeline.Schedule{{Cron: "0 0 30 2 *"}}}},
+	}))
+	clock := &fakeClock{current: time.Date(2024, 3, 1, 0, 30, 0, 0, time.UTC)}
+	sched := newTestScheduler(dataStore, "replica-1", clock)
+	_, err := sched.Tick(ctx)
+	require.NoError(t, err)
+
+	clock.current = time.Date(2024, 3, 1, 1, 0, 10, 0, time.UTC)
+	done := make(chan []models.Run)
+	go func() {
+		runList, err := sched.Tick(ctx)
+		assert.NoError(t, err)
+		done <- runList
+	}()
+	select {
+	case runList := <-done:
+		require.Len(t, runList, 1, "the other schedules still fire")
+		assert.Equal(t, "nightly", runList[0].PipelineId)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the tick never returned")
+	}
+
+	entries, err := sched.Entries(ctx)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		if entry.PipelineId == "broken" {
+			assert.Contains(t, entry.Error, "never fires")
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"sort"
+	"strings"
+)
+
+// Replaces the secrets in job logs
+const Mask string = "***"
+
+// Derived forms of a secret shorter than this are not masked, as they would hide unrelated output
+const minVariantLength int = 4
+
+// Masks secret values in log output, along with their lines and base64 encodings
+type Masker struct {
+	// longest first, so a secret containing another is masked whole
+	patterns [][]byte
+}
+
+/*
+Create a masker for secret values.
+
+Besides the values themselves, each line of a multi-line value and the
+standard and URL-safe base64 encodings of the value are masked, the latter at
+every alignment, so the secret is hidden even inside a longer encoded blob.
+
+[IN] values: the secrets, by name
+
+[OUT] *Masker: the masker
+*/
+func NewMasker(values map[string]string) *Masker {
+	unique := map[string]bool{}
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		unique[value] = true
+		variants := []string{}
+		if strings.Contains(value, "\n") {
+			for _, line := range strings.Split(value, "\n") {
+				variants = append(variants, strings.TrimSpace(line))
+			}
+		}
+		variants = append(variants, base64Variants(value)...)
+		for _, variant := range variants {
+			if len(variant) >= minVariantLength {
+				unique[variant] = true
+			}
+		}
+	}
+	masker := &Masker{}
+	for pattern := range unique {
+		masker.patterns = append(masker.patterns, []byte(pattern))
+	}
+	sort.Slice(masker.patterns, func(i, j int) bool {
+		if len(masker.patterns[i]) != len(masker.patterns[j]) {
+			return len(masker.patterns[i]) > len(masker.patterns[j])
+		}
+		return bytes.Compare(masker.patterns[i], masker.patterns[j]) < 0
+	})
+	return masker
+}
+
+// The characters of the base64 encodings of value that only depend on it, for each of the 3 alignments it can have in a longer input
+func base64Variants(value string) []string {
+	variants := []string{}
+	for offset := 0; offset < 3; offset++ {
+		input := append(make([]byte, offset), value...)
+		// characters encoding the padding bytes, or the bytes that would follow, are left out
+		start := (offset*8 + 5) / 6
+		end := len(input) * 8 / 6
+		if end <= start {
+			continue
+		}
+		for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding} {
+			variants = append(variants, encoding.EncodeToString(input)[start:end])
+		}
+	}
+	return variants
+}
+
+// Replace the secrets in data with Mask
+func (m *Masker) Mask(data []byte) []byte {
+	for _, pattern := range m.patterns {
+		if bytes.Contains(data, pattern) {
+			data = bytes.ReplaceAll(data, pattern, []byte(Mask))
+		}
+	}
+	return data
+}
+
+// Length of the end of data that may be the beginning of a secret, to hold back until more output comes
+func (m *Masker) Partial(data []byte) int {
+	longest := 0
+	for _, pattern := range m.patterns {
+		for length := min(len(pattern)-1, len(data)); length > longest; length-- {
+			if bytes.HasPrefix(pattern, data[len(data)-length:]) {
+				longest = length
+				break
+			}
+		}
+	}
+	return longest
+}
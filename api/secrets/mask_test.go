@@ -0,0 +1,41 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMask(t *testing.T) {
+	masker := NewMasker(map[string]string{
+		"TOKEN":   "s3cr3t-value",
+		"KEY":     "line one\nline two",
+		"PREFIX":  "s3cr3t",
+		"IGNORED": "",
+	})
+	examples := []struct {
+		name   string
+		output string
+		masked string
+	}{
+		{name: "value", output: "token=s3cr3t-value\n", masked: "token=***\n"},
+		{name: "contained value", output: "s3cr3t and s3cr3t-value", masked: "*** and ***"},
+		{name: "lines", output: "got line two", masked: "got ***"},
+		{name: "base64", output: "auth: " + base64.StdEncoding.EncodeToString([]byte("s3cr3t-value")), masked: "auth: ***"},
+		{name: "embedded base64", output: base64.StdEncoding.EncodeToString([]byte("user:s3cr3t-value")), masked: "dXNlcjp***U="},
+		{name: "unrelated", output: "nothing to hide", masked: "nothing to hide"},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			assert.Equal(t, example.masked, string(masker.Mask([]byte(example.output))))
+		})
+	}
+}
+
+func TestPartial(t *testing.T) {
+	masker := NewMasker(map[string]string{"TOKEN": "s3cr3t-value"})
+	assert.Equal(t, 4, masker.Partial([]byte("token=s3cr")))
+	assert.Equal(t, 0, masker.Partial([]byte("token=")))
+	assert.Equal(t, 0, NewMasker(nil).Partial([]byte("s3cr")))
+}
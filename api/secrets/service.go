@@ -0,0 +1,279 @@
+// Package secrets keeps the secrets injected into the environment of jobs,
+// encrypted with AES-GCM under a master key the API reads from its environment.
+//
+// Secrets belong to an organisation, a repository or a pipeline. A job sees
+// those of its organisation, overridden by those of its repository, in turn
+// overridden by those of its pipeline. Values are never returned by the API
+// and are masked in job logs.
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"api/logger"
+	"api/models"
+	"api/store"
+)
+
+const SecretsBucket string = "secrets"
+
+const (
+	// Length of the master key, selecting AES-256
+	KeyBytes int = 32
+	// Larger values are rejected
+	MaxValueBytes int = 48 << 10
+)
+
+// Invalid name or value
+var ErrInvalidSecret = errors.New("invalid secret")
+
+// Secrets are exposed to jobs as environment variables
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// A secret as stored, with its sealed value
+type record struct {
+	models.Secret
+	// Nonce followed by the AES-GCM ciphertext
+	Value []byte `json:"value"`
+}
+
+type Service struct {
+	store     store.Store
+	pipelines *store.Pipelines
+	aead      cipher.AEAD
+	now       func() time.Time
+}
+
+// Decode a base64 master key of KeyBytes bytes
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("the master key is not valid base64: %w", err)
+	}
+	if len(key) != KeyBytes {
+		return nil, fmt.Errorf("the master key holds %d bytes instead of %d", len(key), KeyBytes)
+	}
+	return key, nil
+}
+
+/*
+Create the secrets service.
+
+[IN] s: store holding the sealed secrets
+
+[IN] key: master key of KeyBytes bytes; changing it makes the stored secrets unreadable
+
+[OUT] *Service: the secrets service
+
+[OUT] error: when the key is invalid
+*/
+func NewService(s store.Store, key []byte) (*Service, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid master key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Service{
+		store:     s,
+		pipelines: store.NewPipelines(s),
+		aead:      aead,
+		now:       time.Now,
+	}, nil
+}
+
+func recordKey(scope models.SecretScope, scopeId, name string) string {
+	return string(scope) + "/" + scopeId + "/" + name
+}
+
+/*
+Create or replace a secret.
+
+[IN] ctx: request context
+
+[IN] scope: what the secret is shared with
+
+[IN] scopeId: organisation, owner/repo or pipeline id
+
+[IN] name: environment variable holding the secret in jobs
+
+[IN] value: the secret
+
+[OUT] *models.Secret: the secret, without its value
+
+[OUT] error: ErrInvalidSecret for invalid names and values, store.ErrNotFound for unknown pipelines
+*/
+func (s *Service) Put(ctx context.Context, scope models.SecretScope, scopeId, name, value string) (*models.Secret, error) {
+	err := validate(name, value)
+	if err != nil {
+		return nil, err
+	}
+	err = s.checkScope(ctx, scope, scopeId)
+	if err != nil {
+		return nil, err
+	}
+	key := recordKey(scope, scopeId, name)
+	nonce := make([]byte, s.aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate a nonce: %w", err)
+	}
+	// the key is authenticated so a sealed value cannot be moved to another secret
+	sealed := s.aead.Seal(nonce, nonce, []byte(value), []byte(key))
+	now := s.now().UTC()
+	var secret models.Secret
+	err = s.store.Update(ctx, SecretsBucket, func(b store.Bucket) error {
+		existing, err := store.Decode[record](b, key)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		secret = models.Secret{Name: name, Scope: scope, ScopeId: scopeId, CreatedAt: now, UpdatedAt: now}
+		if existing != nil {
+			secret.CreatedAt = existing.CreatedAt
+		}
+		return store.Encode(b, key, record{Secret: secret, Value: sealed})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to store secret %s: %w", name, err)
+	}
+	logger.FromContext(ctx).Infof("Stored secret %s of %s %s", name, scope, scopeId)
+	return &secret, nil
+}
+
+// Secrets of a scope, sorted by name and without their values
+func (s *Service) List(ctx context.Context, scope models.SecretScope, scopeId string) ([]models.Secret, error) {
+	err := s.checkScope(ctx, scope, scopeId)
+	if err != nil {
+		return nil, err
+	}
+	records, err := store.List[record](ctx, s.store, SecretsBucket)
+	if err != nil {
+		return nil, err
+	}
+	secrets := []models.Secret{}
+	for _, r := range records {
+		if r.Scope == scope && r.ScopeId == scopeId {
+			secrets = append(secrets, r.Secret)
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Name < secrets[j].Name
+	})
+	return secrets, nil
+}
+
+// Delete a secret; store.ErrNotFound when it does not exist
+func (s *Service) Delete(ctx context.Context, scope models.SecretScope, scopeId, name string) error {
+	err := store.Delete(ctx, s.store, SecretsBucket, recordKey(scope, scopeId, name))
+	if err != nil {
+		return err
+	}
+	logger.FromContext(ctx).Infof("Deleted secret %s of %s %s", name, scope, scopeId)
+	return nil
+}
+
+/*
+Decrypt the secrets a pipeline sees, by environment variable name.
+
+[IN] ctx: request context
+
+[IN] p: the pipeline
+
+[OUT] map[string]string: values of the secrets of its organisation, repository and itself, the narrowest scope winning
+
+[OUT] error: also when a secret cannot be decrypted, e.g. after the master key changed
+*/
+func (s *Service) Resolve(ctx context.Context, p *models.Pipeline) (map[string]string, error) {
+	organisation, repository := p.Repository()
+	// broadest scope first, so narrower ones override it
+	scopes := []struct {
+		scope   models.SecretScope
+		scopeId string
+	}{
+		{scope: models.SecretScopeOrganisation, scopeId: organisation},
+		{scope: models.SecretScopeRepository, scopeId: repository},
+		{scope: models.SecretScopePipeline, scopeId: p.Id},
+	}
+	records, err := store.List[record](ctx, s.store, SecretsBucket)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for _, scope := range scopes {
+		if scope.scopeId == "" {
+			continue
+		}
+		for _, r := range records {
+			if r.Scope != scope.scope || r.ScopeId != scope.scopeId {
+				continue
+			}
+			value, err := s.open(r)
+			if err != nil {
+				return nil, err
+			}
+			values[r.Name] = value
+		}
+	}
+	return values, nil
+}
+
+func (s *Service) open(r record) (string, error) {
+	nonceSize := s.aead.NonceSize()
+	if len(r.Value) < nonceSize {
+		return "", fmt.Errorf("secret %s of %s %s is corrupted", r.Name, r.Scope, r.ScopeId)
+	}
+	value, err := s.aead.Open(nil, r.Value[:nonceSize], r.Value[nonceSize:], []byte(recordKey(r.Scope, r.ScopeId, r.Name)))
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt secret %s of %s %s: %w", r.Name, r.Scope, r.ScopeId, err)
+	}
+	return string(value), nil
+}
+
+// Pipelines must exist; organisations and repositories are only checked for their format
+func (s *Service) checkScope(ctx context.Context, scope models.SecretScope, scopeId string) error {
+	switch scope {
+	case models.SecretScopePipeline:
+		_, err := s.pipelines.Get(ctx, scopeId)
+		return err
+	case models.SecretScopeOrganisation:
+		if scopeId == "" || strings.Contains(scopeId, "/") {
+			return fmt.Errorf("%w: invalid organisation %q", ErrInvalidSecret, scopeId)
+		}
+	case models.SecretScopeRepository:
+		owner, repo, found := strings.Cut(scopeId, "/")
+		if !found || owner == "" || repo == "" || strings.Contains(repo, "/") {
+			return fmt.Errorf("%w: invalid repository %q, expected owner/repo", ErrInvalidSecret, scopeId)
+		}
+	default:
+		return fmt.Errorf("%w: unknown scope %q", ErrInvalidSecret, scope)
+	}
+	return nil
+}
+
+func validate(name, value string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("%w: %q is not a valid environment variable name", ErrInvalidSecret, name)
+	}
+	if name == "CI" || strings.HasPrefix(strings.ToUpper(name), "AETERNUM_") {
+		return fmt.Errorf("%w: %s is reserved for the runner", ErrInvalidSecret, name)
+	}
+	if value == "" {
+		return fmt.Errorf("%w: the value of %s is empty", ErrInvalidSecret, name)
+	}
+	if len(value) > MaxValueBytes {
+		return fmt.Errorf("%w: the value of %s is larger than %d bytes", ErrInvalidSecret, name, MaxValueBytes)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"api/models"
+	"api/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestService(t *testing.T, dataStore store.Store) *Service {
+	service, err := NewService(dataStore, bytes.Repeat([]byte{7}, KeyBytes))
+	require.NoError(t, err)
+	service.now = func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+	return service
+}
+
+func newTestStore(t *testing.T) store.Store {
+	dataStore := store.NewMemoryStore()
+	require.NoError(t, store.NewPipelines(dataStore).Create(context.Background(), models.Pipeline{
+		Id:  "pipeline-1",
+		Url: "https://github.com/some-user/my-project",
+	}))
+	return dataStore
+}
+
+func TestParseKey(t *testing.T) {
+	key, err := ParseKey(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, KeyBytes)) + "\n")
+	require.NoError(t, err)
+	assert.Len(t, key, KeyBytes)
+
+	_, err = ParseKey("not base64")
+	assert.Error(t, err)
+	_, err = ParseKey(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.Error(t, err)
+}
+
+func TestPutListDelete(t *testing.T) {
+	ctx := context.Background()
+	dataStore := newTestStore(t)
+	service := newTestService(t, dataStore)
+
+	secret, err := service.Put(ctx, models.SecretScopeRepository, "some-user/my-project", "DEPLOY_TOKEN", "hunter2")
+	require.NoError(t, err)
+	assert.Equal(t, models.Secret{
+		Name:      "DEPLOY_TOKEN",
+		Scope:     models.SecretScopeRepository,
+		ScopeId:   "some-user/my-project",
+		CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, *secret)
+	service.now = func() time.Time { return time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC) }
+	secret, err = service.Put(ctx, models.SecretScopeRepository, "some-user/my-project", "DEPLOY_TOKEN", "hunter3")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), secret.CreatedAt, "replacing a secret keeps its creation date")
+	_, err = service.Put(ctx, models.SecretScopeRepository, "some-user/my-project", "API_KEY", "abc")
+	require.NoError(t, err)
+
+	secretList, err := service.List(ctx, models.SecretScopeRepository, "some-user/my-project")
+	require.NoError(t, err)
+	require.Len(t, secretList, 2)
+	assert.Equal(t, "API_KEY", secretList[0].Name)
+	assert.Equal(t, "DEPLOY_TOKEN", secretList[1].Name)
+
+	// values are sealed in the store
+	records, err := store.List[record](ctx, dataStore, SecretsBucket)
+	require.NoError(t, err)
+	for _, r := range records {
+		assert.NotContains(t, string(r.Value), "hunter")
+	}
+
+	require.NoError(t, service.Delete(ctx, models.SecretScopeRepository, "some-user/my-project", "API_KEY"))
+	assert.ErrorIs(t, service.Delete(ctx, models.SecretScopeRepository, "some-user/my-project", "API_KEY"), store.ErrNotFound)
+}
+
+func TestPutRejections(t *testing.T) {
+	service := newTestService(t, newTestStore(t))
+	examples := []struct {
+		name    string
+		scope   models.SecretScope
+		scopeId string
+		secret  string
+		value   string
+		err     error
+	}{
+		{name: "invalid name", scope: models.SecretScopeOrganisation, scopeId: "some-user", secret: "1TOKEN", value: "x", err: ErrInvalidSecret},
+		{name: "reserved name", scope: models.SecretScopeOrganisation, scopeId: "some-user", secret: "AETERNUM_JOB", value: "x", err: ErrInvalidSecret},
+		{name: "empty value", scope: models.SecretScopeOrganisation, scopeId: "some-user", secret: "TOKEN", err: ErrInvalidSecret},
+		{name: "large value", scope: models.SecretScopeOrganisation, scopeId: "some-user", secret: "TOKEN", value: strings.Repeat("x", MaxValueBytes+1), err: ErrInvalidSecret},
+		{name: "invalid repository", scope: models.SecretScopeRepository, scopeId: "my-project", secret: "TOKEN", value: "x", err: ErrInvalidSecret},
+		{name: "unknown pipeline", scope: models.SecretScopePipeline, scopeId: "pipeline-2", secret: "TOKEN", value: "x", err: store.ErrNotFound},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			_, err := service.Put(context.Background(), example.scope, example.scopeId, example.secret, example.value)
+			assert.ErrorIs(t, err, example.err)
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+	dataStore := newTestStore(t)
+	service := newTestService(t, dataStore)
+	secrets := []struct {
+		scope   models.SecretScope
+		scopeId string
+		name    string
+		value   string
+	}{
+		{scope: models.SecretScopePipeline, scopeId: "pipeline-1", name: "TOKEN", value: "pipeline"},
+		{scope: models.SecretScopeRepository, scopeId: "some-user/my-project", name: "TOKEN", value: "repository"},
+		{scope: models.SecretScopeRepository, scopeId: "some-user/my-project", name: "REGISTRY", value: "repository"},
+		{scope: models.SecretScopeOrganisation, scopeId: "some-user", name: "REGISTRY", value: "organisation"},
+		{scope: models.SecretScopeOrganisation, scopeId: "some-user", name: "SLACK_URL", value: "organisation"},
+		{scope: models.SecretScopeOrganisation, scopeId: "other-user", name: "OTHER", value: "other"},
+	}
+	for _, secret := range secrets {
+		_, err := service.Put(ctx, secret.scope, secret.scopeId, secret.name, secret.value)
+		require.NoError(t, err)
+	}
+
+	p := models.Pipeline{Id: "pipeline-1", Url: "https://github.com/some-user/my-project.git"}
+	values, err := service.Resolve(ctx, &p)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"TOKEN": "pipeline", "REGISTRY": "repository", "SLACK_URL": "organisation"}, values)
+
+	// another master key cannot open the secrets
+	other, err := NewService(dataStore, bytes.Repeat([]byte{8}, KeyBytes))
+	require.NoError(t, err)
+	_, err = other.Resolve(ctx, &p)
+	assert.Error(t, err)
+}
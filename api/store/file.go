@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store persisted as one JSON document per bucket inside a directory.
+// Buckets are guarded by a lock file, so several processes may share the
+// directory, e.g. API replicas mounting the same volume.
+type FileStore struct {
+	dir string
+
+	mu    sync.Mutex
+	locks map[string]*sync.RWMutex
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the data directory %s: %w", dir, err)
+	}
+	return &FileStore{dir: dir, locks: map[string]*sync.RWMutex{}}, nil
+}
+
+func (s *FileStore) View(ctx context.Context, bucket string, fn func(b Bucket) error) error {
+	err := validateBucketName(bucket)
+	if err != nil {
+		return err
+	}
+	lock := s.bucketLock(bucket)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	unlock, err := lockFile(s.path(bucket)+".lock", false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	contents, err := s.read(bucket)
+	if err != nil {
+		return err
+	}
+	return fn(contents)
+}
+
+func (s *FileStore) Update(ctx context.Context, bucket string, fn func(b Bucket) error) error {
+	err := validateBucketName(bucket)
+	if err != nil {
+		return err
+	}
+	lock := s.bucketLock(bucket)
+	lock.Lock()
+	defer lock.Unlock()
+
+	unlock, err := lockFile(s.path(bucket)+".lock", true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	contents, err := s.read(bucket)
+	if err != nil {
+		return err
+	}
+	err = fn(contents)
+	if err != nil {
+		return err
+	}
+	return s.write(bucket, contents)
+}
+
+func (s *FileStore) path(bucket string) string {
+	return filepath.Join(s.dir, bucket+".json")
+}
+
+// Locks serialising goroutines of this process; the lock file handles other processes
+func (s *FileStore) bucketLock(bucket string) *sync.RWMutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lock, ok := s.locks[bucket]
+	if !ok {
+		lock = &sync.RWMutex{}
+		s.locks[bucket] = lock
+	}
+	return lock
+}
+
+func (s *FileStore) read(bucket string) (records, error) {
+	contents := records{}
+	data, err := os.ReadFile(s.path(bucket))
+	if errors.Is(err, os.ErrNotExist) {
+		return contents, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read bucket %s: %w", bucket, err)
+	}
+
+	raw := map[string]json.RawMessage{}
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse bucket %s: %w", bucket, err)
+	}
+	for key, value := range raw {
+		contents[key] = value
+	}
+	return contents, nil
+}
+
+// Replace the bucket file atomically so readers never see a partial write
+func (s *FileStore) write(bucket string, contents records) error {
+	raw := make(map[string]json.RawMessage, len(contents))
+	for key, value := range contents {
+		raw[key] = value
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("unable to encode bucket %s: %w", bucket, err)
+	}
+
+	temp, err := os.CreateTemp(s.dir, "."+bucket+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to write bucket %s: %w", bucket, err)
+	}
+	_, err = temp.Write(data)
+	if err == nil {
+		err = temp.Sync()
+	}
+	closeErr := temp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), s.path(bucket))
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return fmt.Errorf("unable to write bucket %s: %w", bucket, err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Decode the record stored under key
+func Get[T any](ctx context.Context, s Store, bucket, key string) (*T, error) {
+	var record *T
+	err := s.View(ctx, bucket, func(b Bucket) error {
+		var err error
+		record, err = Decode[T](b, key)
+		return err
+	})
+	return record, err
+}
+
+// Encode and store the record under key, replacing any previous value
+func Put[T any](ctx context.Context, s Store, bucket, key string, record T) error {
+	return s.Update(ctx, bucket, func(b Bucket) error {
+		return Encode(b, key, record)
+	})
+}
+
+// Store the record under key, failing if the key is already taken
+func Insert[T any](ctx context.Context, s Store, bucket, key string, record T) error {
+	return s.Update(ctx, bucket, func(b Bucket) error {
+		if _, exists := b.Get(key); exists {
+			return fmt.Errorf("record %s already exists in %s", key, bucket)
+		}
+		return Encode(b, key, record)
+	})
+}
+
+func Delete(ctx context.Context, s Store, bucket, key string) error {
+	return s.Update(ctx, bucket, func(b Bucket) error {
+		if _, exists := b.Get(key); !exists {
+			return fmt.Errorf("%w: %s in %s", ErrNotFound, key, bucket)
+		}
+		b.Delete(key)
+		return nil
+	})
+}
+
+// Decode every record of the bucket, ordered by key
+func List[T any](ctx context.Context, s Store, bucket string) ([]T, error) {
+	recordList := []T{}
+	err := s.View(ctx, bucket, func(b Bucket) error {
+		for _, key := range b.Keys() {
+			record, err := Decode[T](b, key)
+			if err != nil {
+				return err
+			}
+			recordList = append(recordList, *record)
+		}
+		return nil
+	})
+	return recordList, err
+}
+
+// Atomically apply fn to the record stored under key and store the result
+func Modify[T any](ctx context.Context, s Store, bucket, key string, fn func(record *T) error) (*T, error) {
+	var record *T
+	err := s.Update(ctx, bucket, func(b Bucket) error {
+		var err error
+		record, err = Decode[T](b, key)
+		if err != nil {
+			return err
+		}
+		err = fn(record)
+		if err != nil {
+			return err
+		}
+		return Encode(b, key, *record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Decode the record stored under key inside a transaction
+func Decode[T any](b Bucket, key string) (*T, error) {
+	value, ok := b.Get(key)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	record := new(T)
+	err := json.Unmarshal(value, record)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode record %s: %w", key, err)
+	}
+	return record, nil
+}
+
+func Encode[T any](b Bucket, key string, record T) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("unable to encode record %s: %w", key, err)
+	}
+	b.Put(key, value)
+	return nil
+}
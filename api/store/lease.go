@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+const LeasesBucket string = "leases"
+
+// Time-bound ownership of a task shared by several API replicas
+type Lease struct {
+	Name      string    `json:"name"`
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+/*
+Acquire or renew a named lease.
+
+[IN] name: the leased task
+
+[IN] holder: unique identifier of the caller, e.g. one per API replica
+
+[IN] ttl: how long the lease is held without renewal
+
+[IN] now: current time
+
+[OUT] bool: true if the caller holds the lease until now + ttl
+
+[OUT] error: for error propagation
+*/
+func AcquireLease(ctx context.Context, s Store, name, holder string, ttl time.Duration, now time.Time) (bool, error) {
+	acquired := false
+	err := s.Update(ctx, LeasesBucket, func(b Bucket) error {
+		current, err := Decode[Lease](b, name)
+		if err == nil && current.Holder != holder && now.Before(current.ExpiresAt) {
+			return nil
+		}
+		acquired = true
+		return Encode(b, name, Lease{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)})
+	})
+	if err != nil {
+		return false, err
+	}
+	return acquired, nil
+}
+
+// Give up a lease so another holder can take it without waiting for it to expire
+func ReleaseLease(ctx context.Context, s Store, name, holder string) error {
+	return s.Update(ctx, LeasesBucket, func(b Bucket) error {
+		current, err := Decode[Lease](b, name)
+		if err == nil && current.Holder == holder {
+			b.Delete(name)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"sync"
+)
+
+// Store kept in process memory; used in tests and single-replica local runs
+type MemoryStore struct {
+	mu      sync.RWMutex
+	buckets map[string]records
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]records{}}
+}
+
+func (s *MemoryStore) View(ctx context.Context, bucket string, fn func(b Bucket) error) error {
+	err := validateBucketName(bucket)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	contents := s.buckets[bucket]
+	if contents == nil {
+		contents = records{}
+	}
+	return fn(contents)
+}
+
+func (s *MemoryStore) Update(ctx context.Context, bucket string, fn func(b Bucket) error) error {
+	err := validateBucketName(bucket)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	contents := s.buckets[bucket].clone()
+	err = fn(contents)
+	if err != nil {
+		return err
+	}
+	s.buckets[bucket] = contents
+	return nil
+}
@@ -0,0 +1,33 @@
+package store
+
+import (
+	"context"
+
+	"api/models"
+)
+
+const (
+	PipelinesBucket string = "pipelines"
+	RunsBucket      string = "runs"
+)
+
+// Pipeline definitions registered in the API
+type Pipelines struct {
+	store Store
+}
+
+func NewPipelines(s Store) *Pipelines {
+	return &Pipelines{store: s}
+}
+
+func (p *Pipelines) Create(ctx context.Context, pipeline models.Pipeline) error {
+	return Insert(ctx, p.store, PipelinesBucket, pipeline.Id, pipeline)
+}
+
+func (p *Pipelines) Get(ctx context.Context, id string) (*models.Pipeline, error) {
+	return Get[models.Pipeline](ctx, p.store, PipelinesBucket, id)
+}
+
+func (p *Pipelines) List(ctx context.Context) ([]models.Pipeline, error) {
+	return List[models.Pipeline](ctx, p.store, PipelinesBucket)
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+
+	"api/models"
+)
+
+const (
+	RunnersBucket      string = "runners"
+	RunnerTokensBucket string = "runner-tokens"
+)
+
+// Runners registered with the API
+type Runners struct {
+	store Store
+}
+
+func NewRunners(s Store) *Runners {
+	return &Runners{store: s}
+}
+
+// Register a runner along with the hash of its authentication token
+func (r *Runners) Create(ctx context.Context, runner models.Runner, tokenHash string) error {
+	err := Insert(ctx, r.store, RunnerTokensBucket, tokenHash, runner.Id)
+	if err != nil {
+		return err
+	}
+	return Insert(ctx, r.store, RunnersBucket, runner.Id, runner)
+}
+
+func (r *Runners) Get(ctx context.Context, id string) (*models.Runner, error) {
+	return Get[models.Runner](ctx, r.store, RunnersBucket, id)
+}
+
+// Find the runner owning a token
+func (r *Runners) GetByTokenHash(ctx context.Context, tokenHash string) (*models.Runner, error) {
+	id, err := Get[string](ctx, r.store, RunnerTokensBucket, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	return r.Get(ctx, *id)
+}
+
+func (r *Runners) Update(ctx context.Context, id string, fn func(runner *models.Runner) error) (*models.Runner, error) {
+	return Modify(ctx, r.store, RunnersBucket, id, fn)
+}
+
+func (r *Runners) List(ctx context.Context) ([]models.Runner, error) {
+	return List[models.Runner](ctx, r.store, RunnersBucket)
+}
+
+// Remove a runner and revoke its tokens
+func (r *Runners) Delete(ctx context.Context, id string) error {
+	err := r.store.Update(ctx, RunnerTokensBucket, func(b Bucket) error {
+		for _, tokenHash := range b.Keys() {
+			owner, err := Decode[string](b, tokenHash)
+			if err != nil {
+				return err
+			}
+			if *owner == id {
+				b.Delete(tokenHash)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return Delete(ctx, r.store, RunnersBucket, id)
+}
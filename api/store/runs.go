@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"sort"
+
+	"api/models"
+)
+
+// Executions of the registered pipelines
+type Runs struct {
+	store Store
+}
+
+func NewRuns(s Store) *Runs {
+	return &Runs{store: s}
+}
+
+func (r *Runs) Create(ctx context.Context, run models.Run) error {
+	return Insert(ctx, r.store, RunsBucket, run.Id, run)
+}
+
+func (r *Runs) Get(ctx context.Context, id string) (*models.Run, error) {
+	return Get[models.Run](ctx, r.store, RunsBucket, id)
+}
+
+// Atomically change a run, e.g. to move it to another status
+func (r *Runs) Update(ctx context.Context, id string, fn func(run *models.Run) error) (*models.Run, error) {
+	return Modify(ctx, r.store, RunsBucket, id, fn)
+}
+
+func (r *Runs) List(ctx context.Context) ([]models.Run, error) {
+	return List[models.Run](ctx, r.store, RunsBucket)
+}
+
+// Runs of a pipeline, most recent first
+func (r *Runs) ListByPipeline(ctx context.Context, pipelineId string) ([]models.Run, error) {
+	runList, err := r.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pipelineRuns := []models.Run{}
+	for _, run := range runList {
+		if run.PipelineId == pipelineId {
+			pipelineRuns = append(pipelineRuns, run)
+		}
+	}
+	sort.SliceStable(pipelineRuns, func(i, j int) bool {
+		return pipelineRuns[i].CreatedAt.After(pipelineRuns[j].CreatedAt)
+	})
+	return pipelineRuns, nil
+}
@@ -0,0 +1,75 @@
+// Package store provides the key-value persistence shared by the API subsystems.
+//
+// Records are grouped in buckets and encoded as JSON. Every bucket is updated
+// atomically, so read-modify-write cycles are safe across goroutines and, for
+// the file implementation, across API replicas sharing the same data directory.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+var ErrNotFound = errors.New("record not found")
+
+var bucketNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Access to the records of a single bucket inside a transaction
+type Bucket interface {
+	// Returns the raw JSON of the record and whether it exists
+	Get(key string) ([]byte, bool)
+	Put(key string, value []byte)
+	Delete(key string)
+	// Returns every key of the bucket in ascending order
+	Keys() []string
+}
+
+type Store interface {
+	// Read-only access to a bucket
+	View(ctx context.Context, bucket string, fn func(b Bucket) error) error
+	// Atomic read-modify-write of a bucket; changes are discarded if fn returns an error
+	Update(ctx context.Context, bucket string, fn func(b Bucket) error) error
+}
+
+func validateBucketName(bucket string) error {
+	if !bucketNameRegex.MatchString(bucket) {
+		return fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	return nil
+}
+
+// In-memory contents of a bucket, shared by both implementations
+type records map[string][]byte
+
+func (r records) Get(key string) ([]byte, bool) {
+	value, ok := r[key]
+	return value, ok
+}
+
+func (r records) Put(key string, value []byte) {
+	r[key] = value
+}
+
+func (r records) Delete(key string) {
+	delete(r, key)
+}
+
+func (r records) Keys() []string {
+	keys := make([]string, 0, len(r))
+	for key := range r {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (r records) clone() records {
+	copied := make(records, len(r))
+	for key, value := range r {
+		copied[key] = value
+	}
+	return copied
+}
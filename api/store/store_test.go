@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type counter struct {
+	Value int `json:"value"`
+}
+
+func newStores(t *testing.T) map[string]Store {
+	fileStore, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	return map[string]Store{
+		"memory": NewMemoryStore(),
+		"file":   fileStore,
+	}
+}
+
+func TestStoreRecords(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, Put(ctx, s, "counters", "b", counter{Value: 2}))
+			require.NoError(t, Insert(ctx, s, "counters", "a", counter{Value: 1}))
+			assert.ErrorContains(t, Insert(ctx, s, "counters", "a", counter{}), "already exists")
+
+			record, err := Get[counter](ctx, s, "counters", "a")
+			require.NoError(t, err)
+			assert.Equal(t, 1, record.Value)
+
+			recordList, err := List[counter](ctx, s, "counters")
+			require.NoError(t, err)
+			assert.Equal(t, []counter{{Value: 1}, {Value: 2}}, recordList)
+
+			require.NoError(t, Delete(ctx, s, "counters", "a"))
+			_, err = Get[counter](ctx, s, "counters", "a")
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, Delete(ctx, s, "counters", "a"), ErrNotFound)
+		})
+	}
+}
+
+func TestStoreDiscardsFailedUpdates(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, Put(ctx, s, "counters", "a", counter{Value: 1}))
+			err := s.Update(ctx, "counters", func(b Bucket) error {
+				b.Put("a", []byte(`{"value":5}`))
+				b.Delete("a")
+				return fmt.Errorf("boom")
+			})
+			assert.ErrorContains(t, err, "boom")
+
+			record, err := Get[counter](ctx, s, "counters", "a")
+			require.NoError(t, err)
+			assert.Equal(t, 1, record.Value)
+		})
+	}
+}
+
+func TestStoreConcurrentModify(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range newStores(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, Put(ctx, s, "counters", "a", counter{}))
+			wg := sync.WaitGroup{}
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := Modify(ctx, s, "counters", "a", func(c *counter) error {
+						c.Value++
+						return nil
+					})
+					assert.NoError(t, err)
+				}()
+			}
+			wg.Wait()
+
+			record, err := Get[counter](ctx, s, "counters", "a")
+			require.NoError(t, err)
+			assert.Equal(t, 20, record.Value)
+		})
+	}
+}
+
+func TestFileStoreSharedDirectory(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	first, err := NewFileStore(dir)
+	require.NoError(t, err)
+	second, err := NewFileStore(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, Put(ctx, first, "counters", "a", counter{Value: 7}))
+	record, err := Get[counter](ctx, second, "counters", "a")
+	require.NoError(t, err)
+	assert.Equal(t, 7, record.Value)
+}
+
+func TestInvalidBucketName(t *testing.T) {
+	examples := []string{"", "Upper", "../escape", "with space"}
+	for _, bucket := range examples {
+		for name, s := range newStores(t) {
+			err := s.View(context.Background(), bucket, func(b Bucket) error { return nil })
+			assert.ErrorContains(t, err, "invalid bucket name", "%s store, bucket %q", name, bucket)
+		}
+	}
+}
+
+func TestLease(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	acquired, err := AcquireLease(ctx, s, "task", "a", time.Minute, now)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = AcquireLease(ctx, s, "task", "b", time.Minute, now.Add(30*time.Second))
+	require.NoError(t, err)
+	assert.False(t, acquired, "held by a")
+
+	acquired, err = AcquireLease(ctx, s, "task", "a", time.Minute, now.Add(50*time.Second))
+	require.NoError(t, err)
+	assert.True(t, acquired, "renewed by a")
+
+	acquired, err = AcquireLease(ctx, s, "task", "b", time.Minute, now.Add(90*time.Second))
+	require.NoError(t, err)
+	assert.False(t, acquired, "renewal extended the lease")
+
+	require.NoError(t, ReleaseLease(ctx, s, "task", "a"))
+	acquired, err = AcquireLease(ctx, s, "task", "b", time.Minute, now.Add(90*time.Second))
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
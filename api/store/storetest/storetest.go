@@ -0,0 +1,27 @@
+// Package storetest provides the fixtures shared by the tests of the services built on the store.
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"api/models"
+	"api/store"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Time the services under test see as now
+var Now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Memory store holding pipeline-1, named api, of https://github.com/some-user/my-project
+func NewStore(t *testing.T) store.Store {
+	dataStore := store.NewMemoryStore()
+	require.NoError(t, store.NewPipelines(dataStore).Create(context.Background(), models.Pipeline{
+		Id:   "pipeline-1",
+		Url:  "https://github.com/some-user/my-project",
+		Name: "api",
+	}))
+	return dataStore
+}
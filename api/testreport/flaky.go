@@ -0,0 +1,195 @@
+package testreport
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"api/models"
+	"api/store"
+)
+
+const (
+	// Recent runs of a pipeline analysed for flaky tests
+	DefaultFlakyWindow int = 50
+	MaxFlakyWindow     int = 500
+	// Tests flipping at least this often are flaky even without a commit on which they both passed and failed
+	MinFlakeRate float64 = 0.2
+	// A single flip is a test that broke or got fixed
+	minFlips int = 2
+)
+
+// A test of a pipeline job
+type testId struct {
+	job  string
+	pkg  string
+	name string
+}
+
+/*
+Find the flaky tests of a pipeline.
+
+A test is flaky when it both passed and failed on the same commit, e.g. in a
+re-run, or when it flipped between passed and failed on at least MinFlakeRate
+of its consecutive results. Skipped results and package failures are ignored.
+
+[IN] ctx: request context
+
+[IN] pipelineId: the pipeline
+
+[IN] window: number of recent runs analysed; DefaultFlakyWindow when 0
+
+[OUT] []models.FlakyTest: flaky tests, highest flake rate first
+
+[OUT] error: for error propagation
+*/
+func (s *Service) FlakyTests(ctx context.Context, pipelineId string, window int) ([]models.FlakyTest, error) {
+	return s.flakyTests(ctx, pipelineId, window, "")
+}
+
+// Flaky tests of the runs before excludedRunId, so a run is judged on its history only
+func (s *Service) flakyTests(ctx context.Context, pipelineId string, window int, excludedRunId string) ([]models.FlakyTest, error) {
+	if window <= 0 {
+		window = DefaultFlakyWindow
+	}
+	p, err := s.pipelines.Get(ctx, pipelineId)
+	if err != nil {
+		return nil, err
+	}
+	runList, err := s.runs.ListByPipeline(ctx, pipelineId)
+	if err != nil {
+		return nil, err
+	}
+	// oldest first, so results are compared in the order they happened
+	analysed := map[string]int{}
+	commits := map[string]string{}
+	for _, run := range runList {
+		if run.Id == excludedRunId {
+			continue
+		}
+		if len(analysed) == window {
+			break
+		}
+		analysed[run.Id] = window - len(analysed)
+		commits[run.Id] = run.CommitSha
+	}
+	reports, err := store.List[models.TestReport](ctx, s.store, ReportsBucket)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(reports, func(i, j int) bool {
+		a, b := reports[i], reports[j]
+		if analysed[a.RunId] != analysed[b.RunId] {
+			return analysed[a.RunId] < analysed[b.RunId]
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+
+	histories := map[testId][]models.TestResult{}
+	order := []testId{}
+	for _, report := range reports {
+		if _, ok := analysed[report.RunId]; !ok {
+			continue
+		}
+		for _, result := range report.Results {
+			if result.Name == "" || result.Status == models.TestSkipped {
+				continue
+			}
+			id := testId{job: result.Job, pkg: result.Package, name: result.Name}
+			if histories[id] == nil {
+				order = append(order, id)
+			}
+			histories[id] = append(histories[id], result)
+		}
+	}
+
+	flaky := []models.FlakyTest{}
+	for _, id := range order {
+		test := analyse(id, histories[id], commits)
+		if len(test.Commits) == 0 && (test.Flips < minFlips || test.FlakeRate < MinFlakeRate) {
+			continue
+		}
+		test.Quarantined = p.Definition.QuarantineFlakyTests
+		flaky = append(flaky, test)
+	}
+	sort.SliceStable(flaky, func(i, j int) bool {
+		return flaky[i].FlakeRate > flaky[j].FlakeRate
+	})
+	return flaky, nil
+}
+
+func analyse(id testId, history []models.TestResult, commits map[string]string) models.FlakyTest {
+	test := models.FlakyTest{Job: id.job, Package: id.pkg, Name: id.name, Results: len(history)}
+	// statuses seen on each commit
+	outcomes := map[string]map[models.TestStatus]bool{}
+	for i, result := range history {
+		if result.Status == models.TestFailed {
+			test.Failures++
+		}
+		if i > 0 && result.Status != history[i-1].Status {
+			test.Flips++
+		}
+		commit := commits[result.RunId]
+		if commit == "" {
+			continue
+		}
+		if outcomes[commit] == nil {
+			outcomes[commit] = map[models.TestStatus]bool{}
+		}
+		outcomes[commit][result.Status] = true
+		if len(outcomes[commit]) == 2 && !slices.Contains(test.Commits, commit) {
+			test.Commits = append(test.Commits, commit)
+		}
+	}
+	if len(history) > 1 {
+		test.FlakeRate = float64(test.Flips) / float64(len(history)-1)
+	}
+	return test
+}
+
+/*
+Failed tests of a job, when all of them are flaky, were reported by the step that
+failed and its pipeline quarantines flaky tests.
+
+[IN] ctx: request context
+
+[IN] run: run of the job
+
+[IN] job: the failed job
+
+[IN] step: index of the step that failed
+
+[OUT] []string: names of the quarantined failures; empty when the failure stands
+
+[OUT] error: for error propagation
+*/
+func (s *Service) QuarantinedFailures(ctx context.Context, run *models.Run, job string, step int) ([]string, error) {
+	p, err := s.pipelines.Get(ctx, run.PipelineId)
+	if err != nil || !p.Definition.QuarantineFlakyTests {
+		return nil, err
+	}
+	failures, err := s.List(ctx, run.Id, Filter{Job: job, Status: models.TestFailed})
+	if err != nil || len(failures) == 0 {
+		return nil, err
+	}
+	flakyList, err := s.flakyTests(ctx, run.PipelineId, 0, run.Id)
+	if err != nil {
+		return nil, err
+	}
+	flaky := map[testId]bool{}
+	for _, test := range flakyList {
+		flaky[testId{job: test.Job, pkg: test.Package, name: test.Name}] = true
+	}
+	names := []string{}
+	for _, failure := range failures {
+		// a build or deploy step failing after the tests ran is no flake
+		if failure.Step == nil || *failure.Step != step {
+			return nil, nil
+		}
+		if !flaky[testId{job: failure.Job, pkg: failure.Package, name: failure.Name}] {
+			return nil, nil
+		}
+		names = append(names, failure.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,108 @@
+package testreport
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"api/models"
+	"api/pipeline"
+	"api/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Record a run of pipeline-1 on the commit, with one go test -json report per job
+// Index of the step writing the reports of recordRun
+var testStep = 1
+
+func recordRun(t *testing.T, service *Service, runs *store.Runs, runId string, created time.Time, commit string, jobs map[string]string) *models.Run {
+	ctx := context.Background()
+	run := models.Run{Id: runId, PipelineId: "pipeline-1", CommitSha: commit, CreatedAt: created}
+	for job := range jobs {
+		run.Jobs = append(run.Jobs, models.Job{Name: job})
+	}
+	require.NoError(t, runs.Create(ctx, run))
+	for job, report := range jobs {
+		_, err := service.Ingest(ctx, runId, job, "report.json", &testStep, strings.NewReader(report))
+		require.NoError(t, err)
+	}
+	return &run
+}
+
+func goTestEvents(statuses ...string) string {
+	report := ""
+	for i, status := range statuses {
+		report += fmt.Sprintf("{\"Action\":%q,\"Package\":\"api\",\"Test\":\"Test%c\"}\n", status, 'A'+i)
+	}
+	return report
+}
+
+func TestFlakyTests(t *testing.T) {
+	service, runs := newTestService(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// TestA always passes, TestB fails then passes on the same commit, TestC alternates
+	// and TestD broke once for good
+	history := [][]string{
+		{"pass", "fail", "pass", "pass"},
+		{"pass", "pass", "pass", "pass"},
+		{"pass", "pass", "fail", "pass"},
+		{"pass", "pass", "pass", "fail"},
+		{"pass", "pass", "fail", "fail"},
+	}
+	for i, statuses := range history {
+		commit := fmt.Sprintf("commit-%d", i)
+		if i == 1 {
+			commit = "commit-0"
+		}
+		recordRun(t, service, runs, fmt.Sprintf("run-%d", i), start.Add(time.Duration(i)*time.Hour), commit, map[string]string{"unit": goTestEvents(statuses...)})
+	}
+
+	flaky, err := service.FlakyTests(context.Background(), "pipeline-1", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []models.FlakyTest{
+		{Job: "unit", Package: "api", Name: "TestC", Results: 5, Failures: 2, Flips: 3, FlakeRate: 0.75},
+		{Job: "unit", Package: "api", Name: "TestB", Results: 5, Failures: 1, Flips: 1, FlakeRate: 0.25, Commits: []string{"commit-0"}},
+	}, flaky)
+
+	// the last two runs only: TestC flipped once, TestB never failed
+	recent, err := service.FlakyTests(context.Background(), "pipeline-1", 2)
+	require.NoError(t, err)
+	assert.Empty(t, recent)
+}
+
+func TestQuarantinedFailures(t *testing.T) {
+	ctx := context.Background()
+	service, runs := newTestService(t)
+	_, err := store.Modify(ctx, service.store, store.PipelinesBucket, "pipeline-1", func(p *models.Pipeline) error {
+		p.Definition = pipeline.Definition{Name: "api", QuarantineFlakyTests: true}
+		return nil
+	})
+	require.NoError(t, err)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	recordRun(t, service, runs, "run-1", start, "commit-1", map[string]string{"unit": goTestEvents("fail", "pass")})
+	recordRun(t, service, runs, "run-2", start.Add(time.Hour), "commit-1", map[string]string{"unit": goTestEvents("pass", "pass")})
+
+	examples := []struct {
+		name        string
+		report      string
+		failedStep  int
+		quarantined []string
+	}{
+		{name: "only flaky failures", report: goTestEvents("fail", "pass"), failedStep: testStep, quarantined: []string{"TestA"}},
+		{name: "another failure", report: goTestEvents("fail", "fail"), failedStep: testStep},
+		{name: "no failure", report: goTestEvents("pass", "pass"), failedStep: testStep},
+		{name: "another step failed", report: goTestEvents("fail", "pass"), failedStep: testStep + 1},
+	}
+	for i, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			run := recordRun(t, service, runs, fmt.Sprintf("run-%d", i+3), start.Add(time.Duration(i+2)*time.Hour), "commit-2", map[string]string{"unit": example.report})
+			quarantined, err := service.QuarantinedFailures(ctx, run, "unit", example.failedStep)
+			require.NoError(t, err)
+			assert.Equal(t, example.quarantined, quarantined)
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package testreport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"api/models"
+)
+
+// Messages keep their end, where test failures are usually explained
+const maxMessageLength int = 4096
+
+/*
+Parse a test report, telling JUnit XML from `go test -json` output by its first character.
+
+Only the package, name, status, duration and message of the results are set.
+
+[IN] content: the report
+
+[OUT] []models.TestResult: results in the order of the report
+
+[OUT] error: ErrInvalidReport when the report is neither format
+*/
+func Parse(content io.Reader) ([]models.TestResult, error) {
+	reader := bufio.NewReader(content)
+	for {
+		next, err := reader.Peek(1)
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w: the report is empty", ErrInvalidReport)
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch next[0] {
+		case ' ', '\t', '\r', '\n':
+			reader.Discard(1)
+		case 0xef:
+			// UTF-8 byte order mark
+			reader.Discard(3)
+		case '<':
+			return parseJUnit(reader)
+		case '{':
+			return parseGoTest(reader)
+		default:
+			return nil, fmt.Errorf("%w: expected JUnit XML or go test -json output", ErrInvalidReport)
+		}
+	}
+}
+
+type junitSuites struct {
+	Suites []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name   string       `xml:"name,attr"`
+	Cases  []junitCase  `xml:"testcase"`
+	Suites []junitSuite `xml:"testsuite"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Error     *junitMessage `xml:"error"`
+	Skipped   *junitMessage `xml:"skipped"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// Root element <testsuites> or a single <testsuite>, possibly nesting other suites
+func parseJUnit(content io.Reader) ([]models.TestResult, error) {
+	decoder := xml.NewDecoder(content)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidReport, err)
+		}
+		root, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		suites := junitSuites{}
+		switch root.Name.Local {
+		case "testsuites":
+			err = decoder.DecodeElement(&suites, &root)
+		case "testsuite":
+			suites.Suites = make([]junitSuite, 1)
+			err = decoder.DecodeElement(&suites.Suites[0], &root)
+		default:
+			return nil, fmt.Errorf("%w: unexpected JUnit element <%s>", ErrInvalidReport, root.Name.Local)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidReport, err)
+		}
+		results := []models.TestResult{}
+		for _, suite := range suites.Suites {
+			results = suite.appendResults(results)
+		}
+		return results, nil
+	}
+}
+
+func (s junitSuite) appendResults(results []models.TestResult) []models.TestResult {
+	for _, testCase := range s.Cases {
+		result := models.TestResult{
+			Package: testCase.Classname,
+			Name:    testCase.Name,
+			Status:  models.TestPassed,
+		}
+		if result.Package == "" {
+			result.Package = s.Name
+		}
+		result.Duration, _ = strconv.ParseFloat(strings.ReplaceAll(testCase.Time, ",", ""), 64)
+		switch {
+		case testCase.Failure != nil:
+			result.Status, result.Message = models.TestFailed, testCase.Failure.String()
+		case testCase.Error != nil:
+			result.Status, result.Message = models.TestFailed, testCase.Error.String()
+		case testCase.Skipped != nil:
+			result.Status, result.Message = models.TestSkipped, testCase.Skipped.String()
+		}
+		results = append(results, result)
+	}
+	for _, suite := range s.Suites {
+		results = suite.appendResults(results)
+	}
+	return results
+}
+
+func (m *junitMessage) String() string {
+	text := strings.TrimSpace(m.Text)
+	if m.Message == "" || strings.Contains(text, m.Message) {
+		return truncateMessage(text)
+	}
+	if text == "" {
+		return truncateMessage(m.Message)
+	}
+	return truncateMessage(m.Message + "\n\n" + text)
+}
+
+// Event of `go test -json`, see `go doc test2json`
+type goTestEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+type goTest struct {
+	pkg  string
+	name string
+}
+
+/*
+Results of `go test -json` output.
+
+Lines that aren't JSON, e.g. build errors printed to stderr, are ignored. A
+package failing without any failed test, e.g. because it does not build, is
+reported as a failed result without a name.
+*/
+func parseGoTest(content io.Reader) ([]models.TestResult, error) {
+	scanner := bufio.NewScanner(content)
+	scanner.Buffer(make([]byte, 64*1024), int(MaxReportBytes))
+	results := []models.TestResult{}
+	outputs := map[goTest]*strings.Builder{}
+	failedTests := map[string]bool{}
+	events := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		event := goTestEvent{}
+		err := json.Unmarshal(line, &event)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidReport, err)
+		}
+		events++
+		test := goTest{pkg: event.Package, name: event.Test}
+		var status models.TestStatus
+		switch event.Action {
+		case "output":
+			if strings.HasPrefix(event.Output, "=== ") {
+				continue
+			}
+			if outputs[test] == nil {
+				outputs[test] = &strings.Builder{}
+			}
+			outputs[test].WriteString(event.Output)
+			continue
+		case "pass":
+			status = models.TestPassed
+		case "fail":
+			status = models.TestFailed
+		case "skip":
+			status = models.TestSkipped
+		default:
+			continue
+		}
+		if event.Test == "" && (status != models.TestFailed || failedTests[event.Package]) {
+			continue
+		}
+		result := models.TestResult{
+			Package:  event.Package,
+			Name:     event.Test,
+			Status:   status,
+			Duration: event.Elapsed,
+		}
+		if status != models.TestPassed && outputs[test] != nil {
+			result.Message = truncateMessage(strings.TrimSpace(outputs[test].String()))
+		}
+		delete(outputs, test)
+		if status == models.TestFailed {
+			failedTests[event.Package] = true
+		}
+		results = append(results, result)
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidReport, err)
+	}
+	if events == 0 {
+		return nil, fmt.Errorf("%w: no go test -json event", ErrInvalidReport)
+	}
+	return results, nil
+}
+
+func truncateMessage(message string) string {
+	if len(message) <= maxMessageLength {
+		return message
+	}
+	return "..." + message[len(message)-maxMessageLength+3:]
+}
@@ -0,0 +1,97 @@
+package testreport
+
+import (
+	"strings"
+	"testing"
+
+	"api/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJUnit(t *testing.T) {
+	report := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="api.store" tests="2">
+    <testcase classname="api.store" name="TestGet" time="0.012"/>
+    <testcase name="TestPut" time="1,250.5">
+      <failure message="expected 2, got 3">store_test.go:42: expected 2, got 3</failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="api.queue">
+    <testsuite name="nested">
+      <testcase classname="api.queue" name="TestLease"><error message="panic: nil map"/></testcase>
+      <testcase classname="api.queue" name="TestAck"><skipped message="needs redis"/></testcase>
+    </testsuite>
+  </testsuite>
+</testsuites>`
+	results, err := Parse(strings.NewReader(report))
+	require.NoError(t, err)
+	assert.Equal(t, []models.TestResult{
+		{Package: "api.store", Name: "TestGet", Status: models.TestPassed, Duration: 0.012},
+		{Package: "api.store", Name: "TestPut", Status: models.TestFailed, Duration: 1250.5, Message: "store_test.go:42: expected 2, got 3"},
+		{Package: "api.queue", Name: "TestLease", Status: models.TestFailed, Message: "panic: nil map"},
+		{Package: "api.queue", Name: "TestAck", Status: models.TestSkipped, Message: "needs redis"},
+	}, results)
+
+	single, err := Parse(strings.NewReader("\ufeff<testsuite name=\"suite\"><testcase name=\"works\"/></testsuite>"))
+	require.NoError(t, err)
+	assert.Equal(t, []models.TestResult{{Package: "suite", Name: "works", Status: models.TestPassed}}, single)
+}
+
+func TestParseGoTest(t *testing.T) {
+	report := `{"Action":"start","Package":"api/store"}
+{"Action":"run","Package":"api/store","Test":"TestGet"}
+{"Action":"output","Package":"api/store","Test":"TestGet","Output":"=== RUN   TestGet\n"}
+{"Action":"output","Package":"api/store","Test":"TestGet","Output":"--- PASS: TestGet (0.01s)\n"}
+{"Action":"pass","Package":"api/store","Test":"TestGet","Elapsed":0.01}
+{"Action":"run","Package":"api/store","Test":"TestPut"}
+{"Action":"output","Package":"api/store","Test":"TestPut","Output":"    store_test.go:42: expected 2, got 3\n"}
+{"Action":"output","Package":"api/store","Test":"TestPut","Output":"--- FAIL: TestPut (0.20s)\n"}
+{"Action":"fail","Package":"api/store","Test":"TestPut","Elapsed":0.2}
+{"Action":"output","Package":"api/store","Test":"TestList","Output":"    store_test.go:60: needs redis\n"}
+{"Action":"skip","Package":"api/store","Test":"TestList","Elapsed":0}
+{"Action":"output","Package":"api/store","Output":"FAIL\n"}
+{"Action":"fail","Package":"api/store","Elapsed":0.3}
+# api/queue
+queue.go:10:2: undefined: lease
+{"Action":"output","Package":"api/queue","Output":"FAIL\tapi/queue [build failed]\n"}
+{"Action":"fail","Package":"api/queue","Elapsed":0}
+{"Action":"pass","Package":"api/runs","Elapsed":0.1}
+`
+	results, err := Parse(strings.NewReader(report))
+	require.NoError(t, err)
+	assert.Equal(t, []models.TestResult{
+		{Package: "api/store", Name: "TestGet", Status: models.TestPassed, Duration: 0.01},
+		{Package: "api/store", Name: "TestPut", Status: models.TestFailed, Duration: 0.2, Message: "store_test.go:42: expected 2, got 3\n--- FAIL: TestPut (0.20s)"},
+		{Package: "api/store", Name: "TestList", Status: models.TestSkipped, Message: "store_test.go:60: needs redis"},
+		{Package: "api/queue", Status: models.TestFailed, Message: "FAIL\tapi/queue [build failed]"},
+	}, results)
+}
+
+func TestParseRejectsUnknownFormats(t *testing.T) {
+	examples := []struct {
+		name   string
+		report string
+	}{
+		{name: "empty", report: " \n"},
+		{name: "plain text", report: "ok  \tapi/store\t0.012s"},
+		{name: "other XML", report: "<coverage/>"},
+		{name: "truncated XML", report: "<testsuite><testcase name=\"a\">"},
+		{name: "invalid JSON", report: "{\"Action\":"},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(example.report))
+			assert.ErrorIs(t, err, ErrInvalidReport)
+		})
+	}
+}
+
+func TestTruncateMessage(t *testing.T) {
+	message := truncateMessage(strings.Repeat("a", maxMessageLength) + "the end")
+	assert.Len(t, message, maxMessageLength)
+	assert.True(t, strings.HasPrefix(message, "..."))
+	assert.True(t, strings.HasSuffix(message, "the end"))
+}
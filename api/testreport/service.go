@@ -0,0 +1,271 @@
+package testreport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"api/clients/githubclient"
+	"api/logger"
+	"api/models"
+	"api/paths"
+	"api/runs"
+	"api/store"
+)
+
+const ReportsBucket string = "test-reports"
+
+// Larger reports are rejected rather than parsed
+const MaxReportBytes int64 = 64 << 20
+
+// Failed tests listed in a check run summary
+const maxSummaryFailures int = 50
+
+// The report was rejected: invalid name, too large or in an unknown format
+var ErrInvalidReport = errors.New("invalid test report")
+
+// Receives the test summaries of finished jobs, e.g. the GitHub service
+type ChecksPoster interface {
+	CreateCheckRun(ctx context.Context, repoURL, sha string, check githubclient.CheckRun) error
+}
+
+// Filters of the test results of a run; empty fields match everything
+type Filter struct {
+	Job    string
+	Status models.TestStatus
+}
+
+type Service struct {
+	store     store.Store
+	pipelines *store.Pipelines
+	runs      *store.Runs
+	checks    ChecksPoster
+	now       func() time.Time
+}
+
+func NewService(s store.Store) *Service {
+	return &Service{
+		store:     s,
+		pipelines: store.NewPipelines(s),
+		runs:      store.NewRuns(s),
+		now:       time.Now,
+	}
+}
+
+// Post a check run with the test summary of the jobs finished from now on
+func (s *Service) ReportChecks(poster ChecksPoster) {
+	s.checks = poster
+}
+
+/*
+Parse and store a test report uploaded by a job.
+
+Uploading the same name again from the same job replaces its results.
+
+[IN] ctx: request context
+
+[IN] runId: run of the job
+
+[IN] job: job uploading the report
+
+[IN] name: path of the report relative to the job working directory
+
+[IN] step: index of the step that wrote the report; nil when unknown
+
+[IN] content: JUnit XML or `go test -json` output
+
+[OUT] *models.TestSummary: counts of the report results
+
+[OUT] error: ErrInvalidReport when the report was rejected
+*/
+func (s *Service) Ingest(ctx context.Context, runId, job, name string, step *int, content io.Reader) (*models.TestSummary, error) {
+	if !paths.Valid(name) {
+		return nil, fmt.Errorf("%w: invalid name %q", ErrInvalidReport, name)
+	}
+	limited := &io.LimitedReader{R: content, N: MaxReportBytes + 1}
+	results, err := Parse(limited)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", name, err)
+	}
+	if limited.N == 0 {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrInvalidReport, name, MaxReportBytes)
+	}
+	for i := range results {
+		results[i].RunId, results[i].Job, results[i].Report, results[i].Step = runId, job, name, step
+	}
+	report := models.TestReport{
+		RunId:     runId,
+		Job:       job,
+		Name:      name,
+		Results:   results,
+		CreatedAt: s.now().UTC(),
+	}
+	err = store.Put(ctx, s.store, ReportsBucket, key(runId, job, name), report)
+	if err != nil {
+		return nil, fmt.Errorf("unable to record test report %s: %w", name, err)
+	}
+	summary := Summarize(results)
+	logger.FromContext(ctx).Infof("Stored test report %s of job %s in run %s: %d tests, %d failed", name, job, runId, summary.Total, summary.Failed)
+	return &summary, nil
+}
+
+/*
+List the test results of a run, sorted by job, package and name.
+
+Jobs reused by a re-run keep their results in the run that executed them, so
+those are listed as well.
+
+[IN] ctx: request context
+
+[IN] runId: the run
+
+[IN] filter: job and status of the results to list
+
+[OUT] []models.TestResult: matching results
+
+[OUT] error: store.ErrNotFound when the run does not exist
+*/
+func (s *Service) List(ctx context.Context, runId string, filter Filter) ([]models.TestResult, error) {
+	run, err := s.runs.Get(ctx, runId)
+	if err != nil {
+		return nil, err
+	}
+	sources := runs.JobSources(run)
+	reports, err := store.List[models.TestReport](ctx, s.store, ReportsBucket)
+	if err != nil {
+		return nil, err
+	}
+	results := []models.TestResult{}
+	for _, report := range reports {
+		if sources[report.Job] != report.RunId || (filter.Job != "" && report.Job != filter.Job) {
+			continue
+		}
+		for _, result := range report.Results {
+			if filter.Status == "" || result.Status == filter.Status {
+				results = append(results, result)
+			}
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Job != b.Job {
+			return a.Job < b.Job
+		}
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		return a.Name < b.Name
+	})
+	return results, nil
+}
+
+func Summarize(results []models.TestResult) models.TestSummary {
+	summary := models.TestSummary{Total: len(results)}
+	for _, result := range results {
+		summary.Duration += result.Duration
+		switch result.Status {
+		case models.TestPassed:
+			summary.Passed++
+		case models.TestFailed:
+			summary.Failed++
+		case models.TestSkipped:
+			summary.Skipped++
+		}
+	}
+	return summary
+}
+
+/*
+Post the test summary of a finished job as a check run on its commit.
+
+Nothing is posted without a checks poster, a commit or any test result. Jobs
+whose failed tests were all quarantined get a neutral conclusion.
+
+[IN] ctx: request context
+
+[IN] run: run of the job
+
+[IN] job: the finished job
+
+[OUT] error: for error propagation
+*/
+func (s *Service) PublishSummary(ctx context.Context, run *models.Run, job string) error {
+	if s.checks == nil || run.CommitSha == "" {
+		return nil
+	}
+	results, err := s.List(ctx, run.Id, Filter{Job: job})
+	if err != nil || len(results) == 0 {
+		return err
+	}
+	p, err := s.pipelines.Get(ctx, run.PipelineId)
+	if err != nil {
+		return err
+	}
+	summary := Summarize(results)
+	conclusion := githubclient.CheckConclusionSuccess
+	if summary.Failed > 0 {
+		conclusion = githubclient.CheckConclusionFailure
+	}
+	// the failures were all quarantined flaky tests
+	finished, err := runs.FindJob(run, job)
+	if err == nil && len(finished.Quarantined) > 0 {
+		conclusion = githubclient.CheckConclusionNeutral
+	}
+	return s.checks.CreateCheckRun(ctx, p.Url, run.CommitSha, githubclient.CheckRun{
+		Name:        fmt.Sprintf("aeternum/%s/%s tests", p.Name, job),
+		Conclusion:  conclusion,
+		Title:       title(summary),
+		Summary:     markdownSummary(summary, results),
+		CompletedAt: s.now().UTC(),
+	})
+}
+
+// e.g. "2 failed, 10 passed, 1 skipped"
+func title(summary models.TestSummary) string {
+	counts := []string{}
+	if summary.Failed > 0 {
+		counts = append(counts, fmt.Sprintf("%d failed", summary.Failed))
+	}
+	counts = append(counts, fmt.Sprintf("%d passed", summary.Passed))
+	if summary.Skipped > 0 {
+		counts = append(counts, fmt.Sprintf("%d skipped", summary.Skipped))
+	}
+	return strings.Join(counts, ", ")
+}
+
+func markdownSummary(summary models.TestSummary, results []models.TestResult) string {
+	text := &strings.Builder{}
+	fmt.Fprintf(text, "| Passed | Failed | Skipped | Duration |\n|---|---|---|---|\n")
+	fmt.Fprintf(text, "| %d | %d | %d | %.1fs |\n", summary.Passed, summary.Failed, summary.Skipped, summary.Duration)
+	if summary.Failed == 0 {
+		return text.String()
+	}
+	fmt.Fprintf(text, "\n### Failed tests\n\n")
+	listed := 0
+	for _, result := range results {
+		if result.Status != models.TestFailed {
+			continue
+		}
+		if listed == maxSummaryFailures {
+			fmt.Fprintf(text, "\n... and %d more\n", summary.Failed-listed)
+			break
+		}
+		listed++
+		name := strings.TrimPrefix(result.Package+" "+result.Name, " ")
+		message, _, _ := strings.Cut(result.Message, "\n")
+		if message == "" {
+			fmt.Fprintf(text, "- `%s`\n", name)
+			continue
+		}
+		fmt.Fprintf(text, "- `%s`: %s\n", name, message)
+	}
+	return text.String()
+}
+
+func key(runId, job, name string) string {
+	return runId + "/" + job + "/" + name
+}
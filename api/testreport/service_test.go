@@ -0,0 +1,123 @@
+package testreport
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"api/clients/githubclient"
+	"api/models"
+	"api/store"
+	"api/store/storetest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const junitReport string = `<testsuite name="api">
+  <testcase classname="api" name="TestA" time="1.5"/>
+  <testcase classname="api" name="TestB" time="0.5"><failure message="boom">boom
+at api_test.go:12</failure></testcase>
+  <testcase classname="api" name="TestC"><skipped/></testcase>
+</testsuite>`
+
+type fakeChecks struct {
+	repoURL string
+	sha     string
+	checks  []githubclient.CheckRun
+}
+
+func (f *fakeChecks) CreateCheckRun(ctx context.Context, repoURL, sha string, check githubclient.CheckRun) error {
+	f.repoURL, f.sha = repoURL, sha
+	f.checks = append(f.checks, check)
+	return nil
+}
+
+func newTestService(t *testing.T) (*Service, *store.Runs) {
+	dataStore := storetest.NewStore(t)
+	service := NewService(dataStore)
+	service.now = func() time.Time { return storetest.Now }
+	return service, store.NewRuns(dataStore)
+}
+
+func ingest(t *testing.T, service *Service, runId, job, name, report string) models.TestSummary {
+	summary, err := service.Ingest(context.Background(), runId, job, name, nil, strings.NewReader(report))
+	require.NoError(t, err)
+	return *summary
+}
+
+func TestIngestAndList(t *testing.T) {
+	ctx := context.Background()
+	service, runs := newTestService(t)
+	require.NoError(t, runs.Create(ctx, models.Run{Id: "run-1", PipelineId: "pipeline-1", Jobs: []models.Job{{Name: "unit"}, {Name: "lint"}}}))
+	require.NoError(t, runs.Create(ctx, models.Run{Id: "run-2", PipelineId: "pipeline-1", Jobs: []models.Job{{Name: "unit", ReusedFrom: "run-1"}, {Name: "lint"}}}))
+
+	summary := ingest(t, service, "run-1", "unit", "reports/unit.xml", junitReport)
+	assert.Equal(t, models.TestSummary{Total: 3, Passed: 1, Failed: 1, Skipped: 1, Duration: 2}, summary)
+	ingest(t, service, "run-1", "lint", "lint.json", `{"Action":"pass","Package":"api","Test":"TestLint"}`)
+	ingest(t, service, "run-2", "lint", "lint.json", `{"Action":"fail","Package":"api","Test":"TestLint"}`)
+	// uploading a report again replaces it
+	ingest(t, service, "run-2", "lint", "lint.json", `{"Action":"fail","Package":"api","Test":"TestVet"}`)
+
+	examples := []struct {
+		name   string
+		filter Filter
+		tests  []string
+	}{
+		{name: "all", tests: []string{"run-2 lint TestVet", "run-1 unit TestA", "run-1 unit TestB", "run-1 unit TestC"}},
+		{name: "status", filter: Filter{Status: models.TestFailed}, tests: []string{"run-2 lint TestVet", "run-1 unit TestB"}},
+		{name: "job", filter: Filter{Job: "unit", Status: models.TestPassed}, tests: []string{"run-1 unit TestA"}},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			results, err := service.List(ctx, "run-2", example.filter)
+			require.NoError(t, err)
+			tests := []string{}
+			for _, result := range results {
+				tests = append(tests, result.RunId+" "+result.Job+" "+result.Name)
+			}
+			assert.Equal(t, example.tests, tests)
+		})
+	}
+
+	_, err := service.List(ctx, "run-3", Filter{})
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
+
+func TestIngestRejections(t *testing.T) {
+	service, _ := newTestService(t)
+	for _, name := range []string{"", "/etc/report.xml", "../report.xml", "reports//unit.xml"} {
+		_, err := service.Ingest(context.Background(), "run-1", "unit", name, nil, strings.NewReader(junitReport))
+		assert.ErrorIs(t, err, ErrInvalidReport, name)
+	}
+	_, err := service.Ingest(context.Background(), "run-1", "unit", "coverage.out", nil, strings.NewReader("mode: set"))
+	assert.ErrorIs(t, err, ErrInvalidReport)
+}
+
+func TestPublishSummary(t *testing.T) {
+	ctx := context.Background()
+	service, runs := newTestService(t)
+	run := models.Run{Id: "run-1", PipelineId: "pipeline-1", CommitSha: "abc123", Jobs: []models.Job{{Name: "unit"}, {Name: "lint"}}}
+	require.NoError(t, runs.Create(ctx, run))
+	ingest(t, service, "run-1", "unit", "unit.xml", junitReport)
+
+	// nothing is posted until a poster is configured
+	require.NoError(t, service.PublishSummary(ctx, &run, "unit"))
+	checks := &fakeChecks{}
+	service.ReportChecks(checks)
+	require.NoError(t, service.PublishSummary(ctx, &run, "unit"))
+	require.NoError(t, service.PublishSummary(ctx, &run, "lint"), "jobs without results post nothing")
+
+	require.Len(t, checks.checks, 1)
+	assert.Equal(t, "https://github.com/some-user/my-project", checks.repoURL)
+	assert.Equal(t, "abc123", checks.sha)
+	assert.Equal(t, githubclient.CheckRun{
+		Name:       "aeternum/api/unit tests",
+		Conclusion: githubclient.CheckConclusionFailure,
+		Title:      "1 failed, 1 passed, 1 skipped",
+		Summary: "| Passed | Failed | Skipped | Duration |\n|---|---|---|---|\n| 1 | 1 | 1 | 2.0s |\n" +
+			"\n### Failed tests\n\n- `api TestB`: boom\n",
+		CompletedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, checks.checks[0])
+}
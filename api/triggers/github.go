@@ -0,0 +1,110 @@
+package triggers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"api/clients/githubclient"
+	"api/logger"
+
+	"github.com/google/go-github/v56/github"
+)
+
+// GitHub only lists the first commits of a push in the webhook payload
+const maxPayloadCommits int = 20
+
+const nullCommitSha string = "0000000000000000000000000000000000000000"
+
+// Looks up the files changed between two commits when the payload is incomplete
+type Comparer interface {
+	CompareRefs(ctx context.Context, repoURL, base, head string) (*githubclient.RefComparison, error)
+}
+
+// Check the X-Hub-Signature-256 header of a delivery against the webhook secret
+func ValidateSignature(secret string, signature string, payload []byte) error {
+	if signature == "" {
+		return fmt.Errorf("the webhook delivery is not signed")
+	}
+	err := github.ValidateSignature(signature, payload, []byte(secret))
+	if err != nil {
+		return fmt.Errorf("invalid webhook signature: %w", err)
+	}
+	return nil
+}
+
+/*
+Convert a GitHub push payload into a Push.
+
+[IN] ctx: request context
+
+[IN] event: the decoded push payload
+
+[IN] comparer: used when the payload does not list every change; may be nil
+
+[OUT] *Push: the push, or nil when it deleted a branch or did not target one
+
+[OUT] error: for error propagation
+*/
+func PushFromGithub(ctx context.Context, event *github.PushEvent, comparer Comparer) (*Push, error) {
+	branch, isBranch := strings.CutPrefix(event.GetRef(), "refs/heads/")
+	if !isBranch || event.GetDeleted() {
+		return nil, nil
+	}
+	repoURL := event.GetRepo().GetHTMLURL()
+	if repoURL == "" {
+		return nil, fmt.Errorf("the push payload has no repository URL")
+	}
+	return &Push{
+		RepoURL:      repoURL,
+		Branch:       branch,
+		CommitSha:    event.GetAfter(),
+		ChangedFiles: changedFiles(ctx, event, repoURL, comparer),
+	}, nil
+}
+
+// Files touched by the push, or nil when they cannot be determined
+func changedFiles(ctx context.Context, event *github.PushEvent, repoURL string, comparer Comparer) []string {
+	log := logger.FromContext(ctx)
+	// a new branch has nothing to compare against
+	if event.GetCreated() || event.GetBefore() == nullCommitSha {
+		return nil
+	}
+	if len(event.Commits) > 0 && len(event.Commits) < maxPayloadCommits {
+		files := []string{}
+		for _, commit := range event.Commits {
+			files = append(files, commit.Added...)
+			files = append(files, commit.Removed...)
+			files = append(files, commit.Modified...)
+		}
+		return uniqueSorted(files)
+	}
+	if comparer == nil {
+		return nil
+	}
+	comparison, err := comparer.CompareRefs(ctx, repoURL, event.GetBefore(), event.GetAfter())
+	if err != nil {
+		log.Warnf("Unable to list the changes of %s...%s: %v", event.GetBefore(), event.GetAfter(), err)
+		return nil
+	}
+	// a partial list would let path filters skip pipelines whose files changed
+	if comparison.FilesTruncated() {
+		log.Infof("Comparison %s...%s reached the limit of %d files, ignoring the path filters", event.GetBefore(), event.GetAfter(), githubclient.MaxComparisonFiles)
+		return nil
+	}
+	return uniqueSorted(comparison.ChangedPaths())
+}
+
+func uniqueSorted(values []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
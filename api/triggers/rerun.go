@@ -0,0 +1,103 @@
+package triggers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"api/models"
+	"api/queue"
+	"api/store"
+)
+
+// Returned when asked to re-run a run that is not finished, or has nothing to re-run
+var ErrNotRerunnable = errors.New("the run cannot be re-run")
+
+/*
+Start a new attempt of a finished run, on the same branch and commit.
+
+With failedOnly, the jobs that succeeded keep their result and only the
+failed, cancelled and skipped jobs run again, along with the jobs needing
+them. Reused jobs point at the run that executed them, where their logs are.
+
+[IN] ctx: request context
+
+[IN] pipelines: pipeline store
+
+[IN] runs: run store
+
+[IN] jobs: job queue
+
+[IN] runId: the run to re-run
+
+[IN] failedOnly: reuse the jobs that succeeded
+
+[OUT] *models.Run: the new attempt
+
+[OUT] error: ErrNotRerunnable when the run is not finished or nothing failed
+*/
+func Rerun(ctx context.Context, pipelines *store.Pipelines, runs *store.Runs, jobs queue.Queue, runId string, failedOnly bool) (*models.Run, error) {
+	previous, err := runs.Get(ctx, runId)
+	if err != nil {
+		return nil, err
+	}
+	if !previous.Status.IsFinal() {
+		return nil, fmt.Errorf("%w: run %s is still %s", ErrNotRerunnable, runId, previous.Status)
+	}
+	if failedOnly && previous.Status != models.StatusFailed && previous.Status != models.StatusCancelled {
+		return nil, fmt.Errorf("%w: run %s has no failed jobs", ErrNotRerunnable, runId)
+	}
+	p, err := pipelines.Get(ctx, previous.PipelineId)
+	if err != nil {
+		return nil, err
+	}
+
+	run := NewRun(*p, previous.Trigger, time.Now())
+	run.Branch = previous.Branch
+	run.CommitSha = previous.CommitSha
+	run.Attempt = max(previous.Attempt, 1) + 1
+	run.RerunOf = previous.Id
+	if failedOnly {
+		reuseSucceededJobs(&run, previous)
+	}
+	err = Start(ctx, runs, jobs, run)
+	if err != nil {
+		return nil, fmt.Errorf("unable to re-run run %s: %w", runId, err)
+	}
+	return &run, nil
+}
+
+// Copy the results of the jobs that succeeded and whose needs are all reused
+func reuseSucceededJobs(run *models.Run, previous *models.Run) {
+	results := map[string]models.Job{}
+	for _, job := range previous.Jobs {
+		results[job.Name] = job
+	}
+	reused := map[string]bool{}
+	// run jobs come in dependency order, so needs are decided first
+	for i := range run.Jobs {
+		job := &run.Jobs[i]
+		result, ok := results[job.Name]
+		if !ok || result.Status != models.StatusSucceeded {
+			continue
+		}
+		reusable := true
+		for _, need := range job.Needs {
+			reusable = reusable && reused[need]
+		}
+		if !reusable {
+			continue
+		}
+		reused[job.Name] = true
+		job.Status = result.Status
+		job.RunnerId = result.RunnerId
+		job.Steps = result.Steps
+		job.StartedAt = result.StartedAt
+		job.FinishedAt = result.FinishedAt
+		job.ReusedFrom = result.ReusedFrom
+		if job.ReusedFrom == "" {
+			job.ReusedFrom = previous.Id
+		}
+	}
+}
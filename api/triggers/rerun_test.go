@@ -0,0 +1,138 @@
+package triggers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"api/models"
+	"api/queue"
+	"api/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const rerunPipeline string = `
+name: release
+jobs:
+  lint:
+    steps: [{run: make lint}]
+  test:
+    steps: [{run: make test}]
+  build:
+    needs: [lint, test]
+    steps: [{run: make build}]
+  deploy:
+    needs: [build]
+    steps: [{run: make deploy}]
+`
+
+// Store a finished run of the pipeline with the given job statuses
+func createFinishedRun(t *testing.T, dispatcher *Dispatcher, status models.Status, jobStatuses map[string]models.Status) models.Run {
+	ctx := context.Background()
+	p, err := dispatcher.pipelines.Get(ctx, "pipeline-0")
+	require.NoError(t, err)
+	run := NewRun(*p, TriggerPush, time.Now())
+	run.Branch = "main"
+	run.CommitSha = "abc123"
+	run.Status = status
+	for i := range run.Jobs {
+		run.Jobs[i].Status = jobStatuses[run.Jobs[i].Name]
+		run.Jobs[i].RunnerId = "runner-1"
+	}
+	require.NoError(t, dispatcher.runs.Create(ctx, run))
+	return run
+}
+
+func TestRerunFailedOnly(t *testing.T) {
+	ctx := context.Background()
+	dispatcher, runs, jobs := newTestDispatcher(t, rerunPipeline)
+	first := createFinishedRun(t, dispatcher, models.StatusFailed, map[string]models.Status{
+		"lint":   models.StatusSucceeded,
+		"test":   models.StatusFailed,
+		"build":  models.StatusSkipped,
+		"deploy": models.StatusSkipped,
+	})
+
+	second, err := Rerun(ctx, dispatcher.pipelines, runs, jobs, first.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, second.Attempt)
+	assert.Equal(t, first.Id, second.RerunOf)
+	assert.Equal(t, "main", second.Branch)
+	assert.Equal(t, "abc123", second.CommitSha)
+	statuses := map[string]models.Status{}
+	for _, job := range second.Jobs {
+		statuses[job.Name] = job.Status
+	}
+	assert.Equal(t, map[string]models.Status{
+		"lint":   models.StatusSucceeded,
+		"test":   models.StatusQueued,
+		"build":  models.StatusQueued,
+		"deploy": models.StatusQueued,
+	}, statuses)
+	assert.Equal(t, first.Id, second.Jobs[0].ReusedFrom)
+	assert.Equal(t, "runner-1", second.Jobs[0].RunnerId)
+
+	// only test is ready: build still needs it
+	message, err := jobs.Lease(ctx, "worker", time.Minute, nil)
+	require.NoError(t, err)
+	queuedJob := models.QueuedJob{}
+	require.NoError(t, message.Decode(&queuedJob))
+	assert.Equal(t, models.QueuedJob{RunId: second.Id, PipelineId: "pipeline-0", Job: "test"}, queuedJob)
+	assert.Equal(t, queue.LaneNormal, message.Lane)
+	message, err = jobs.Lease(ctx, "worker", time.Minute, nil)
+	require.NoError(t, err)
+	assert.Nil(t, message)
+
+	// a third attempt still points at the run that executed lint
+	_, err = runs.Update(ctx, second.Id, func(run *models.Run) error {
+		run.Status = models.StatusCancelled
+		return nil
+	})
+	require.NoError(t, err)
+	third, err := Rerun(ctx, dispatcher.pipelines, runs, jobs, second.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, third.Attempt)
+	assert.Equal(t, first.Id, third.Jobs[0].ReusedFrom)
+
+	history, err := runs.ListByPipeline(ctx, "pipeline-0")
+	require.NoError(t, err)
+	assert.Len(t, history, 3, "every attempt is kept")
+}
+
+func TestRerunAll(t *testing.T) {
+	ctx := context.Background()
+	dispatcher, runs, jobs := newTestDispatcher(t, rerunPipeline)
+	first := createFinishedRun(t, dispatcher, models.StatusSucceeded, map[string]models.Status{
+		"lint":   models.StatusSucceeded,
+		"test":   models.StatusSucceeded,
+		"build":  models.StatusSucceeded,
+		"deploy": models.StatusSucceeded,
+	})
+
+	second, err := Rerun(ctx, dispatcher.pipelines, runs, jobs, first.Id, false)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusQueued, second.Status)
+	for _, job := range second.Jobs {
+		assert.Equal(t, models.StatusQueued, job.Status, job.Name)
+		assert.Empty(t, job.ReusedFrom)
+	}
+	depth, err := jobs.Depth(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, depth[queue.LaneNormal], "lint and test are ready")
+}
+
+func TestRerunRejections(t *testing.T) {
+	ctx := context.Background()
+	dispatcher, runs, jobs := newTestDispatcher(t, rerunPipeline)
+	succeeded := createFinishedRun(t, dispatcher, models.StatusSucceeded, map[string]models.Status{})
+	running := createFinishedRun(t, dispatcher, models.StatusRunning, map[string]models.Status{})
+
+	_, err := Rerun(ctx, dispatcher.pipelines, runs, jobs, succeeded.Id, true)
+	assert.ErrorIs(t, err, ErrNotRerunnable)
+	_, err = Rerun(ctx, dispatcher.pipelines, runs, jobs, running.Id, false)
+	assert.ErrorIs(t, err, ErrNotRerunnable)
+	_, err = Rerun(ctx, dispatcher.pipelines, runs, jobs, "unknown", false)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
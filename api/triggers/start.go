@@ -0,0 +1,84 @@
+package triggers
+
+import (
+	"context"
+	"fmt"
+
+	"api/models"
+	"api/queue"
+	"api/store"
+)
+
+// Name of the queue holding the jobs waiting for execution
+const JobQueueName string = "jobs"
+
+const TriggerManual string = "manual"
+
+// Lane of the jobs of a run: people waiting on manual runs go first, schedules last
+func LaneFor(trigger string) queue.Lane {
+	switch trigger {
+	case TriggerManual:
+		return queue.LaneHigh
+	case TriggerPush:
+		return queue.LaneNormal
+	}
+	return queue.LaneLow
+}
+
+/*
+Store a new run and enqueue its queued jobs whose needs all succeeded.
+
+Skipped runs are only stored. The other jobs with dependencies are enqueued
+once the jobs they need succeed.
+
+[IN] ctx: request context
+
+[IN] runs: run store
+
+[IN] jobs: job queue
+
+[IN] run: the run to start
+
+[OUT] error: for error propagation
+*/
+func Start(ctx context.Context, runs *store.Runs, jobs queue.Queue, run models.Run) error {
+	err := runs.Create(ctx, run)
+	if err != nil {
+		return err
+	}
+	if run.Status != models.StatusQueued {
+		return nil
+	}
+	statuses := map[string]models.Status{}
+	for _, job := range run.Jobs {
+		statuses[job.Name] = job.Status
+	}
+	for _, job := range run.Jobs {
+		ready := job.Status == models.StatusQueued
+		for _, need := range job.Needs {
+			ready = ready && statuses[need] == models.StatusSucceeded
+		}
+		if !ready {
+			continue
+		}
+		err = EnqueueJob(ctx, jobs, run, job.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func EnqueueJob(ctx context.Context, jobs queue.Queue, run models.Run, job string) error {
+	payload := models.QueuedJob{RunId: run.Id, PipelineId: run.PipelineId, Job: job}
+	for _, candidate := range run.Jobs {
+		if candidate.Name == job {
+			payload.RunsOn = candidate.RunsOn
+		}
+	}
+	_, err := jobs.Enqueue(ctx, payload, queue.EnqueueOptions{Lane: LaneFor(run.Trigger)})
+	if err != nil {
+		return fmt.Errorf("unable to enqueue job %s of run %s: %w", job, run.Id, err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+// Package triggers turns repository events into pipeline runs.
+package triggers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"api/logger"
+	"api/models"
+	"api/queue"
+	"api/store"
+
+	"github.com/google/uuid"
+)
+
+const TriggerPush string = "push"
+
+// A push to a branch of a repository
+type Push struct {
+	RepoURL   string
+	Branch    string
+	CommitSha string
+	// Paths touched by the push; nil when they could not be determined
+	ChangedFiles []string
+}
+
+// Cancels runs, e.g. the runner service
+type Canceller interface {
+	Cancel(ctx context.Context, runId string, reason string) (*models.Run, error)
+}
+
+// Creates the runs of the pipelines matching an event
+type Dispatcher struct {
+	pipelines *store.Pipelines
+	runs      *store.Runs
+	jobs      queue.Queue
+	canceller Canceller
+	now       func() time.Time
+}
+
+// Superseded runs are only cancelled when a canceller is given
+func NewDispatcher(pipelines *store.Pipelines, runs *store.Runs, jobs queue.Queue, canceller Canceller) *Dispatcher {
+	return &Dispatcher{pipelines: pipelines, runs: runs, jobs: jobs, canceller: canceller, now: time.Now}
+}
+
+/*
+Create a run for every pipeline of the repository listening to pushes on the branch.
+
+Runs of pipelines whose path filters match none of the changed files are
+recorded as skipped, so the history shows why nothing was built. Pipelines
+with cancel-superseded cancel the unfinished runs of the branch.
+
+[IN] ctx: request context
+
+[IN] push: the push event
+
+[OUT] []models.Run: the created runs, queued or skipped
+
+[OUT] error: for error propagation
+*/
+func (d *Dispatcher) Push(ctx context.Context, push Push) ([]models.Run, error) {
+	log := logger.FromContext(ctx)
+	pipelineList, err := d.pipelines.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list pipelines: %w", err)
+	}
+
+	runList := []models.Run{}
+	for _, pipeline := range pipelineList {
+		trigger := pipeline.Definition.On.Push
+		if trigger == nil || !SameRepository(pipeline.Url, push.RepoURL) || !trigger.MatchesBranch(push.Branch) {
+			continue
+		}
+		run := NewRun(pipeline, TriggerPush, d.now())
+		run.Branch = push.Branch
+		run.CommitSha = push.CommitSha
+		if !trigger.MatchesPaths(push.ChangedFiles) {
+			skipRun(&run, models.ReasonNoMatchingChanges)
+		}
+		err = Start(ctx, d.runs, d.jobs, run)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create a run of pipeline %s: %w", pipeline.Id, err)
+		}
+		log.Infof("Created %s run %s of pipeline %s for %s@%s", run.Status, run.Id, pipeline.Id, push.Branch, push.CommitSha)
+		runList = append(runList, run)
+		if pipeline.Definition.CancelSuperseded && run.Status == models.StatusQueued {
+			d.cancelSuperseded(ctx, run)
+		}
+	}
+	return runList, nil
+}
+
+// Cancel the older unfinished push runs of the branch; failures only delay their end
+func (d *Dispatcher) cancelSuperseded(ctx context.Context, run models.Run) {
+	log := logger.FromContext(ctx)
+	if d.canceller == nil {
+		return
+	}
+	previous, err := d.runs.ListByPipeline(ctx, run.PipelineId)
+	if err != nil {
+		log.Warnf("Unable to find the runs superseded by %s: %v", run.Id, err)
+		return
+	}
+	for _, candidate := range previous {
+		if candidate.Id == run.Id || candidate.Trigger != TriggerPush || candidate.Branch != run.Branch || candidate.Status.IsFinal() {
+			continue
+		}
+		_, err = d.canceller.Cancel(ctx, candidate.Id, fmt.Sprintf("superseded by run %s", run.Id))
+		if err != nil {
+			log.Warnf("Unable to cancel run %s superseded by %s: %v", candidate.Id, run.Id, err)
+		}
+	}
+}
+
+// Build a queued run with one job per pipeline job, in dependency order
+func NewRun(pipeline models.Pipeline, trigger string, now time.Time) models.Run {
+	run := models.Run{
+		Id:         uuid.NewString(),
+		PipelineId: pipeline.Id,
+		Status:     models.StatusQueued,
+		Trigger:    trigger,
+		Attempt:    1,
+		Jobs:       []models.Job{},
+		CreatedAt:  now.UTC(),
+	}
+	// stored definitions were validated, so the order is always available
+	order, _ := pipeline.Definition.JobOrder()
+	for _, name := range order {
+		run.Jobs = append(run.Jobs, models.Job{
+			Name:   name,
+			Status: models.StatusQueued,
+			Needs:  pipeline.Definition.Jobs[name].Needs,
+			RunsOn: pipeline.Definition.Jobs[name].RunsOn,
+		})
+	}
+	return run
+}
+
+func skipRun(run *models.Run, reason string) {
+	finishedAt := run.CreatedAt
+	run.Status = models.StatusSkipped
+	run.Reason = reason
+	run.FinishedAt = &finishedAt
+	for i := range run.Jobs {
+		run.Jobs[i].Status = models.StatusSkipped
+	}
+}
+
+// Compare repository URLs ignoring case, trailing slashes and the .git suffix
+func SameRepository(a, b string) bool {
+	return normalizeRepoURL(a) == normalizeRepoURL(b)
+}
+
+func normalizeRepoURL(repoURL string) string {
+	repoURL = strings.TrimSuffix(strings.TrimSpace(repoURL), "/")
+	repoURL = strings.TrimSuffix(repoURL, ".git")
+	return strings.ToLower(repoURL)
+}
@@ -0,0 +1,291 @@
+package triggers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"api/clients/githubclient"
+	"api/models"
+	"api/pipeline"
+	"api/queue"
+	"api/store"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRepoURL string = "https://github.com/some-user/my-project"
+
+func newTestDispatcher(t *testing.T, definitions ...string) (*Dispatcher, *store.Runs, *queue.StoreQueue) {
+	dataStore := store.NewMemoryStore()
+	pipelines := store.NewPipelines(dataStore)
+	runs := store.NewRuns(dataStore)
+	for i, yamlDefinition := range definitions {
+		definition, err := pipeline.Parse([]byte(yamlDefinition))
+		require.NoError(t, err)
+		err = pipelines.Create(context.Background(), models.Pipeline{
+			Id:         fmt.Sprintf("pipeline-%d", i),
+			Url:        testRepoURL,
+			Name:       definition.Name,
+			Definition: *definition,
+		})
+		require.NoError(t, err)
+	}
+	jobs := queue.NewStoreQueue(dataStore, JobQueueName)
+	dispatcher := NewDispatcher(pipelines, runs, jobs, nil)
+	dispatcher.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+	return dispatcher, runs, jobs
+}
+
+const apiPipeline string = `
+name: api
+on:
+  push:
+    branches: [main]
+    paths: ["api/**"]
+    paths-ignore: ["**/*.md"]
+jobs:
+  test:
+    steps: [{run: go test ./...}]
+  build:
+    needs: [test]
+    steps: [{run: go build ./...}]
+`
+
+const docsPipeline string = `
+name: docs
+on:
+  push:
+    paths: ["docs/**"]
+jobs:
+  publish:
+    steps: [{run: mkdocs build}]
+`
+
+const manualPipeline string = `
+name: manual
+jobs:
+  release:
+    steps: [{run: make release}]
+`
+
+func TestDispatchPush(t *testing.T) {
+	dispatcher, runs, jobs := newTestDispatcher(t, apiPipeline, docsPipeline, manualPipeline)
+	ctx := context.Background()
+
+	runList, err := dispatcher.Push(ctx, Push{
+		RepoURL:      testRepoURL + ".git",
+		Branch:       "main",
+		CommitSha:    "abc123",
+		ChangedFiles: []string{"api/main.go", "README.md"},
+	})
+	require.NoError(t, err)
+	require.Len(t, runList, 2)
+
+	apiRun := runList[0]
+	assert.Equal(t, "pipeline-0", apiRun.PipelineId)
+	assert.Equal(t, models.StatusQueued, apiRun.Status)
+	assert.Empty(t, apiRun.Reason)
+	assert.Equal(t, "main", apiRun.Branch)
+	assert.Equal(t, "abc123", apiRun.CommitSha)
+	assert.Equal(t, TriggerPush, apiRun.Trigger)
+	assert.Equal(t, []models.Job{
+		{Name: "test", Status: models.StatusQueued},
+		{Name: "build", Status: models.StatusQueued, Needs: []string{"test"}},
+	}, apiRun.Jobs)
+
+	docsRun := runList[1]
+	assert.Equal(t, "pipeline-1", docsRun.PipelineId)
+	assert.Equal(t, models.StatusSkipped, docsRun.Status)
+	assert.Equal(t, "skipped: no matching changes", docsRun.Reason)
+	assert.NotNil(t, docsRun.FinishedAt)
+	assert.Equal(t, models.StatusSkipped, docsRun.Jobs[0].Status)
+
+	stored, err := runs.Get(ctx, docsRun.Id)
+	require.NoError(t, err)
+	assert.Equal(t, docsRun.Reason, stored.Reason)
+
+	// only the job without dependencies of the queued run is ready
+	message, err := jobs.Lease(ctx, "worker", time.Minute, nil)
+	require.NoError(t, err)
+	queuedJob := models.QueuedJob{}
+	require.NoError(t, message.Decode(&queuedJob))
+	assert.Equal(t, models.QueuedJob{RunId: apiRun.Id, PipelineId: "pipeline-0", Job: "test"}, queuedJob)
+	assert.Equal(t, queue.LaneNormal, message.Lane)
+	message, err = jobs.Lease(ctx, "worker", time.Minute, nil)
+	require.NoError(t, err)
+	assert.Nil(t, message)
+}
+
+func TestDispatchPushFilters(t *testing.T) {
+	examples := []struct {
+		name   string
+		push   Push
+		status []models.Status
+	}{
+		{"docs only", Push{RepoURL: testRepoURL, Branch: "main", ChangedFiles: []string{"api/README.md"}}, []models.Status{models.StatusSkipped, models.StatusSkipped}},
+		{"other branch", Push{RepoURL: testRepoURL, Branch: "feature", ChangedFiles: []string{"docs/a.md"}}, []models.Status{models.StatusQueued}},
+		{"unknown changes", Push{RepoURL: testRepoURL, Branch: "main"}, []models.Status{models.StatusQueued, models.StatusQueued}},
+		{"other repository", Push{RepoURL: "https://github.com/some-user/other", Branch: "main"}, []models.Status{}},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			dispatcher, _, _ := newTestDispatcher(t, apiPipeline, docsPipeline)
+			runList, err := dispatcher.Push(context.Background(), example.push)
+			require.NoError(t, err)
+			status := []models.Status{}
+			for _, run := range runList {
+				status = append(status, run.Status)
+			}
+			assert.Equal(t, example.status, status)
+		})
+	}
+}
+
+type fakeComparer struct {
+	calls      int
+	comparison *githubclient.RefComparison
+	err        error
+}
+
+func (f *fakeComparer) CompareRefs(ctx context.Context, repoURL, base, head string) (*githubclient.RefComparison, error) {
+	f.calls++
+	return f.comparison, f.err
+}
+
+func newPushEvent(before string, created bool, commits int) *github.PushEvent {
+	event := &github.PushEvent{
+		Ref:     github.String("refs/heads/main"),
+		Before:  github.String(before),
+		After:   github.String("def456"),
+		Created: github.Bool(created),
+		Repo:    &github.PushEventRepository{HTMLURL: github.String(testRepoURL)},
+	}
+	for i := 0; i < commits; i++ {
+		event.Commits = append(event.Commits, &github.HeadCommit{
+			Added:    []string{fmt.Sprintf("api/file%d.go", i%2)},
+			Modified: []string{"README.md"},
+		})
+	}
+	return event
+}
+
+type fakeCanceller struct {
+	runs      *store.Runs
+	cancelled map[string]string
+}
+
+func (f *fakeCanceller) Cancel(ctx context.Context, runId string, reason string) (*models.Run, error) {
+	f.cancelled[runId] = reason
+	return f.runs.Update(ctx, runId, func(run *models.Run) error {
+		run.Status = models.StatusCancelled
+		return nil
+	})
+}
+
+func TestDispatchPushCancelsSupersededRuns(t *testing.T) {
+	ctx := context.Background()
+	dispatcher, runs, _ := newTestDispatcher(t, `
+name: api
+cancel-superseded: true
+on:
+  push: {}
+jobs:
+  test:
+    steps: [{run: go test ./...}]
+`, `
+name: docs
+on:
+  push: {}
+jobs:
+  publish:
+    steps: [{run: mkdocs build}]
+`)
+	canceller := &fakeCanceller{runs: runs, cancelled: map[string]string{}}
+	dispatcher.canceller = canceller
+
+	first, err := dispatcher.Push(ctx, Push{RepoURL: testRepoURL, Branch: "main", CommitSha: "aaa"})
+	require.NoError(t, err)
+	other, err := dispatcher.Push(ctx, Push{RepoURL: testRepoURL, Branch: "feature", CommitSha: "bbb"})
+	require.NoError(t, err)
+	assert.Empty(t, canceller.cancelled)
+
+	second, err := dispatcher.Push(ctx, Push{RepoURL: testRepoURL, Branch: "main", CommitSha: "ccc"})
+	require.NoError(t, err)
+	// only the run of the pipeline asking for it, on the same branch
+	assert.Equal(t, map[string]string{first[0].Id: "superseded by run " + second[0].Id}, canceller.cancelled)
+	assert.Equal(t, "pipeline-0", first[0].PipelineId)
+	assert.Equal(t, "feature", other[0].Branch)
+
+	_, err = dispatcher.Push(ctx, Push{RepoURL: testRepoURL, Branch: "main", CommitSha: "ddd"})
+	require.NoError(t, err)
+	assert.Len(t, canceller.cancelled, 2, "cancelled runs are not cancelled again")
+}
+
+func TestPushFromGithub(t *testing.T) {
+	comparison := &githubclient.RefComparison{Files: []githubclient.ChangedFile{
+		{Filename: "docs/new.md", PreviousFilename: "docs/old.md", Status: githubclient.FileStatusRenamed},
+	}}
+	truncated := &githubclient.RefComparison{}
+	for i := 0; i < githubclient.MaxComparisonFiles; i++ {
+		truncated.Files = append(truncated.Files, githubclient.ChangedFile{Filename: fmt.Sprintf("api/file%d.go", i), Status: githubclient.FileStatusModified})
+	}
+	examples := []struct {
+		name         string
+		event        *github.PushEvent
+		comparer     *fakeComparer
+		changedFiles []string
+		compared     int
+	}{
+		{"files from payload", newPushEvent("abc123", false, 3), &fakeComparer{}, []string{"README.md", "api/file0.go", "api/file1.go"}, 0},
+		{"new branch", newPushEvent(nullCommitSha, true, 3), &fakeComparer{}, nil, 0},
+		{"truncated payload", newPushEvent("abc123", false, 20), &fakeComparer{comparison: comparison}, []string{"docs/new.md", "docs/old.md"}, 1},
+		{"no commits in payload", newPushEvent("abc123", false, 0), &fakeComparer{comparison: comparison}, []string{"docs/new.md", "docs/old.md"}, 1},
+		{"compare failure", newPushEvent("abc123", false, 0), &fakeComparer{err: fmt.Errorf("boom")}, nil, 1},
+		{"too many changed files", newPushEvent("abc123", false, 0), &fakeComparer{comparison: truncated}, nil, 1},
+	}
+	for _, example := range examples {
+		t.Run(example.name, func(t *testing.T) {
+			push, err := PushFromGithub(context.Background(), example.event, example.comparer)
+			require.NoError(t, err)
+			assert.Equal(t, testRepoURL, push.RepoURL)
+			assert.Equal(t, "main", push.Branch)
+			assert.Equal(t, "def456", push.CommitSha)
+			assert.Equal(t, example.changedFiles, push.ChangedFiles)
+			assert.Equal(t, example.compared, example.comparer.calls)
+		})
+	}
+
+	t.Run("deleted branch", func(t *testing.T) {
+		event := newPushEvent("abc123", false, 1)
+		event.Deleted = github.Bool(true)
+		push, err := PushFromGithub(context.Background(), event, nil)
+		require.NoError(t, err)
+		assert.Nil(t, push)
+	})
+
+	t.Run("tag push", func(t *testing.T) {
+		event := newPushEvent("abc123", false, 1)
+		event.Ref = github.String("refs/tags/v1.0.0")
+		push, err := PushFromGithub(context.Background(), event, nil)
+		require.NoError(t, err)
+		assert.Nil(t, push)
+	})
+}
+
+func TestValidateSignature(t *testing.T) {
+	payload := []byte(`{"zen":"Keep it logically awesome."}`)
+	mac := hmac.New(sha256.New, []byte("s3cr3t"))
+	mac.Write(payload)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	assert.NoError(t, ValidateSignature("s3cr3t", signature, payload))
+	assert.ErrorContains(t, ValidateSignature("other", signature, payload), "invalid webhook signature")
+	assert.ErrorContains(t, ValidateSignature("s3cr3t", "", payload), "not signed")
+}
@@ -0,0 +1,133 @@
+package workspace
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+Extract a GitHub tarball into the destination directory.
+
+GitHub wraps the repository in a single top-level directory, which is stripped.
+
+[IN] archive: the tar.gz stream
+
+[IN] dest: directory to extract into
+
+[IN] limit: maximum number of bytes to write; negative for no limit
+
+[OUT] int64: bytes written
+*/
+func extractTarball(archive io.Reader, dest string, limit int64) (int64, error) {
+	gzipReader, err := gzip.NewReader(archive)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read archive: %w", err)
+	}
+	defer gzipReader.Close()
+
+	var written int64
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return written, nil
+		}
+		if err != nil {
+			return written, fmt.Errorf("unable to read archive: %w", err)
+		}
+
+		name := stripTopLevelDir(header.Name)
+		if name == "" {
+			continue
+		}
+		target, err := safeJoin(dest, name)
+		if err != nil {
+			return written, err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeSymlink:
+			err = ensureNoSymlinkParents(dest, target)
+			if err == nil {
+				err = os.Symlink(header.Linkname, target)
+			}
+		case tar.TypeReg:
+			if limit >= 0 && written+header.Size > limit {
+				return written, fmt.Errorf("%w while extracting %s", ErrQuotaExceeded, name)
+			}
+			err = ensureNoSymlinkParents(dest, target)
+			if err == nil {
+				err = extractFile(tarReader, target, header)
+				written += header.Size
+			}
+		default:
+			// global pax headers and anything exotic carry no workspace contents
+			continue
+		}
+		if err != nil {
+			return written, fmt.Errorf("unable to extract %s: %w", name, err)
+		}
+	}
+}
+
+func extractFile(reader io.Reader, target string, header *tar.Header) error {
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm()|0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.CopyN(file, reader, header.Size)
+	return err
+}
+
+func stripTopLevelDir(name string) string {
+	_, rest, found := strings.Cut(strings.TrimPrefix(name, "./"), "/")
+	if !found {
+		return ""
+	}
+	return rest
+}
+
+// Join a repository path onto the root, refusing paths that escape it
+func safeJoin(root, name string) (string, error) {
+	target := filepath.Join(root, filepath.FromSlash(name))
+	if !strings.HasPrefix(target, filepath.Clean(root)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("path %s escapes the workspace", name)
+	}
+	return target, nil
+}
+
+// Refuse to write through a symlink created earlier in the same archive
+func ensureNoSymlinkParents(root, target string) error {
+	relative, err := filepath.Rel(root, filepath.Dir(target))
+	if err != nil || relative == "." {
+		return err
+	}
+	current := root
+	for _, part := range strings.Split(relative, string(os.PathSeparator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("path %s traverses the symlink %s", target, current)
+		}
+	}
+	return nil
+}
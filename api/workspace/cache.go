@@ -0,0 +1,162 @@
+package workspace
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Content-addressed store of git blobs shared by every checkout.
+// Blobs are kept at <dir>/<first two SHA chars>/<SHA>, and their
+// modification time records the last use for LRU eviction.
+type blobCache struct {
+	dir string
+
+	mu   sync.Mutex
+	size int64
+}
+
+func newBlobCache(dir string) (*blobCache, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create blob cache directory: %w", err)
+	}
+	cache := &blobCache{dir: dir}
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		cache.size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to scan blob cache: %w", err)
+	}
+	return cache, nil
+}
+
+func (c *blobCache) path(sha string) string {
+	if len(sha) < 2 {
+		return filepath.Join(c.dir, sha)
+	}
+	return filepath.Join(c.dir, sha[:2], sha)
+}
+
+func (c *blobCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *blobCache) Has(sha string) bool {
+	_, err := os.Stat(c.path(sha))
+	return err == nil
+}
+
+func (c *blobCache) Read(sha string) ([]byte, error) {
+	path := c.path(sha)
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return contents, nil
+}
+
+// Store a blob after checking its contents hash to the expected SHA
+func (c *blobCache) Write(sha string, contents []byte) error {
+	actual := gitBlobSHA(contents)
+	if actual != sha {
+		return fmt.Errorf("blob %s failed verification, contents hash to %s", sha, actual)
+	}
+	path := c.path(sha)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create blob cache directory: %w", err)
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+sha)
+	if err != nil {
+		return fmt.Errorf("unable to cache blob %s: %w", sha, err)
+	}
+	_, err = temp.Write(contents)
+	temp.Close()
+	if err != nil {
+		os.Remove(temp.Name())
+		return fmt.Errorf("unable to cache blob %s: %w", sha, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// a concurrent checkout may have cached the same blob meanwhile
+	if c.Has(sha) {
+		os.Remove(temp.Name())
+		return nil
+	}
+	err = os.Rename(temp.Name(), path)
+	if err != nil {
+		os.Remove(temp.Name())
+		return fmt.Errorf("unable to cache blob %s: %w", sha, err)
+	}
+	c.size += int64(len(contents))
+	return nil
+}
+
+type cachedBlob struct {
+	sha      string
+	path     string
+	size     int64
+	lastUsed time.Time
+}
+
+// Remove the least recently used blobs until at least the requested bytes
+// are freed, skipping the blobs in keep. Returns the bytes freed.
+func (c *blobCache) Evict(bytes int64, keep map[string]bool) int64 {
+	blobs := []cachedBlob{}
+	filepath.WalkDir(c.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || keep[entry.Name()] {
+			return nil
+		}
+		info, err := entry.Info()
+		if err == nil {
+			blobs = append(blobs, cachedBlob{sha: entry.Name(), path: path, size: info.Size(), lastUsed: info.ModTime()})
+		}
+		return nil
+	})
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].lastUsed.Before(blobs[j].lastUsed)
+	})
+
+	var freed int64
+	for _, blob := range blobs {
+		if freed >= bytes {
+			break
+		}
+		if os.Remove(blob.path) == nil {
+			freed += blob.size
+		}
+	}
+
+	c.mu.Lock()
+	c.size -= freed
+	c.mu.Unlock()
+	return freed
+}
+
+// SHA git assigns to a blob with the given contents
+func gitBlobSHA(contents []byte) string {
+	hash := sha1.New()
+	fmt.Fprintf(hash, "blob %d\x00", len(contents))
+	hash.Write(contents)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,321 @@
+// Package workspace materialises repositories at a given commit into per-run
+// directories that jobs can execute in.
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"api/clients/githubclient"
+	"api/logger"
+)
+
+var ErrQuotaExceeded = errors.New("workspace disk quota exceeded")
+
+// Source of repository contents; implemented by githubclient.GithubService
+type Source interface {
+	GetCommitTree(ctx context.Context, repoURL, commitSHA string) (*githubclient.CommitTree, error)
+	GetBlob(ctx context.Context, repoURL, blobSHA string) ([]byte, error)
+	DownloadArchive(ctx context.Context, repoURL, ref string) (io.ReadCloser, error)
+}
+
+type Config struct {
+	// Directory holding the run workspaces and the blob cache
+	RootDir string
+	// Maximum bytes used by workspaces and cached blobs together; 0 disables the quota
+	QuotaBytes int64
+}
+
+// A checked out copy of a repository, owned by a single run
+type Workspace struct {
+	RunID     string
+	Dir       string
+	CommitSHA string
+	Size      int64
+
+	manager *Manager
+}
+
+// Remove the workspace from disk and release its share of the quota
+func (w *Workspace) Cleanup() error {
+	return w.manager.release(w)
+}
+
+type Manager struct {
+	source  Source
+	runsDir string
+	cache   *blobCache
+	quota   int64
+
+	mu       sync.Mutex
+	active   map[string]*Workspace
+	reserved int64
+}
+
+/*
+Create a workspace manager.
+
+The root directory is expected to be owned by this manager alone: any run
+directory left behind by a previous process is removed on start.
+
+[IN] source: where repository trees and blobs are fetched from
+
+[IN] config: root directory and disk quota
+
+[OUT] *Manager: manager ready to check out workspaces
+*/
+func NewManager(source Source, config Config) (*Manager, error) {
+	runsDir := filepath.Join(config.RootDir, "runs")
+	err := os.RemoveAll(runsDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to remove stale workspaces: %w", err)
+	}
+	err = os.MkdirAll(runsDir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create workspaces directory: %w", err)
+	}
+	cache, err := newBlobCache(filepath.Join(config.RootDir, "blobs"))
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{
+		source:  source,
+		runsDir: runsDir,
+		cache:   cache,
+		quota:   config.QuotaBytes,
+		active:  map[string]*Workspace{},
+	}, nil
+}
+
+/*
+Materialise the repository at the given commit into a fresh directory for the run.
+
+Blobs are served from the content-addressed cache when possible. Trees too large
+for the GitHub trees API are fetched as a tarball instead.
+
+[IN] ctx: context
+
+[IN] runID: identifier of the run owning the workspace
+
+[IN] repoURL: repository to check out, e.g. "https://github.com/owner/repository-name"
+
+[IN] commitSHA: commit to check out
+
+[OUT] *Workspace: the checked out workspace, to be cleaned up once the run finishes
+*/
+func (m *Manager) Checkout(ctx context.Context, runID, repoURL, commitSHA string) (*Workspace, error) {
+	log := logger.FromContext(ctx)
+
+	m.mu.Lock()
+	if _, exists := m.active[runID]; exists {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("a workspace for run %s already exists", runID)
+	}
+	workspace := &Workspace{
+		RunID:     runID,
+		Dir:       filepath.Join(m.runsDir, runID),
+		CommitSHA: commitSHA,
+		manager:   m,
+	}
+	m.active[runID] = workspace
+	m.mu.Unlock()
+
+	err := os.Mkdir(workspace.Dir, 0755)
+	if err == nil {
+		err = m.populate(ctx, workspace, repoURL)
+	}
+	if err != nil {
+		m.release(workspace)
+		return nil, fmt.Errorf("unable to check out %s@%s: %w", repoURL, commitSHA, err)
+	}
+	log.Infof("Checked out %s@%s for run %s (%d bytes)", repoURL, commitSHA, runID, workspace.Size)
+	return workspace, nil
+}
+
+// Bytes currently used by workspaces and cached blobs
+func (m *Manager) Usage() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage()
+}
+
+func (m *Manager) usage() int64 {
+	used := m.cache.Size() + m.reserved
+	for _, workspace := range m.active {
+		used += workspace.Size
+	}
+	return used
+}
+
+func (m *Manager) populate(ctx context.Context, workspace *Workspace, repoURL string) error {
+	tree, err := m.source.GetCommitTree(ctx, repoURL, workspace.CommitSHA)
+	if err != nil {
+		return err
+	}
+	if tree.Truncated {
+		return m.populateFromArchive(ctx, workspace, repoURL)
+	}
+	return m.populateFromTree(ctx, workspace, repoURL, tree)
+}
+
+func (m *Manager) populateFromTree(ctx context.Context, workspace *Workspace, repoURL string, tree *githubclient.CommitTree) error {
+	log := logger.FromContext(ctx)
+
+	// every blob lands in the workspace, and the missing ones in the cache as well
+	needed := map[string]bool{}
+	var required int64
+	for _, entry := range tree.Entries {
+		if entry.Type != githubclient.EntryTypeFile && entry.Type != githubclient.EntryTypeSymlink {
+			continue
+		}
+		required += int64(entry.Size)
+		if !needed[entry.SHA] && !m.cache.Has(entry.SHA) {
+			required += int64(entry.Size)
+		}
+		needed[entry.SHA] = true
+	}
+	err := m.reserve(required, needed)
+	if err != nil {
+		return err
+	}
+	defer m.unreserve(required)
+
+	for _, entry := range tree.Entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		target, err := safeJoin(workspace.Dir, entry.Path)
+		if err != nil {
+			return err
+		}
+		switch entry.Type {
+		case githubclient.EntryTypeDir:
+			err = os.MkdirAll(target, 0755)
+		case githubclient.EntryTypeSubmodule:
+			log.Warnf("Submodule %s is not checked out", entry.Path)
+			err = os.MkdirAll(target, 0755)
+		case githubclient.EntryTypeSymlink:
+			var contents []byte
+			contents, err = m.getBlob(ctx, repoURL, entry.SHA)
+			if err == nil {
+				err = os.Symlink(string(contents), target)
+			}
+		default:
+			var contents []byte
+			contents, err = m.getBlob(ctx, repoURL, entry.SHA)
+			if err == nil {
+				err = writeFile(target, contents, entry.IsExecutable())
+				m.mu.Lock()
+				workspace.Size += int64(len(contents))
+				m.mu.Unlock()
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("unable to materialise %s: %w", entry.Path, err)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) populateFromArchive(ctx context.Context, workspace *Workspace, repoURL string) error {
+	log := logger.FromContext(ctx)
+	log.Infof("Tree of %s@%s is truncated, falling back to the tarball", repoURL, workspace.CommitSHA)
+
+	archive, err := m.source.DownloadArchive(ctx, repoURL, workspace.CommitSHA)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	// the size of the archive is only known once extracted
+	limit := m.reserveRemaining()
+	written, err := extractTarball(archive, workspace.Dir, limit)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	workspace.Size = written
+	if limit > 0 {
+		m.reserved -= limit
+	}
+	return err
+}
+
+func (m *Manager) getBlob(ctx context.Context, repoURL, sha string) ([]byte, error) {
+	contents, err := m.cache.Read(sha)
+	if err == nil {
+		return contents, nil
+	}
+	contents, err = m.source.GetBlob(ctx, repoURL, sha)
+	if err != nil {
+		return nil, err
+	}
+	err = m.cache.Write(sha, contents)
+	if err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+// Reserve space for a checkout, evicting cached blobs the checkout does not need
+func (m *Manager) reserve(required int64, keep map[string]bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.quota > 0 {
+		excess := m.usage() + required - m.quota
+		if excess > 0 {
+			m.cache.Evict(excess, keep)
+		}
+		if m.usage()+required > m.quota {
+			return fmt.Errorf("%w: %d bytes required, %d of %d in use", ErrQuotaExceeded, required, m.usage(), m.quota)
+		}
+	}
+	m.reserved += required
+	return nil
+}
+
+// Reserve whatever is left of the quota; negative when there is no quota
+func (m *Manager) reserveRemaining() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.quota <= 0 {
+		return -1
+	}
+	remaining := max(m.quota-m.usage(), 0)
+	m.reserved += remaining
+	return remaining
+}
+
+func (m *Manager) unreserve(required int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reserved -= required
+}
+
+func (m *Manager) release(workspace *Workspace) error {
+	m.mu.Lock()
+	delete(m.active, workspace.RunID)
+	m.mu.Unlock()
+
+	err := os.RemoveAll(workspace.Dir)
+	if err != nil {
+		return fmt.Errorf("unable to remove workspace of run %s: %w", workspace.RunID, err)
+	}
+	return nil
+}
+
+func writeFile(path string, contents []byte, executable bool) error {
+	mode := os.FileMode(0644)
+	if executable {
+		mode = 0755
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, contents, mode)
+}
@@ -0,0 +1,352 @@
+package workspace
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"api/clients/githubclient"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	repoURL   = "https://github.com/some-user/my-project"
+	commitSHA = "0108e3c4f3100134a42fa333d103464498669ea5" // pragma: allowlist secret
+)
+
+type fakeSource struct {
+	tree      *githubclient.CommitTree
+	blobs     map[string][]byte
+	archive   []byte
+	blobCalls int
+	// called when the extraction starts reading the archive
+	onArchiveRead func()
+}
+
+type hookedReader struct {
+	io.Reader
+	hook func()
+}
+
+func (r *hookedReader) Read(p []byte) (int, error) {
+	if r.hook != nil {
+		r.hook()
+		r.hook = nil
+	}
+	return r.Reader.Read(p)
+}
+
+func (s *fakeSource) GetCommitTree(ctx context.Context, repoURL, sha string) (*githubclient.CommitTree, error) {
+	return s.tree, nil
+}
+
+func (s *fakeSource) GetBlob(ctx context.Context, repoURL, sha string) ([]byte, error) {
+	s.blobCalls++
+	contents, ok := s.blobs[sha]
+	if !ok {
+		return nil, fmt.Errorf("blob %s not found", sha)
+	}
+	return contents, nil
+}
+
+func (s *fakeSource) DownloadArchive(ctx context.Context, repoURL, ref string) (io.ReadCloser, error) {
+	return io.NopCloser(&hookedReader{Reader: bytes.NewReader(s.archive), hook: s.onArchiveRead}), nil
+}
+
+func newFakeSource(files map[string]string) *fakeSource {
+	source := &fakeSource{
+		tree:  &githubclient.CommitTree{CommitSHA: commitSHA},
+		blobs: map[string][]byte{},
+	}
+	source.tree.Entries = append(source.tree.Entries, githubclient.TreeEntry{Path: "scripts", Mode: "040000", Type: githubclient.EntryTypeDir})
+	for _, path := range []string{"README.md", "scripts/build.sh", "scripts/latest"} {
+		contents, ok := files[path]
+		if !ok {
+			continue
+		}
+		sha := gitBlobSHA([]byte(contents))
+		source.blobs[sha] = []byte(contents)
+		entry := githubclient.TreeEntry{Path: path, Mode: "100644", Type: githubclient.EntryTypeFile, Size: len(contents), SHA: sha}
+		if path == "scripts/build.sh" {
+			entry.Mode = "100755"
+		}
+		if path == "scripts/latest" {
+			entry.Mode = "120000"
+			entry.Type = githubclient.EntryTypeSymlink
+		}
+		source.tree.Entries = append(source.tree.Entries, entry)
+	}
+	return source
+}
+
+var sampleFiles = map[string]string{
+	"README.md":        "# my-project\n",
+	"scripts/build.sh": "#!/bin/sh\ngo build ./...\n",
+	"scripts/latest":   "build.sh",
+}
+
+func TestCheckoutFromTree(t *testing.T) {
+	source := newFakeSource(sampleFiles)
+	manager, err := NewManager(source, Config{RootDir: t.TempDir()})
+	require.NoError(t, err)
+
+	workspace, err := manager.Checkout(context.Background(), "run-1", repoURL, commitSHA)
+	require.NoError(t, err)
+
+	readme, err := os.ReadFile(filepath.Join(workspace.Dir, "README.md"))
+	assert.NoError(t, err)
+	assert.Equal(t, "# my-project\n", string(readme))
+
+	info, err := os.Stat(filepath.Join(workspace.Dir, "scripts", "build.sh"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	target, err := os.Readlink(filepath.Join(workspace.Dir, "scripts", "latest"))
+	assert.NoError(t, err)
+	assert.Equal(t, "build.sh", target)
+
+	assert.Equal(t, int64(len(sampleFiles["README.md"])+len(sampleFiles["scripts/build.sh"])), workspace.Size)
+}
+
+func TestCheckoutReusesCachedBlobs(t *testing.T) {
+	source := newFakeSource(sampleFiles)
+	manager, err := NewManager(source, Config{RootDir: t.TempDir()})
+	require.NoError(t, err)
+
+	first, err := manager.Checkout(context.Background(), "run-1", repoURL, commitSHA)
+	require.NoError(t, err)
+	assert.Equal(t, 3, source.blobCalls)
+	require.NoError(t, first.Cleanup())
+
+	second, err := manager.Checkout(context.Background(), "run-2", repoURL, commitSHA)
+	require.NoError(t, err)
+	assert.Equal(t, 3, source.blobCalls)
+	assert.FileExists(t, filepath.Join(second.Dir, "README.md"))
+}
+
+func TestCheckoutCacheSurvivesRestart(t *testing.T) {
+	root := t.TempDir()
+	source := newFakeSource(sampleFiles)
+	manager, err := NewManager(source, Config{RootDir: root})
+	require.NoError(t, err)
+	_, err = manager.Checkout(context.Background(), "run-1", repoURL, commitSHA)
+	require.NoError(t, err)
+
+	restarted, err := NewManager(source, Config{RootDir: root})
+	require.NoError(t, err)
+	assert.NoDirExists(t, filepath.Join(root, "runs", "run-1"))
+
+	_, err = restarted.Checkout(context.Background(), "run-1", repoURL, commitSHA)
+	require.NoError(t, err)
+	assert.Equal(t, 3, source.blobCalls)
+}
+
+func TestCheckoutRejectsCorruptBlob(t *testing.T) {
+	source := newFakeSource(sampleFiles)
+	for sha := range source.blobs {
+		source.blobs[sha] = []byte("tampered")
+	}
+	manager, err := NewManager(source, Config{RootDir: t.TempDir()})
+	require.NoError(t, err)
+
+	_, err = manager.Checkout(context.Background(), "run-1", repoURL, commitSHA)
+	assert.ErrorContains(t, err, "failed verification")
+	assert.NoDirExists(t, filepath.Join(manager.runsDir, "run-1"))
+}
+
+func TestCheckoutDuplicateRun(t *testing.T) {
+	manager, err := NewManager(newFakeSource(sampleFiles), Config{RootDir: t.TempDir()})
+	require.NoError(t, err)
+
+	_, err = manager.Checkout(context.Background(), "run-1", repoURL, commitSHA)
+	require.NoError(t, err)
+	_, err = manager.Checkout(context.Background(), "run-1", repoURL, commitSHA)
+	assert.ErrorContains(t, err, "already exists")
+}
+
+func TestCheckoutQuota(t *testing.T) {
+	source := newFakeSource(sampleFiles)
+	// the first checkout needs every blob twice: once cached, once in the workspace
+	manager, err := NewManager(source, Config{RootDir: t.TempDir(), QuotaBytes: 100})
+	require.NoError(t, err)
+
+	first, err := manager.Checkout(context.Background(), "run-1", repoURL, commitSHA)
+	require.NoError(t, err)
+
+	_, err = manager.Checkout(context.Background(), "run-2", repoURL, commitSHA)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.NoDirExists(t, filepath.Join(manager.runsDir, "run-2"))
+
+	require.NoError(t, first.Cleanup())
+	_, err = manager.Checkout(context.Background(), "run-2", repoURL, commitSHA)
+	assert.NoError(t, err)
+}
+
+func TestCheckoutQuotaEvictsUnusedBlobs(t *testing.T) {
+	manager, err := NewManager(newFakeSource(sampleFiles), Config{RootDir: t.TempDir(), QuotaBytes: 100})
+	require.NoError(t, err)
+	first, err := manager.Checkout(context.Background(), "run-1", repoURL, commitSHA)
+	require.NoError(t, err)
+	require.NoError(t, first.Cleanup())
+
+	// a different commit whose blobs do not fit next to the old cached ones
+	manager.source = newFakeSource(map[string]string{
+		"README.md": "# my-project, rewritten from scratch\n",
+	})
+	_, err = manager.Checkout(context.Background(), "run-2", repoURL, commitSHA)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, manager.Usage(), int64(100))
+}
+
+func TestCleanupRemovesWorkspace(t *testing.T) {
+	manager, err := NewManager(newFakeSource(sampleFiles), Config{RootDir: t.TempDir()})
+	require.NoError(t, err)
+
+	workspace, err := manager.Checkout(context.Background(), "run-1", repoURL, commitSHA)
+	require.NoError(t, err)
+	cachedSize := manager.cache.Size()
+
+	require.NoError(t, workspace.Cleanup())
+	assert.NoDirExists(t, workspace.Dir)
+	assert.Equal(t, cachedSize, manager.Usage())
+}
+
+func newTarball(t *testing.T, entries []tar.Header, contents map[string]string) []byte {
+	buf := bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, header := range entries {
+		header := header
+		body := contents[header.Name]
+		header.Size = int64(len(body))
+		require.NoError(t, tarWriter.WriteHeader(&header))
+		_, err := tarWriter.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+	return buf.Bytes()
+}
+
+func TestCheckoutFromArchiveWhenTreeTruncated(t *testing.T) {
+	source := newFakeSource(sampleFiles)
+	source.tree.Truncated = true
+	source.archive = newTarball(t, []tar.Header{
+		{Name: "pax_global_header", Typeflag: tar.TypeXGlobalHeader, PAXRecords: map[string]string{"comment": commitSHA}},
+		{Name: "some-user-my-project-0108e3c/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "some-user-my-project-0108e3c/README.md", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "some-user-my-project-0108e3c/scripts/build.sh", Typeflag: tar.TypeReg, Mode: 0755},
+	}, map[string]string{
+		"some-user-my-project-0108e3c/README.md":        sampleFiles["README.md"],
+		"some-user-my-project-0108e3c/scripts/build.sh": sampleFiles["scripts/build.sh"],
+	})
+	manager, err := NewManager(source, Config{RootDir: t.TempDir()})
+	require.NoError(t, err)
+
+	workspace, err := manager.Checkout(context.Background(), "run-1", repoURL, commitSHA)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, source.blobCalls)
+	readme, err := os.ReadFile(filepath.Join(workspace.Dir, "README.md"))
+	assert.NoError(t, err)
+	assert.Equal(t, sampleFiles["README.md"], string(readme))
+	info, err := os.Stat(filepath.Join(workspace.Dir, "scripts", "build.sh"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+}
+
+func newArchiveSource(t *testing.T) *fakeSource {
+	source := newFakeSource(sampleFiles)
+	source.tree.Truncated = true
+	source.archive = newTarball(t, []tar.Header{
+		{Name: "some-user-my-project-0108e3c/README.md", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "some-user-my-project-0108e3c/scripts/build.sh", Typeflag: tar.TypeReg, Mode: 0755},
+	}, map[string]string{
+		"some-user-my-project-0108e3c/README.md":        sampleFiles["README.md"],
+		"some-user-my-project-0108e3c/scripts/build.sh": sampleFiles["scripts/build.sh"],
+	})
+	return source
+}
+
+func TestCheckoutFromArchiveReservesTheQuota(t *testing.T) {
+	source := newArchiveSource(t)
+	manager, err := NewManager(source, Config{RootDir: t.TempDir(), QuotaBytes: 1000})
+	require.NoError(t, err)
+	source.onArchiveRead = func() {
+		assert.Equal(t, int64(1000), manager.Usage(), "the rest of the quota is reserved while extracting")
+		assert.ErrorIs(t, manager.reserve(1, nil), ErrQuotaExceeded)
+	}
+
+	workspace, err := manager.Checkout(context.Background(), "run-1", repoURL, commitSHA)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(sampleFiles["README.md"])+len(sampleFiles["scripts/build.sh"])), workspace.Size)
+	assert.Equal(t, workspace.Size, manager.Usage())
+}
+
+func TestCheckoutFromArchiveReleasesTheQuotaOnFailure(t *testing.T) {
+	manager, err := NewManager(newArchiveSource(t), Config{RootDir: t.TempDir(), QuotaBytes: 20})
+	require.NoError(t, err)
+
+	_, err = manager.Checkout(context.Background(), "run-1", repoURL, commitSHA)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.Equal(t, int64(0), manager.Usage())
+}
+
+func TestBlobCacheCountsEachBlobOnce(t *testing.T) {
+	cache, err := newBlobCache(t.TempDir())
+	require.NoError(t, err)
+	contents := []byte(sampleFiles["README.md"])
+	sha := gitBlobSHA(contents)
+
+	require.NoError(t, cache.Write(sha, contents))
+	require.NoError(t, cache.Write(sha, contents))
+	assert.Equal(t, int64(len(contents)), cache.Size())
+}
+
+func TestExtractTarballRejectsEscapes(t *testing.T) {
+	examples := []struct {
+		description string
+		entries     []tar.Header
+	}{
+		{
+			description: "parent directory traversal",
+			entries: []tar.Header{
+				{Name: "root/../../evil.sh", Typeflag: tar.TypeReg, Mode: 0644},
+			},
+		},
+		{
+			description: "write through a symlink",
+			entries: []tar.Header{
+				{Name: "root/link", Typeflag: tar.TypeSymlink, Linkname: "/tmp"},
+				{Name: "root/link/evil.sh", Typeflag: tar.TypeReg, Mode: 0644},
+			},
+		},
+	}
+
+	for _, example := range examples {
+		t.Run(example.description, func(t *testing.T) {
+			dest := t.TempDir()
+			archive := newTarball(t, example.entries, map[string]string{})
+
+			_, err := extractTarball(bytes.NewReader(archive), dest, -1)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestExtractTarballLimit(t *testing.T) {
+	archive := newTarball(t, []tar.Header{
+		{Name: "root/big.bin", Typeflag: tar.TypeReg, Mode: 0644},
+	}, map[string]string{"root/big.bin": "0123456789"})
+
+	_, err := extractTarball(bytes.NewReader(archive), t.TempDir(), 5)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+}